@@ -0,0 +1,141 @@
+package dbtools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IndexSuggestion is a sequential scan that might benefit from an index.
+type IndexSuggestion struct {
+	SQL    string
+	Caller string
+	Table  string
+	// Filter is the condition the rows are filtered with during the scan.
+	Filter string
+	// Columns are the columns in the filter, when they can be detected.
+	Columns []string
+	// Rows is the estimated number of rows of the table.
+	Rows float64
+}
+
+// DDL returns a CREATE INDEX statement for the suggestion. It returns an
+// empty string if the columns can't be detected.
+func (s IndexSuggestion) DDL() string {
+	if len(s.Columns) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("CREATE INDEX ON %s (%s)", s.Table, strings.Join(s.Columns, ", "))
+}
+
+// SuggestIndexes explains the statements with generic plans and returns a
+// suggestion for each sequential scan with a filter on a table that has at
+// least minRows rows according to the statistics. The statements are not
+// executed. It is meant to be run against a development database with
+// realistic statistics, using the statements recorded with the CaptureSQL
+// option. The generic plans require PostgreSQL 16 or newer.
+//
+// Only the SELECT, UPDATE and DELETE statements are explained. If a statement
+// can't be explained, it is skipped.
+func SuggestIndexes(ctx context.Context, q Querier, stmts []CapturedStatement, minRows float64) ([]IndexSuggestion, error) {
+	var ret []IndexSuggestion
+	for _, s := range stmts {
+		if !explainable(s.SQL) {
+			continue
+		}
+		var raw []byte
+		err := q.QueryRow(ctx, "EXPLAIN (FORMAT JSON, GENERIC_PLAN) "+s.SQL).Scan(&raw)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		var plans []struct {
+			Plan planNode `json:"Plan"`
+		}
+		if err := json.Unmarshal(raw, &plans); err != nil {
+			return nil, fmt.Errorf("decoding the plan of %q: %w", s.SQL, err)
+		}
+		for _, plan := range plans {
+			for _, node := range plan.Plan.seqScans() {
+				if node.Filter == "" {
+					continue
+				}
+				var rows float64
+				const query = `SELECT reltuples::float8 FROM pg_class WHERE oid = $1::regclass`
+				err := q.QueryRow(ctx, query, node.Relation).Scan(&rows)
+				if err != nil {
+					return nil, fmt.Errorf("reading the size of %q: %w", node.Relation, err)
+				}
+				if rows < minRows {
+					continue
+				}
+				ret = append(ret, IndexSuggestion{
+					SQL:     s.SQL,
+					Caller:  s.Caller,
+					Table:   node.Relation,
+					Filter:  node.Filter,
+					Columns: filterColumns(node.Filter),
+					Rows:    rows,
+				})
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+type planNode struct {
+	NodeType string     `json:"Node Type"`
+	Relation string     `json:"Relation Name"`
+	Filter   string     `json:"Filter"`
+	Plans    []planNode `json:"Plans"`
+}
+
+func (n planNode) seqScans() []planNode {
+	var ret []planNode
+	if n.NodeType == "Seq Scan" {
+		ret = append(ret, n)
+	}
+	for _, child := range n.Plans {
+		ret = append(ret, child.seqScans()...)
+	}
+
+	return ret
+}
+
+func explainable(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "UPDATE", "DELETE", "WITH":
+		return true
+	}
+
+	return false
+}
+
+// filterColumn matches the column on the left side of a comparison in a plan
+// filter, for example "(email = $1)" or "((status)::text = 'active'::text)".
+var filterColumn = regexp.MustCompile(`\(+([a-z_][a-z0-9_]*)\)?(?:::[a-z ]+)?\s*(?:=|<>|<=|>=|<|>|~~|IS\b)`)
+
+// filterColumns returns the distinct columns of the filter in order.
+func filterColumns(filter string) []string {
+	var ret []string
+	seen := make(map[string]struct{})
+	for _, m := range filterColumn.FindAllStringSubmatch(filter, -1) {
+		if _, ok := seen[m[1]]; ok {
+			continue
+		}
+		seen[m[1]] = struct{}{}
+		ret = append(ret, m[1])
+	}
+
+	return ret
+}
@@ -0,0 +1,81 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const seqScanPlan = `[{"Plan": {
+	"Node Type": "Limit",
+	"Plans": [{
+		"Node Type": "Seq Scan",
+		"Relation Name": "users",
+		"Filter": "((email = $1) AND ((status)::text = 'active'::text))"
+	}]
+}}]`
+
+const indexScanPlan = `[{"Plan": {
+	"Node Type": "Index Scan",
+	"Relation Name": "users",
+	"Index Name": "users_pkey"
+}}]`
+
+func TestSuggestIndexes(t *testing.T) {
+	t.Parallel()
+	t.Run("Suggestions", testSuggestIndexesSuggestions)
+	t.Run("SmallTable", testSuggestIndexesSmallTable)
+	t.Run("Skipped", testSuggestIndexesSkipped)
+}
+
+func testSuggestIndexesSuggestions(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^EXPLAIN .* WHERE email`).Return([]string{"QUERY PLAN"}, []any{[]byte(seqScanPlan)})
+	sim.On(`^EXPLAIN .* WHERE id`).Return([]string{"QUERY PLAN"}, []any{[]byte(indexScanPlan)})
+	sim.On(`pg_class`).Return([]string{"reltuples"}, []any{float64(50000)})
+
+	stmts := []dbtools.CapturedStatement{
+		{SQL: "SELECT id FROM users WHERE email = $1 AND status = 'active' LIMIT 1", Caller: "users.go:10"},
+		{SQL: "SELECT email FROM users WHERE id = $1", Caller: "users.go:20"},
+	}
+	got, err := dbtools.SuggestIndexes(context.Background(), sim, stmts, 1000)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "users", got[0].Table)
+	assert.Equal(t, "users.go:10", got[0].Caller)
+	assert.Equal(t, []string{"email", "status"}, got[0].Columns)
+	assert.InDelta(t, 50000, got[0].Rows, 0.1)
+	assert.Equal(t, "CREATE INDEX ON users (email, status)", got[0].DDL())
+}
+
+func testSuggestIndexesSmallTable(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^EXPLAIN`).Return([]string{"QUERY PLAN"}, []any{[]byte(seqScanPlan)})
+	sim.On(`pg_class`).Return([]string{"reltuples"}, []any{float64(10)})
+
+	stmts := []dbtools.CapturedStatement{{SQL: "SELECT id FROM users WHERE email = $1"}}
+	got, err := dbtools.SuggestIndexes(context.Background(), sim, stmts, 1000)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func testSuggestIndexesSkipped(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^EXPLAIN`).Error(assert.AnError)
+
+	stmts := []dbtools.CapturedStatement{
+		{SQL: "INSERT INTO users (email) VALUES ($1)"},
+		{SQL: "SELECT broken"},
+	}
+	got, err := dbtools.SuggestIndexes(context.Background(), sim, stmts, 0)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	assert.Equal(t, []string{"EXPLAIN (FORMAT JSON, GENERIC_PLAN) SELECT broken"}, sim.SQL())
+}
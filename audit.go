@@ -0,0 +1,78 @@
+package dbtools
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// UnboundedRead is a SELECT statement on a large table that has neither a
+// WHERE nor a LIMIT clause.
+type UnboundedRead struct {
+	SQL    string
+	Table  string
+	Caller string
+}
+
+// unboundedAudit reports the unbounded reads on the tables.
+type unboundedAudit struct {
+	tables map[string]struct{}
+	report func(UnboundedRead)
+}
+
+var (
+	sourceTableRe = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+((?:"?[\w$]+"?\.)?"?[\w$]+"?)`)
+	boundRe       = regexp.MustCompile(`(?i)\b(?:WHERE|LIMIT|FETCH\s+(?:FIRST|NEXT))\b`)
+)
+
+// check reports the sql if it reads any of the tables without a WHERE or a
+// LIMIT clause. The check is lexical, therefore a WHERE clause in a sub-query
+// counts as a bound.
+func (a *unboundedAudit) check(sql string) {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH":
+	default:
+		return
+	}
+	if boundRe.MatchString(sql) {
+		return
+	}
+	for _, m := range sourceTableRe.FindAllStringSubmatch(sql, -1) {
+		name := strings.ToLower(strings.ReplaceAll(m[1], `"`, ""))
+		_, full := a.tables[name]
+		_, bare := a.tables[name[strings.LastIndex(name, ".")+1:]]
+		if full || bare {
+			a.report(UnboundedRead{SQL: sql, Table: name, Caller: caller()})
+			return
+		}
+	}
+}
+
+// hook returns a statement hook that checks the statements of the
+// transactions.
+func (a *unboundedAudit) hook() stmtHook {
+	return stmtHook{
+		before: func(_ context.Context, s *statement) error {
+			if len(s.Queries) > 0 {
+				for _, q := range s.Queries {
+					a.check(q)
+				}
+				return nil
+			}
+			a.check(s.SQL)
+
+			return nil
+		},
+	}
+}
+
+// audit checks the sql of the query helpers if the audit is enabled.
+func (p *PGX) audit(sql string) {
+	if p.unbounded != nil {
+		p.unbounded.check(sql)
+	}
+}
@@ -0,0 +1,117 @@
+package dbtools_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type readRecorder struct {
+	mu    sync.Mutex
+	reads []dbtools.UnboundedRead
+}
+
+func (r *readRecorder) report(read dbtools.UnboundedRead) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads = append(r.reads, read)
+}
+
+func TestAuditUnboundedReads(t *testing.T) {
+	t.Parallel()
+	t.Run("Statements", testAuditUnboundedReadsStatements)
+	t.Run("Transaction", testAuditUnboundedReadsTransaction)
+	t.Run("Batch", testAuditUnboundedReadsBatch)
+}
+
+func testAuditUnboundedReadsStatements(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		sql   string
+		table string
+	}{
+		"no where":      {"SELECT * FROM events", "events"},
+		"qualified":     {`SELECT id FROM public."Events" ORDER BY id`, "public.events"},
+		"schema config": {"SELECT id FROM audit.log", "audit.log"},
+		"join":          {"SELECT u.id FROM users u JOIN events e ON e.user_id = u.id", "events"},
+		"cte":           {"WITH e AS (SELECT * FROM events) SELECT count(*) FROM e", "events"},
+		"where":         {"SELECT * FROM events WHERE id = $1", ""},
+		"limit":         {"SELECT * FROM events ORDER BY id DESC LIMIT 10", ""},
+		"fetch":         {"SELECT * FROM events FETCH FIRST 10 ROWS ONLY", ""},
+		"other table":   {"SELECT * FROM users", ""},
+		"other schema":  {"SELECT * FROM other.log", ""},
+		"insert":        {"INSERT INTO events SELECT * FROM events", ""},
+		"prefix":        {"SELECT * FROM events_archive", ""},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sim := dbtesting.NewSimulator()
+			sim.On(`.`).Exec("SELECT 0")
+			rec := &readRecorder{}
+			tr, err := dbtools.New(sim,
+				dbtools.AuditUnboundedReads(rec.report, "events", "Audit.Log"),
+			)
+			require.NoError(t, err)
+
+			_, err = tr.Exec(context.Background(), tc.sql)
+			require.NoError(t, err)
+			if tc.table == "" {
+				assert.Empty(t, rec.reads)
+				return
+			}
+			require.Len(t, rec.reads, 1)
+			assert.Equal(t, tc.table, rec.reads[0].Table)
+			assert.Equal(t, tc.sql, rec.reads[0].SQL)
+			assert.Contains(t, rec.reads[0].Caller, "audit_test.go")
+		})
+	}
+}
+
+func testAuditUnboundedReadsTransaction(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT`).Return([]string{"id"}, []any{1})
+	rec := &readRecorder{}
+	tr, err := dbtools.New(sim, dbtools.AuditUnboundedReads(rec.report, "events"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT id FROM events")
+		if err != nil {
+			return err
+		}
+		rows.Close()
+		var id int
+		return tx.QueryRow(ctx, "SELECT id FROM events WHERE id = 1").Scan(&id)
+	})
+	require.NoError(t, err)
+	require.Len(t, rec.reads, 1)
+	assert.Equal(t, "SELECT id FROM events", rec.reads[0].SQL)
+	assert.Contains(t, rec.reads[0].Caller, "audit_test.go")
+}
+
+func testAuditUnboundedReadsBatch(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT`).Exec("SELECT 1")
+	rec := &readRecorder{}
+	tr, err := dbtools.New(sim, dbtools.AuditUnboundedReads(rec.report, "events"))
+	require.NoError(t, err)
+
+	err = tr.Batch(context.Background(), func(b *pgx.Batch) error {
+		b.Queue("SELECT 1 FROM events LIMIT 1")
+		b.Queue("SELECT 1 FROM events")
+		return nil
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, rec.reads, 1)
+	assert.Equal(t, "SELECT 1 FROM events", rec.reads[0].SQL)
+}
@@ -0,0 +1,58 @@
+package dbtools
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/arsham/retry/v3"
+)
+
+// conflictBackoff is the delay policy for the deadlocks and the
+// serialization failures.
+type conflictBackoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+// delay returns a random delay between zero and the exponential delay of the
+// attempt, capped at the max.
+func (b conflictBackoff) delay(attempt int) time.Duration {
+	ceiling := b.base
+	for i := 1; i < attempt && ceiling < b.max; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, b.max)
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int64N(int64(ceiling))) //nolint:gosec // the jitter doesn't need a secure random.
+}
+
+// retryLoop returns the retry strategy of a transaction of the kind called
+// with the ctx, and a function that records the error of each attempt. When
+// the DeadlockBackoff option is set, the delay after a deadlock or a
+// serialization failure is taken from the conflict backoff instead of the
+// retry strategy.
+func (p *PGX) retryLoop(ctx context.Context, kind OpKind) (retry.Retry, func(error)) {
+	loop := p.callPolicy(ctx, kind)
+	if p.conflicts == nil {
+		return p.paced(loop), func(error) {}
+	}
+
+	var last error
+	method := loop.Method
+	if method == nil {
+		method = retry.StandardDelay
+	}
+	backoff := *p.conflicts
+	loop.Method = func(attempt int, delay time.Duration) time.Duration {
+		if IsDeadlock(last) || IsSerializationFailure(last) {
+			return backoff.delay(attempt)
+		}
+		return method(attempt, delay)
+	}
+
+	return p.paced(loop), func(err error) { last = err }
+}
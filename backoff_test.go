@@ -0,0 +1,90 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadlockBackoff(t *testing.T) {
+	t.Parallel()
+	t.Run("Conflicts", testDeadlockBackoffConflicts)
+	t.Run("OtherErrors", testDeadlockBackoffOtherErrors)
+	t.Run("Mixed", testDeadlockBackoffMixed)
+}
+
+// failingTx returns a function that fails the transaction with the errs in
+// order, and succeeds after them.
+func failingTx(errs ...error) func(pgx.Tx) error {
+	calls := 0
+	return func(pgx.Tx) error {
+		calls++
+		if calls <= len(errs) {
+			return errs[calls-1]
+		}
+		return nil
+	}
+}
+
+func testDeadlockBackoffConflicts(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(5, time.Hour),
+		dbtools.DeadlockBackoff(time.Millisecond, 5*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	deadlock := &pgconn.PgError{Code: "40P01"}
+	serialization := &pgconn.PgError{Code: "40001"}
+	start := time.Now()
+	err = tr.Transaction(context.Background(), failingTx(deadlock, serialization, deadlock, serialization))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second,
+		"the conflicts should not be delayed with the retry strategy")
+}
+
+func testDeadlockBackoffOtherErrors(t *testing.T) {
+	t.Parallel()
+	delay := 20 * time.Millisecond
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(3, delay),
+		dbtools.DeadlockBackoff(time.Hour, time.Hour),
+	)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = tr.Transaction(context.Background(), failingTx(assert.AnError, assert.AnError))
+	require.NoError(t, err)
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, delay)
+	assert.Less(t, elapsed, time.Minute)
+}
+
+func testDeadlockBackoffMixed(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.DeadlockBackoff(time.Hour, time.Hour),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	deadlock := &pgconn.PgError{Code: "40P01"}
+	done := make(chan error, 1)
+	go func() {
+		done <- tr.Transaction(ctx, failingTx(assert.AnError, deadlock))
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("didn't expect the transaction to finish before the backoff: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,40 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Batch sends a batch of queries inside a transaction and retries the whole
+// transaction with the same semantics as the Transaction method. On every
+// attempt a new pgx.Batch is created and passed to the build function to queue
+// the queries, and the results are passed to the handle function. The handle
+// function can be nil if you are not interested in the results, in which case
+// only the errors of the queries are checked.
+//
+// The BatchResults are always closed before the transaction is committed or
+// rolled back, therefore the handle function must not close it or hold on to
+// it.
+func (p *PGX) Batch(ctx context.Context, build func(*pgx.Batch) error, handle func(pgx.BatchResults) error) error {
+	return p.Transaction(ctx, func(tx pgx.Tx) (err error) {
+		batch := &pgx.Batch{}
+		if err := build(batch); err != nil {
+			return fmt.Errorf("building batch: %w", err)
+		}
+
+		results := tx.SendBatch(ctx, batch)
+		defer func() {
+			if er := results.Close(); er != nil {
+				err = errors.Join(err, fmt.Errorf("closing batch results: %w", er))
+			}
+		}()
+		if handle == nil {
+			return nil
+		}
+
+		return handle(results)
+	})
+}
@@ -0,0 +1,158 @@
+package dbtools_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXBatch(t *testing.T) {
+	t.Parallel()
+	t.Run("BuildError", testPGXBatchBuildError)
+	t.Run("Success", testPGXBatchSuccess)
+	t.Run("HandleError", testPGXBatchHandleError)
+	t.Run("CloseError", testPGXBatchCloseError)
+	t.Run("StopError", testPGXBatchStopError)
+}
+
+func testPGXBatchBuildError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	total := 3
+	tr, err := dbtools.New(db, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	err = tr.Batch(ctx, func(*pgx.Batch) error {
+		return assert.AnError
+	}, func(pgx.BatchResults) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testPGXBatchSuccess(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	results := mocks.NewBatchResults(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("SendBatch", mock.Anything, mock.MatchedBy(func(b *pgx.Batch) bool {
+		return b.Len() == 2
+	})).Return(results).Once()
+	results.On("Exec").Return(pgconn.NewCommandTag("INSERT 0 1"), nil).Twice()
+	results.On("Close").Return(nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = tr.Batch(ctx, func(b *pgx.Batch) error {
+		b.Queue("INSERT INTO foo (bar) VALUES ($1)", 1)
+		b.Queue("INSERT INTO foo (bar) VALUES ($1)", 2)
+		return nil
+	}, func(br pgx.BatchResults) error {
+		for range 2 {
+			if _, err := br.Exec(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func testPGXBatchHandleError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	total := 3
+	tr, err := dbtools.New(db, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	results := mocks.NewBatchResults(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("SendBatch", mock.Anything, mock.Anything).Return(results).Times(total)
+	results.On("Close").Return(nil).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	calls := 0
+	err = tr.Batch(ctx, func(b *pgx.Batch) error {
+		// Makes sure a fresh batch is given on each attempt.
+		assert.Zero(t, b.Len())
+		b.Queue("SELECT 1")
+		return nil
+	}, func(pgx.BatchResults) error {
+		calls++
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, total, calls)
+}
+
+func testPGXBatchCloseError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	closeErr := errors.New(randomString(10))
+	tx := mocks.NewPGXTx(t)
+	results := mocks.NewBatchResults(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("SendBatch", mock.Anything, mock.Anything).Return(results).Once()
+	results.On("Close").Return(closeErr).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	err = tr.Batch(ctx, func(b *pgx.Batch) error {
+		b.Queue("SELECT 1")
+		return nil
+	}, nil)
+	assert.ErrorIs(t, err, closeErr)
+}
+
+func testPGXBatchStopError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	results := mocks.NewBatchResults(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("SendBatch", mock.Anything, mock.Anything).Return(results).Once()
+	results.On("Close").Return(nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	err = tr.Batch(ctx, func(b *pgx.Batch) error {
+		b.Queue("SELECT 1")
+		return nil
+	}, func(pgx.BatchResults) error {
+		return &retry.StopError{Err: assert.AnError}
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+}
@@ -0,0 +1,135 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	contextType = reflect.TypeFor[context.Context]()
+	txType      = reflect.TypeFor[pgx.Tx]()
+	errorType   = reflect.TypeFor[error]()
+)
+
+// Bind sets each exported function field of the struct that the dst points to
+// to a function that calls the method of the impl with the same name in a
+// transaction run by the tr. This removes the boilerplate of starting the
+// transactions in the repository layers:
+//
+//	type UserStore struct {
+//		Create func(ctx context.Context, u User) (int64, error)
+//		Rename func(ctx context.Context, id int64, name string) error
+//	}
+//
+//	type userQueries struct{}
+//
+//	func (userQueries) Create(ctx context.Context, tx pgx.Tx, u User) (int64, error)
+//	func (userQueries) Rename(ctx context.Context, tx pgx.Tx, id int64, name string) error
+//
+//	var store UserStore
+//	err := dbtools.Bind(tr, &store, userQueries{})
+//
+// The methods receive the transaction after the context, and should otherwise
+// have the same signature as the fields. The last result should be an error,
+// which decides whether the transaction is committed or retried. The results
+// of the successful attempt are returned. If the transaction fails, the zero
+// values and the error are returned.
+//
+// It returns an ErrInvalidBinding error if the dst is not a pointer to a
+// struct, or a method is missing or has a different signature.
+func Bind(tr Transactioner, dst, impl any) error {
+	if tr == nil {
+		return ErrEmptyDatabase
+	}
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Pointer || dv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T is not a pointer to a struct", ErrInvalidBinding, dst)
+	}
+	dv = dv.Elem()
+	iv := reflect.ValueOf(impl)
+
+	for i := range dv.NumField() {
+		field := dv.Type().Field(i)
+		if !field.IsExported() || field.Type.Kind() != reflect.Func {
+			continue
+		}
+		method := iv.MethodByName(field.Name)
+		if !method.IsValid() {
+			return fmt.Errorf("%w: %T has no %s method", ErrInvalidBinding, impl, field.Name)
+		}
+		if err := checkBinding(field.Type, method.Type()); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidBinding, field.Name, err)
+		}
+		dv.Field(i).Set(bindMethod(tr, field.Type, method))
+	}
+
+	return nil
+}
+
+// checkBinding returns an error if the method doesn't receive a pgx.Tx after
+// the context of the field's arguments, or returns different results.
+func checkBinding(field, method reflect.Type) error {
+	if field.NumIn() == 0 || field.In(0) != contextType {
+		return fmt.Errorf("first argument should be a context.Context")
+	}
+	if field.NumOut() == 0 || field.Out(field.NumOut()-1) != errorType {
+		return fmt.Errorf("last result should be an error")
+	}
+	want := []reflect.Type{contextType, txType}
+	for i := 1; i < field.NumIn(); i++ {
+		want = append(want, field.In(i))
+	}
+	out := make([]reflect.Type, field.NumOut())
+	for i := range out {
+		out[i] = field.Out(i)
+	}
+	wantType := reflect.FuncOf(want, out, field.IsVariadic())
+	if method != wantType {
+		return fmt.Errorf("method should be %s, got %s", wantType, method)
+	}
+
+	return nil
+}
+
+// bindMethod returns a function of the typ that calls the method in a
+// transaction.
+func bindMethod(tr Transactioner, typ reflect.Type, method reflect.Value) reflect.Value {
+	return reflect.MakeFunc(typ, func(args []reflect.Value) []reflect.Value {
+		ctx, _ := args[0].Interface().(context.Context)
+		// The results are zero if the Transactioner doesn't call the function.
+		ret := make([]reflect.Value, typ.NumOut())
+		for i := range ret {
+			ret[i] = reflect.Zero(typ.Out(i))
+		}
+		err := tr.Transaction(ctx, func(tx pgx.Tx) error {
+			in := make([]reflect.Value, 0, len(args)+1)
+			in = append(in, args[0], reflect.ValueOf(&tx).Elem())
+			in = append(in, args[1:]...)
+			var out []reflect.Value
+			if typ.IsVariadic() {
+				out = method.CallSlice(in)
+			} else {
+				out = method.Call(in)
+			}
+			copy(ret, out)
+			if errV := out[len(out)-1]; !errV.IsNil() {
+				return errV.Interface().(error) //nolint:forcetypeassert // checked by checkBinding.
+			}
+
+			return nil
+		})
+		if err == nil {
+			return ret
+		}
+
+		for i := range ret {
+			ret[i] = reflect.Zero(typ.Out(i))
+		}
+		ret[len(ret)-1] = reflect.ValueOf(&err).Elem()
+
+		return ret
+	})
+}
@@ -0,0 +1,157 @@
+package dbtools_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/dbtoolstest"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bindStore struct {
+	Create  func(ctx context.Context, name string) (int64, error)
+	Rename  func(ctx context.Context, id int64, name string) error
+	Tag     func(ctx context.Context, tags ...string) (string, error)
+	private func()
+	Name    string
+}
+
+type bindQueries struct {
+	fail int
+}
+
+func (q *bindQueries) Create(ctx context.Context, tx pgx.Tx, name string) (int64, error) {
+	if q.fail > 0 {
+		q.fail--
+		return 0, assert.AnError
+	}
+	var id int64
+	err := tx.QueryRow(ctx, "INSERT INTO users (name) VALUES ($1) RETURNING id", name).Scan(&id)
+	return id, err
+}
+
+func (q *bindQueries) Rename(context.Context, pgx.Tx, int64, string) error {
+	return assert.AnError
+}
+
+func (q *bindQueries) Tag(_ context.Context, _ pgx.Tx, tags ...string) (string, error) {
+	return strings.Join(tags, ","), nil
+}
+
+// skipTransactioner returns without calling the functions.
+type skipTransactioner struct{}
+
+func (skipTransactioner) Transaction(context.Context, ...func(pgx.Tx) error) error { return nil }
+
+func TestBind(t *testing.T) {
+	t.Parallel()
+	t.Run("Invalid", testBindInvalid)
+	t.Run("Transaction", testBindTransaction)
+	t.Run("Error", testBindError)
+	t.Run("Variadic", testBindVariadic)
+	t.Run("Skipped", testBindSkipped)
+}
+
+func testBindInvalid(t *testing.T) {
+	t.Parallel()
+	fake := &dbtoolstest.FakeTransactioner{}
+	err := dbtools.Bind(nil, &bindStore{}, &bindQueries{})
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+
+	err = dbtools.Bind(fake, bindStore{}, &bindQueries{})
+	assert.ErrorIs(t, err, dbtools.ErrInvalidBinding)
+
+	var missing struct {
+		Delete func(ctx context.Context, id int64) error
+	}
+	err = dbtools.Bind(fake, &missing, &bindQueries{})
+	require.ErrorIs(t, err, dbtools.ErrInvalidBinding)
+	assert.Contains(t, err.Error(), "Delete")
+
+	tcs := map[string]any{
+		"no context": &struct {
+			Rename func(id int64, name string) error
+		}{},
+		"no error": &struct {
+			Rename func(ctx context.Context, id int64, name string)
+		}{},
+		"arguments": &struct {
+			Rename func(ctx context.Context, id int64) error
+		}{},
+		"results": &struct {
+			Create func(ctx context.Context, name string) (int, error)
+		}{},
+	}
+	for name, dst := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := dbtools.Bind(fake, dst, &bindQueries{})
+			assert.ErrorIs(t, err, dbtools.ErrInvalidBinding)
+		})
+	}
+}
+
+func testBindTransaction(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^INSERT INTO users`).Return([]string{"id"}, []any{int64(42)})
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	var store bindStore
+	require.NoError(t, dbtools.Bind(tr, &store, &bindQueries{fail: 1}))
+	assert.Nil(t, store.private)
+
+	id, err := store.Create(context.Background(), "arsham")
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, id)
+	want := []string{
+		"BEGIN", "ROLLBACK",
+		"BEGIN", "INSERT INTO users (name) VALUES ($1) RETURNING id", "COMMIT",
+	}
+	assert.Equal(t, want, sim.SQL())
+}
+
+func testBindError(t *testing.T) {
+	t.Parallel()
+	fake := &dbtoolstest.FakeTransactioner{Attempts: 2}
+	var store bindStore
+	require.NoError(t, dbtools.Bind(fake, &store, &bindQueries{fail: 5}))
+
+	id, err := store.Create(context.Background(), "arsham")
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Zero(t, id)
+	assert.Equal(t, 2, fake.Rollbacks())
+
+	err = store.Rename(context.Background(), 1, "john")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testBindVariadic(t *testing.T) {
+	t.Parallel()
+	fake := &dbtoolstest.FakeTransactioner{}
+	var store bindStore
+	require.NoError(t, dbtools.Bind(fake, &store, &bindQueries{}))
+
+	got, err := store.Tag(context.Background(), "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, "a,b", got)
+	assert.Equal(t, 1, fake.Commits())
+}
+
+func testBindSkipped(t *testing.T) {
+	t.Parallel()
+	var store bindStore
+	require.NoError(t, dbtools.Bind(skipTransactioner{}, &store, &bindQueries{}))
+
+	id, err := store.Create(context.Background(), "arsham")
+	require.NoError(t, err)
+	assert.Zero(t, id)
+	assert.NoError(t, store.Rename(context.Background(), 1, "john"))
+}
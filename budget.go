@@ -0,0 +1,104 @@
+package dbtools
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arsham/retry/v3"
+)
+
+// Budget limits the number of retries in a time window. It is a token bucket
+// that holds up to the given number of retries, and is refilled at the same
+// rate over the window. Each retry takes a token, and the calls stop retrying
+// when the bucket is empty. Share a Budget between the PGX instances of a
+// service with the WithBudget option, so an outage doesn't multiply the load
+// on the database with the retries of every call site. It is safe for
+// concurrent use.
+type Budget struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+	last     time.Time
+}
+
+// NewBudget returns a full Budget that allows the retries in each window. It
+// returns an ErrInvalidBudget error if the retries or the window is not
+// positive.
+func NewBudget(retries int, window time.Duration) (*Budget, error) {
+	if retries < 1 || window <= 0 {
+		return nil, fmt.Errorf("%w: %d retries in %s", ErrInvalidBudget, retries, window)
+	}
+
+	return &Budget{
+		capacity: float64(retries),
+		tokens:   float64(retries),
+		rate:     float64(retries) / window.Seconds(),
+		last:     time.Now(),
+	}, nil
+}
+
+// Available returns the number of retries that can be made right now.
+func (b *Budget) Available() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+
+	return int(b.tokens)
+}
+
+// take takes a token from the bucket. It returns false if the bucket is
+// empty.
+func (b *Budget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// refill adds the tokens earned since the last refill. The mu should be held.
+func (b *Budget) refill() {
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// budgeted returns a function that calls the fn, and takes a token from the
+// budget for each error that is going to be retried by the loop. When the budget is
+// empty, the error is wrapped with the ErrRetryBudgetExhausted error and the
+// retries are stopped.
+func (p *PGX) budgeted(loop retry.Retry, fn func() error) func() error {
+	if p.budget == nil {
+		return fn
+	}
+	attempts := 0
+
+	return func() error {
+		attempts++
+		return p.spend(fn(), attempts, loop.Attempts)
+	}
+}
+
+// spend takes a token from the budget if the err is going to be retried. The
+// attempts is the number of the attempts of the retry strategy.
+func (p *PGX) spend(err error, attempt, attempts int) error {
+	if p.budget == nil || err == nil || attempt >= attempts {
+		return err
+	}
+	var stop *retry.StopError
+	if errors.As(err, &stop) {
+		return err
+	}
+	if !p.budget.take() {
+		return &retry.StopError{Err: fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)}
+	}
+
+	return err
+}
@@ -0,0 +1,121 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBudget(t *testing.T) {
+	t.Parallel()
+	_, err := dbtools.NewBudget(0, time.Second)
+	assert.ErrorIs(t, err, dbtools.ErrInvalidBudget)
+	_, err = dbtools.NewBudget(1, 0)
+	assert.ErrorIs(t, err, dbtools.ErrInvalidBudget)
+
+	b, err := dbtools.NewBudget(3, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 3, b.Available())
+}
+
+func TestWithBudget(t *testing.T) {
+	t.Parallel()
+	t.Run("Shared", testWithBudgetShared)
+	t.Run("Refill", testWithBudgetRefill)
+	t.Run("LastAttempt", testWithBudgetLastAttempt)
+	t.Run("Exec", testWithBudgetExec)
+}
+
+func testWithBudgetShared(t *testing.T) {
+	t.Parallel()
+	b, err := dbtools.NewBudget(2, time.Hour)
+	require.NoError(t, err)
+	ctx := context.Background()
+	first, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(5, time.Millisecond), dbtools.WithBudget(b))
+	require.NoError(t, err)
+	second, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(5, time.Millisecond), dbtools.WithBudget(b))
+	require.NoError(t, err)
+
+	calls := 0
+	err = first.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, dbtools.ErrRetryBudgetExhausted)
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 3, calls, "expected the first attempt and two retries")
+	assert.Zero(t, b.Available())
+
+	calls = 0
+	err = second.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, dbtools.ErrRetryBudgetExhausted)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	err = second.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls, "the successful calls shouldn't need a budget")
+}
+
+func testWithBudgetRefill(t *testing.T) {
+	t.Parallel()
+	b, err := dbtools.NewBudget(1, 20*time.Millisecond)
+	require.NoError(t, err)
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(2, time.Millisecond), dbtools.WithBudget(b))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), failingTx(assert.AnError))
+	require.NoError(t, err)
+	assert.Zero(t, b.Available())
+
+	assert.Eventually(t, func() bool {
+		return b.Available() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func testWithBudgetLastAttempt(t *testing.T) {
+	t.Parallel()
+	b, err := dbtools.NewBudget(1, time.Hour)
+	require.NoError(t, err)
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(1, time.Millisecond), dbtools.WithBudget(b))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), failingTx(assert.AnError))
+	require.ErrorIs(t, err, assert.AnError)
+	assert.NotErrorIs(t, err, dbtools.ErrRetryBudgetExhausted)
+	assert.Equal(t, 1, b.Available(), "the last attempt shouldn't take a token")
+}
+
+func testWithBudgetExec(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	b, err := dbtools.NewBudget(1, time.Hour)
+	require.NoError(t, err)
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Millisecond), dbtools.WithBudget(b))
+	require.NoError(t, err)
+
+	q.On("Exec", mock.Anything, "SELECT 1").
+		Return(pgconn.CommandTag{}, assert.AnError).Twice()
+
+	_, err = tr.Exec(context.Background(), "SELECT 1")
+	require.ErrorIs(t, err, dbtools.ErrRetryBudgetExhausted)
+	assert.ErrorIs(t, err, assert.AnError)
+}
@@ -0,0 +1,56 @@
+package dbtools
+
+import (
+	"context"
+	"time"
+
+	"github.com/arsham/retry/v3"
+)
+
+type callRetryKey struct{}
+
+// callRetry is the retry strategy set for a call with the WithCallRetry
+// function.
+type callRetry struct {
+	attempts int
+	delay    time.Duration
+}
+
+// WithCallRetry returns a copy of the ctx that overrides the retry attempts
+// and the delay of the transactions and the queries that are called with it.
+// The rest of the configuration is kept. It lets the hot paths use a tighter
+// policy than the background jobs that share the same PGX:
+//
+//	ctx = dbtools.WithCallRetry(ctx, 3, 10*time.Millisecond)
+//	err := tr.Transaction(ctx, fns...)
+//
+// The attempts are set to 1 if the value is less than 1.
+func WithCallRetry(ctx context.Context, attempts int, delay time.Duration) context.Context {
+	return context.WithValue(ctx, callRetryKey{}, callRetry{
+		attempts: max(attempts, 1),
+		delay:    delay,
+	})
+}
+
+// retryPolicy returns the retry strategy of the calls of the kind made with
+// the ctx. The strategy set with the WithCallRetry function takes precedence
+// over the one set with the KindRetry option.
+func (p *PGX) retryPolicy(ctx context.Context, kind OpKind) retry.Retry {
+	return p.paced(p.callPolicy(ctx, kind))
+}
+
+// callPolicy returns the retry strategy of the retryPolicy method before the
+// delays are paced.
+func (p *PGX) callPolicy(ctx context.Context, kind OpKind) retry.Retry {
+	loop := p.loop
+	if c, ok := p.kindRetry[kind]; ok {
+		loop.Attempts = c.attempts
+		loop.Delay = c.delay
+	}
+	if c, ok := ctx.Value(callRetryKey{}).(callRetry); ok {
+		loop.Attempts = c.attempts
+		loop.Delay = c.delay
+	}
+
+	return p.delegated(loop)
+}
@@ -0,0 +1,74 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCallRetry(t *testing.T) {
+	t.Parallel()
+	t.Run("Transaction", testWithCallRetryTransaction)
+	t.Run("Exec", testWithCallRetryExec)
+	t.Run("NoRetry", testWithCallRetryNoRetry)
+}
+
+func testWithCallRetryTransaction(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(), dbtools.Retry(10, time.Hour))
+	require.NoError(t, err)
+
+	calls := 0
+	ctx := dbtools.WithCallRetry(context.Background(), 3, time.Millisecond)
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls, "the other calls should keep the configured strategy")
+}
+
+func testWithCallRetryExec(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Hour))
+	require.NoError(t, err)
+
+	q.On("Exec", mock.Anything, "SELECT 1").
+		Return(pgconn.CommandTag{}, assert.AnError).Twice()
+
+	ctx := dbtools.WithCallRetry(context.Background(), 2, time.Millisecond)
+	_, err = tr.Exec(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testWithCallRetryNoRetry(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(), dbtools.Retry(10, time.Hour))
+	require.NoError(t, err)
+
+	calls := 0
+	ctx := dbtools.WithCallRetry(context.Background(), 0, 0)
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,137 @@
+package dbtools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CapturedStatement is a distinct statement recorded by the SQLCapture.
+type CapturedStatement struct {
+	SQL string `json:"sql"`
+	// Caller is the file and line of the code that ran the statement.
+	Caller string `json:"caller"`
+	Count  int    `json:"count"`
+}
+
+type captureKey struct {
+	sql    string
+	caller string
+}
+
+// SQLCapture records every distinct statement that runs through the PGX
+// objects configured with the CaptureSQL option, with the call site. It is
+// meant for tests and development, for example for producing an inventory of
+// the queries for DBA review. It is safe for concurrent use.
+type SQLCapture struct {
+	mu         sync.Mutex
+	statements map[captureKey]int
+}
+
+// NewSQLCapture returns an empty SQLCapture.
+func NewSQLCapture() *SQLCapture {
+	return &SQLCapture{statements: make(map[captureKey]int)}
+}
+
+// record records the sql with the caller outside of this package.
+func (c *SQLCapture) record(sql string) {
+	key := captureKey{sql: strings.TrimSpace(sql), caller: caller()}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements[key]++
+}
+
+// Statements returns the recorded statements sorted by the SQL and the
+// caller.
+func (c *SQLCapture) Statements() []CapturedStatement {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make([]CapturedStatement, 0, len(c.statements))
+	for key, count := range c.statements {
+		ret = append(ret, CapturedStatement{SQL: key.sql, Caller: key.caller, Count: count})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].SQL != ret[j].SQL {
+			return ret[i].SQL < ret[j].SQL
+		}
+		return ret[i].Caller < ret[j].Caller
+	})
+
+	return ret
+}
+
+// WriteJSON writes the recorded statements to the w as a JSON array.
+func (c *SQLCapture) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c.Statements()); err != nil {
+		return fmt.Errorf("writing captured statements: %w", err)
+	}
+
+	return nil
+}
+
+// hook returns a statement hook that records the statements.
+func (c *SQLCapture) hook() stmtHook {
+	return stmtHook{
+		before: func(_ context.Context, s *statement) error {
+			if len(s.Queries) > 0 {
+				for _, q := range s.Queries {
+					c.record(q)
+				}
+				return nil
+			}
+			c.record(s.SQL)
+
+			return nil
+		},
+	}
+}
+
+// capture records the sql if the capture is enabled.
+func (p *PGX) capture(sql string) {
+	if p.sqlCapture != nil {
+		p.sqlCapture.record(sql)
+	}
+}
+
+// ignoredCallers are the packages that are skipped when looking for the call
+// site of a statement.
+var ignoredCallers = []string{
+	"github.com/arsham/dbtools/v4.",
+	"github.com/arsham/retry/",
+	"github.com/jackc/pgx/",
+	"runtime.",
+}
+
+// caller returns the file and line of the first caller outside of this
+// package and its dependencies.
+func caller() string {
+	pc := make([]uintptr, 32)
+	n := runtime.Callers(3, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	for {
+		frame, more := frames.Next()
+		if !ignoredCaller(frame.Function) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+func ignoredCaller(fn string) bool {
+	for _, prefix := range ignoredCallers {
+		if strings.HasPrefix(fn, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package dbtools_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureSQL(t *testing.T) {
+	t.Parallel()
+	t.Run("Transaction", testCaptureSQLTransaction)
+	t.Run("Helpers", testCaptureSQLHelpers)
+	t.Run("WriteJSON", testCaptureSQLWriteJSON)
+}
+
+func testCaptureSQLTransaction(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`.`)
+	c := dbtools.NewSQLCapture()
+	tr, err := dbtools.New(sim, dbtools.CaptureSQL(c))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		for range 3 {
+			if _, err := tx.Exec(ctx, "UPDATE users SET seen = true"); err != nil {
+				return err
+			}
+		}
+		br := tx.SendBatch(ctx, func() *pgx.Batch {
+			b := &pgx.Batch{}
+			b.Queue("SELECT 1")
+			b.Queue("SELECT 2")
+			return b
+		}())
+		return br.Close()
+	})
+	require.NoError(t, err)
+
+	got := c.Statements()
+	require.Len(t, got, 3)
+	assert.Equal(t, "SELECT 1", got[0].SQL)
+	assert.Equal(t, "SELECT 2", got[1].SQL)
+	assert.Equal(t, "UPDATE users SET seen = true", got[2].SQL)
+	assert.Equal(t, 3, got[2].Count)
+	assert.Contains(t, got[2].Caller, "capture_test.go:")
+}
+
+func testCaptureSQLHelpers(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`.`).Return([]string{"n"}, []any{1})
+	c := dbtools.NewSQLCapture()
+	tr, err := dbtools.New(sim, dbtools.CaptureSQL(c))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = tr.Exec(ctx, "DELETE FROM sessions")
+	require.NoError(t, err)
+	err = tr.QueryRow(ctx, func(r pgx.Row) error {
+		var n int
+		return r.Scan(&n)
+	}, "SELECT count(*) FROM users")
+	require.NoError(t, err)
+
+	got := c.Statements()
+	require.Len(t, got, 2)
+	assert.Equal(t, "DELETE FROM sessions", got[0].SQL)
+	assert.Equal(t, "SELECT count(*) FROM users", got[1].SQL)
+	for _, s := range got {
+		assert.Contains(t, s.Caller, "capture_test.go:")
+	}
+}
+
+func testCaptureSQLWriteJSON(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`.`)
+	c := dbtools.NewSQLCapture()
+	tr, err := dbtools.New(sim, dbtools.CaptureSQL(c))
+	require.NoError(t, err)
+	_, err = tr.Exec(context.Background(), "VACUUM users")
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, c.WriteJSON(buf))
+	var got []dbtools.CapturedStatement
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	require.Len(t, got, 1)
+	assert.Equal(t, "VACUUM users", got[0].SQL)
+	assert.Equal(t, 1, got[0].Count)
+}
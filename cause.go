@@ -0,0 +1,25 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// withCause adds the cause of the ctx cancellation to the err if the err is
+// caused by the ctx, and the cause is not already in the chain. This keeps
+// the cause given to the context.WithCancelCause, context.WithDeadlineCause
+// or context.WithTimeoutCause functions, while the err still matches the
+// context.Canceled or context.DeadlineExceeded errors.
+func withCause(ctx context.Context, err error) error {
+	ctxErr := ctx.Err()
+	if err == nil || ctxErr == nil || !errors.Is(err, ctxErr) {
+		return err
+	}
+	cause := context.Cause(ctx)
+	if cause == nil || errors.Is(err, cause) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", err, cause)
+}
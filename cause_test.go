@@ -0,0 +1,114 @@
+package dbtools_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errShutdown = errors.New("shutting down")
+
+func TestContextCause(t *testing.T) {
+	t.Parallel()
+	t.Run("Transaction", testContextCauseTransaction)
+	t.Run("Deadline", testContextCauseDeadline)
+	t.Run("NoCause", testContextCauseNoCause)
+	t.Run("Unrelated", testContextCauseUnrelated)
+	t.Run("Helpers", testContextCauseHelpers)
+}
+
+func testContextCauseTransaction(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Millisecond))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		cancel(errShutdown)
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, errShutdown)
+}
+
+func testContextCauseDeadline(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`.`).Error(assert.AnError)
+	tr, err := dbtools.New(sim, dbtools.Retry(100, 5*time.Millisecond))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 20*time.Millisecond, errShutdown)
+	defer cancel()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT 1")
+		return err
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, errShutdown)
+}
+
+func testContextCauseNoCause(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = tr.Transaction(ctx, func(pgx.Tx) error { return nil })
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, context.Canceled.Error(), err.Error())
+}
+
+func testContextCauseUnrelated(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		cancel(errShutdown)
+		return &retry.StopError{Err: assert.AnError}
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.NotErrorIs(t, err, errShutdown, "the error isn't caused by the context")
+}
+
+func testContextCauseHelpers(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errShutdown)
+
+	_, err = tr.Exec(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, errShutdown)
+
+	err = tr.Query(ctx, func(pgx.Rows) error { return nil }, "SELECT 1")
+	assert.ErrorIs(t, err, errShutdown)
+
+	err = tr.QueryRow(ctx, func(pgx.Row) error { return nil }, "SELECT 1")
+	assert.ErrorIs(t, err, errShutdown)
+}
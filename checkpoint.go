@@ -0,0 +1,30 @@
+package dbtools
+
+import (
+	"context"
+	"slices"
+)
+
+// checkpoint runs each step in its own transaction. The done function is
+// called with the index of each step after it is committed.
+type checkpoint struct {
+	done func(index int)
+}
+
+// resume runs the steps from the next index, each in its own transaction with
+// the prefix steps, and advances the next index after each commit. Therefore
+// the next attempt resumes from the step that failed.
+func (p *PGX) resume(ctx context.Context, prefix, steps []Step, next *int) error {
+	for *next < len(steps) {
+		group := append(slices.Clip(prefix), steps[*next])
+		if err := p.attempt(ctx, group); err != nil {
+			return err
+		}
+		if p.checkpoint.done != nil {
+			p.checkpoint.done(*next)
+		}
+		*next++
+	}
+
+	return nil
+}
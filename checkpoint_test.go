@@ -0,0 +1,91 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+	t.Run("Resume", testCheckpointResume)
+	t.Run("CommitError", testCheckpointCommitError)
+	t.Run("InternalSteps", testCheckpointInternalSteps)
+}
+
+func testCheckpointResume(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	var done []int
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.Checkpoint(func(i int) { done = append(done, i) }),
+	)
+	require.NoError(t, err)
+
+	calls := make([]int, 3)
+	err = tr.Transaction(context.Background(),
+		func(pgx.Tx) error { calls[0]++; return nil },
+		func(pgx.Tx) error {
+			calls[1]++
+			if calls[1] < 2 {
+				return assert.AnError
+			}
+			return nil
+		},
+		func(pgx.Tx) error { calls[2]++; return nil },
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 1}, calls)
+	assert.Equal(t, []int{0, 1, 2}, done)
+	assert.Equal(t, []string{
+		"BEGIN", "COMMIT",
+		"BEGIN", "ROLLBACK",
+		"BEGIN", "COMMIT",
+		"BEGIN", "COMMIT",
+	}, sim.SQL())
+}
+
+func testCheckpointCommitError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^COMMIT$`).Error(assert.AnError).Times(1)
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(2, time.Millisecond),
+		dbtools.Checkpoint(nil),
+	)
+	require.NoError(t, err)
+
+	calls := make([]int, 2)
+	err = tr.Transaction(context.Background(),
+		func(pgx.Tx) error { calls[0]++; return nil },
+		func(pgx.Tx) error { calls[1]++; return nil },
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, calls)
+}
+
+func testCheckpointInternalSteps(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`set_config`)
+	tr, err := dbtools.New(sim, dbtools.Checkpoint(nil))
+	require.NoError(t, err)
+
+	ctx := dbtools.WithTenant(context.Background(), "acme")
+	err = tr.Transaction(ctx,
+		func(pgx.Tx) error { return nil },
+		func(pgx.Tx) error { return nil },
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN", "SELECT set_config($1, $2, true)", "COMMIT",
+		"BEGIN", "SELECT set_config($1, $2, true)", "COMMIT",
+	}, sim.SQL())
+}
@@ -0,0 +1,81 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ChunkPolicy decides what the RunChunks function does when a chunk fails.
+type ChunkPolicy int
+
+const (
+	// StopOnError stops running the chunks after the first failed chunk.
+	StopOnError ChunkPolicy = iota
+	// ContinueOnError runs the remaining chunks after a chunk fails.
+	ContinueOnError
+)
+
+// ChunkResult is the result of a chunk of the RunChunks function. The chunk
+// contains the items from the Start index up to, but not including, the End
+// index.
+type ChunkResult struct {
+	Index int
+	Start int
+	End   int
+	Err   error
+}
+
+// RunChunks splits the items into chunks of the given size, and runs the fn
+// with each chunk in its own transaction with the tr, therefore each chunk is
+// retried separately and the committed chunks are not rolled back when a
+// later chunk fails. The fn receives a copy of the chunk slice header, and it
+// might be called again with the same chunk when its transaction is retried.
+//
+// It returns the results of the chunks that were run, in order. With the
+// StopOnError policy the error of the failed chunk is returned, and with the
+// ContinueOnError policy the errors of all the failed chunks are joined. The
+// remaining chunks are not run when the ctx is cancelled:
+//
+//	results, err := dbtools.RunChunks(ctx, p, rows, 5000, dbtools.ContinueOnError,
+//		func(tx pgx.Tx, chunk [][]any) error {
+//			_, err := dbtools.Upsert(ctx, tx, table, columns, chunk, conflict, update)
+//			return err
+//		},
+//	)
+//
+// It returns an ErrInvalidChunkSize error if the size is less than 1.
+func RunChunks[T any](ctx context.Context, tr Transactioner, items []T, size int, policy ChunkPolicy, fn func(pgx.Tx, []T) error) ([]ChunkResult, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidChunkSize, size)
+	}
+	results := make([]ChunkResult, 0, (len(items)+size-1)/size)
+	var errs []error
+	for start := 0; start < len(items); start += size {
+		if err := ctx.Err(); err != nil {
+			return results, errors.Join(append(errs, err)...)
+		}
+		res := ChunkResult{
+			Index: len(results),
+			Start: start,
+			End:   min(start+size, len(items)),
+		}
+		chunk := items[res.Start:res.End:res.End]
+		res.Err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+			return fn(tx, chunk)
+		})
+		results = append(results, res)
+		if res.Err == nil {
+			continue
+		}
+		err := fmt.Errorf("chunk #%d (items %d-%d): %w", res.Index, res.Start, res.End-1, res.Err)
+		if policy == StopOnError {
+			return results, err
+		}
+		errs = append(errs, err)
+	}
+
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,145 @@
+package dbtools_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunChunks(t *testing.T) {
+	t.Parallel()
+	t.Run("Chunks", testRunChunksChunks)
+	t.Run("Retry", testRunChunksRetry)
+	t.Run("StopOnError", testRunChunksStopOnError)
+	t.Run("ContinueOnError", testRunChunksContinueOnError)
+	t.Run("Cancelled", testRunChunksCancelled)
+	t.Run("InvalidSize", testRunChunksInvalidSize)
+}
+
+func testRunChunksChunks(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	var got [][]int
+	results, err := dbtools.RunChunks(context.Background(), tr, []int{1, 2, 3, 4, 5}, 2, dbtools.StopOnError,
+		func(_ pgx.Tx, chunk []int) error {
+			got = append(got, chunk)
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, got)
+	assert.Equal(t, []dbtools.ChunkResult{
+		{Index: 0, Start: 0, End: 2},
+		{Index: 1, Start: 2, End: 4},
+		{Index: 2, Start: 4, End: 5},
+	}, results)
+	assert.Equal(t, []string{"BEGIN", "COMMIT", "BEGIN", "COMMIT", "BEGIN", "COMMIT"}, sim.SQL())
+}
+
+func testRunChunksRetry(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(), dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	calls := 0
+	results, err := dbtools.RunChunks(context.Background(), tr, []int{1, 2, 3}, 2, dbtools.StopOnError,
+		func(_ pgx.Tx, chunk []int) error {
+			calls++
+			if calls == 2 {
+				return &pgconn.PgError{Code: "40001"}
+			}
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls, "only the failed chunk should be retried")
+	assert.Len(t, results, 2)
+}
+
+func testRunChunksStopOnError(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+
+	results, err := dbtools.RunChunks(context.Background(), tr, []int{1, 2, 3, 4, 5}, 2, dbtools.StopOnError,
+		func(_ pgx.Tx, chunk []int) error {
+			if chunk[0] == 3 {
+				return assert.AnError
+			}
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "chunk #1 (items 2-3)")
+	require.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, assert.AnError)
+}
+
+func testRunChunksContinueOnError(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+
+	errOdd := errors.New("odd chunk")
+	results, err := dbtools.RunChunks(context.Background(), tr, []int{1, 2, 3, 4, 5}, 1, dbtools.ContinueOnError,
+		func(_ pgx.Tx, chunk []int) error {
+			if chunk[0]%2 == 1 {
+				return errOdd
+			}
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, errOdd)
+	require.Len(t, results, 5)
+	for _, res := range results {
+		if res.Index%2 == 0 {
+			assert.ErrorIs(t, res.Err, errOdd)
+			assert.Contains(t, err.Error(), fmt.Sprintf("chunk #%d", res.Index))
+			continue
+		}
+		assert.NoError(t, res.Err)
+	}
+}
+
+func testRunChunksCancelled(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results, err := dbtools.RunChunks(ctx, tr, []int{1, 2, 3}, 1, dbtools.ContinueOnError,
+		func(pgx.Tx, []int) error {
+			cancel()
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, results, 1)
+}
+
+func testRunChunksInvalidSize(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	_, err = dbtools.RunChunks(context.Background(), tr, []int{1}, 0, dbtools.StopOnError,
+		func(pgx.Tx, []int) error { return nil },
+	)
+	require.ErrorIs(t, err, dbtools.ErrInvalidChunkSize)
+	assert.Empty(t, sim.SQL())
+}
@@ -0,0 +1,113 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Classifier decides whether the err should be retried. When it returns false
+// the transaction is stopped and the error is returned.
+type Classifier func(err error) bool
+
+// classify wraps the err in a *retry.StopError if the classifier decides it
+// should not be retried.
+func (p *PGX) classify(err error) error {
+	if err == nil || p.classifier == nil || p.classifier(err) {
+		return err
+	}
+	if p.lockTimeouts != nil && IsLockTimeout(err) {
+		return err
+	}
+	var stop *retry.StopError
+	if errors.As(err, &stop) {
+		return err
+	}
+
+	return &retry.StopError{Err: err}
+}
+
+// SQLState returns the SQLSTATE code of the err if it is a *pgconn.PgError.
+// It returns an empty string otherwise.
+func SQLState(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+
+	return ""
+}
+
+// IsDeadlock returns true if the err is caused by a deadlock between
+// transactions.
+func IsDeadlock(err error) bool {
+	return SQLState(err) == "40P01" // deadlock_detected
+}
+
+// IsLockTimeout returns true if the err is caused by a lock that could not be
+// acquired within the lock_timeout.
+func IsLockTimeout(err error) bool {
+	return SQLState(err) == "55P03" // lock_not_available
+}
+
+// IsSerializationFailure returns true if the err is caused by a conflict with
+// a concurrent transaction in the serializable or repeatable read isolation
+// levels.
+func IsSerializationFailure(err error) bool {
+	return SQLState(err) == "40001" // serialization_failure
+}
+
+// IsRetryable returns true if retrying the transaction may succeed, which is
+// the case for the serialization failures, deadlocks and connection errors.
+// It can be used as a Classifier.
+func IsRetryable(err error) bool {
+	return IsSerializationFailure(err) || IsDeadlock(err) || IsConnectionError(err)
+}
+
+// IsAuthError returns true if the err is caused by a failed authentication,
+// for example when the password is rotated.
+func IsAuthError(err error) bool {
+	switch SQLState(err) {
+	case "28P01", // invalid_password
+		"28000": // invalid_authorization_specification
+		return true
+	}
+
+	return false
+}
+
+// IsConnectionError returns true if the err is caused by a broken or
+// unreachable connection, or when the server is shutting down or not
+// accepting connections yet. The cancellation and the deadline of the
+// caller's context are not connection errors, even when they interrupt
+// dialling or when the context.DeadlineExceeded error is seen as a net.Error.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	code := SQLState(err)
+	switch {
+	case strings.HasPrefix(code, "08"): // connection_exception
+		return true
+	case code == "57P01", code == "57P02", code == "57P03":
+		// admin_shutdown, crash_shutdown, cannot_connect_now
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,185 @@
+package dbtools_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLState(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		err  error
+		want string
+	}{
+		"nil":     {nil, ""},
+		"other":   {assert.AnError, ""},
+		"pgerror": {&pgconn.PgError{Code: "40001"}, "40001"},
+		"wrapped": {fmt.Errorf("foo: %w", &pgconn.PgError{Code: "40P01"}), "40P01"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, dbtools.SQLState(tc.err))
+		})
+	}
+}
+
+func TestWithClassifier(t *testing.T) {
+	t.Parallel()
+	t.Run("Transaction", testWithClassifierTransaction)
+	t.Run("Exec", testWithClassifierExec)
+}
+
+func testWithClassifierTransaction(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	permanent := errors.New(randomString(10))
+	tr, err := dbtools.New(db,
+		dbtools.Retry(10, time.Millisecond),
+		dbtools.WithClassifier(func(err error) bool {
+			return !errors.Is(err, permanent)
+		}),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(3)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(3)
+
+	calls := 0
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		if calls == 3 {
+			return permanent
+		}
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, permanent)
+	assert.Equal(t, 3, calls)
+}
+
+func testWithClassifierExec(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db,
+		dbtools.Retry(10, time.Millisecond),
+		dbtools.WithClassifier(func(error) bool { return false }),
+	)
+	require.NoError(t, err)
+
+	q.On("Exec", mock.Anything, "SELECT 1").
+		Return(pgconn.CommandTag{}, assert.AnError).Once()
+
+	_, err = tr.Exec(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestIsConnectionError(t *testing.T) {
+	t.Parallel()
+	// Connecting with a cancelled context returns a *pgconn.ConnectError that
+	// wraps the context.Canceled error.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, dialErr := pgconn.Connect(ctx, "postgres://user@127.0.0.1:1/db")
+	var connErr *pgconn.ConnectError
+	require.ErrorAs(t, dialErr, &connErr)
+	require.ErrorIs(t, dialErr, context.Canceled)
+
+	tcs := map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":           {nil, false},
+		"other":         {assert.AnError, false},
+		"connect error": {&pgconn.ConnectError{}, true},
+		"class 08":      {&pgconn.PgError{Code: "08006"}, true},
+		"shutdown":      {fmt.Errorf("foo: %w", &pgconn.PgError{Code: "57P01"}), true},
+		"serialization": {&pgconn.PgError{Code: "40001"}, false},
+		"net error":     {&net.OpError{Op: "read", Err: assert.AnError}, true},
+		"canceled":      {fmt.Errorf("foo: %w", context.Canceled), false},
+		"deadline":      {fmt.Errorf("foo: %w", context.DeadlineExceeded), false},
+		"dial canceled": {dialErr, false},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, dbtools.IsConnectionError(tc.err))
+		})
+	}
+}
+
+func TestIsDeadlock(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":           {nil, false},
+		"other":         {assert.AnError, false},
+		"deadlock":      {fmt.Errorf("foo: %w", &pgconn.PgError{Code: "40P01"}), true},
+		"serialization": {&pgconn.PgError{Code: "40001"}, false},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, dbtools.IsDeadlock(tc.err))
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":           {nil, false},
+		"other":         {assert.AnError, false},
+		"serialization": {fmt.Errorf("foo: %w", &pgconn.PgError{Code: "40001"}), true},
+		"deadlock":      {&pgconn.PgError{Code: "40P01"}, true},
+		"connection":    {&pgconn.PgError{Code: "08006"}, true},
+		"unique":        {&pgconn.PgError{Code: "23505"}, false},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, dbtools.IsRetryable(tc.err))
+		})
+	}
+}
+
+func TestIsAuthError(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":           {nil, false},
+		"other":         {assert.AnError, false},
+		"password":      {&pgconn.PgError{Code: "28P01"}, true},
+		"authorization": {fmt.Errorf("foo: %w", &pgconn.PgError{Code: "28000"}), true},
+		"serialization": {&pgconn.PgError{Code: "40001"}, false},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, dbtools.IsAuthError(tc.err))
+		})
+	}
+}
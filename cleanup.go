@@ -0,0 +1,159 @@
+package dbtools
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type attemptScopeKey struct{}
+
+// attemptScope holds the cleanup and the commit functions of the running
+// attempt, and the keys of the side effects that are done in all attempts of
+// the call.
+type attemptScope struct {
+	mu      sync.Mutex
+	fns     []func()
+	commits []func()
+	keys    *idempotencyScope
+}
+
+// withAttemptScope returns a copy of the ctx with a new attempt scope that
+// shares the keys, and the scope.
+func withAttemptScope(ctx context.Context, keys *idempotencyScope) (context.Context, *attemptScope) {
+	scope := &attemptScope{keys: keys}
+	return context.WithValue(ctx, attemptScopeKey{}, scope), scope
+}
+
+// scopedTx carries the attempt scope to the functions of the transaction.
+// The nested transactions share the scope of their parent.
+type scopedTx struct {
+	pgx.Tx
+	scope *attemptScope
+}
+
+// scopeTx returns the tx with the attempt scope of the ctx if there is one.
+func scopeTx(ctx context.Context, tx pgx.Tx) pgx.Tx {
+	scope, _ := ctx.Value(attemptScopeKey{}).(*attemptScope)
+	if scope == nil {
+		return tx
+	}
+
+	return &scopedTx{Tx: tx, scope: scope}
+}
+
+// Begin starts a pseudo nested transaction in the same attempt scope.
+func (s *scopedTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := s.Tx.Begin(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // the tx is transparent.
+	}
+
+	return &scopedTx{Tx: tx, scope: s.scope}, nil
+}
+
+// txScope returns the attempt scope of the tx. The transactions that are
+// wrapped by a Middleware or a decorator are unwrapped if they have an
+// Unwrap() pgx.Tx method.
+func txScope(tx pgx.Tx) *attemptScope {
+	for tx != nil {
+		if s, ok := tx.(*scopedTx); ok {
+			return s.scope
+		}
+		u, ok := tx.(interface{ Unwrap() pgx.Tx })
+		if !ok {
+			return nil
+		}
+		tx = u.Unwrap()
+	}
+
+	return nil
+}
+
+// OnAttemptEnd registers the fn to be called when the attempt of the tx ends,
+// whether it is committed, rolled back or panicked. The tx should be the one
+// that is passed to the transaction function, a nested transaction of it, or
+// a decorator of it with an Unwrap() pgx.Tx method. The functions are called
+// in the reverse order of the registration, after the transaction is
+// finished. The panics in the functions are ignored. It returns an
+// ErrNoAttemptScope error if the tx is not started by the PGX.
+//
+//	err := tr.Transaction(ctx, func(tx pgx.Tx) error {
+//		f, err := os.CreateTemp("", "export")
+//		if err != nil {
+//			return err
+//		}
+//		dbtools.OnAttemptEnd(tx, func() { os.Remove(f.Name()) })
+//		return export(ctx, tx, f)
+//	})
+func OnAttemptEnd(tx pgx.Tx, fn func()) error {
+	scope := txScope(tx)
+	if scope == nil {
+		return ErrNoAttemptScope
+	}
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	scope.fns = append(scope.fns, fn)
+
+	return nil
+}
+
+// AfterCommit registers the fn to be called after the transaction of the tx
+// is committed. The fn is not called if the attempt is rolled back, or if it
+// is run with the DryRun method. The functions are called in the order of the
+// registration, and their panics are ignored. Like the OnAttemptEnd function,
+// the tx can be a nested transaction or a decorator with an Unwrap() pgx.Tx
+// method. It returns an ErrNoAttemptScope error if the tx is not started by
+// the PGX.
+func AfterCommit(tx pgx.Tx, fn func()) error {
+	scope := txScope(tx)
+	if scope == nil {
+		return ErrNoAttemptScope
+	}
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	scope.commits = append(scope.commits, fn)
+
+	return nil
+}
+
+// committed calls the commit functions of the attempt scope of the ctx and
+// clears them.
+func committed(ctx context.Context) {
+	scope, _ := ctx.Value(attemptScopeKey{}).(*attemptScope)
+	if scope == nil {
+		return
+	}
+	scope.mu.Lock()
+	fns := scope.commits
+	scope.commits = nil
+	scope.mu.Unlock()
+
+	for _, fn := range fns {
+		if fn != nil {
+			func() {
+				defer func() { _ = recover() }()
+				fn()
+			}()
+		}
+	}
+}
+
+// end calls the cleanup functions of the scope and clears them. The panics
+// are recovered, otherwise a committed transaction would be retried.
+func (a *attemptScope) end() {
+	a.mu.Lock()
+	fns := a.fns
+	a.fns = nil
+	a.mu.Unlock()
+
+	for i := len(fns) - 1; i >= 0; i-- {
+		if fns[i] != nil {
+			func() {
+				defer func() { _ = recover() }()
+				fns[i]()
+			}()
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package dbtools_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnAttemptEnd(t *testing.T) {
+	t.Parallel()
+	t.Run("NoScope", testOnAttemptEndNoScope)
+	t.Run("Commit", testOnAttemptEndCommit)
+	t.Run("Retry", testOnAttemptEndRetry)
+	t.Run("Panic", testOnAttemptEndPanic)
+	t.Run("PanickingCleanup", testOnAttemptEndPanickingCleanup)
+	t.Run("Nested", testOnAttemptEndNested)
+	t.Run("Concurrent", testOnAttemptEndConcurrent)
+	t.Run("Middleware", testOnAttemptEndMiddleware)
+}
+
+func testOnAttemptEndNoScope(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	err := dbtools.OnAttemptEnd(tx, func() {})
+	assert.ErrorIs(t, err, dbtools.ErrNoAttemptScope)
+}
+
+func testOnAttemptEndCommit(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	var order []string
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		require.NoError(t, dbtools.OnAttemptEnd(tx, func() { order = append(order, "first") }))
+		require.NoError(t, dbtools.OnAttemptEnd(tx, func() { order = append(order, "second") }))
+		assert.Empty(t, order)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second", "first"}, order)
+	assert.Equal(t, []string{"BEGIN", "COMMIT"}, sim.SQL())
+}
+
+func testOnAttemptEndRetry(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	calls, cleanups := 0, 0
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		calls++
+		assert.Equal(t, calls-1, cleanups, "previous attempt should be cleaned up")
+		require.NoError(t, dbtools.OnAttemptEnd(tx, func() { cleanups++ }))
+		if calls < 3 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, cleanups)
+}
+
+func testOnAttemptEndPanic(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	cleanups := 0
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		require.NoError(t, dbtools.OnAttemptEnd(tx, func() { cleanups++ }))
+		panic("oops")
+	})
+	require.Error(t, err)
+	assert.Equal(t, 2, cleanups)
+	assert.Equal(t, []string{"BEGIN", "ROLLBACK", "BEGIN", "ROLLBACK"}, sim.SQL())
+}
+
+func testOnAttemptEndPanickingCleanup(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	called := false
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		require.NoError(t, dbtools.OnAttemptEnd(tx, func() { called = true }))
+		require.NoError(t, dbtools.OnAttemptEnd(tx, func() { panic("cleanup") }))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, called)
+}
+
+func testOnAttemptEndNested(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	called := false
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		nested, err := tx.Begin(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, dbtools.OnAttemptEnd(nested, func() { called = true }))
+		return nested.Commit(context.Background())
+	})
+	require.NoError(t, err)
+	assert.True(t, called)
+}
+
+func testOnAttemptEndConcurrent(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	registered := make(chan struct{})
+	release := make(chan struct{})
+	var first atomic.Bool
+	done := make(chan error)
+	go func() {
+		done <- tr.Transaction(ctx, func(tx pgx.Tx) error {
+			require.NoError(t, dbtools.OnAttemptEnd(tx, func() { first.Store(true) }))
+			close(registered)
+			<-release
+			return nil
+		})
+	}()
+
+	<-registered
+	err = tr.Transaction(ctx, func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+	assert.False(t, first.Load(), "the other transaction's cleanup should not run")
+
+	close(release)
+	require.NoError(t, <-done)
+	assert.True(t, first.Load())
+}
+
+// decoratedTx is a decorator that a Middleware passes to the functions.
+type decoratedTx struct {
+	pgx.Tx
+}
+
+func (d *decoratedTx) Unwrap() pgx.Tx { return d.Tx }
+
+func testOnAttemptEndMiddleware(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim, dbtools.WithMiddleware(
+		func(next dbtools.TxFunc) dbtools.TxFunc {
+			return func(tx pgx.Tx) error { return next(tx) }
+		},
+		func(next dbtools.TxFunc) dbtools.TxFunc {
+			return func(tx pgx.Tx) error { return next(&decoratedTx{Tx: tx}) }
+		},
+	))
+	require.NoError(t, err)
+
+	called := false
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		return dbtools.OnAttemptEnd(tx, func() { called = true })
+	})
+	require.NoError(t, err)
+	assert.True(t, called)
+}
+
+func TestAfterCommit(t *testing.T) {
+	t.Parallel()
+	t.Run("NoScope", testAfterCommitNoScope)
+	t.Run("Commit", testAfterCommitCommit)
+	t.Run("Rollback", testAfterCommitRollback)
+	t.Run("DryRun", testAfterCommitDryRun)
+}
+
+func testAfterCommitNoScope(t *testing.T) {
+	t.Parallel()
+	err := dbtools.AfterCommit(mocks.NewPGXTx(t), func() {})
+	assert.ErrorIs(t, err, dbtools.ErrNoAttemptScope)
+}
+
+func testAfterCommitCommit(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	var order []string
+	calls := 0
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		calls++
+		require.NoError(t, dbtools.AfterCommit(tx, func() { order = append(order, "first") }))
+		require.NoError(t, dbtools.AfterCommit(tx, func() { panic("commit") }))
+		require.NoError(t, dbtools.AfterCommit(tx, func() { order = append(order, "second") }))
+		assert.Empty(t, order)
+		if calls == 1 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, order, "only the committed attempt should run them")
+}
+
+func testAfterCommitRollback(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		require.NoError(t, dbtools.AfterCommit(tx, func() {
+			t.Error("didn't expect to receive this call")
+		}))
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+}
+
+func testAfterCommitDryRun(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.DryRun(context.Background(), func(tx pgx.Tx) error {
+		return dbtools.AfterCommit(tx, func() {
+			t.Error("didn't expect to receive this call")
+		})
+	})
+	require.NoError(t, err)
+}
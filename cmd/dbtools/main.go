@@ -0,0 +1,249 @@
+// Command dbtools runs the operational helpers of the dbtools package, so the
+// same code paths that are used by the services can be invoked from init
+// containers and local scripts.
+//
+// Usage:
+//
+//	dbtools [flags] <command>
+//
+// The commands are:
+//
+//	wait       waits until the database accepts connections
+//	self-test  checks that transactions can be run on the database
+//	migrate    applies the pending migrations of the -dir directory
+//	rollback   reverts the last -steps migrations of the -dir directory
+//	seed       loads the .sql and .csv files of the -seeds directory
+//
+// The connection string is read from the -dsn flag, or the DATABASE_URL
+// environment variable.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/migrate"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	errNoDSN          = errors.New("connection string is not set")
+	errUnknownCommand = errors.New("unknown command")
+)
+
+// config is the configuration that is shared between the commands.
+type config struct {
+	dsn      string
+	attempts int
+	delay    time.Duration
+	timeout  time.Duration
+	dir      string
+	steps    int
+	seeds    string
+	truncate bool
+}
+
+func (c config) retry() retry.Retry {
+	return retry.Retry{
+		Attempts: c.attempts,
+		Delay:    c.delay,
+	}
+}
+
+// command runs with a pool that is already reachable.
+type command struct {
+	usage string
+	run   func(ctx context.Context, w io.Writer, pool *pgxpool.Pool, c config) error
+}
+
+var commands = map[string]command{
+	"wait": {
+		usage: "waits until the database accepts connections",
+		run:   runWait,
+	},
+	"self-test": {
+		usage: "checks that transactions can be run on the database",
+		run:   runSelfTest,
+	},
+	"migrate": {
+		usage: "applies the pending migrations of the -dir directory",
+		run:   runMigrate,
+	},
+	"rollback": {
+		usage: "reverts the last -steps migrations of the -dir directory",
+		run:   runRollback,
+	},
+	"seed": {
+		usage: "loads the .sql and .csv files of the -seeds directory",
+		run:   runSeed,
+	},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, os.Args[1:], os.Stdout, os.Getenv)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dbtools:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, w io.Writer, getenv func(string) string) error {
+	fs := flag.NewFlagSet("dbtools", flag.ContinueOnError)
+	fs.SetOutput(w)
+	c := config{}
+	fs.StringVar(&c.dsn, "dsn", getenv("DATABASE_URL"), "connection string, defaults to $DATABASE_URL")
+	fs.IntVar(&c.attempts, "attempts", 30, "number of attempts to reach the database")
+	fs.DurationVar(&c.delay, "delay", time.Second, "delay between the attempts")
+	fs.DurationVar(&c.timeout, "timeout", 5*time.Minute, "timeout of the command")
+	fs.StringVar(&c.dir, "dir", "migrations", "directory of the migration files")
+	fs.IntVar(&c.steps, "steps", 1, "number of the migrations to revert")
+	fs.StringVar(&c.seeds, "seeds", "seeds", "directory of the seed files")
+	fs.BoolVar(&c.truncate, "truncate", false, "truncate the tables of the CSV seed files first")
+	fs.Usage = func() {
+		fmt.Fprintln(w, "Usage: dbtools [flags] <command>")
+		fmt.Fprintln(w, "\nCommands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].usage)
+		}
+		fmt.Fprintln(w, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("%w: expected one command", errUnknownCommand)
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("%w: %q", errUnknownCommand, fs.Arg(0))
+	}
+	if c.dsn == "" {
+		return errNoDSN
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	pool, err := dbtools.NewPoolWithRetry(ctx, c.dsn, c.retry(),
+		dbtools.WithApplicationName("dbtools", fs.Arg(0)),
+	)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	return cmd.run(ctx, w, pool, c)
+}
+
+func runWait(_ context.Context, w io.Writer, _ *pgxpool.Pool, _ config) error {
+	// The pool is already reachable.
+	fmt.Fprintln(w, "database is ready")
+	return nil
+}
+
+func runSelfTest(ctx context.Context, w io.Writer, pool *pgxpool.Pool, c config) error {
+	tr, err := dbtools.New(pool, dbtools.WithRetry(c.retry()))
+	if err != nil {
+		return err
+	}
+
+	var version string
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SHOW server_version").Scan(&version)
+	})
+	if err != nil {
+		return fmt.Errorf("running a transaction: %w", err)
+	}
+	fmt.Fprintln(w, "server version:", version)
+
+	err = tr.ReadOnly().Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT 1")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("running a read only transaction: %w", err)
+	}
+	fmt.Fprintln(w, "self-test passed")
+
+	return nil
+}
+
+func newMigrator(pool *pgxpool.Pool, c config) (*migrate.Migrator, error) {
+	tr, err := dbtools.New(pool, dbtools.WithRetry(c.retry()))
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(tr, os.DirFS(c.dir))
+}
+
+func runMigrate(ctx context.Context, w io.Writer, pool *pgxpool.Pool, c config) error {
+	m, err := newMigrator(pool, c)
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx)
+	for _, mig := range applied {
+		fmt.Fprintf(w, "applied %d_%s\n", mig.Version, mig.Name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d migrations applied\n", len(applied))
+
+	return nil
+}
+
+func runRollback(ctx context.Context, w io.Writer, pool *pgxpool.Pool, c config) error {
+	m, err := newMigrator(pool, c)
+	if err != nil {
+		return err
+	}
+	reverted, err := m.Down(ctx, c.steps)
+	for _, mig := range reverted {
+		fmt.Fprintf(w, "reverted %d_%s\n", mig.Version, mig.Name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d migrations reverted\n", len(reverted))
+
+	return nil
+}
+
+func runSeed(ctx context.Context, w io.Writer, pool *pgxpool.Pool, c config) error {
+	tr, err := dbtools.New(pool, dbtools.WithRetry(c.retry()))
+	if err != nil {
+		return err
+	}
+	var opts []dbtools.SeedOption
+	if c.truncate {
+		opts = append(opts, dbtools.TruncateFirst())
+	}
+	if err := dbtools.Seed(ctx, tr, os.DirFS(c.seeds), "*", opts...); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "seed files loaded")
+
+	return nil
+}
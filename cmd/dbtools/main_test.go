@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noEnv(string) string { return "" }
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	t.Run("NoCommand", testRunNoCommand)
+	t.Run("UnknownCommand", testRunUnknownCommand)
+	t.Run("NoDSN", testRunNoDSN)
+	t.Run("BadDSN", testRunBadDSN)
+}
+
+func testRunNoCommand(t *testing.T) {
+	t.Parallel()
+	buf := &bytes.Buffer{}
+	err := run(context.Background(), nil, buf, noEnv)
+	assert.ErrorIs(t, err, errUnknownCommand)
+	assert.Contains(t, buf.String(), "self-test")
+	assert.Contains(t, buf.String(), "wait")
+	assert.Contains(t, buf.String(), "migrate")
+	assert.Contains(t, buf.String(), "rollback")
+	assert.Contains(t, buf.String(), "seed")
+}
+
+func testRunUnknownCommand(t *testing.T) {
+	t.Parallel()
+	buf := &bytes.Buffer{}
+	err := run(context.Background(), []string{"explode"}, buf, noEnv)
+	assert.ErrorIs(t, err, errUnknownCommand)
+	assert.Contains(t, err.Error(), "explode")
+}
+
+func testRunNoDSN(t *testing.T) {
+	t.Parallel()
+	err := run(context.Background(), []string{"wait"}, &bytes.Buffer{}, noEnv)
+	assert.ErrorIs(t, err, errNoDSN)
+}
+
+func testRunBadDSN(t *testing.T) {
+	t.Parallel()
+	getenv := func(string) string { return "postgres://%zz" }
+	err := run(context.Background(), []string{"-attempts", "1", "wait"}, &bytes.Buffer{}, getenv)
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package dbtools
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CommitAction is the decision of a CommitPolicy.
+type CommitAction int
+
+const (
+	// RetryCommit retries the transaction with the Classifier and the retry
+	// policy of the PGX object.
+	RetryCommit CommitAction = iota
+	// StopCommit stops retrying and returns the error of the commit.
+	StopCommit
+)
+
+// CommitPolicy decides what to do when committing a transaction fails. The
+// err wraps the ErrCommitUncertain error if the transaction might have been
+// committed. The policy can also be used for reconciling the uncertain
+// commits, for example by recording them for verification.
+type CommitPolicy func(err error) CommitAction
+
+// StopOnUncertainCommit is a CommitPolicy that stops retrying when the
+// transaction might have been committed, and retries otherwise.
+func StopOnUncertainCommit(err error) CommitAction {
+	if errors.Is(err, ErrCommitUncertain) {
+		return StopCommit
+	}
+
+	return RetryCommit
+}
+
+// commitFailed wraps the error of the commit and applies the CommitPolicy.
+func (p *PGX) commitFailed(err error) error {
+	uncertain := uncertainCommit(err)
+	err = fmt.Errorf("committing transaction: %w", err)
+	if uncertain {
+		err = fmt.Errorf("%w: %w", ErrCommitUncertain, err)
+	}
+	if p.commitPolicy != nil && p.commitPolicy(err) == StopCommit {
+		return &retry.StopError{Err: err}
+	}
+
+	return p.classify(err)
+}
+
+// uncertainCommit returns true if the err of the commit doesn't tell whether
+// the transaction was committed. When the server responds with an error, or
+// the transaction was rolled back, or the COMMIT statement was not sent, the
+// transaction is not committed.
+func uncertainCommit(err error) bool {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr), errors.Is(err, pgx.ErrTxCommitRollback),
+		errors.Is(err, pgx.ErrTxClosed), pgconn.SafeToRetry(err):
+		return false
+	}
+
+	return true
+}
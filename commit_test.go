@@ -0,0 +1,109 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// commitFailing returns a pool that fails the commits of the attempts with
+// the err.
+func commitFailing(t *testing.T, attempts int, err error) *mocks.Pool {
+	t.Helper()
+	db := mocks.NewPool(t)
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(attempts)
+	tx.On("Commit", mock.Anything).Return(err).Times(attempts)
+	return db
+}
+
+func TestOnCommitFailure(t *testing.T) {
+	t.Parallel()
+	t.Run("Default", testOnCommitFailureDefault)
+	t.Run("StopOnUncertain", testOnCommitFailureStopOnUncertain)
+	t.Run("Certain", testOnCommitFailureCertain)
+	t.Run("CommitRollback", testOnCommitFailureCommitRollback)
+	t.Run("Callback", testOnCommitFailureCallback)
+}
+
+func testOnCommitFailureDefault(t *testing.T) {
+	t.Parallel()
+	db := commitFailing(t, 3, assert.AnError)
+	tr, err := dbtools.New(db, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.ErrorIs(t, err, assert.AnError)
+	assert.ErrorIs(t, err, dbtools.ErrCommitUncertain)
+}
+
+func testOnCommitFailureStopOnUncertain(t *testing.T) {
+	t.Parallel()
+	db := commitFailing(t, 1, assert.AnError)
+	tr, err := dbtools.New(db,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.OnCommitFailure(dbtools.StopOnUncertainCommit),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.ErrorIs(t, err, assert.AnError)
+	assert.ErrorIs(t, err, dbtools.ErrCommitUncertain)
+}
+
+func testOnCommitFailureCertain(t *testing.T) {
+	t.Parallel()
+	pgErr := &pgconn.PgError{Code: "40001"}
+	db := commitFailing(t, 3, pgErr)
+	tr, err := dbtools.New(db,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.OnCommitFailure(dbtools.StopOnUncertainCommit),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.ErrorIs(t, err, pgErr)
+	assert.NotErrorIs(t, err, dbtools.ErrCommitUncertain)
+}
+
+func testOnCommitFailureCommitRollback(t *testing.T) {
+	t.Parallel()
+	db := commitFailing(t, 2, pgx.ErrTxCommitRollback)
+	tr, err := dbtools.New(db,
+		dbtools.Retry(2, time.Millisecond),
+		dbtools.OnCommitFailure(dbtools.StopOnUncertainCommit),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.ErrorIs(t, err, pgx.ErrTxCommitRollback)
+	assert.NotErrorIs(t, err, dbtools.ErrCommitUncertain)
+}
+
+func testOnCommitFailureCallback(t *testing.T) {
+	t.Parallel()
+	pgErr := &pgconn.PgError{Code: "23505"}
+	db := commitFailing(t, 1, pgErr)
+	var got []error
+	tr, err := dbtools.New(db,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.OnCommitFailure(func(err error) dbtools.CommitAction {
+			got = append(got, err)
+			return dbtools.StopCommit
+		}),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.ErrorIs(t, err, pgErr)
+	require.Len(t, got, 1)
+	assert.ErrorIs(t, got[0], pgErr)
+}
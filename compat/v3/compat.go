@@ -0,0 +1,127 @@
+// Package dbtools is a shim for the v3 API of the dbtools package that is
+// backed by the v4 implementation. Replace the github.com/arsham/dbtools/v3
+// import path with github.com/arsham/dbtools/v4/compat/v3 to gain the v4
+// behaviour, then migrate the call sites to the v4 package one by one.
+//
+// The *retry.StopError errors of the github.com/arsham/retry/v2 package,
+// which the v3 API uses, are honoured in the transaction functions.
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	retryv2 "github.com/arsham/retry/v2"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrEmptyDatabase is returned when no database connection is set.
+var ErrEmptyDatabase = dbtools.ErrEmptyDatabase
+
+// Pool is the contract for beginning a transaction with a pgxpool db
+// connection.
+type Pool = dbtools.Pool
+
+// Tx is a transaction began with sql.DB.
+type Tx = dbtools.Tx
+
+// A ConfigFunc function sets up a Transaction.
+type ConfigFunc func(*PGX)
+
+// WithRetry sets the retrier. The default retrier tries only once.
+func WithRetry(r retryv2.Retry) ConfigFunc {
+	return func(p *PGX) {
+		p.loop = retry.Retry{
+			Method:   retry.DelayMethod(r.Method),
+			Delay:    r.Delay,
+			Attempts: r.Attempts,
+		}
+	}
+}
+
+// Retry sets the retry strategy. If you want to pass a Retry object you can
+// use the WithRetry function instead.
+func Retry(attempts int, delay time.Duration) ConfigFunc {
+	return func(p *PGX) {
+		p.loop.Attempts = attempts
+		p.loop.Delay = delay
+	}
+}
+
+// GracePeriod sets the context timeout when doing a rollback. The default
+// value is 30s.
+func GracePeriod(delay time.Duration) ConfigFunc {
+	return func(p *PGX) {
+		p.gracePeriod = delay
+	}
+}
+
+// PGX is a concurrent-safe object that can retry a transaction on a
+// pgxpool.Pool connection until it succeeds. See the v4 dbtools.PGX for the
+// details.
+type PGX struct {
+	tr          *dbtools.PGX
+	loop        retry.Retry
+	gracePeriod time.Duration
+}
+
+// NewPGX returns an error if conn is nil. It sets the retry attempts to 1 if
+// the value is less than 1.
+func NewPGX(conn Pool, conf ...ConfigFunc) (*PGX, error) {
+	p := &PGX{
+		gracePeriod: 30 * time.Second,
+		loop: retry.Retry{
+			Attempts: 1,
+			Delay:    300 * time.Millisecond,
+			Method:   retry.IncrementalDelay,
+		},
+	}
+	for _, fn := range conf {
+		fn(p)
+	}
+	tr, err := dbtools.New(conn,
+		dbtools.WithRetry(p.loop),
+		dbtools.GracePeriod(p.gracePeriod),
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.tr = tr
+
+	return p, nil
+}
+
+// Transaction runs the fns in a transaction with the v4 semantics. A
+// *retry.StopError of the github.com/arsham/retry/v2 package stops the
+// retries.
+func (p *PGX) Transaction(ctx context.Context, fns ...func(pgx.Tx) error) error {
+	wrapped := make([]func(pgx.Tx) error, len(fns))
+	for i, fn := range fns {
+		if fn == nil {
+			continue
+		}
+		wrapped[i] = func(tx pgx.Tx) error {
+			return stopError(fn(tx))
+		}
+	}
+
+	return p.tr.Transaction(ctx, wrapped...)
+}
+
+// V4 returns the v4 implementation, for migrating the call sites gradually.
+func (p *PGX) V4() *dbtools.PGX {
+	return p.tr
+}
+
+// stopError converts a v2 *retry.StopError to a v3 one.
+func stopError(err error) error {
+	var stop *retryv2.StopError
+	if errors.As(err, &stop) {
+		return &retry.StopError{Err: stop.Err}
+	}
+
+	return err
+}
@@ -0,0 +1,105 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v4 "github.com/arsham/dbtools/v4"
+	dbtools "github.com/arsham/dbtools/v4/compat/v3"
+	"github.com/arsham/dbtools/v4/mocks"
+	retryv2 "github.com/arsham/retry/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPGX(t *testing.T) {
+	t.Parallel()
+	_, err := dbtools.NewPGX(nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+
+	p, err := dbtools.NewPGX(mocks.NewPool(t))
+	require.NoError(t, err)
+	assert.NotNil(t, p.V4())
+}
+
+func TestPGXTransaction(t *testing.T) {
+	t.Parallel()
+	t.Run("Retry", testPGXTransactionRetry)
+	t.Run("WithRetry", testPGXTransactionWithRetry)
+	t.Run("StopError", testPGXTransactionStopError)
+	t.Run("NilFunction", testPGXTransactionNilFunction)
+}
+
+func testPGXTransactionRetry(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	p, err := dbtools.NewPGX(db, dbtools.Retry(3, time.Millisecond), dbtools.GracePeriod(time.Second))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(3)
+	tx.On("Rollback", mock.Anything).Return(nil).Twice()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	calls := 0
+	err = p.Transaction(context.Background(), func(pgx.Tx) error {
+		calls++
+		if calls < 3 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func testPGXTransactionWithRetry(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	p, err := dbtools.NewPGX(db, dbtools.WithRetry(retryv2.Retry{
+		Attempts: 2,
+		Delay:    time.Millisecond,
+		Method:   retryv2.IncrementalDelay,
+	}))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Twice()
+	tx.On("Rollback", mock.Anything).Return(nil).Twice()
+
+	err = p.Transaction(context.Background(), func(pgx.Tx) error {
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testPGXTransactionStopError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	p, err := dbtools.NewPGX(db, dbtools.Retry(5, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	calls := 0
+	err = p.Transaction(context.Background(), func(pgx.Tx) error {
+		calls++
+		return &retryv2.StopError{Err: assert.AnError}
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, calls)
+}
+
+func testPGXTransactionNilFunction(t *testing.T) {
+	t.Parallel()
+	p, err := dbtools.NewPGX(mocks.NewPool(t))
+	require.NoError(t, err)
+
+	err = p.Transaction(context.Background(), nil)
+	assert.ErrorIs(t, err, v4.ErrNilStep)
+}
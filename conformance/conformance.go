@@ -0,0 +1,174 @@
+// Package conformance provides a test suite for the dbtools.Pool
+// implementations, for example the wrappers, shims and fakes, to make sure
+// they behave as the dbtools.PGX expects.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPool runs the suite against the pools returned by the newPool function.
+// Each test gets a new pool. The optional interfaces, like the
+// dbtools.TxBeginner and dbtools.Pinger, are tested if the pool implements
+// them. No statements are run on the pool:
+//
+//	func TestMyPool(t *testing.T) {
+//		conformance.TestPool(t, func(t *testing.T) dbtools.Pool {
+//			return mypool.New(t)
+//		})
+//	}
+func TestPool(t *testing.T, newPool func(t *testing.T) dbtools.Pool) {
+	t.Helper()
+	tcs := map[string]func(*testing.T, dbtools.Pool){
+		"Begin":               testBegin,
+		"CommitTwice":         testCommitTwice,
+		"RollbackTwice":       testRollbackTwice,
+		"RollbackAfterCommit": testRollbackAfterCommit,
+		"CommitAfterRollback": testCommitAfterRollback,
+		"Nested":              testNested,
+		"BeginTx":             testBeginTx,
+		"Ping":                testPing,
+		"TransactionCommit":   testTransactionCommit,
+		"TransactionError":    testTransactionError,
+		"TransactionPanic":    testTransactionPanic,
+		"TransactionRetry":    testTransactionRetry,
+	}
+	for name, fn := range tcs {
+		t.Run(name, func(t *testing.T) {
+			fn(t, newPool(t))
+		})
+	}
+}
+
+func begin(t *testing.T, pool dbtools.Pool) pgx.Tx {
+	t.Helper()
+	tx, err := pool.Begin(context.Background())
+	require.NoError(t, err, "Begin")
+	require.NotNil(t, tx, "Begin should return a transaction")
+	return tx
+}
+
+func testBegin(t *testing.T, pool dbtools.Pool) {
+	tx := begin(t, pool)
+	assert.NoError(t, tx.Rollback(context.Background()))
+}
+
+func testCommitTwice(t *testing.T, pool dbtools.Pool) {
+	ctx := context.Background()
+	tx := begin(t, pool)
+	require.NoError(t, tx.Commit(ctx))
+	err := tx.Commit(ctx)
+	assert.ErrorIs(t, err, pgx.ErrTxClosed, "committing a closed transaction")
+}
+
+func testRollbackTwice(t *testing.T, pool dbtools.Pool) {
+	ctx := context.Background()
+	tx := begin(t, pool)
+	require.NoError(t, tx.Rollback(ctx))
+	err := tx.Rollback(ctx)
+	assert.ErrorIs(t, err, pgx.ErrTxClosed, "rolling back a closed transaction")
+}
+
+func testRollbackAfterCommit(t *testing.T, pool dbtools.Pool) {
+	ctx := context.Background()
+	tx := begin(t, pool)
+	require.NoError(t, tx.Commit(ctx))
+	err := tx.Rollback(ctx)
+	assert.ErrorIs(t, err, pgx.ErrTxClosed, "rolling back a committed transaction")
+}
+
+func testCommitAfterRollback(t *testing.T, pool dbtools.Pool) {
+	ctx := context.Background()
+	tx := begin(t, pool)
+	require.NoError(t, tx.Rollback(ctx))
+	err := tx.Commit(ctx)
+	assert.Error(t, err, "committing a rolled back transaction")
+}
+
+func testNested(t *testing.T, pool dbtools.Pool) {
+	ctx := context.Background()
+	tx := begin(t, pool)
+	nested, err := tx.Begin(ctx)
+	require.NoError(t, err, "Begin on the transaction")
+	require.NotNil(t, nested)
+	require.NoError(t, nested.Commit(ctx), "committing the nested transaction")
+	assert.NoError(t, tx.Commit(ctx), "the outer transaction should stay open")
+}
+
+func testBeginTx(t *testing.T, pool dbtools.Pool) {
+	b, ok := pool.(dbtools.TxBeginner)
+	if !ok {
+		t.Skip("pool does not implement dbtools.TxBeginner")
+	}
+	ctx := context.Background()
+	tx, err := b.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	require.NoError(t, err)
+	require.NotNil(t, tx)
+	assert.NoError(t, tx.Commit(ctx))
+}
+
+func testPing(t *testing.T, pool dbtools.Pool) {
+	p, ok := pool.(dbtools.Pinger)
+	if !ok {
+		t.Skip("pool does not implement dbtools.Pinger")
+	}
+	assert.NoError(t, p.Ping(context.Background()))
+}
+
+func testTransactionCommit(t *testing.T, pool dbtools.Pool) {
+	tr, err := dbtools.New(pool, dbtools.Retry(1, time.Millisecond))
+	require.NoError(t, err)
+	calls := 0
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		calls++
+		assert.NotNil(t, tx)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func testTransactionError(t *testing.T, pool dbtools.Pool) {
+	tr, err := dbtools.New(pool, dbtools.Retry(1, time.Millisecond))
+	require.NoError(t, err)
+	want := errors.New("conformance error")
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		return want
+	})
+	assert.ErrorIs(t, err, want)
+}
+
+func testTransactionPanic(t *testing.T, pool dbtools.Pool) {
+	tr, err := dbtools.New(pool, dbtools.Retry(1, time.Millisecond))
+	require.NoError(t, err)
+	assert.NotPanics(t, func() {
+		err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+			panic("conformance panic")
+		})
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "conformance panic")
+}
+
+func testTransactionRetry(t *testing.T, pool dbtools.Pool) {
+	tr, err := dbtools.New(pool, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+	seen := make(map[pgx.Tx]struct{})
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		seen[tx] = struct{}{}
+		if len(seen) < 3 {
+			return errors.New("conformance retry")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, seen, 3, "each attempt should get a new transaction")
+}
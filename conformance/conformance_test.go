@@ -0,0 +1,16 @@
+package conformance_test
+
+import (
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/conformance"
+	"github.com/arsham/dbtools/v4/dbtesting"
+)
+
+func TestSimulator(t *testing.T) {
+	t.Parallel()
+	conformance.TestPool(t, func(*testing.T) dbtools.Pool {
+		return dbtesting.NewSimulator()
+	})
+}
@@ -0,0 +1,175 @@
+package dbtools
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// NewFromConn returns a PGX that runs the transactions and queries on a
+// single connection, for example a *pgx.Conn in a CLI tool or a migration,
+// with the same retry and rollback behaviour as a pool. Since a connection
+// can't be used concurrently, the transactions and queries are serialised:
+// the connection is held from the beginning of a transaction until it is
+// committed or rolled back, and by the rows until they are closed. It returns
+// an ErrEmptyDatabase error if conn is nil.
+func NewFromConn(conn Conn, conf ...ConfigFunc) (*PGX, error) {
+	if conn == nil {
+		return nil, ErrEmptyDatabase
+	}
+
+	return New(newConnPool(conn), conf...)
+}
+
+// connPool serialises the access to a single connection. The sem is used
+// instead of a mutex so the callers can give up when their context is done.
+type connPool struct {
+	conn Conn
+	sem  chan struct{}
+}
+
+func newConnPool(conn Conn) *connPool {
+	return &connPool{
+		conn: conn,
+		sem:  make(chan struct{}, 1),
+	}
+}
+
+// acquire returns a function that releases the connection. The returned
+// function can be called more than once.
+func (c *connPool) acquire(ctx context.Context) (func(), error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, withCause(ctx, ctx.Err())
+	}
+
+	return sync.OnceFunc(func() { <-c.sem }), nil
+}
+
+// Begin starts a transaction and holds the connection until the transaction
+// is finished.
+func (c *connPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	return c.begin(ctx, c.conn.Begin)
+}
+
+// BeginTx starts a transaction with the txOptions and holds the connection
+// until the transaction is finished.
+func (c *connPool) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	return c.begin(ctx, func(ctx context.Context) (pgx.Tx, error) {
+		return c.conn.BeginTx(ctx, txOptions)
+	})
+}
+
+func (c *connPool) begin(ctx context.Context, fn func(context.Context) (pgx.Tx, error)) (pgx.Tx, error) {
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := fn(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return &connTx{Tx: tx, release: release}, nil
+}
+
+// Ping checks the connection is alive.
+func (c *connPool) Ping(ctx context.Context) error {
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return c.conn.Ping(ctx)
+}
+
+// Exec runs the query on the connection.
+func (c *connPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer release()
+
+	return c.conn.Exec(ctx, sql, args...)
+}
+
+// Query runs the query on the connection and holds the connection until the
+// rows are closed.
+func (c *connPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.conn.Query(ctx, sql, args...)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return &connRows{Rows: rows, release: release}, nil
+}
+
+// QueryRow runs the query on the connection and holds the connection until
+// the row is scanned.
+func (c *connPool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+
+	return &connRow{Row: c.conn.QueryRow(ctx, sql, args...), release: release}
+}
+
+// connTx releases the connection when the transaction is committed or rolled
+// back. The transaction is closed after a failed commit too.
+type connTx struct {
+	pgx.Tx
+	release func()
+}
+
+func (t *connTx) Commit(ctx context.Context) error {
+	defer t.release()
+	return t.Tx.Commit(ctx)
+}
+
+func (t *connTx) Rollback(ctx context.Context) error {
+	defer t.release()
+	return t.Tx.Rollback(ctx)
+}
+
+// connRows releases the connection when the rows are closed, which happens
+// when Next returns false too.
+type connRows struct {
+	pgx.Rows
+	release func()
+}
+
+func (r *connRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.release()
+
+	return false
+}
+
+func (r *connRows) Close() {
+	r.Rows.Close()
+	r.release()
+}
+
+type connRow struct {
+	pgx.Row
+	release func()
+}
+
+func (r *connRow) Scan(dest ...any) error {
+	defer r.release()
+	return r.Row.Scan(dest...)
+}
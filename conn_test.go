@@ -0,0 +1,179 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromConn(t *testing.T) {
+	t.Parallel()
+	t.Run("NilConn", testNewFromConnNilConn)
+	t.Run("Retry", testNewFromConnRetry)
+	t.Run("Serialised", testNewFromConnSerialised)
+	t.Run("Rows", testNewFromConnRows)
+	t.Run("Row", testNewFromConnRow)
+	t.Run("BeginError", testNewFromConnBeginError)
+	t.Run("Integration", testNewFromConnIntegration)
+}
+
+func testNewFromConnNilConn(t *testing.T) {
+	t.Parallel()
+	_, err := dbtools.NewFromConn(nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func testNewFromConnRetry(t *testing.T) {
+	t.Parallel()
+	conn := mocks.NewConn(t)
+	tr, err := dbtools.NewFromConn(conn, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	conn.On("Begin", mock.Anything).Return(tx, nil).Twice()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	calls := 0
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		calls++
+		if calls == 1 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	conn.On("Exec", mock.Anything, "SELECT 1").Return(pgconn.CommandTag{}, nil).Once()
+	_, err = tr.Exec(context.Background(), "SELECT 1")
+	assert.NoError(t, err, "connection should be released")
+}
+
+func testNewFromConnSerialised(t *testing.T) {
+	t.Parallel()
+	conn := mocks.NewConn(t)
+	tr, err := dbtools.NewFromConn(conn)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	conn.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err := tr.Exec(ctx, "SELECT 1")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		return nil
+	})
+	require.NoError(t, err)
+
+	conn.On("Exec", mock.Anything, "SELECT 1").Return(pgconn.CommandTag{}, nil).Once()
+	_, err = tr.Exec(ctx, "SELECT 1")
+	assert.NoError(t, err)
+}
+
+func testNewFromConnRows(t *testing.T) {
+	t.Parallel()
+	conn := mocks.NewConn(t)
+	tr, err := dbtools.NewFromConn(conn)
+	require.NoError(t, err)
+
+	rows := mocks.NewPGXRows(t)
+	conn.On("Query", mock.Anything, "SELECT 1").Return(rows, nil).Once()
+	rows.On("Next").Return(false).Once()
+	rows.On("Close").Return().Once()
+	rows.On("Err").Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Query(ctx, func(pgx.Rows) error { return nil }, "SELECT 1")
+	require.NoError(t, err)
+
+	conn.On("Exec", mock.Anything, "SELECT 1").Return(pgconn.CommandTag{}, nil).Once()
+	_, err = tr.Exec(ctx, "SELECT 1")
+	assert.NoError(t, err, "connection should be released")
+}
+
+func testNewFromConnRow(t *testing.T) {
+	t.Parallel()
+	conn := mocks.NewConn(t)
+	tr, err := dbtools.NewFromConn(conn)
+	require.NoError(t, err)
+
+	row := mocks.NewPGXRow(t)
+	conn.On("QueryRow", mock.Anything, "SELECT 1").Return(row).Once()
+	row.On("Scan", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.QueryRow(ctx, func(row pgx.Row) error {
+		var i int
+		return row.Scan(&i)
+	}, "SELECT 1")
+	require.NoError(t, err)
+
+	conn.On("Exec", mock.Anything, "SELECT 1").Return(pgconn.CommandTag{}, nil).Once()
+	_, err = tr.Exec(ctx, "SELECT 1")
+	assert.NoError(t, err, "connection should be released")
+}
+
+func testNewFromConnBeginError(t *testing.T) {
+	t.Parallel()
+	conn := mocks.NewConn(t)
+	tr, err := dbtools.NewFromConn(conn, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	conn.On("Begin", mock.Anything).Return(nil, assert.AnError).Once()
+	conn.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+}
+
+func testNewFromConnIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow test")
+	}
+	t.Parallel()
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getDB(t))
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+
+	tr, err := dbtools.NewFromConn(conn, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	_, err = tr.Exec(ctx, "CREATE TABLE conn_test (id INT)")
+	require.NoError(t, err)
+
+	calls := 0
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		calls++
+		if _, err := tx.Exec(ctx, "INSERT INTO conn_test VALUES (1)"); err != nil {
+			return err
+		}
+		if calls == 1 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	var count int
+	err = tr.QueryRow(ctx, func(row pgx.Row) error {
+		return row.Scan(&count)
+	}, "SELECT count(*) FROM conn_test")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -6,14 +6,157 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/arsham/retry/v3"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
-// ErrEmptyDatabase is returned when no database connection is set.
-var ErrEmptyDatabase = errors.New("no database connection is set")
+var (
+	// ErrEmptyDatabase is returned when no database connection is set.
+	ErrEmptyDatabase = errors.New("no database connection is set")
+
+	// ErrNoSteps is returned when a StepList without any steps is run.
+	ErrNoSteps = errors.New("no steps to run")
+
+	// ErrNilStep is returned when a transaction function is nil.
+	ErrNilStep = errors.New("nil step function")
+
+	// ErrDuplicateStep is returned when two steps in a StepList have the same
+	// name.
+	ErrDuplicateStep = errors.New("duplicate step name")
+
+	// ErrNoQuerier is returned when the pool does not implement the Querier
+	// interface for running queries outside of a transaction.
+	ErrNoQuerier = errors.New("pool does not support running queries")
+
+	// ErrNoTxBeginner is returned when transaction options are set but the
+	// pool does not implement the TxBeginner interface.
+	ErrNoTxBeginner = errors.New("pool does not support transaction options")
+
+	// ErrUnknownPreset is returned when the requested preset is not
+	// registered.
+	ErrUnknownPreset = errors.New("unknown preset")
+
+	// ErrSchemaVersion is returned when the database schema is older than the
+	// expected version.
+	ErrSchemaVersion = errors.New("database schema is not migrated")
+
+	// ErrNoSchemaVersion is returned when the schema version is verified
+	// without being configured.
+	ErrNoSchemaVersion = errors.New("schema version is not configured")
+
+	// ErrQuotaExceeded is returned when a transaction runs more statements or
+	// writes more rows than the configured quota.
+	ErrQuotaExceeded = errors.New("transaction quota exceeded")
+
+	// ErrLockNotAcquired is returned when an advisory lock is held by another
+	// session.
+	ErrLockNotAcquired = errors.New("advisory lock not acquired")
+
+	// ErrSavepointLeak is returned when a transaction is about to be committed
+	// with savepoints that are not released.
+	ErrSavepointLeak = errors.New("savepoints not released")
+
+	// ErrReadOnly is returned when a write query is run with a ReadOnlyPGX.
+	ErrReadOnly = errors.New("write query on a read only handle")
+
+	// ErrUnknownManager is returned when the requested name is not registered
+	// in the Registry.
+	ErrUnknownManager = errors.New("unknown manager")
+
+	// ErrDuplicateManager is returned when a name is registered twice in the
+	// Registry.
+	ErrDuplicateManager = errors.New("duplicate manager name")
+
+	// ErrInvalidBinding is returned when the Bind function can't bind the
+	// methods to the functions.
+	ErrInvalidBinding = errors.New("invalid binding")
+
+	// ErrResultTooLarge is returned when a query returns more rows or bytes
+	// than the configured limits.
+	ErrResultTooLarge = errors.New("result set too large")
+
+	// ErrNoAttemptScope is returned when a cleanup function is registered
+	// with a transaction that is not started by the PGX.
+	ErrNoAttemptScope = errors.New("transaction has no attempt scope")
+
+	// ErrCommitUncertain is returned when committing a transaction fails in a
+	// way that the transaction might have been committed, for example when
+	// the connection is lost after the COMMIT statement is sent.
+	ErrCommitUncertain = errors.New("transaction might have been committed")
+
+	// ErrRetryBudgetExhausted is returned when a call stops retrying because
+	// the retry Budget is empty. It wraps the error of the last attempt.
+	ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+	// ErrInvalidBudget is returned by the NewBudget function when the retries
+	// or the window is not positive.
+	ErrInvalidBudget = errors.New("invalid retry budget")
+
+	// ErrInvalidAttempts is returned by the New function when the
+	// StrictConfig option is set and the retry attempts are less than 1.
+	ErrInvalidAttempts = errors.New("invalid retry attempts")
+
+	// ErrInvalidDelay is returned by the New function when the StrictConfig
+	// option is set and the retry delay is negative.
+	ErrInvalidDelay = errors.New("invalid retry delay")
+
+	// ErrInvalidGracePeriod is returned by the New function when the
+	// StrictConfig option is set and the grace period is not positive.
+	ErrInvalidGracePeriod = errors.New("invalid grace period")
+
+	// ErrInvalidLockTimeout is returned by the New function when the
+	// StrictConfig option is set and the max of the EscalateLockTimeout
+	// option is less than the first timeout.
+	ErrInvalidLockTimeout = errors.New("invalid lock timeout")
+
+	// ErrTransactionTooOld is returned when a statement is run in an attempt
+	// that has been running for longer than the MaxTransactionAge.
+	ErrTransactionTooOld = errors.New("transaction is too old")
+
+	// ErrInvalidCursor is returned when a pagination cursor can't be decoded,
+	// or its signature doesn't match.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrTransactionKilled is returned when the backend of a transaction is
+	// cancelled or terminated by the Watchdog.
+	ErrTransactionKilled = errors.New("transaction killed by the watchdog")
+
+	// ErrInvalidUpsert is returned by the Upsert function when the columns
+	// or the rows don't match.
+	ErrInvalidUpsert = errors.New("invalid upsert")
+
+	// ErrInvalidChunkSize is returned by the RunChunks function when the
+	// chunk size is less than 1.
+	ErrInvalidChunkSize = errors.New("invalid chunk size")
+
+	// ErrInvalidPageSize is returned by the Pager when the page size is less
+	// than 1.
+	ErrInvalidPageSize = errors.New("invalid page size")
+
+	// ErrNoSeedFiles is returned by the Seed function when the glob doesn't
+	// match any files.
+	ErrNoSeedFiles = errors.New("no seed files")
+
+	// ErrInvalidInvalidator is returned when creating an Invalidator without
+	// a channel or a handler.
+	ErrInvalidInvalidator = errors.New("invalid invalidator")
+)
+
+// Transactioner is the contract for running functions in a transaction. The
+// *PGX and the *ReadOnlyPGX satisfy this interface. Depend on this interface
+// in your code and use the mocks.Transactioner in the tests.
+//
+//go:generate mockery --name Transactioner --filename transactioner_mock.go
+type Transactioner interface {
+	Transaction(ctx context.Context, fns ...func(pgx.Tx) error) error
+}
 
 // Pool is the contract for beginning a transaction with a pgxpool db
 // connection.
@@ -23,12 +166,67 @@ type Pool interface {
 	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
+// TxBeginner is the contract for beginning a transaction with options. The
+// *pgxpool.Pool satisfies this interface.
+//
+//go:generate mockery --name TxBeginner --filename tx_beginner_mock.go
+type TxBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// Pinger is the contract for checking the database is reachable. The
+// *pgxpool.Pool satisfies this interface.
+//
+//go:generate mockery --name Pinger --filename pinger_mock.go
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Querier is the contract for running queries without a transaction. The
+// *pgxpool.Pool satisfies this interface.
+//
+//go:generate mockery --name Querier --filename querier_mock.go
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Conn is the contract for a single database connection. The *pgx.Conn
+// satisfies this interface.
+//
+//go:generate mockery --name Conn --filename conn_mock.go
+type Conn interface {
+	Pool
+	TxBeginner
+	Pinger
+	Querier
+}
+
 //nolint:unused,deadcode // only used for mocking.
 //go:generate mockery --name pgxTx --filename pgx_tx_mock.go --structname PGXTx
 type pgxTx interface {
 	pgx.Tx
 }
 
+//nolint:unused,deadcode // only used for mocking.
+//go:generate mockery --name batchResults --filename batch_results_mock.go --structname BatchResults
+type batchResults interface {
+	pgx.BatchResults
+}
+
+//nolint:unused,deadcode // only used for mocking.
+//go:generate mockery --name pgxRows --filename pgx_rows_mock.go --structname PGXRows
+type pgxRows interface {
+	pgx.Rows
+}
+
+//nolint:unused,deadcode // only used for mocking.
+//go:generate mockery --name pgxRow --filename pgx_row_mock.go --structname PGXRow
+type pgxRow interface {
+	pgx.Row
+}
+
 // Tx is a transaction began with sql.DB.
 //
 //go:generate mockery --name Tx --filename tx_mock.go
@@ -57,6 +255,46 @@ func WithRetry(r retry.Retry) ConfigFunc {
 	}
 }
 
+// WithRetrier replaces the retry engine with the r. The retry strategy of the
+// PGX object, the KindRetry, DeadlockBackoff, NoDelay, OnDelay and
+// WithSleeper options, and the WithCallRetry function have no effect when a
+// Retrier is set, as the r decides the attempts and the delays. A nil r
+// restores the default engine.
+func WithRetrier(r Retrier) ConfigFunc {
+	return func(p *PGX) {
+		p.retrier = r
+	}
+}
+
+// NoDelay skips the delays between the attempts, while keeping the number of
+// the attempts. It is meant for the tests that exercise the retries, which
+// otherwise wait for the delays. Use it with the OnDelay option to assert on
+// the delays that would have been waited.
+func NoDelay() ConfigFunc {
+	return func(p *PGX) {
+		p.noDelay = true
+	}
+}
+
+// OnDelay calls the fn with the attempt number and the delay after each
+// failed attempt, before the delay is waited. The fn is called synchronously.
+func OnDelay(fn func(attempt int, d time.Duration)) ConfigFunc {
+	return func(p *PGX) {
+		p.onDelay = fn
+	}
+}
+
+// WithSleeper waits the delays between the attempts with the fn instead of the
+// time.Sleep function, for example to use the virtual time of a simulation,
+// or a sleeper that is shared with the rest of the platform. The fn receives
+// the context of the call, and when it returns an error the retries are
+// stopped and the error is returned.
+func WithSleeper(fn func(ctx context.Context, d time.Duration) error) ConfigFunc {
+	return func(p *PGX) {
+		p.sleeper = fn
+	}
+}
+
 // Retry sets the retry strategy. If you want to pass a Retry object you can
 // use the WithRetry function instead.
 func Retry(attempts int, delay time.Duration) ConfigFunc {
@@ -68,9 +306,497 @@ func Retry(attempts int, delay time.Duration) ConfigFunc {
 
 // GracePeriod sets the context timeout when doing a rollback. This context
 // needs to be different from the context user is giving as the user's context
-// might be cancelled. The default value is 30s.
+// might be cancelled. The default value is 30s. It can be overridden for a
+// call with the WithGracePeriod function.
 func GracePeriod(delay time.Duration) ConfigFunc {
 	return func(p *PGX) {
 		p.gracePeriod = delay
 	}
 }
+
+// TxOptions sets the options used for beginning transactions, for example the
+// isolation level or the access mode. The pool should implement the
+// TxBeginner interface, otherwise the transactions return an ErrNoTxBeginner
+// error.
+func TxOptions(opts pgx.TxOptions) ConfigFunc {
+	return func(p *PGX) {
+		p.txOptions = &opts
+	}
+}
+
+// Label sets a label that is added to the errors returned from the
+// transactions.
+func Label(name string) ConfigFunc {
+	return func(p *PGX) {
+		p.label = name
+	}
+}
+
+// WithPreset registers a named set of configurations. The PGX.Preset method
+// returns a copy of the PGX object with these configurations applied. This
+// way the common transaction shapes can be defined once:
+//
+//	tr, err := dbtools.New(pool,
+//		dbtools.WithPreset("critical-write",
+//			dbtools.Retry(20, time.Second),
+//			dbtools.TxOptions(pgx.TxOptions{IsoLevel: pgx.Serializable}),
+//			dbtools.Label("critical-write"),
+//		),
+//	)
+//	// ...
+//	p, err := tr.Preset("critical-write")
+func WithPreset(name string, conf ...ConfigFunc) ConfigFunc {
+	return func(p *PGX) {
+		presets := make(map[string][]ConfigFunc, len(p.presets)+1)
+		for k, v := range p.presets {
+			presets[k] = v
+		}
+		presets[name] = conf
+		p.presets = presets
+	}
+}
+
+// SchemaVersion sets the table and the column that hold the applied migration
+// versions, and the minimum version the application expects. The
+// PGX.VerifySchema method uses this information to check the database is
+// migrated. For example for the golang-migrate library:
+//
+//	dbtools.SchemaVersion(pgx.Identifier{"schema_migrations"}, "version", 42)
+func SchemaVersion(table pgx.Identifier, column string, want int64) ConfigFunc {
+	return func(p *PGX) {
+		p.schema = &schemaVersion{
+			table:  table,
+			column: column,
+			want:   want,
+		}
+	}
+}
+
+// WithClassifier sets the Classifier that decides which errors are retried.
+// By default all errors are retried, except the *retry.StopError errors.
+func WithClassifier(c Classifier) ConfigFunc {
+	return func(p *PGX) {
+		p.classifier = c
+	}
+}
+
+// ForeignTables prepares the PGX for transactions that touch foreign tables
+// via the postgres_fdw extension. It chains the FDWClassifier in front of the
+// current Classifier, therefore you should set this option after the
+// WithClassifier option. If any tables are given, on each attempt a probe
+// query is made on each of them before running the functions to verify the
+// remote servers are reachable.
+func ForeignTables(probes ...pgx.Identifier) ConfigFunc {
+	return func(p *PGX) {
+		p.classifier = FDWClassifier(p.classifier)
+		p.probes = append(p.probes[:len(p.probes):len(p.probes)], probes...)
+	}
+}
+
+// Replicas sets the replica pools. Transactions with the pgx.ReadOnly access
+// mode are routed to the replicas in a round-robin fashion, and the rest of
+// the transactions go to the primary pool. See the NewWithReplicas function
+// for more information.
+func Replicas(pools ...Pool) ConfigFunc {
+	return func(p *PGX) {
+		if len(pools) == 0 {
+			p.replicas = nil
+			return
+		}
+		fallback := false
+		if p.replicas != nil {
+			fallback = p.replicas.fallback
+		}
+		p.replicas = &replicaSet{
+			pools:    pools,
+			next:     new(atomic.Uint64),
+			fallback: fallback,
+		}
+	}
+}
+
+// ReplicaFallback sets whether the read-only transactions should go to the
+// primary pool when none of the replicas are reachable. It should be set after
+// the Replicas option.
+func ReplicaFallback(fallback bool) ConfigFunc {
+	return func(p *PGX) {
+		if p.replicas != nil {
+			r := *p.replicas
+			r.fallback = fallback
+			p.replicas = &r
+		}
+	}
+}
+
+// SetLocal sets the run-time parameter to the value at the beginning of each
+// transaction with the SET LOCAL semantics, therefore the value is reset when
+// the transaction ends.
+func SetLocal(name, value string) ConfigFunc {
+	return func(p *PGX) {
+		p.locals = append(p.locals[:len(p.locals):len(p.locals)], localSetting{
+			name:  name,
+			value: value,
+		})
+	}
+}
+
+// ApplicationName sets the application_name for the duration of each
+// transaction, which is visible in the pg_stat_activity view.
+func ApplicationName(name string) ConfigFunc {
+	return SetLocal("application_name", name)
+}
+
+// Labels sets each label as the "dbtools.<key>" run-time parameter for the
+// duration of each transaction, therefore they can be inspected on the server
+// with the current_setting function.
+func Labels(labels map[string]string) ConfigFunc {
+	return func(p *PGX) {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			SetLocal(labelPrefix+k, labels[k])(p)
+		}
+	}
+}
+
+// StatementQuota sets the maximum number of statements each attempt of a
+// transaction may run. Each query of a batch is counted as one statement.
+// When the quota is exceeded the statement is not run, and the transaction is
+// rolled back and stopped with an ErrQuotaExceeded error. Zero means no limit.
+func StatementQuota(n int) ConfigFunc {
+	return func(p *PGX) {
+		q := p.quotaCopy()
+		q.statements = n
+		p.quota = q
+	}
+}
+
+// RowQuota sets the maximum number of rows each attempt of a transaction may
+// write with the INSERT, UPDATE, DELETE, MERGE and COPY statements. When the
+// quota is exceeded the transaction is rolled back and stopped with an
+// ErrQuotaExceeded error. Zero means no limit.
+func RowQuota(n int64) ConfigFunc {
+	return func(p *PGX) {
+		q := p.quotaCopy()
+		q.rows = n
+		p.quota = q
+	}
+}
+
+// TenantSetting sets the name of the run-time parameter that holds the tenant
+// ID set with the WithTenant function. The default value is "app.tenant_id".
+func TenantSetting(name string) ConfigFunc {
+	return func(p *PGX) {
+		p.tenantSetting = name
+	}
+}
+
+// FailOnSavepointLeak stops the transaction with an ErrSavepointLeak error if
+// the SAVEPOINT statements run by the functions are not released by the time
+// of committing. The transaction is rolled back and is not retried. Leaked
+// savepoints are costly in long transactions.
+func FailOnSavepointLeak() ConfigFunc {
+	return func(p *PGX) {
+		p.savepoints = &savepointCheck{}
+	}
+}
+
+// WarnOnSavepointLeak calls the warn function with the names of the
+// savepoints that are not released by the time of committing. The transaction
+// is committed anyway.
+func WarnOnSavepointLeak(warn func(names []string)) ConfigFunc {
+	return func(p *PGX) {
+		p.savepoints = &savepointCheck{warn: warn}
+	}
+}
+
+// WithMetrics reports the attempts and the transactions to the m. The
+// queries that run with the Exec, Query and QueryRow methods are reported as
+// transactions too. Use the Label option to break down the measurements by
+// the business operation.
+func WithMetrics(m Metrics) ConfigFunc {
+	return func(p *PGX) {
+		p.metrics = m
+	}
+}
+
+// CaptureSQL records every statement that runs through the transactions and
+// the query helpers in the c, with the call site. This is meant for tests and
+// development.
+func CaptureSQL(c *SQLCapture) ConfigFunc {
+	return func(p *PGX) {
+		p.sqlCapture = c
+	}
+}
+
+// Checkpoint runs each function of the Transaction method, or each step of a
+// StepList, in its own transaction. When an attempt fails, the next attempt
+// resumes from the failed function, therefore the functions that are already
+// committed are not run again. If the commit of a function fails, that
+// function is run again as it is not known whether it was committed.
+//
+// The done function, if not nil, is called with the index of each function
+// after it is committed, so the progress can be persisted.
+func Checkpoint(done func(index int)) ConfigFunc {
+	return func(p *PGX) {
+		p.checkpoint = &checkpoint{done: done}
+	}
+}
+
+// WarmUp runs the statements at the start of every attempt, after the local
+// run-time parameters are set and before the functions are called. This is
+// useful for the session setup that is needed in every transaction, for
+// example setting the search_path. The failures are retried as the failures
+// of starting the transaction.
+func WarmUp(statements ...string) ConfigFunc {
+	return func(p *PGX) {
+		p.warmUp = append(p.warmUp[:len(p.warmUp):len(p.warmUp)], statements...)
+	}
+}
+
+// MaxResultRows limits the number of rows the Query method reads. When the
+// limit is exceeded, the query is stopped with an ErrResultTooLarge error and
+// is not retried. It can be overridden for a call with the WithResultLimit
+// function.
+func MaxResultRows(n int64) ConfigFunc {
+	return func(p *PGX) {
+		p.results.rows = n
+	}
+}
+
+// MaxResultBytes limits the size of the raw values the Query method reads.
+// When the limit is exceeded, the query is stopped with an ErrResultTooLarge
+// error and is not retried. It can be overridden for a call with the
+// WithResultLimit function.
+func MaxResultBytes(n int64) ConfigFunc {
+	return func(p *PGX) {
+		p.results.bytes = n
+	}
+}
+
+// AuditUnboundedReads calls the report function for each SELECT statement
+// that reads any of the tables without a WHERE or a LIMIT clause. Both the
+// statements of the transactions and the query helpers are checked. This is
+// meant for development and tests, where the report function can fail the
+// test:
+//
+//	dbtools.AuditUnboundedReads(func(r dbtools.UnboundedRead) {
+//		t.Errorf("unbounded read on %s at %s: %s", r.Table, r.Caller, r.SQL)
+//	}, "events", "audit_log")
+//
+// The table names can be qualified with the schema name.
+func AuditUnboundedReads(report func(UnboundedRead), tables ...string) ConfigFunc {
+	return func(p *PGX) {
+		a := &unboundedAudit{
+			tables: make(map[string]struct{}, len(tables)),
+			report: report,
+		}
+		for _, t := range tables {
+			a.tables[strings.ToLower(t)] = struct{}{}
+		}
+		p.unbounded = a
+	}
+}
+
+// TraceQueries annotates the context of the statements that are run in the
+// transactions with a TxInfo, and calls the tracers around them. The tracers
+// receive the annotated context, and so do the tracers that are configured on
+// the pool, where the TxInfoFromContext function returns the transaction ID
+// and the attempt number:
+//
+//	func (t *logTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+//		if info, ok := dbtools.TxInfoFromContext(ctx); ok {
+//			t.log.Info("query", "sql", data.SQL, "tx", info.ID, "attempt", info.Attempt)
+//		}
+//		return ctx
+//	}
+//
+// The internal statements of the features, for example the SET LOCAL
+// statements, are not traced.
+func TraceQueries(tracers ...pgx.QueryTracer) ConfigFunc {
+	return func(p *PGX) {
+		p.tracer = &queryTracer{tracers: slices.Clone(tracers)}
+	}
+}
+
+// OnCommitFailure sets the policy that decides whether the transaction is
+// retried when committing it fails. The policy receives the error of the
+// commit, which wraps the ErrCommitUncertain error when the outcome of the
+// commit is unknown. By default the commit errors are retried like any other
+// error, which might run the side effects of a committed transaction twice.
+// The StopOnUncertainCommit policy stops retrying in that case:
+//
+//	dbtools.OnCommitFailure(dbtools.StopOnUncertainCommit)
+func OnCommitFailure(policy CommitPolicy) ConfigFunc {
+	return func(p *PGX) {
+		p.commitPolicy = policy
+	}
+}
+
+// DeadlockBackoff sets the delay after the attempts that fail with a deadlock
+// or a serialization failure to an exponential backoff with full jitter: a
+// random delay between zero and base * 2^(attempt-1), capped at the max. The
+// other errors are delayed with the retry strategy. The random delays stop
+// the competing transactions from retrying at the same time and conflicting
+// again:
+//
+//	dbtools.DeadlockBackoff(10*time.Millisecond, time.Second)
+func DeadlockBackoff(base, maxDelay time.Duration) ConfigFunc {
+	return func(p *PGX) {
+		p.conflicts = &conflictBackoff{base: base, max: maxDelay}
+	}
+}
+
+// WithBudget limits the retries of the transactions and the queries with the
+// b. The b can be shared between several PGX instances. When the budget is
+// empty the calls return the error of their last attempt, wrapped with the
+// ErrRetryBudgetExhausted error, instead of retrying:
+//
+//	budget, err := dbtools.NewBudget(100, time.Minute)
+//	users, err := dbtools.New(pool, dbtools.WithBudget(budget))
+//	orders, err := dbtools.New(pool, dbtools.WithBudget(budget))
+func WithBudget(b *Budget) ConfigFunc {
+	return func(p *PGX) {
+		p.budget = b
+	}
+}
+
+// StrictConfig makes the New function validate the configuration instead of
+// correcting it. For example with this option the Retry(0, time.Second)
+// returns an ErrInvalidAttempts error instead of trying once, and the
+// GracePeriod(0) returns an ErrInvalidGracePeriod error, so the
+// misconfigurations are caught when the service starts. The copies made with
+// the Preset and the With methods are validated too.
+func StrictConfig() ConfigFunc {
+	return func(p *PGX) {
+		p.strict = true
+	}
+}
+
+// SoftLimits reports the guardrails that exceed the limits to the warn
+// function, without stopping the transactions or the queries. Set them lower
+// than the hard limits, for example the StatementQuota, the MaxResultRows and
+// the MaxTransactionAge, or without the hard limits to roll a guardrail out
+// observationally before enforcing it:
+//
+//	dbtools.SoftLimits(dbtools.Limits{
+//		Statements: 50,
+//		Age:        time.Second,
+//	}, func(w dbtools.LimitWarning) {
+//		log.Printf("%s exceeded %s: %d > %d", w.Label, w.Limit, w.Value, w.Soft)
+//	}),
+//	dbtools.StatementQuota(100),
+//
+// Each limit is reported once per attempt of a transaction, and once per
+// attempt of a Query call. A nil warn function removes the soft limits.
+func SoftLimits(limits Limits, warn func(LimitWarning)) ConfigFunc {
+	return func(p *PGX) {
+		p.soft = nil
+		if warn != nil {
+			p.soft = &softLimits{limits: limits, warn: warn}
+		}
+	}
+}
+
+// MaxTransactionAge stops the attempts of the transactions that run a
+// statement after they have been running for longer than d. The attempt is
+// rolled back and the transaction is stopped with an ErrTransactionTooOld
+// error. Zero means no limit.
+func MaxTransactionAge(d time.Duration) ConfigFunc {
+	return func(p *PGX) {
+		p.maxAge = d
+	}
+}
+
+// OnRollbackTimeout calls the fn with the label of the transaction and the
+// rollback error when a rollback doesn't finish within the grace period. The
+// transaction might be left open on the server, holding its locks, until the
+// connection is closed. If the Metrics set with the WithMetrics option
+// implements the RollbackMetrics interface, it is notified too.
+func OnRollbackTimeout(fn func(label string, err error)) ConfigFunc {
+	return func(p *PGX) {
+		p.onRollbackTimeout = fn
+	}
+}
+
+// KindRetry sets the retry attempts and the delay of the operations of the
+// kind, for example to retry the statements that run without a transaction
+// more aggressively than the transactions. The rest of the retry strategy is
+// kept. The attempts are set to 1 if the value is less than 1.
+func KindRetry(kind OpKind, attempts int, delay time.Duration) ConfigFunc {
+	return func(p *PGX) {
+		policies := make(map[OpKind]callRetry, len(p.kindRetry)+1)
+		for k, v := range p.kindRetry {
+			policies[k] = v
+		}
+		policies[kind] = callRetry{attempts: max(attempts, 1), delay: delay}
+		p.kindRetry = policies
+	}
+}
+
+// Watchdog cancels the running statement of the attempts that take longer
+// than cancelAfter with the pg_cancel_backend function, from another
+// connection of the pool, because cancelling the context doesn't always free
+// the locks on the server promptly. If the attempt is still running after
+// the terminateAfter duration, its backend is terminated with the
+// pg_terminate_backend function. Zero terminateAfter disables the
+// termination, and zero cancelAfter disables the watchdog. The transaction is
+// stopped with an ErrTransactionKilled error.
+//
+// The pool should implement the Querier interface, otherwise the
+// transactions return an ErrNoQuerier error. The transactions that run on
+// the read replicas are not watched. The backend pid is queried at the start
+// of each attempt.
+func Watchdog(cancelAfter, terminateAfter time.Duration) ConfigFunc {
+	return func(p *PGX) {
+		if cancelAfter <= 0 {
+			p.watchdog = nil
+			return
+		}
+		p.watchdog = &watchdog{
+			cancelAfter:    cancelAfter,
+			terminateAfter: terminateAfter,
+		}
+	}
+}
+
+// EscalateLockTimeout sets the lock_timeout of each attempt, starting with the
+// first duration and doubling it on each retry up to the maxTimeout. The first
+// attempts fail fast under contention, and the later attempts are more
+// patient. The lock timeouts are retried even if the Classifier doesn't
+// retry them, see the IsLockTimeout function. The lock_timeout is reset when
+// the transaction ends.
+//
+// A zero maxTimeout doesn't cap the timeout. A maxTimeout that is less than
+// the first is raised to the first, unless the StrictConfig option is set, in
+// which case the New function returns an ErrInvalidLockTimeout error. A first
+// value of zero or less disables the escalation.
+func EscalateLockTimeout(first, maxTimeout time.Duration) ConfigFunc {
+	return func(p *PGX) {
+		if first <= 0 {
+			p.lockTimeouts = nil
+			return
+		}
+		p.lockTimeouts = &lockEscalation{first: first, max: maxTimeout}
+	}
+}
+
+// WithMiddleware appends the mw to the middleware that wrap each function
+// passed to the Transaction method, in every attempt. The first middleware is
+// the outermost one, and the nil values are ignored. The functions receive
+// the transaction with the statement hooks installed, and the internal
+// functions of the other options are not wrapped.
+func WithMiddleware(mw ...Middleware) ConfigFunc {
+	return func(p *PGX) {
+		mws := slices.Clip(p.middleware)
+		for _, m := range mw {
+			if m != nil {
+				mws = append(mws, m)
+			}
+		}
+		p.middleware = mws
+	}
+}
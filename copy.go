@@ -0,0 +1,38 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CopyFrom runs the tx.CopyFrom method inside a transaction and retries the
+// transaction with the same semantics as the Transaction method. Since a
+// pgx.CopyFromSource can be consumed only once, the source function is called
+// on each attempt to create a fresh source. For example:
+//
+//	n, err := p.CopyFrom(ctx, pgx.Identifier{"people"}, []string{"name", "age"},
+//		func() pgx.CopyFromSource {
+//			return pgx.CopyFromRows(rows)
+//		},
+//	)
+//
+// It returns the number of rows copied in the successful attempt.
+func (p *PGX) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, source func() pgx.CopyFromSource) (int64, error) {
+	var n int64
+	err := p.Transaction(withKind(ctx, KindCopy), func(tx pgx.Tx) error {
+		var err error
+		n, err = tx.CopyFrom(ctx, table, columns, source())
+		if err != nil {
+			return fmt.Errorf("copying to %s: %w", table.Sanitize(), err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,87 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXCopyFrom(t *testing.T) {
+	t.Parallel()
+	t.Run("Error", testPGXCopyFromError)
+	t.Run("RetrySuccess", testPGXCopyFromRetrySuccess)
+}
+
+func testPGXCopyFromError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	total := 3
+	tr, err := dbtools.New(db, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+
+	table := pgx.Identifier{"people"}
+	columns := []string{"name"}
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("CopyFrom", mock.Anything, table, columns, mock.Anything).
+		Return(int64(0), assert.AnError).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	calls := 0
+	n, err := tr.CopyFrom(ctx, table, columns, func() pgx.CopyFromSource {
+		calls++
+		return pgx.CopyFromRows([][]any{{"a"}})
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), `"people"`)
+	assert.Zero(t, n)
+	assert.Equal(t, total, calls)
+}
+
+func testPGXCopyFromRetrySuccess(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Millisecond))
+	require.NoError(t, err)
+
+	rows := [][]any{{"a"}, {"b"}, {"c"}}
+	table := pgx.Identifier{"people"}
+	columns := []string{"name"}
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Twice()
+	consume := func(src pgx.CopyFromSource) int64 {
+		var n int64
+		for src.Next() {
+			n++
+		}
+		return n
+	}
+	tx.On("CopyFrom", mock.Anything, table, columns, mock.Anything).
+		Return(func(_ context.Context, _ pgx.Identifier, _ []string, src pgx.CopyFromSource) (int64, error) {
+			consume(src)
+			return 0, assert.AnError
+		}).Once()
+	tx.On("CopyFrom", mock.Anything, table, columns, mock.Anything).
+		Return(func(_ context.Context, _ pgx.Identifier, _ []string, src pgx.CopyFromSource) (int64, error) {
+			return consume(src), nil
+		}).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	n, err := tr.CopyFrom(ctx, table, columns, func() pgx.CopyFromSource {
+		return pgx.CopyFromRows(rows)
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, len(rows), n)
+}
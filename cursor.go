@@ -0,0 +1,187 @@
+package dbtools
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CursorCodec encodes the values of the key columns of the last row of a
+// page into an opaque token, and decodes them back for the keyset query of
+// the next page. The values keep their types, therefore they can be passed to
+// the query as the arguments:
+//
+//	token, err := codec.Encode(last.CreatedAt, last.ID)
+//	// send the token to the client.
+//	keys, err := codec.Decode(token)
+//	err = p.Query(ctx, scan, `SELECT id, name FROM users
+//		WHERE (created_at, id) > ($1, $2)
+//		ORDER BY created_at, id LIMIT 50`, keys...)
+//
+// The supported types are int, int8, int16, int32 and int64, which are
+// decoded as int64, uint, uint8, uint16, uint32 and uint64, which are decoded
+// as uint64, float32 and float64, which are decoded as float64, string, bool,
+// []byte, time.Time and nil. The zero value encodes the tokens without a
+// signature.
+type CursorCodec struct {
+	key []byte
+}
+
+// NewCursorCodec returns a CursorCodec that signs the tokens with the
+// HMAC-SHA256 of the key, and rejects the tokens that are not signed with the
+// same key. This prevents the clients from crafting the cursors. An empty key
+// returns a codec without signatures.
+func NewCursorCodec(key []byte) *CursorCodec {
+	return &CursorCodec{key: key}
+}
+
+// EncodeCursor encodes the keys into an unsigned token. See the CursorCodec
+// type.
+func EncodeCursor(keys ...any) (string, error) {
+	return (&CursorCodec{}).Encode(keys...)
+}
+
+// DecodeCursor decodes the keys of an unsigned token. See the CursorCodec
+// type.
+func DecodeCursor(token string) ([]any, error) {
+	return (&CursorCodec{}).Decode(token)
+}
+
+// Encode returns the token of the keys. It returns an ErrInvalidCursor error
+// if a key has an unsupported type.
+func (c *CursorCodec) Encode(keys ...any) (string, error) {
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		v, err := encodeKey(k)
+		if err != nil {
+			return "", fmt.Errorf("%w: key %d: %w", ErrInvalidCursor, i, err)
+		}
+		values[i] = v
+	}
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(payload)
+	if len(c.key) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(c.sign(payload))
+	}
+
+	return token, nil
+}
+
+// Decode returns the keys of the token. It returns an ErrInvalidCursor error
+// if the token is malformed, or its signature doesn't match the key of the
+// codec.
+func (c *CursorCodec) Decode(token string) ([]any, error) {
+	encoded, sig, signed := strings.Cut(token, ".")
+	if signed != (len(c.key) > 0) {
+		return nil, fmt.Errorf("%w: unexpected signature", ErrInvalidCursor)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	if signed {
+		mac, err := base64.RawURLEncoding.DecodeString(sig)
+		if err != nil || !hmac.Equal(mac, c.sign(payload)) {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidCursor)
+		}
+	}
+
+	var values []string
+	if err := json.Unmarshal(payload, &values); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	keys := make([]any, len(values))
+	for i, v := range values {
+		k, err := decodeKey(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %w", ErrInvalidCursor, i, err)
+		}
+		keys[i] = k
+	}
+
+	return keys, nil
+}
+
+func (c *CursorCodec) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// encodeKey returns the key prefixed with the tag of its type.
+func encodeKey(key any) (string, error) {
+	switch k := key.(type) {
+	case nil:
+		return "n:", nil
+	case int:
+		return "i:" + strconv.FormatInt(int64(k), 10), nil
+	case int8:
+		return "i:" + strconv.FormatInt(int64(k), 10), nil
+	case int16:
+		return "i:" + strconv.FormatInt(int64(k), 10), nil
+	case int32:
+		return "i:" + strconv.FormatInt(int64(k), 10), nil
+	case int64:
+		return "i:" + strconv.FormatInt(k, 10), nil
+	case uint:
+		return "u:" + strconv.FormatUint(uint64(k), 10), nil
+	case uint8:
+		return "u:" + strconv.FormatUint(uint64(k), 10), nil
+	case uint16:
+		return "u:" + strconv.FormatUint(uint64(k), 10), nil
+	case uint32:
+		return "u:" + strconv.FormatUint(uint64(k), 10), nil
+	case uint64:
+		return "u:" + strconv.FormatUint(k, 10), nil
+	case float32:
+		return "f:" + strconv.FormatFloat(float64(k), 'g', -1, 32), nil
+	case float64:
+		return "f:" + strconv.FormatFloat(k, 'g', -1, 64), nil
+	case string:
+		return "s:" + k, nil
+	case bool:
+		return "b:" + strconv.FormatBool(k), nil
+	case []byte:
+		return "x:" + base64.RawStdEncoding.EncodeToString(k), nil
+	case time.Time:
+		return "t:" + k.Format(time.RFC3339Nano), nil
+	default:
+		return "", fmt.Errorf("unsupported type %T", key)
+	}
+}
+
+func decodeKey(v string) (any, error) {
+	tag, value, ok := strings.Cut(v, ":")
+	if !ok {
+		return nil, fmt.Errorf("missing type")
+	}
+	switch tag {
+	case "n":
+		return nil, nil
+	case "i":
+		return strconv.ParseInt(value, 10, 64)
+	case "u":
+		return strconv.ParseUint(value, 10, 64)
+	case "f":
+		return strconv.ParseFloat(value, 64)
+	case "s":
+		return value, nil
+	case "b":
+		return strconv.ParseBool(value)
+	case "x":
+		return base64.RawStdEncoding.DecodeString(value)
+	case "t":
+		return time.Parse(time.RFC3339Nano, value)
+	default:
+		return nil, fmt.Errorf("unknown type %q", tag)
+	}
+}
@@ -0,0 +1,102 @@
+package dbtools_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorCodec(t *testing.T) {
+	t.Parallel()
+	t.Run("RoundTrip", testCursorCodecRoundTrip)
+	t.Run("Signed", testCursorCodecSigned)
+	t.Run("Unsupported", testCursorCodecUnsupported)
+	t.Run("Malformed", testCursorCodecMalformed)
+}
+
+func testCursorCodecRoundTrip(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 3, 1, 10, 30, 0, 123456789, time.UTC)
+	token, err := dbtools.EncodeCursor(at, 42, int32(7), 1.5, "a:b.c", true, []byte{0, 1}, nil)
+	require.NoError(t, err)
+	assert.NotContains(t, token, "a:b.c", "the token should be opaque")
+
+	keys, err := dbtools.DecodeCursor(token)
+	require.NoError(t, err)
+	require.Len(t, keys, 8)
+	got, ok := keys[0].(time.Time)
+	require.True(t, ok)
+	assert.True(t, at.Equal(got))
+	assert.Equal(t, []any{int64(42), int64(7), 1.5, "a:b.c", true, []byte{0, 1}, nil}, keys[1:])
+
+	token, err = dbtools.EncodeCursor()
+	require.NoError(t, err)
+	keys, err = dbtools.DecodeCursor(token)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	token, err = dbtools.EncodeCursor(int8(-8), int16(-16), int64(-64),
+		uint(1), uint8(8), uint16(16), uint32(32), uint64(math.MaxUint64))
+	require.NoError(t, err)
+	keys, err = dbtools.DecodeCursor(token)
+	require.NoError(t, err)
+	assert.Equal(t, []any{
+		int64(-8), int64(-16), int64(-64),
+		uint64(1), uint64(8), uint64(16), uint64(32), uint64(math.MaxUint64),
+	}, keys)
+}
+
+func testCursorCodecSigned(t *testing.T) {
+	t.Parallel()
+	codec := dbtools.NewCursorCodec([]byte("secret"))
+	token, err := codec.Encode(int64(42), "alice")
+	require.NoError(t, err)
+
+	keys, err := codec.Decode(token)
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(42), "alice"}, keys)
+
+	_, err = dbtools.NewCursorCodec([]byte("other")).Decode(token)
+	assert.ErrorIs(t, err, dbtools.ErrInvalidCursor)
+
+	_, err = dbtools.DecodeCursor(token)
+	assert.ErrorIs(t, err, dbtools.ErrInvalidCursor, "unsigned codec should reject signed tokens")
+
+	forged, err := dbtools.EncodeCursor(int64(1), "alice")
+	require.NoError(t, err)
+	_, sig, _ := strings.Cut(token, ".")
+	_, err = codec.Decode(forged + "." + sig)
+	assert.ErrorIs(t, err, dbtools.ErrInvalidCursor)
+	_, err = codec.Decode(forged)
+	assert.ErrorIs(t, err, dbtools.ErrInvalidCursor)
+}
+
+func testCursorCodecUnsupported(t *testing.T) {
+	t.Parallel()
+	_, err := dbtools.EncodeCursor(struct{}{})
+	assert.ErrorIs(t, err, dbtools.ErrInvalidCursor)
+}
+
+func testCursorCodecMalformed(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]string{
+		"not base64":   "!!!",
+		"not json":     "bm90IGpzb24",
+		"missing type": "WyI0MiJd",     // ["42"]
+		"unknown type": "WyJ6OjQyIl0",  // ["z:42"]
+		"bad integer":  "WyJpOmFiYyJd", // ["i:abc"]
+		"bad unsigned": "WyJ1Oi0xIl0",  // ["u:-1"]
+	}
+	for name, token := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := dbtools.DecodeCursor(token)
+			assert.ErrorIs(t, err, dbtools.ErrInvalidCursor)
+		})
+	}
+}
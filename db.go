@@ -2,11 +2,14 @@ package dbtools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/arsham/retry/v3"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // PGX is a concurrent-safe object that can retry a transaction on a
@@ -27,14 +30,50 @@ import (
 // Any panic in functions will be wrapped in an error and will be counted as an
 // error.
 type PGX struct {
-	pool        Pool
-	loop        retry.Retry
-	gracePeriod time.Duration
+	pool          Pool
+	txOptions     *pgx.TxOptions
+	presets       map[string][]ConfigFunc
+	schema        *schemaVersion
+	classifier    Classifier
+	commitPolicy  CommitPolicy
+	conflicts     *conflictBackoff
+	budget        *Budget
+	strict        bool
+	soft          *softLimits
+	maxAge        time.Duration
+	probes        []pgx.Identifier
+	replicas      *replicaSet
+	locals        []localSetting
+	warmUp        []string
+	quota         *quota
+	results       resultLimit
+	savepoints    *savepointCheck
+	metrics       Metrics
+	checkpoint    *checkpoint
+	sqlCapture    *SQLCapture
+	unbounded     *unboundedAudit
+	tracer        *queryTracer
+	label         string
+	tenantSetting string
+	loop          retry.Retry
+	gracePeriod   time.Duration
+
+	onRollbackTimeout func(label string, err error)
+	kindRetry         map[OpKind]callRetry
+	retrier           Retrier
+	watchdog          *watchdog
+	lockTimeouts      *lockEscalation
+	middleware        []Middleware
+	noDelay           bool
+	onDelay           func(attempt int, d time.Duration)
+	sleeper           func(ctx context.Context, d time.Duration) error
 }
 
 // New returns an error if conn is nil. It sets the retry attempts to 1 if the
-// value is less than 1. The retry strategy can be set either by providing a
-// retry.Retry method or the individual components. See the ConfigFunc helpers.
+// value is less than 1, unless the StrictConfig option is set, in which case
+// the invalid configurations are returned as errors. The retry strategy can be
+// set either by providing a retry.Retry method or the individual components.
+// See the ConfigFunc helpers.
 func New(conn Pool, conf ...ConfigFunc) (*PGX, error) {
 	if conn == nil {
 		return nil, ErrEmptyDatabase
@@ -48,14 +87,62 @@ func New(conn Pool, conf ...ConfigFunc) (*PGX, error) {
 			Method:   retry.IncrementalDelay,
 		},
 	}
+	if err := obj.apply(conf...); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// apply applies the conf and validates the result if the StrictConfig option
+// is set.
+func (p *PGX) apply(conf ...ConfigFunc) error {
 	for _, fn := range conf {
-		fn(obj)
+		fn(p)
+	}
+	if p.strict {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	if p.loop.Attempts < 1 {
+		p.loop.Attempts = 1
 	}
-	if obj.loop.Attempts < 1 {
-		obj.loop.Attempts = 1
+	if l := p.lockTimeouts; l != nil && l.max > 0 && l.max < l.first {
+		p.lockTimeouts = &lockEscalation{first: l.first, max: l.first}
 	}
 
-	return obj, nil
+	return nil
+}
+
+// validate returns the errors of the invalid configurations.
+func (p *PGX) validate() error {
+	var errs []error
+	if p.loop.Attempts < 1 {
+		errs = append(errs, fmt.Errorf("%w: %d", ErrInvalidAttempts, p.loop.Attempts))
+	}
+	if p.loop.Delay < 0 {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidDelay, p.loop.Delay))
+	}
+	if p.gracePeriod <= 0 {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidGracePeriod, p.gracePeriod))
+	}
+	if l := p.lockTimeouts; l != nil && l.max > 0 && l.max < l.first {
+		errs = append(errs, fmt.Errorf("%w: max %s is less than %s", ErrInvalidLockTimeout, l.max, l.first))
+	}
+
+	return errors.Join(errs...)
+}
+
+// clone returns a copy of the PGX with the conf applied. The copy shares the
+// same pool.
+func (p *PGX) clone(conf ...ConfigFunc) (*PGX, error) {
+	obj := *p
+	if err := obj.apply(conf...); err != nil {
+		return nil, err
+	}
+
+	return &obj, nil
 }
 
 // Transaction returns an error if the connection is not set, or can't begin
@@ -67,54 +154,201 @@ func New(conn Pool, conf ...ConfigFunc) (*PGX, error) {
 // and returns.
 //
 // It stops retrying if any of the errors are wrapped in a *retry.StopError or
-// when the context is cancelled.
+// when the context is cancelled. If the context is cancelled with a cause,
+// the returned error wraps the cause too. It returns an ErrNilStep error
+// without starting a transaction if any of the fns are nil.
 func (p *PGX) Transaction(ctx context.Context, fns ...func(pgx.Tx) error) error {
+	steps := make([]Step, len(fns))
+	for i, fn := range fns {
+		if fn == nil {
+			return fmt.Errorf("%w: function #%d", ErrNilStep, i)
+		}
+		steps[i] = Step{Fn: fn}
+	}
+
+	return p.run(ctx, steps)
+}
+
+func (p *PGX) run(ctx context.Context, steps []Step) error {
 	if p.pool == nil {
 		return ErrEmptyDatabase
 	}
 
-	return p.loop.DoContext(ctx, func() error {
-		tx, err := p.pool.Begin(ctx)
-		if err != nil {
-			return fmt.Errorf("starting transaction: %w", err)
+	steps = slices.Clone(steps)
+	for i := range steps {
+		steps[i].index = i
+	}
+	prefix := p.prepare(ctx, nil)
+	all := append(slices.Clip(prefix), steps...)
+	run := func(ctx context.Context) error {
+		return p.attempt(ctx, all)
+	}
+	if p.checkpoint != nil && !isDryRun(ctx) {
+		next := 0
+		run = func(ctx context.Context) error {
+			return p.resume(ctx, prefix, steps, &next)
 		}
+	}
+	id := nextTxID()
+	attempts := 0
+	start := time.Now()
+	kind := kindOf(ctx)
+	loop, record := p.retryLoop(ctx, kind)
+	keys := callKeys(ctx)
+	err := p.do(ctx, loop, func() (err error) {
+		attempts++
+		attemptStart := time.Now()
+		attemptCtx, scope := withAttemptScope(ctx, keys)
+		defer scope.end()
+		defer func() {
+			if r := recover(); r != nil {
+				p.observeAttempt(attemptStart, ClassPanic)
+				record(nil)
+				panic(r)
+			}
+			p.observeAttempt(attemptStart, ErrorClass(err))
+			record(err)
+		}()
 
-		for _, fn := range fns {
-			var err error
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						// In this case we want to rollback and panic so the
-						// retry library can handle it.
-						err = fmt.Errorf("%v", r)
-						panic(p.rollbackWithErr(tx, err))
-					}
-				}()
-				err = fn(tx)
-			}()
+		err = run(withTxInfo(attemptCtx, TxInfo{ID: id, Attempt: attempts, Label: p.label}))
+		return p.spend(err, attempts, loop.Attempts)
+	})
+	err = withCause(ctx, err)
+	p.observeTransaction(start, err, attempts)
+	if err != nil && p.label != "" {
+		err = fmt.Errorf("transaction %q: %w", p.label, err)
+	}
 
-			if err == nil {
-				continue
-			}
+	return p.endCall(kind, start, attempts, err)
+}
 
-			return p.rollbackWithErr(tx, err)
+// attempt runs the steps in a new transaction once.
+func (p *PGX) attempt(ctx context.Context, steps []Step) (err error) {
+	tx, err := p.begin(ctx)
+	if err != nil {
+		return txError(ctx, PhaseBegin, nil, p.classify(fmt.Errorf("starting transaction: %w", err)))
+	}
+	if err := p.escalate(ctx, tx); err != nil {
+		return p.rollbackWithErr(ctx, tx, PhaseBegin, nil, p.classify(err))
+	}
+	w, err := p.watch(ctx, tx)
+	if err != nil {
+		return p.rollbackWithErr(ctx, tx, PhaseBegin, nil, p.classify(err))
+	}
+	if w != nil {
+		tx = &watchedTx{Tx: tx, w: w}
+		defer func() { err = w.result(err) }()
+	}
+	wrapped := p.wrapTx(ctx, tx)
+	scoped := scopeTx(ctx, wrapped)
+
+	for _, step := range steps {
+		phase := step.phase
+		if phase == "" {
+			phase = PhaseFn
 		}
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					// In this case we want to rollback and panic so the
+					// retry library can handle it.
+					err = step.wrapErr(fmt.Errorf("%v", r))
+					panic(p.rollbackWithErr(ctx, tx, phase, &step, err))
+				}
+			}()
+			if step.internal {
+				err = step.Fn(tx)
+				return
+			}
+			err = p.chain(step.Fn)(scoped)
+		}()
 
-		if err := tx.Commit(ctx); err != nil {
-			return fmt.Errorf("committing transaction: %w", err)
+		if err == nil {
+			continue
 		}
 
-		return nil
-	})
+		return p.rollbackWithErr(ctx, tx, phase, &step, p.classify(step.wrapErr(err)))
+	}
+
+	if err := commitHooks(ctx, wrapped); err != nil {
+		return p.rollbackWithErr(ctx, tx, PhaseCommit, nil, p.classify(err))
+	}
+	if isDryRun(ctx) {
+		return p.rollbackDryRun(ctx, tx)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return txError(ctx, PhaseCommit, nil, p.commitFailed(err))
+	}
+	committed(ctx)
+
+	return nil
 }
 
-func (p *PGX) rollbackWithErr(tx pgx.Tx, err error) error {
-	ctx, cancel := context.WithTimeout(context.Background(), p.gracePeriod)
+// prepare returns the steps with the internal steps of the enabled features
+// prepended.
+func (p *PGX) prepare(ctx context.Context, steps []Step) []Step {
+	var ret []Step
+	ret = append(ret, p.localSteps(ctx)...)
+	ret = append(ret, p.warmUpSteps(ctx)...)
+	ret = append(ret, p.tenantSteps(ctx)...)
+	ret = append(ret, tagSteps(ctx)...)
+	ret = append(ret, p.probeSteps(ctx)...)
+
+	return append(ret, steps...)
+}
+
+// begin starts a transaction with the configured transaction options. If the
+// options are set but the pool does not implement the TxBeginner interface, it
+// returns an ErrNoTxBeginner error wrapped in a *retry.StopError.
+func (p *PGX) begin(ctx context.Context) (pgx.Tx, error) {
+	if p.readOnly() && p.replicas != nil {
+		return p.replicas.begin(ctx, p.pool, *p.txOptions)
+	}
+
+	return beginOn(ctx, p.pool, p.txOptions)
+}
+
+func (p *PGX) readOnly() bool {
+	return p.txOptions != nil && p.txOptions.AccessMode == pgx.ReadOnly
+}
+
+// beginOn starts a transaction on the pool with the opts if they are not nil.
+func beginOn(ctx context.Context, pool Pool, opts *pgx.TxOptions) (pgx.Tx, error) {
+	if opts == nil {
+		return pool.Begin(ctx)
+	}
+	b, ok := pool.(TxBeginner)
+	if !ok {
+		return nil, &retry.StopError{Err: ErrNoTxBeginner}
+	}
+
+	return b.BeginTx(ctx, *opts)
+}
+
+// rollbackWithErr rolls back the tx within the grace period of the ctx and
+// returns the err of the phase as a *TxError. The rollback error is added to
+// the err unless the tx or its connection is already closed, in which case
+// the transaction is already rolled back.
+func (p *PGX) rollbackWithErr(ctx context.Context, tx pgx.Tx, phase TxPhase, step *Step, err error) error {
+	rctx, cancel := context.WithTimeout(context.Background(), p.grace(ctx))
 	defer cancel()
-	if er := tx.Rollback(ctx); er != nil {
-		//nolint:wrapcheck // false positive.
-		return fmt.Errorf("(rolling back transaction: %w): %w", er, err)
+	er := tx.Rollback(rctx)
+	if er != nil && errors.Is(rctx.Err(), context.DeadlineExceeded) {
+		p.rollbackTimedOut(er)
+	}
+	if er != nil && !closedTx(er) {
+		err = fmt.Errorf("(rolling back transaction: %w): %w", er, err)
+		phase = PhaseRollback
 	}
 
-	return err
+	return txError(ctx, phase, step, err)
+}
+
+// closedTx returns true if the rollback error er is caused by the tx or its
+// connection being closed. The server rolls back the transactions of the
+// closed connections, and pgx closes the connection when a rollback fails
+// before it is sent.
+func closedTx(er error) bool {
+	return errors.Is(er, pgx.ErrTxClosed) || IsConnectionError(er) || pgconn.SafeToRetry(er)
 }
@@ -12,7 +12,7 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func ExampleNewPGX() {
+func ExampleNew() {
 	// This setup tries the transaction only once.
 	dbtools.New(&exampleConn{})
 
@@ -126,3 +126,26 @@ func ExamplePGX_Transaction_panics() {
 	// Transaction's error: <nil>
 	// Called 5 times.
 }
+
+func ExampleSteps() {
+	tr, err := dbtools.New(&exampleConn{})
+	if err != nil {
+		panic(err)
+	}
+	err = dbtools.Steps().
+		Add("lock-user", func(pgx.Tx) error {
+			fmt.Println("Locking the user.")
+			return nil
+		}).
+		Add("debit", func(pgx.Tx) error {
+			fmt.Println("Debiting the account.")
+			return nil
+		}).
+		Run(context.Background(), tr)
+	fmt.Printf("Transaction's error: %v", err)
+
+	// Output:
+	// Locking the user.
+	// Debiting the account.
+	// Transaction's error: <nil>
+}
@@ -3,6 +3,8 @@ package dbtools_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
 	"testing"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/arsham/dbtools/v4/mocks"
 	"github.com/arsham/retry/v3"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -28,6 +31,21 @@ func TestNewPGX(t *testing.T) {
 		"low attempts": {db, []dbtools.ConfigFunc{dbtools.Retry(-1, time.Millisecond)}, nil},
 		"retrier":      {db, []dbtools.ConfigFunc{dbtools.WithRetry(retry.Retry{})}, nil},
 		"defaults":     {db, nil, nil},
+		"strict": {db, []dbtools.ConfigFunc{
+			dbtools.StrictConfig(), dbtools.Retry(3, time.Millisecond),
+		}, nil},
+		"strict attempts": {db, []dbtools.ConfigFunc{
+			dbtools.StrictConfig(), dbtools.Retry(-1, time.Millisecond),
+		}, dbtools.ErrInvalidAttempts},
+		"strict retrier": {db, []dbtools.ConfigFunc{
+			dbtools.StrictConfig(), dbtools.WithRetry(retry.Retry{}),
+		}, dbtools.ErrInvalidAttempts},
+		"strict delay": {db, []dbtools.ConfigFunc{
+			dbtools.StrictConfig(), dbtools.Retry(1, -time.Second),
+		}, dbtools.ErrInvalidDelay},
+		"strict grace period": {db, []dbtools.ConfigFunc{
+			dbtools.StrictConfig(), dbtools.GracePeriod(0),
+		}, dbtools.ErrInvalidGracePeriod},
 	}
 	for name, tc := range tcs {
 		t.Run(name, func(t *testing.T) {
@@ -45,6 +63,7 @@ func TestNewPGX(t *testing.T) {
 func TestPGX(t *testing.T) {
 	t.Parallel()
 	t.Run("NilDatabase", testPGXTransactionNilDatabase)
+	t.Run("NilFunction", testPGXTransactionNilFunction)
 	t.Run("BeginError", testPGXTransactionBeginError)
 	t.Run("CancelledContext", testPGXTransactionCancelledContext)
 	t.Run("Panic", testPGXTransactionPanic)
@@ -71,6 +90,21 @@ func testPGXTransactionNilDatabase(t *testing.T) {
 	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
 }
 
+func testPGXTransactionNilFunction(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	}, nil)
+	assert.ErrorIs(t, err, dbtools.ErrNilStep)
+}
+
 func testPGXTransactionBeginError(t *testing.T) {
 	t.Parallel()
 	db := mocks.NewPool(t)
@@ -186,6 +220,7 @@ func testPGXTransactionAnError(t *testing.T) {
 	t.Parallel()
 	t.Run("NoRollbackError", testPGXTransactionAnErrorNoRollbackError)
 	t.Run("WithRollbackError", testPGXTransactionAnErrorWithRollbackError)
+	t.Run("ClosedTx", testPGXTransactionAnErrorClosedTx)
 }
 
 func testPGXTransactionAnErrorNoRollbackError(t *testing.T) {
@@ -235,6 +270,35 @@ func testPGXTransactionAnErrorWithRollbackError(t *testing.T) {
 	assert.ErrorIs(t, err, rollbackError)
 }
 
+func testPGXTransactionAnErrorClosedTx(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]error{
+		"tx closed":  pgx.ErrTxClosed,
+		"wrapped":    fmt.Errorf("rolling back: %w", pgx.ErrTxClosed),
+		"net error":  &net.OpError{Op: "write", Err: assert.AnError},
+		"connection": &pgconn.PgError{Code: "08006"},
+	}
+	for name, rollbackError := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			db := mocks.NewPool(t)
+			tr, err := dbtools.New(db)
+			require.NoError(t, err)
+
+			tx := mocks.NewPGXTx(t)
+			db.On("Begin", mock.Anything).Return(tx, nil).Once()
+			tx.On("Rollback", mock.Anything).Return(rollbackError).Once()
+
+			err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+				return assert.AnError
+			})
+			require.ErrorIs(t, err, assert.AnError)
+			assert.NotErrorIs(t, err, rollbackError)
+			assert.NotContains(t, err.Error(), "rolling back transaction")
+		})
+	}
+}
+
 func testPGXTransactionErrorIs(t *testing.T) {
 	t.Parallel()
 	db := mocks.NewPool(t)
@@ -509,3 +573,15 @@ func testPGXTransactionContextCancelled(t *testing.T) {
 	require.ErrorIs(t, err, context.Canceled)
 	assert.Equal(t, 1, calls)
 }
+
+func TestTransactioner(t *testing.T) {
+	t.Parallel()
+	var _ dbtools.Transactioner = (*dbtools.PGX)(nil)
+	var _ dbtools.Transactioner = (*dbtools.ReadOnlyPGX)(nil)
+
+	tr := mocks.NewTransactioner(t)
+	tr.On("Transaction", mock.Anything, mock.Anything).Return(assert.AnError).Once()
+	var got dbtools.Transactioner = tr
+	err := got.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	assert.ErrorIs(t, err, assert.AnError)
+}
@@ -0,0 +1,152 @@
+package dbtesting
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// StatementCounter is a dbtools.Pool that counts the statements of each
+// transaction started on it. Use it in tests to catch code paths that run more
+// queries than expected, for example an N+1 query pattern introduced by a
+// refactor:
+//
+//	counter := dbtesting.NewStatementCounter(pool)
+//	tr, err := dbtools.New(counter)
+//	// ...
+//	counter.AssertBudget(t, 3)
+//
+// Each attempt of a retried transaction is counted separately. The statements
+// of nested transactions are counted against their parent transaction.
+type StatementCounter struct {
+	pool   dbtools.Pool
+	mu     sync.Mutex
+	counts []int
+}
+
+// NewStatementCounter returns a StatementCounter that starts its transactions
+// on the pool.
+func NewStatementCounter(pool dbtools.Pool) *StatementCounter {
+	return &StatementCounter{pool: pool}
+}
+
+// Begin starts a transaction on the underlying pool.
+func (s *StatementCounter) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.track(tx), nil
+}
+
+// BeginTx starts a transaction with the txOptions on the underlying pool. It
+// returns a dbtools.ErrNoTxBeginner error wrapped in a *retry.StopError if the
+// pool does not implement the dbtools.TxBeginner interface.
+func (s *StatementCounter) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	b, ok := s.pool.(dbtools.TxBeginner)
+	if !ok {
+		return nil, &retry.StopError{Err: dbtools.ErrNoTxBeginner}
+	}
+	tx, err := b.BeginTx(ctx, txOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.track(tx), nil
+}
+
+func (s *StatementCounter) track(tx pgx.Tx) pgx.Tx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts = append(s.counts, 0)
+
+	return &countingTx{Tx: tx, counter: s, index: len(s.counts) - 1}
+}
+
+func (s *StatementCounter) add(index, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[index] += n
+}
+
+// Counts returns the number of statements of each transaction in the order
+// they were started.
+func (s *StatementCounter) Counts() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make([]int, len(s.counts))
+	copy(counts, s.counts)
+
+	return counts
+}
+
+// Reset forgets all the recorded transactions.
+func (s *StatementCounter) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts = nil
+}
+
+// AssertBudget reports an error on t for each transaction that ran more than
+// budget statements. It returns false if any of the transactions exceeded the
+// budget.
+func (s *StatementCounter) AssertBudget(t testing.TB, budget int) bool {
+	t.Helper()
+	ok := true
+	for i, n := range s.Counts() {
+		if n > budget {
+			t.Errorf("transaction #%d ran %d statements, want at most %d", i, n, budget)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// countingTx counts the statements that run through it. A batch is counted as
+// the number of its queries.
+type countingTx struct {
+	pgx.Tx
+	counter *StatementCounter
+	index   int
+}
+
+func (c *countingTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := c.Tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingTx{Tx: tx, counter: c.counter, index: c.index}, nil
+}
+
+func (c *countingTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	c.counter.add(c.index, 1)
+	return c.Tx.Exec(ctx, sql, args...)
+}
+
+func (c *countingTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	c.counter.add(c.index, 1)
+	return c.Tx.Query(ctx, sql, args...)
+}
+
+func (c *countingTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	c.counter.add(c.index, 1)
+	return c.Tx.QueryRow(ctx, sql, args...)
+}
+
+func (c *countingTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	c.counter.add(c.index, b.Len())
+	return c.Tx.SendBatch(ctx, b)
+}
+
+func (c *countingTx) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	c.counter.add(c.index, 1)
+	return c.Tx.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
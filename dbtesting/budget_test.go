@@ -0,0 +1,142 @@
+package dbtesting_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingT records the errors instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestStatementCounter(t *testing.T) {
+	t.Parallel()
+	t.Run("Counts", testStatementCounterCounts)
+	t.Run("Retries", testStatementCounterRetries)
+	t.Run("AssertBudget", testStatementCounterAssertBudget)
+	t.Run("NoTxBeginner", testStatementCounterNoTxBeginner)
+}
+
+func testStatementCounterCounts(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	counter := dbtesting.NewStatementCounter(db)
+	tr, err := dbtools.New(counter)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	results := mocks.NewBatchResults(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Twice()
+	tx.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil).Times(3)
+	tx.On("SendBatch", mock.Anything, mock.Anything).Return(results).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Twice()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		for range 2 {
+			if _, err := tx.Exec(ctx, "SELECT 1"); err != nil {
+				return err
+			}
+		}
+		b := &pgx.Batch{}
+		b.Queue("SELECT 1")
+		b.Queue("SELECT 2")
+		tx.SendBatch(ctx, b)
+		return nil
+	})
+	require.NoError(t, err)
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT 1")
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 1}, counter.Counts())
+
+	counter.Reset()
+	assert.Empty(t, counter.Counts())
+}
+
+func testStatementCounterRetries(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	counter := dbtesting.NewStatementCounter(db)
+	total := 3
+	tr, err := dbtools.New(counter, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT 1"); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []int{1, 1, 1}, counter.Counts())
+}
+
+func testStatementCounterAssertBudget(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	counter := dbtesting.NewStatementCounter(db)
+	tr, err := dbtools.New(counter)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).Return(nil).Times(5)
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		for i := range 5 {
+			tx.QueryRow(ctx, "SELECT name FROM users WHERE id = $1", i)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.True(t, counter.AssertBudget(t, 5))
+	rt := &recordingT{TB: t}
+	assert.False(t, counter.AssertBudget(rt, 4))
+	require.Len(t, rt.errors, 1)
+	assert.Contains(t, rt.errors[0], "ran 5 statements")
+}
+
+func testStatementCounterNoTxBeginner(t *testing.T) {
+	t.Parallel()
+	counter := dbtesting.NewStatementCounter(mocks.NewPool(t))
+	tr, err := dbtools.New(counter, dbtools.Retry(10, time.Millisecond),
+		dbtools.TxOptions(pgx.TxOptions{AccessMode: pgx.ReadOnly}),
+	)
+	require.NoError(t, err)
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	assert.ErrorIs(t, err, dbtools.ErrNoTxBeginner)
+}
@@ -0,0 +1,549 @@
+package dbtesting
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrUnexpectedStatement is returned by the Simulator when no rule matches a
+// statement.
+var ErrUnexpectedStatement = errors.New("unexpected statement")
+
+// Statement is a statement that was run on the Simulator. The transaction
+// boundaries are recorded as the BEGIN, COMMIT, ROLLBACK, SAVEPOINT, RELEASE
+// SAVEPOINT and ROLLBACK TO SAVEPOINT statements.
+type Statement struct {
+	SQL  string
+	Args []any
+}
+
+// Simulator is an in-process pool that responds to the statements with the
+// scripted rules. It implements the dbtools.Pool, dbtools.TxBeginner,
+// dbtools.Querier and dbtools.Pinger interfaces, therefore the code that uses
+// the pgx interfaces can be tested without a database or a database/sql
+// driver:
+//
+//	sim := dbtesting.NewSimulator()
+//	sim.On(`^SELECT name FROM users`).Return([]string{"name"}, []any{"arsham"})
+//	sim.On(`^UPDATE users`).Exec("UPDATE 1")
+//	tr, err := dbtools.New(sim)
+//
+// The rules are checked in the order they are added, and the first matching
+// rule responds. The BEGIN, COMMIT and ROLLBACK statements succeed unless a
+// rule matches them. Any other statement that doesn't match a rule returns an
+// ErrUnexpectedStatement error.
+type Simulator struct {
+	mu         sync.Mutex
+	rules      []*Rule
+	statements []Statement
+	savepoints int
+}
+
+// NewSimulator returns a Simulator without any rules.
+func NewSimulator() *Simulator {
+	return &Simulator{}
+}
+
+// On adds a rule for the statements that match the pattern. It panics if the
+// pattern is not a valid regular expression. By default the rule responds with
+// an empty result.
+func (s *Simulator) On(pattern string) *Rule {
+	r := &Rule{re: regexp.MustCompile(pattern)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, r)
+
+	return r
+}
+
+// Statements returns the statements that were run on the Simulator in order.
+func (s *Simulator) Statements() []Statement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]Statement, len(s.statements))
+	copy(ret, s.statements)
+
+	return ret
+}
+
+// SQL returns the SQL of the statements that were run on the Simulator in
+// order.
+func (s *Simulator) SQL() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]string, len(s.statements))
+	for i, st := range s.statements {
+		ret[i] = st.SQL
+	}
+
+	return ret
+}
+
+// respond records the statement and returns the response of the first
+// matching rule. If no rule matches and the statement is not required to
+// match, it returns an empty response.
+func (s *Simulator) respond(sql string, args []any, required bool) (response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = append(s.statements, Statement{SQL: sql, Args: args})
+	for _, r := range s.rules {
+		if !r.match(sql) {
+			continue
+		}
+		return r.response, r.response.err
+	}
+	if required {
+		return response{}, fmt.Errorf("%w: %s", ErrUnexpectedStatement, sql)
+	}
+
+	return response{}, nil
+}
+
+func (s *Simulator) nextSavepoint() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.savepoints++
+
+	return fmt.Sprintf("sp_%d", s.savepoints)
+}
+
+// Begin starts a simulated transaction.
+func (s *Simulator) Begin(context.Context) (pgx.Tx, error) {
+	if _, err := s.respond("BEGIN", nil, false); err != nil {
+		return nil, err
+	}
+
+	return &simTx{sim: s}, nil
+}
+
+// BeginTx starts a simulated transaction. The txOptions are ignored.
+func (s *Simulator) BeginTx(ctx context.Context, _ pgx.TxOptions) (pgx.Tx, error) {
+	return s.Begin(ctx)
+}
+
+// Ping succeeds unless a rule matches the "PING" statement.
+func (s *Simulator) Ping(context.Context) error {
+	_, err := s.respond("PING", nil, false)
+	return err
+}
+
+// Exec responds to the sql with the matching rule.
+func (s *Simulator) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	res, err := s.respond(sql, args, true)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	return res.commandTag(), nil
+}
+
+// Query responds to the sql with the matching rule.
+func (s *Simulator) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	res, err := s.respond(sql, args, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.rowSet(), nil
+}
+
+// QueryRow responds to the sql with the matching rule.
+func (s *Simulator) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := s.Query(ctx, sql, args...)
+	return simRow{rows: rows, err: err}
+}
+
+// Rule is a scripted response for the statements that match its pattern.
+type Rule struct {
+	re       *regexp.Regexp
+	response response
+	times    int
+	used     int
+}
+
+type response struct {
+	tag     string
+	columns []string
+	rows    [][]any
+	err     error
+}
+
+// Return sets the rows that are returned for the matching statements.
+func (r *Rule) Return(columns []string, rows ...[]any) *Rule {
+	r.response.columns = columns
+	r.response.rows = rows
+
+	return r
+}
+
+// Exec sets the command tag that is returned for the matching statements,
+// for example "INSERT 0 1".
+func (r *Rule) Exec(tag string) *Rule {
+	r.response.tag = tag
+	return r
+}
+
+// Error sets the error that is returned for the matching statements.
+func (r *Rule) Error(err error) *Rule {
+	r.response.err = err
+	return r
+}
+
+// Times limits the number of statements the rule responds to. After that the
+// next matching rules respond. Zero means no limit.
+func (r *Rule) Times(n int) *Rule {
+	r.times = n
+	return r
+}
+
+// match returns true and counts the use if the sql matches the rule and the
+// rule is not used up.
+func (r *Rule) match(sql string) bool {
+	if r.times > 0 && r.used >= r.times {
+		return false
+	}
+	if !r.re.MatchString(sql) {
+		return false
+	}
+	r.used++
+
+	return true
+}
+
+func (r response) commandTag() pgconn.CommandTag {
+	if r.tag != "" {
+		return pgconn.NewCommandTag(r.tag)
+	}
+
+	return pgconn.NewCommandTag(fmt.Sprintf("SELECT %d", len(r.rows)))
+}
+
+func (r response) rowSet() *simRows {
+	return &simRows{columns: r.columns, rows: r.rows, tag: r.commandTag(), pos: -1}
+}
+
+// simTx is a simulated transaction. The nested transactions have a savepoint.
+type simTx struct {
+	sim       *Simulator
+	savepoint string
+	closed    bool
+}
+
+func (t *simTx) check() error {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+
+	return nil
+}
+
+func (t *simTx) Begin(context.Context) (pgx.Tx, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	name := t.sim.nextSavepoint()
+	if _, err := t.sim.respond("SAVEPOINT "+name, nil, false); err != nil {
+		return nil, err
+	}
+
+	return &simTx{sim: t.sim, savepoint: name}, nil
+}
+
+func (t *simTx) Commit(context.Context) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	t.closed = true
+	sql := "COMMIT"
+	if t.savepoint != "" {
+		sql = "RELEASE SAVEPOINT " + t.savepoint
+	}
+	_, err := t.sim.respond(sql, nil, false)
+
+	return err
+}
+
+func (t *simTx) Rollback(context.Context) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	t.closed = true
+	sql := "ROLLBACK"
+	if t.savepoint != "" {
+		sql = "ROLLBACK TO SAVEPOINT " + t.savepoint
+	}
+	_, err := t.sim.respond(sql, nil, false)
+
+	return err
+}
+
+func (t *simTx) CopyFrom(_ context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+	var rows []any
+	for src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return 0, err
+		}
+		rows = append(rows, values)
+	}
+	if err := src.Err(); err != nil {
+		return 0, err
+	}
+	_, err := t.sim.respond("COPY "+table.Sanitize(), []any{columns, rows}, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(rows)), nil
+}
+
+func (t *simTx) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+	if err := t.check(); err != nil {
+		return &simBatchResults{err: err}
+	}
+
+	return &simBatchResults{sim: t.sim, queries: b.QueuedQueries}
+}
+
+func (t *simTx) LargeObjects() pgx.LargeObjects { return pgx.LargeObjects{} }
+
+func (t *simTx) Prepare(_ context.Context, name, sql string) (*pgconn.StatementDescription, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+
+	return &pgconn.StatementDescription{Name: name, SQL: sql}, nil
+}
+
+func (t *simTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := t.check(); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	return t.sim.Exec(ctx, sql, args...)
+}
+
+func (t *simTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+
+	return t.sim.Query(ctx, sql, args...)
+}
+
+func (t *simTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := t.Query(ctx, sql, args...)
+	return simRow{rows: rows, err: err}
+}
+
+func (t *simTx) Conn() *pgx.Conn { return nil }
+
+// simBatchResults responds to the queued queries in order.
+type simBatchResults struct {
+	sim     *Simulator
+	queries []*pgx.QueuedQuery
+	err     error
+}
+
+func (b *simBatchResults) next() (response, error) {
+	if b.err != nil {
+		return response{}, b.err
+	}
+	if len(b.queries) == 0 {
+		return response{}, errors.New("no more queries in the batch")
+	}
+	q := b.queries[0]
+	b.queries = b.queries[1:]
+
+	return b.sim.respond(q.SQL, q.Arguments, true)
+}
+
+func (b *simBatchResults) Exec() (pgconn.CommandTag, error) {
+	res, err := b.next()
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	return res.commandTag(), nil
+}
+
+func (b *simBatchResults) Query() (pgx.Rows, error) {
+	res, err := b.next()
+	if err != nil {
+		return nil, err
+	}
+
+	return res.rowSet(), nil
+}
+
+func (b *simBatchResults) QueryRow() pgx.Row {
+	rows, err := b.Query()
+	return simRow{rows: rows, err: err}
+}
+
+func (b *simBatchResults) Close() error {
+	err := b.err
+	b.err = pgx.ErrTxClosed
+
+	return err
+}
+
+// simRows iterates over the scripted rows.
+type simRows struct {
+	columns []string
+	rows    [][]any
+	tag     pgconn.CommandTag
+	pos     int
+	err     error
+	closed  bool
+}
+
+func (r *simRows) Close()                        { r.closed = true }
+func (r *simRows) Err() error                    { return r.err }
+func (r *simRows) CommandTag() pgconn.CommandTag { return r.tag }
+func (r *simRows) Conn() *pgx.Conn               { return nil }
+
+func (r *simRows) FieldDescriptions() []pgconn.FieldDescription {
+	ret := make([]pgconn.FieldDescription, len(r.columns))
+	for i, name := range r.columns {
+		ret[i] = pgconn.FieldDescription{Name: name}
+	}
+
+	return ret
+}
+
+func (r *simRows) Next() bool {
+	if r.closed || r.err != nil || r.pos+1 >= len(r.rows) {
+		r.closed = true
+		return false
+	}
+	r.pos++
+
+	return true
+}
+
+// RawValues returns the text format of the values of the current row. The
+// NULL values are returned as nil.
+func (r *simRows) RawValues() [][]byte {
+	row, err := r.Values()
+	if err != nil {
+		return nil
+	}
+	ret := make([][]byte, len(row))
+	for i, v := range row {
+		if v != nil {
+			ret[i] = []byte(fmt.Sprint(v))
+		}
+	}
+
+	return ret
+}
+
+func (r *simRows) Values() ([]any, error) {
+	if r.pos < 0 || r.pos >= len(r.rows) {
+		return nil, errors.New("no row")
+	}
+	row := make([]any, len(r.rows[r.pos]))
+	copy(row, r.rows[r.pos])
+
+	return row, nil
+}
+
+func (r *simRows) Scan(dest ...any) error {
+	row, err := r.Values()
+	if err != nil {
+		return err
+	}
+	if len(dest) != len(row) {
+		r.err = fmt.Errorf("number of field descriptions must equal number of destinations, got %d and %d", len(row), len(dest))
+		return r.err
+	}
+	for i, d := range dest {
+		if err := assign(d, row[i]); err != nil {
+			r.err = fmt.Errorf("scanning column %d: %w", i, err)
+			return r.err
+		}
+	}
+
+	return nil
+}
+
+// assign sets the value the dest points to to the val.
+func assign(dest, val any) error {
+	if dest == nil {
+		return nil
+	}
+	if s, ok := dest.(sql.Scanner); ok {
+		return s.Scan(val)
+	}
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return fmt.Errorf("destination %T is not a pointer", dest)
+	}
+	elem := dv.Elem()
+	if val == nil {
+		elem.Set(reflect.Zero(elem.Type()))
+		return nil
+	}
+	v := reflect.ValueOf(val)
+	switch {
+	case v.Type().AssignableTo(elem.Type()):
+		elem.Set(v)
+	case elem.Kind() == reflect.Pointer && v.Type().AssignableTo(elem.Type().Elem()):
+		ptr := reflect.New(elem.Type().Elem())
+		ptr.Elem().Set(v)
+		elem.Set(ptr)
+	case isNumber(v.Kind()) && isNumber(elem.Kind()):
+		elem.Set(v.Convert(elem.Type()))
+	default:
+		return fmt.Errorf("can't assign %T to %T", val, dest)
+	}
+
+	return nil
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// simRow returns the first row of the rows.
+type simRow struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r simRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+
+	return r.rows.Err()
+}
@@ -0,0 +1,201 @@
+package dbtesting_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulator(t *testing.T) {
+	t.Parallel()
+	t.Run("Transaction", testSimulatorTransaction)
+	t.Run("Unexpected", testSimulatorUnexpected)
+	t.Run("Times", testSimulatorTimes)
+	t.Run("Nested", testSimulatorNested)
+	t.Run("Batch", testSimulatorBatch)
+	t.Run("QueryRow", testSimulatorQueryRow)
+	t.Run("RawValues", testSimulatorRawValues)
+}
+
+func testSimulatorTransaction(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT id, name FROM users`).Return([]string{"id", "name"},
+		[]any{1, "arsham"},
+		[]any{2, nil},
+	)
+	sim.On(`^UPDATE users`).Exec("UPDATE 2")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var names []string
+	var tag string
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT id, name FROM users")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var name *string
+			if err := rows.Scan(&id, &name); err != nil {
+				return err
+			}
+			if name != nil {
+				names = append(names, *name)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		res, err := tx.Exec(ctx, "UPDATE users SET seen = true")
+		tag = res.String()
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"arsham"}, names)
+	assert.Equal(t, "UPDATE 2", tag)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SELECT id, name FROM users",
+		"UPDATE users SET seen = true",
+		"COMMIT",
+	}, sim.SQL())
+}
+
+func testSimulatorUnexpected(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM users")
+		return err
+	})
+	require.ErrorIs(t, err, dbtesting.ErrUnexpectedStatement)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM users", "ROLLBACK"}, sim.SQL())
+}
+
+func testSimulatorTimes(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^INSERT`).Error(assert.AnError).Times(2)
+	sim.On(`^INSERT`).Exec("INSERT 0 1")
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	calls := 0
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		calls++
+		_, err := tx.Exec(ctx, "INSERT INTO users (name) VALUES ($1)", "arsham")
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	statements := sim.Statements()
+	require.NotEmpty(t, statements)
+	assert.Equal(t, "COMMIT", statements[len(statements)-1].SQL)
+	assert.Equal(t, []any{"arsham"}, statements[len(statements)-2].Args)
+}
+
+func testSimulatorNested(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT 1`)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		nested, err := tx.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := nested.Exec(ctx, "SELECT 1"); err != nil {
+			return err
+		}
+		if err := nested.Rollback(ctx); err != nil {
+			return err
+		}
+		_, err = nested.Exec(ctx, "SELECT 1")
+		assert.ErrorIs(t, err, pgx.ErrTxClosed)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SAVEPOINT sp_1",
+		"SELECT 1",
+		"ROLLBACK TO SAVEPOINT sp_1",
+		"COMMIT",
+	}, sim.SQL())
+}
+
+func testSimulatorBatch(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^INSERT`).Exec("INSERT 0 1")
+	sim.On(`^SELECT count`).Return([]string{"count"}, []any{int64(2)})
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	var count int
+	err = tr.Batch(context.Background(), func(b *pgx.Batch) error {
+		b.Queue("INSERT INTO users (name) VALUES ($1)", "a")
+		b.Queue("SELECT count(*) FROM users")
+		return nil
+	}, func(br pgx.BatchResults) error {
+		if _, err := br.Exec(); err != nil {
+			return err
+		}
+		return br.QueryRow().Scan(&count)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func testSimulatorQueryRow(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`WHERE id = 1`).Return([]string{"name"}, []any{"arsham"})
+	sim.On(`WHERE id = 2`).Return([]string{"name"})
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var name string
+	err = tr.QueryRow(ctx, func(r pgx.Row) error {
+		return r.Scan(&name)
+	}, "SELECT name FROM users WHERE id = 1")
+	require.NoError(t, err)
+	assert.Equal(t, "arsham", name)
+
+	err = tr.QueryRow(ctx, func(r pgx.Row) error {
+		return r.Scan(&name)
+	}, "SELECT name FROM users WHERE id = 2")
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func testSimulatorRawValues(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT`).Return([]string{"id", "name"}, []any{42, nil})
+
+	rows, err := sim.Query(context.Background(), "SELECT id, name FROM users")
+	require.NoError(t, err)
+	defer rows.Close()
+	require.True(t, rows.Next())
+	assert.Equal(t, [][]byte{[]byte("42"), nil}, rows.RawValues())
+}
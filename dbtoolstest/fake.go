@@ -0,0 +1,138 @@
+// Package dbtoolstest provides fakes for testing the code that depends on the
+// dbtools package.
+package dbtoolstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// FakeTransactioner is a dbtools.Transactioner that runs the functions
+// without a database and records the outcome of each attempt. It mimics the
+// retry semantics of the dbtools.PGX: an attempt fails if any of the
+// functions return an error or panic, and the transaction is retried until
+// the attempts are exhausted or a *retry.StopError is returned. There are no
+// delays between the attempts. The zero value has one attempt and passes a
+// nil pgx.Tx to the functions. It is safe for concurrent use.
+//
+//	fake := &dbtoolstest.FakeTransactioner{Attempts: 3}
+//	fake.FailAttempts(serializationErr)
+//	svc := NewService(fake)
+//	err := svc.Transfer(ctx, from, to, amount)
+//	assert.Equal(t, 1, fake.Commits())
+type FakeTransactioner struct {
+	// Tx is passed to the functions, for example a transaction of a
+	// dbtesting.Simulator.
+	Tx pgx.Tx
+	// Attempts is the maximum number of attempts of each transaction. Values
+	// less than 1 mean one attempt.
+	Attempts int
+
+	mu        sync.Mutex
+	scripted  []error
+	calls     int
+	attempts  int
+	commits   int
+	rollbacks int
+}
+
+// FailAttempts scripts the errors of the next attempts in order. An attempt
+// with a scripted error runs the functions, and fails with the error instead
+// of committing. A nil error lets the attempt commit.
+func (f *FakeTransactioner) FailAttempts(errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripted = append(f.scripted, errs...)
+}
+
+// Transaction runs the fns as described in the FakeTransactioner
+// documentation.
+func (f *FakeTransactioner) Transaction(_ context.Context, fns ...func(pgx.Tx) error) error {
+	for i, fn := range fns {
+		if fn == nil {
+			return fmt.Errorf("%w: function #%d", dbtools.ErrNilStep, i)
+		}
+	}
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+
+	var err error
+	for range max(f.Attempts, 1) {
+		err = f.attempt(fns)
+		if err == nil {
+			return nil
+		}
+		var stop *retry.StopError
+		if errors.As(err, &stop) {
+			return stop.Err
+		}
+	}
+
+	return err
+}
+
+func (f *FakeTransactioner) attempt(fns []func(pgx.Tx) error) (err error) {
+	f.mu.Lock()
+	f.attempts++
+	var scripted error
+	if len(f.scripted) > 0 {
+		scripted = f.scripted[0]
+		f.scripted = f.scripted[1:]
+	}
+	f.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if err != nil {
+			f.rollbacks++
+			return
+		}
+		f.commits++
+	}()
+	for _, fn := range fns {
+		if err := fn(f.Tx); err != nil {
+			return err
+		}
+	}
+
+	return scripted
+}
+
+// Calls returns the number of Transaction calls.
+func (f *FakeTransactioner) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// AttemptCount returns the number of attempts of all transactions.
+func (f *FakeTransactioner) AttemptCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.attempts
+}
+
+// Commits returns the number of committed attempts.
+func (f *FakeTransactioner) Commits() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commits
+}
+
+// Rollbacks returns the number of rolled back attempts.
+func (f *FakeTransactioner) Rollbacks() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rollbacks
+}
@@ -0,0 +1,117 @@
+package dbtoolstest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/dbtoolstest"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeTransactioner(t *testing.T) {
+	t.Parallel()
+	t.Run("Success", testFakeTransactionerSuccess)
+	t.Run("NilFunction", testFakeTransactionerNilFunction)
+	t.Run("ScriptedErrors", testFakeTransactionerScriptedErrors)
+	t.Run("Exhausted", testFakeTransactionerExhausted)
+	t.Run("StopError", testFakeTransactionerStopError)
+	t.Run("Panic", testFakeTransactionerPanic)
+	t.Run("Tx", testFakeTransactionerTx)
+}
+
+func testFakeTransactionerSuccess(t *testing.T) {
+	t.Parallel()
+	f := &dbtoolstest.FakeTransactioner{}
+	var _ dbtools.Transactioner = f
+	calls := 0
+	err := f.Transaction(context.Background(),
+		func(pgx.Tx) error { calls++; return nil },
+		func(pgx.Tx) error { calls++; return nil },
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 1, f.Calls())
+	assert.Equal(t, 1, f.AttemptCount())
+	assert.Equal(t, 1, f.Commits())
+	assert.Zero(t, f.Rollbacks())
+}
+
+func testFakeTransactionerNilFunction(t *testing.T) {
+	t.Parallel()
+	f := &dbtoolstest.FakeTransactioner{}
+	err := f.Transaction(context.Background(), nil)
+	assert.ErrorIs(t, err, dbtools.ErrNilStep)
+	assert.Zero(t, f.Calls())
+}
+
+func testFakeTransactionerScriptedErrors(t *testing.T) {
+	t.Parallel()
+	f := &dbtoolstest.FakeTransactioner{Attempts: 3}
+	f.FailAttempts(assert.AnError, assert.AnError)
+	calls := 0
+	err := f.Transaction(context.Background(), func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 3, f.AttemptCount())
+	assert.Equal(t, 1, f.Commits())
+	assert.Equal(t, 2, f.Rollbacks())
+}
+
+func testFakeTransactionerExhausted(t *testing.T) {
+	t.Parallel()
+	f := &dbtoolstest.FakeTransactioner{Attempts: 2}
+	err := f.Transaction(context.Background(), func(pgx.Tx) error {
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 2, f.Rollbacks())
+	assert.Zero(t, f.Commits())
+}
+
+func testFakeTransactionerStopError(t *testing.T) {
+	t.Parallel()
+	f := &dbtoolstest.FakeTransactioner{Attempts: 5}
+	err := f.Transaction(context.Background(), func(pgx.Tx) error {
+		return &retry.StopError{Err: assert.AnError}
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, f.AttemptCount())
+}
+
+func testFakeTransactionerPanic(t *testing.T) {
+	t.Parallel()
+	f := &dbtoolstest.FakeTransactioner{}
+	var err error
+	assert.NotPanics(t, func() {
+		err = f.Transaction(context.Background(), func(pgx.Tx) error {
+			panic("oops")
+		})
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oops")
+	assert.Equal(t, 1, f.Rollbacks())
+}
+
+func testFakeTransactionerTx(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^UPDATE`).Exec("UPDATE 1")
+	tx, err := sim.Begin(context.Background())
+	require.NoError(t, err)
+
+	f := &dbtoolstest.FakeTransactioner{Tx: tx}
+	err = f.Transaction(context.Background(), func(tx pgx.Tx) error {
+		_, err := tx.Exec(context.Background(), "UPDATE users SET seen = true")
+		return err
+	})
+	require.NoError(t, err)
+	assert.Contains(t, sim.SQL(), "UPDATE users SET seen = true")
+}
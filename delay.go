@@ -0,0 +1,57 @@
+package dbtools
+
+import (
+	"context"
+	"time"
+
+	"github.com/arsham/retry/v3"
+)
+
+// paced returns the loop with the delays reported to the OnDelay function,
+// and skipped when the NoDelay option is set.
+func (p *PGX) paced(loop retry.Retry) retry.Retry {
+	if !p.noDelay && p.onDelay == nil {
+		return loop
+	}
+	method := loop.Method
+	if method == nil {
+		method = retry.StandardDelay
+	}
+	loop.Method = func(attempt int, delay time.Duration) time.Duration {
+		d := method(attempt, delay)
+		if p.onDelay != nil {
+			p.onDelay(attempt, d)
+		}
+		if p.noDelay {
+			return 0
+		}
+		return d
+	}
+
+	return loop
+}
+
+// slept returns the loop and the fn with the delays waited by the sleeper set
+// with the WithSleeper option. When the sleeper returns an error, the next
+// attempt is not made and the error is returned.
+func (p *PGX) slept(ctx context.Context, loop retry.Retry, fn func() error) (retry.Retry, func() error) {
+	if p.sleeper == nil {
+		return loop, fn
+	}
+	method := loop.Method
+	if method == nil {
+		method = retry.StandardDelay
+	}
+	var err error
+	loop.Method = func(attempt int, delay time.Duration) time.Duration {
+		err = p.sleeper(ctx, method(attempt, delay))
+		return 0
+	}
+
+	return loop, func() error {
+		if err != nil {
+			return &retry.StopError{Err: err}
+		}
+		return fn()
+	}
+}
@@ -0,0 +1,165 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// delayRecorder records the delays reported by the OnDelay option.
+type delayRecorder struct {
+	attempts []int
+	delays   []time.Duration
+}
+
+func (d *delayRecorder) record(attempt int, delay time.Duration) {
+	d.attempts = append(d.attempts, attempt)
+	d.delays = append(d.delays, delay)
+}
+
+func TestNoDelay(t *testing.T) {
+	t.Parallel()
+	t.Run("Transaction", testNoDelayTransaction)
+	t.Run("Query", testNoDelayQuery)
+	t.Run("DeadlockBackoff", testNoDelayDeadlockBackoff)
+}
+
+func testNoDelayTransaction(t *testing.T) {
+	t.Parallel()
+	rec := &delayRecorder{}
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.WithRetry(retry.Retry{
+			Attempts: 5,
+			Delay:    time.Hour,
+			Method:   retry.IncrementalDelay,
+		}),
+		dbtools.NoDelay(),
+		dbtools.OnDelay(rec.record),
+	)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = tr.Transaction(context.Background(), failingTx(assert.AnError, assert.AnError, assert.AnError))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, []int{1, 2, 3}, rec.attempts)
+	require.Len(t, rec.delays, 3)
+	assert.Less(t, rec.delays[0], rec.delays[1], "the delays should be computed")
+	assert.Less(t, rec.delays[1], rec.delays[2], "the delays should be computed")
+	assert.Contains(t, tr.Describe().Features, "NoDelay")
+}
+
+func testNoDelayQuery(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^DELETE").Error(&pgconn.ConnectError{}).Times(2)
+	sim.On("^DELETE").Exec("DELETE 1")
+	rec := &delayRecorder{}
+	tr, err := dbtools.New(sim,
+		dbtools.WithRetry(retry.Retry{
+			Attempts: 3,
+			Delay:    time.Hour,
+			Method:   retry.StandardDelay,
+		}),
+		dbtools.NoDelay(),
+		dbtools.OnDelay(rec.record),
+	)
+	require.NoError(t, err)
+
+	_, err = tr.Exec(context.Background(), "DELETE FROM sessions")
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Hour, time.Hour}, rec.delays)
+}
+
+func testNoDelayDeadlockBackoff(t *testing.T) {
+	t.Parallel()
+	rec := &delayRecorder{}
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(3, time.Hour),
+		dbtools.DeadlockBackoff(time.Hour, 2*time.Hour),
+		dbtools.NoDelay(),
+		dbtools.OnDelay(rec.record),
+	)
+	require.NoError(t, err)
+
+	deadlock := &pgconn.PgError{Code: "40P01"}
+	start := time.Now()
+	err = tr.Transaction(context.Background(), failingTx(deadlock, assert.AnError))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Len(t, rec.delays, 2)
+	assert.LessOrEqual(t, rec.delays[0], 2*time.Hour, "the conflict backoff should be reported")
+}
+
+func TestWithSleeper(t *testing.T) {
+	t.Parallel()
+	t.Run("Sleep", testWithSleeperSleep)
+	t.Run("Error", testWithSleeperError)
+	t.Run("WaitForReady", testWithSleeperWaitForReady)
+}
+
+func testWithSleeperSleep(t *testing.T) {
+	t.Parallel()
+	var slept []time.Duration
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.WithRetry(retry.Retry{
+			Attempts: 4,
+			Delay:    time.Hour,
+			Method:   retry.StandardDelay,
+		}),
+		dbtools.WithSleeper(func(_ context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = tr.Transaction(context.Background(), failingTx(assert.AnError, assert.AnError))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, []time.Duration{time.Hour, time.Hour}, slept)
+	assert.Contains(t, tr.Describe().Features, "WithSleeper")
+}
+
+func testWithSleeperError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^DELETE").Error(&pgconn.ConnectError{})
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(5, time.Hour),
+		dbtools.WithSleeper(func(context.Context, time.Duration) error {
+			return assert.AnError
+		}),
+	)
+	require.NoError(t, err)
+
+	_, err = tr.Exec(context.Background(), "DELETE FROM sessions")
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Len(t, sim.SQL(), 1, "the retries should stop when the sleeper fails")
+}
+
+func testWithSleeperWaitForReady(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("PING").Error(&pgconn.ConnectError{}).Times(2)
+	calls := 0
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(3, time.Hour),
+		dbtools.WithSleeper(func(context.Context, time.Duration) error {
+			calls++
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, tr.WaitForReady(context.Background()))
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,151 @@
+package dbtools
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Duration is a time.Duration that is encoded as a string in JSON, for
+// example "300ms".
+type Duration time.Duration
+
+// String returns the duration in the format of the time.Duration type.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Description is the effective configuration of a PGX object. It can be
+// encoded as JSON.
+type Description struct {
+	Label       string   `json:"label,omitempty"`
+	Attempts    int      `json:"attempts"`
+	Delay       Duration `json:"delay"`
+	GracePeriod Duration `json:"grace_period"`
+	// IsoLevel, AccessMode and DeferrableMode are the options the
+	// transactions are started with. They are empty when the TxOptions is not
+	// set, or the option is left to the server's default.
+	IsoLevel       string `json:"iso_level,omitempty"`
+	AccessMode     string `json:"access_mode,omitempty"`
+	DeferrableMode string `json:"deferrable_mode,omitempty"`
+	// Replicas is the number of the read replicas.
+	Replicas        int  `json:"replicas,omitempty"`
+	ReplicaFallback bool `json:"replica_fallback,omitempty"`
+	// Presets are the names of the registered presets, in order.
+	Presets []string `json:"presets,omitempty"`
+	// Parameters are the run-time parameters set in each transaction.
+	Parameters      map[string]string `json:"parameters,omitempty"`
+	StatementQuota  int               `json:"statement_quota,omitempty"`
+	RowQuota        int64             `json:"row_quota,omitempty"`
+	MaxResultRows   int64             `json:"max_result_rows,omitempty"`
+	MaxResultBytes  int64             `json:"max_result_bytes,omitempty"`
+	DeadlockBackoff *[2]Duration      `json:"deadlock_backoff,omitempty"`
+	// Hooks are the statement hooks that are installed on the transactions,
+	// in the order they are called.
+	Hooks []string `json:"hooks,omitempty"`
+	// Features are the names of the enabled options, in order.
+	Features []string `json:"features,omitempty"`
+}
+
+// Describe returns the effective configuration of the p, so it can be logged
+// when the service starts, or checked during an incident:
+//
+//	b, err := json.Marshal(tr.Describe())
+//	// handle the error!
+//	log.Printf("database policy: %s", b)
+func (p *PGX) Describe() Description {
+	d := Description{
+		Label:          p.label,
+		Attempts:       p.loop.Attempts,
+		Delay:          Duration(p.loop.Delay),
+		GracePeriod:    Duration(p.gracePeriod),
+		StatementQuota: p.quotaCopy().statements,
+		RowQuota:       p.quotaCopy().rows,
+		MaxResultRows:  p.results.rows,
+		MaxResultBytes: p.results.bytes,
+	}
+	for name := range p.presets {
+		d.Presets = append(d.Presets, name)
+	}
+	slices.Sort(d.Presets)
+	if p.txOptions != nil {
+		d.IsoLevel = string(p.txOptions.IsoLevel)
+		d.AccessMode = string(p.txOptions.AccessMode)
+		d.DeferrableMode = string(p.txOptions.DeferrableMode)
+	}
+	if p.replicas != nil {
+		d.Replicas = len(p.replicas.pools)
+		d.ReplicaFallback = p.replicas.fallback
+	}
+	if len(p.locals) > 0 {
+		d.Parameters = make(map[string]string, len(p.locals))
+		for _, l := range p.locals {
+			d.Parameters[l.name] = l.value
+		}
+	}
+	if p.conflicts != nil {
+		d.DeadlockBackoff = &[2]Duration{Duration(p.conflicts.base), Duration(p.conflicts.max)}
+	}
+
+	hooks := []struct {
+		name string
+		on   bool
+	}{
+		{"quota", p.quota != nil},
+		{"limits", p.soft != nil || p.maxAge > 0},
+		{"savepoints", p.savepoints != nil},
+		{"capture", p.sqlCapture != nil},
+		{"unbounded", p.unbounded != nil},
+		{"tracer", p.tracer != nil},
+	}
+	for _, h := range hooks {
+		if h.on {
+			d.Hooks = append(d.Hooks, h.name)
+		}
+	}
+
+	features := []struct {
+		name string
+		on   bool
+	}{
+		{"AuditUnboundedReads", p.unbounded != nil},
+		{"CaptureSQL", p.sqlCapture != nil},
+		{"Checkpoint", p.checkpoint != nil},
+		{"DeadlockBackoff", p.conflicts != nil},
+		{"EscalateLockTimeout", p.lockTimeouts != nil},
+		{"FailOnSavepointLeak", p.savepoints != nil && p.savepoints.warn == nil},
+		{"ForeignTables", len(p.probes) > 0},
+		{"KindRetry", len(p.kindRetry) > 0},
+		{"MaxTransactionAge", p.maxAge > 0},
+		{"NoDelay", p.noDelay},
+		{"OnCommitFailure", p.commitPolicy != nil},
+		{"OnDelay", p.onDelay != nil},
+		{"OnRollbackTimeout", p.onRollbackTimeout != nil},
+		{"SchemaVersion", p.schema != nil},
+		{"SoftLimits", p.soft != nil},
+		{"StrictConfig", p.strict},
+		{"TenantSetting", p.tenantSetting != ""},
+		{"TraceQueries", p.tracer != nil},
+		{"WarnOnSavepointLeak", p.savepoints != nil && p.savepoints.warn != nil},
+		{"WarmUp", len(p.warmUp) > 0},
+		{"Watchdog", p.watchdog != nil},
+		{"WithBudget", p.budget != nil},
+		{"WithClassifier", p.classifier != nil},
+		{"WithMetrics", p.metrics != nil},
+		{"WithMiddleware", len(p.middleware) > 0},
+		{"WithRetrier", p.retrier != nil},
+		{"WithSleeper", p.sleeper != nil},
+	}
+	for _, f := range features {
+		if f.on {
+			d.Features = append(d.Features, f.name)
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,93 @@
+package dbtools_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXDescribe(t *testing.T) {
+	t.Parallel()
+	t.Run("Defaults", testPGXDescribeDefaults)
+	t.Run("Configured", testPGXDescribeConfigured)
+	t.Run("SavepointLeak", testPGXDescribeSavepointLeak)
+	t.Run("JSON", testPGXDescribeJSON)
+}
+
+func testPGXDescribeDefaults(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(mocks.NewPool(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, dbtools.Description{
+		Attempts:    1,
+		Delay:       dbtools.Duration(300 * time.Millisecond),
+		GracePeriod: dbtools.Duration(30 * time.Second),
+	}, tr.Describe())
+}
+
+func testPGXDescribeConfigured(t *testing.T) {
+	t.Parallel()
+	budget, err := dbtools.NewBudget(10, time.Minute)
+	require.NoError(t, err)
+	tr, err := dbtools.NewWithReplicas(mocks.NewPool(t), []dbtools.Pool{mocks.NewPool(t)},
+		dbtools.Label("orders"),
+		dbtools.Retry(5, time.Second),
+		dbtools.TxOptions(pgx.TxOptions{IsoLevel: pgx.Serializable}),
+		dbtools.ReplicaFallback(true),
+		dbtools.WithPreset("write"),
+		dbtools.WithPreset("read"),
+		dbtools.SetLocal("statement_timeout", "5s"),
+		dbtools.StatementQuota(10),
+		dbtools.MaxResultRows(1000),
+		dbtools.DeadlockBackoff(time.Millisecond, time.Second),
+		dbtools.WithBudget(budget),
+		dbtools.CaptureSQL(dbtools.NewSQLCapture()),
+	)
+	require.NoError(t, err)
+
+	d := tr.Describe()
+	assert.Equal(t, "orders", d.Label)
+	assert.Equal(t, 5, d.Attempts)
+	assert.Equal(t, dbtools.Duration(time.Second), d.Delay)
+	assert.Equal(t, "serializable", d.IsoLevel)
+	assert.Empty(t, d.AccessMode)
+	assert.Equal(t, 1, d.Replicas)
+	assert.True(t, d.ReplicaFallback)
+	assert.Equal(t, []string{"read", "write"}, d.Presets)
+	assert.Equal(t, map[string]string{"statement_timeout": "5s"}, d.Parameters)
+	assert.Equal(t, 10, d.StatementQuota)
+	assert.EqualValues(t, 1000, d.MaxResultRows)
+	assert.Equal(t, &[2]dbtools.Duration{
+		dbtools.Duration(time.Millisecond), dbtools.Duration(time.Second),
+	}, d.DeadlockBackoff)
+	assert.Equal(t, []string{"quota", "capture"}, d.Hooks)
+	assert.Equal(t, []string{"CaptureSQL", "DeadlockBackoff", "WithBudget"}, d.Features)
+}
+
+func testPGXDescribeSavepointLeak(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(mocks.NewPool(t), dbtools.FailOnSavepointLeak())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FailOnSavepointLeak"}, tr.Describe().Features)
+
+	tr, err = dbtools.New(mocks.NewPool(t), dbtools.WarnOnSavepointLeak(func([]string) {}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"WarnOnSavepointLeak"}, tr.Describe().Features)
+}
+
+func testPGXDescribeJSON(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(mocks.NewPool(t), dbtools.Retry(3, 500*time.Millisecond))
+	require.NoError(t, err)
+
+	b, err := json.Marshal(tr.Describe())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"attempts":3,"delay":"500ms","grace_period":"30s"}`, string(b))
+}
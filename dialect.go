@@ -0,0 +1,19 @@
+package dbtools
+
+// Dialect holds the defaults of a database engine. It is used by the
+// database/sql adapters, for example the sqlxtx and the gormtx packages, to
+// retry the same kind of errors regardless of the engine. The MySQL dialect is
+// in the mysqldialect package.
+type Dialect struct {
+	// Name of the engine.
+	Name string
+	// Classifier decides which errors are retried.
+	Classifier Classifier
+}
+
+// Postgres retries the serialization failures, deadlocks and connection
+// errors.
+var Postgres = Dialect{
+	Name:       "postgres",
+	Classifier: IsRetryable,
+}
@@ -0,0 +1,15 @@
+package dbtools_test
+
+import (
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialect(t *testing.T) {
+	t.Parallel()
+	assert.True(t, dbtools.Postgres.Classifier(&pgconn.PgError{Code: "40P01"}))
+	assert.False(t, dbtools.Postgres.Classifier(&pgconn.PgError{Code: "23505"}))
+}
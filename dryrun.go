@@ -0,0 +1,41 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type dryRunKey struct{}
+
+// DryRun runs the fns in a transaction in the same way as the Transaction
+// method, but rolls the transaction back instead of committing it. It returns
+// nil if the transaction would have been committed, including the checks
+// that run before the commit, for example the FailOnSavepointLeak option. It
+// is useful for preflight checks and rehearsing migrations:
+//
+//	err := tr.DryRun(ctx, archiveOrders)
+//
+// The Checkpoint option is ignored, as the earlier groups of the functions
+// would not be visible to the later ones. The side effects of the fns outside
+// of the database are not rolled back.
+func (p *PGX) DryRun(ctx context.Context, fns ...func(pgx.Tx) error) error {
+	return p.Transaction(context.WithValue(ctx, dryRunKey{}, true), fns...)
+}
+
+// isDryRun returns true if the transactions of the ctx should be rolled back
+// instead of being committed.
+func isDryRun(ctx context.Context) bool {
+	v, _ := ctx.Value(dryRunKey{}).(bool)
+	return v
+}
+
+// rollbackDryRun rolls back the tx of a successful attempt of a dry run.
+func (p *PGX) rollbackDryRun(ctx context.Context, tx pgx.Tx) error {
+	if err := tx.Rollback(ctx); err != nil {
+		return txError(ctx, PhaseRollback, nil, p.classify(fmt.Errorf("rolling back dry run: %w", err)))
+	}
+
+	return nil
+}
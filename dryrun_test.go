@@ -0,0 +1,80 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXDryRun(t *testing.T) {
+	t.Parallel()
+	t.Run("Success", testPGXDryRunSuccess)
+	t.Run("Failure", testPGXDryRunFailure)
+	t.Run("Retried", testPGXDryRunRetried)
+	t.Run("CommitChecks", testPGXDryRunCommitChecks)
+}
+
+func testPGXDryRunSuccess(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^DELETE").Exec("DELETE 10")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.DryRun(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM orders")
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM orders", "ROLLBACK"}, sim.SQL())
+
+	err = tr.Transaction(ctx, func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, "COMMIT", sim.SQL()[len(sim.SQL())-1], "the ctx of the caller should not be changed")
+}
+
+func testPGXDryRunFailure(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.DryRun(context.Background(), func(pgx.Tx) error {
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NotContains(t, sim.SQL(), "COMMIT")
+}
+
+func testPGXDryRunRetried(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	err = tr.DryRun(context.Background(), failingTx(&pgconn.PgError{Code: "40001"}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "ROLLBACK", "BEGIN", "ROLLBACK"}, sim.SQL())
+}
+
+func testPGXDryRunCommitChecks(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^SAVEPOINT").Exec("SAVEPOINT")
+	tr, err := dbtools.New(sim, dbtools.FailOnSavepointLeak())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.DryRun(ctx, func(tx pgx.Tx) error {
+		return execAll(ctx, tx, "SAVEPOINT a")
+	})
+	assert.ErrorIs(t, err, dbtools.ErrSavepointLeak)
+}
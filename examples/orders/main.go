@@ -0,0 +1,96 @@
+// Command orders is an example service that shows how the subsystems of the
+// dbtools package compose. Orders are created in retried transactions through
+// a bound repository, and the "order.created" events are written to the
+// transactional outbox in the same transaction, then relayed to the log.
+//
+// Usage:
+//
+//	DATABASE_URL=postgres://... orders -addr :8080
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/outbox"
+	"github.com/arsham/retry/v3"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, os.Args[1:])
+	stop()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("orders", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	dsn := fs.String("dsn", os.Getenv("DATABASE_URL"), "connection string")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pool, err := dbtools.NewPoolWithRetry(ctx, *dsn,
+		retry.Retry{Attempts: 30, Delay: time.Second},
+		dbtools.WithApplicationName("orders", "dev"),
+	)
+	if err != nil {
+		return fmt.Errorf("connecting to the database: %w", err)
+	}
+	defer pool.Close()
+
+	tr, err := dbtools.New(pool,
+		dbtools.Retry(10, 100*time.Millisecond),
+		dbtools.WithClassifier(dbtools.IsRetryable),
+		dbtools.Label("orders"),
+	)
+	if err != nil {
+		return err
+	}
+	if err := migrate(ctx, tr); err != nil {
+		return err
+	}
+
+	store, err := NewStore(tr)
+	if err != nil {
+		return err
+	}
+	relay, err := outbox.NewRelay(tr, func(_ context.Context, msg outbox.Message) error {
+		log.Printf("delivering %s: %s", msg.Topic, msg.Payload)
+		return nil
+	}, outbox.OnError(func(err error) { log.Printf("relaying: %v", err) }))
+	if err != nil {
+		return err
+	}
+	go relay.Run(ctx)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           NewHandler(store),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown) //nolint:errcheck // the server is stopping anyway.
+	}()
+	log.Printf("listening on %s", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/outbox"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T) (*httptest.Server, *dbtesting.Simulator) {
+	t.Helper()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.WithClassifier(dbtools.IsRetryable),
+	)
+	require.NoError(t, err)
+	store, err := NewStore(tr)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(NewHandler(store))
+	t.Cleanup(srv.Close)
+
+	return srv, sim
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^CREATE`).Exec("CREATE TABLE")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	require.NoError(t, migrate(context.Background(), tr))
+	assert.Equal(t, []string{"BEGIN", ordersSchema, outbox.Schema, "COMMIT"}, sim.SQL())
+}
+
+func TestCreateOrder(t *testing.T) {
+	t.Parallel()
+	t.Run("Created", testCreateOrderCreated)
+	t.Run("Retried", testCreateOrderRetried)
+	t.Run("InvalidQuantity", testCreateOrderInvalidQuantity)
+	t.Run("BadRequest", testCreateOrderBadRequest)
+}
+
+func testCreateOrderCreated(t *testing.T) {
+	t.Parallel()
+	srv, sim := newServer(t)
+	now := time.Now().UTC()
+	sim.On(`^INSERT INTO orders`).Return([]string{"id", "created_at"}, []any{int64(1), now})
+	sim.On(`^INSERT INTO dbtools_outbox`).Exec("INSERT 0 1")
+
+	res, err := http.Post(srv.URL+"/orders", "application/json",
+		strings.NewReader(`{"item":"book","quantity":2}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	stmts := sim.Statements()
+	require.Len(t, stmts, 4)
+	assert.Equal(t, "COMMIT", stmts[3].SQL)
+	assert.Equal(t, "order.created", stmts[2].Args[0])
+	assert.Contains(t, string(stmts[2].Args[1].([]byte)), `"item":"book"`)
+}
+
+func testCreateOrderRetried(t *testing.T) {
+	t.Parallel()
+	srv, sim := newServer(t)
+	sim.On(`^INSERT INTO orders`).Error(&pgconn.PgError{Code: "40001"}).Times(1)
+	sim.On(`^INSERT INTO orders`).Return([]string{"id", "created_at"}, []any{int64(1), time.Now()})
+	sim.On(`^INSERT INTO dbtools_outbox`).Exec("INSERT 0 1")
+
+	res, err := http.Post(srv.URL+"/orders", "application/json",
+		strings.NewReader(`{"item":"book","quantity":2}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "ROLLBACK", sim.SQL()[2])
+}
+
+func testCreateOrderInvalidQuantity(t *testing.T) {
+	t.Parallel()
+	srv, sim := newServer(t)
+
+	res, err := http.Post(srv.URL+"/orders", "application/json",
+		strings.NewReader(`{"item":"book","quantity":0}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, sim.SQL())
+}
+
+func testCreateOrderBadRequest(t *testing.T) {
+	t.Parallel()
+	srv, sim := newServer(t)
+
+	res, err := http.Post(srv.URL+"/orders", "application/json", strings.NewReader(`{`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Empty(t, sim.SQL())
+}
+
+func TestGetOrder(t *testing.T) {
+	t.Parallel()
+	srv, sim := newServer(t)
+	sim.On(`WHERE id = \$1`).Return([]string{"id", "item", "quantity", "created_at"},
+		[]any{int64(1), "book", 2, time.Now()}).Times(1)
+	sim.On(`WHERE id = \$1`).Return([]string{"id", "item", "quantity", "created_at"})
+
+	res, err := http.Get(srv.URL + "/orders/1")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = http.Get(srv.URL + "/orders/2")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, err = http.Get(srv.URL + "/orders/abc")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/outbox"
+	"github.com/jackc/pgx/v5"
+)
+
+const ordersSchema = `CREATE TABLE IF NOT EXISTS orders (
+	id         BIGSERIAL PRIMARY KEY,
+	item       TEXT NOT NULL,
+	quantity   INT NOT NULL CHECK (quantity > 0),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// migrations are run in order in a single transaction when the service
+// starts.
+var migrations = []string{
+	ordersSchema,
+	outbox.Schema,
+}
+
+func migrate(ctx context.Context, tr dbtools.Transactioner) error {
+	return tr.Transaction(ctx, func(tx pgx.Tx) error {
+		for i, m := range migrations {
+			if _, err := tx.Exec(ctx, m); err != nil {
+				return fmt.Errorf("running migration #%d: %w", i, err)
+			}
+		}
+		return nil
+	})
+}
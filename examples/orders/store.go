@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/outbox"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errNotFound        = errors.New("order not found")
+	errInvalidQuantity = errors.New("quantity should be positive")
+)
+
+// Order is an order of a number of items.
+type Order struct {
+	ID        int64     `json:"id"`
+	Item      string    `json:"item"`
+	Quantity  int       `json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store is the repository of the orders. Each function runs in its own
+// retried transaction.
+type Store struct {
+	Create func(ctx context.Context, o Order) (Order, error)
+	Get    func(ctx context.Context, id int64) (Order, error)
+}
+
+// NewStore binds the queries to the Store.
+func NewStore(tr dbtools.Transactioner) (*Store, error) {
+	s := &Store{}
+	if err := dbtools.Bind(tr, s, queries{}); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// queries implements the Store in a transaction.
+type queries struct{}
+
+func (queries) Create(ctx context.Context, tx pgx.Tx, o Order) (Order, error) {
+	if o.Quantity <= 0 {
+		return Order{}, &retry.StopError{Err: errInvalidQuantity}
+	}
+	const query = `INSERT INTO orders (item, quantity) VALUES ($1, $2)
+		RETURNING id, created_at`
+	err := tx.QueryRow(ctx, query, o.Item, o.Quantity).Scan(&o.ID, &o.CreatedAt)
+	if err != nil {
+		return Order{}, fmt.Errorf("creating order: %w", err)
+	}
+
+	payload, err := json.Marshal(o)
+	if err != nil {
+		return Order{}, &retry.StopError{Err: err}
+	}
+	if err := outbox.Enqueue(ctx, tx, "order.created", payload); err != nil {
+		return Order{}, err
+	}
+
+	return o, nil
+}
+
+func (queries) Get(ctx context.Context, tx pgx.Tx, id int64) (Order, error) {
+	const query = `SELECT id, item, quantity, created_at FROM orders WHERE id = $1`
+	var o Order
+	err := tx.QueryRow(ctx, query, id).Scan(&o.ID, &o.Item, &o.Quantity, &o.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Order{}, &retry.StopError{Err: errNotFound}
+	}
+	if err != nil {
+		return Order{}, fmt.Errorf("reading order: %w", err)
+	}
+
+	return o, nil
+}
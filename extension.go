@@ -0,0 +1,75 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Extension registers the types of a PostgreSQL extension on a connection.
+// The signature matches the RegisterTypes functions of the libraries like
+// pgvector-go, therefore they can be used directly.
+type Extension func(ctx context.Context, conn *pgx.Conn) error
+
+var (
+	// HStore registers the hstore type of the hstore extension.
+	HStore = BaseType("hstore", pgtype.HstoreCodec{})
+
+	// CIText registers the citext type of the citext extension.
+	CIText = BaseType("citext", &pgtype.TextCodec{})
+)
+
+// BaseType returns an Extension that registers the base type with the given
+// name with the codec, and its array type if it exists. The extension should
+// be created in the database before the connection is established.
+func BaseType(name string, codec pgtype.Codec) Extension {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		var oid, arrayOID uint32
+		const query = `SELECT oid, typarray FROM pg_type WHERE oid = $1::text::regtype::oid`
+		err := conn.QueryRow(ctx, query, name).Scan(&oid, &arrayOID)
+		if err != nil {
+			return fmt.Errorf("loading type %q: %w", name, err)
+		}
+		tm := conn.TypeMap()
+		typ := &pgtype.Type{Name: name, OID: oid, Codec: codec}
+		tm.RegisterType(typ)
+		if arrayOID != 0 {
+			tm.RegisterType(&pgtype.Type{
+				Name:  "_" + name,
+				OID:   arrayOID,
+				Codec: &pgtype.ArrayCodec{ElementType: typ},
+			})
+		}
+
+		return nil
+	}
+}
+
+// AfterConnect returns a function to be used as the AfterConnect hook of the
+// pgxpool.Config that registers all the exts on each new connection.
+func AfterConnect(exts ...Extension) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		for _, ext := range exts {
+			if err := ext(ctx, conn); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// RegisterExtensions sets up the config to register the exts on each new
+// connection. If the config already has an AfterConnect hook, it is called
+// before registering the exts.
+//
+//	config, err := pgxpool.ParseConfig(dsn)
+//	// handle the error!
+//	dbtools.RegisterExtensions(config, dbtools.HStore, pgxvec.RegisterTypes)
+//	pool, err := pgxpool.NewWithConfig(ctx, config)
+func RegisterExtensions(config *pgxpool.Config, exts ...Extension) {
+	WithAfterConnect(AfterConnect(exts...))(config)
+}
@@ -0,0 +1,93 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterExtensions(t *testing.T) {
+	t.Parallel()
+	t.Run("Order", testRegisterExtensionsOrder)
+	t.Run("Error", testRegisterExtensionsError)
+	t.Run("RealDatabase", testRegisterExtensionsRealDatabase)
+}
+
+func testRegisterExtensionsOrder(t *testing.T) {
+	t.Parallel()
+	calls := []string{}
+	ext := func(name string) dbtools.Extension {
+		return func(context.Context, *pgx.Conn) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	config := &pgxpool.Config{
+		AfterConnect: func(context.Context, *pgx.Conn) error {
+			calls = append(calls, "prev")
+			return nil
+		},
+	}
+	dbtools.RegisterExtensions(config, ext("a"), ext("b"))
+	err := config.AfterConnect(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prev", "a", "b"}, calls)
+}
+
+func testRegisterExtensionsError(t *testing.T) {
+	t.Parallel()
+	config := &pgxpool.Config{}
+	dbtools.RegisterExtensions(config,
+		func(context.Context, *pgx.Conn) error { return assert.AnError },
+		func(context.Context, *pgx.Conn) error {
+			t.Error("didn't expect to receive this call")
+			return nil
+		},
+	)
+	err := config.AfterConnect(context.Background(), nil)
+	assert.ErrorIs(t, err, assert.AnError)
+
+	config = &pgxpool.Config{
+		AfterConnect: func(context.Context, *pgx.Conn) error { return assert.AnError },
+	}
+	dbtools.RegisterExtensions(config, func(context.Context, *pgx.Conn) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	err = config.AfterConnect(context.Background(), nil)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testRegisterExtensionsRealDatabase(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("slow test")
+	}
+	ctx := context.Background()
+	addr := getDB(t)
+	conn, err := pgx.Connect(ctx, addr)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, `CREATE EXTENSION IF NOT EXISTS hstore`)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close(ctx))
+
+	config, err := pgxpool.ParseConfig(addr)
+	require.NoError(t, err)
+	dbtools.RegisterExtensions(config, dbtools.HStore)
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer db.Close()
+
+	bar := "bar"
+	want := pgtype.Hstore{"foo": &bar}
+	var got pgtype.Hstore
+	err = db.QueryRow(ctx, `SELECT $1::hstore`, want).Scan(&got)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
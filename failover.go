@@ -0,0 +1,136 @@
+package dbtools
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// FailoverPolicy defines when the Failover switches to the next pool and how
+// long a failed pool is avoided.
+type FailoverPolicy struct {
+	// ShouldFailover decides whether the error returned from beginning a
+	// transaction should mark the pool as unhealthy. If nil, the
+	// IsConnectionError function is used, therefore the cancellation and the
+	// deadline of the caller's context don't mark the pool as unhealthy.
+	ShouldFailover func(error) bool
+	// Cooldown is the duration a failed pool is avoided before it is tried
+	// again. The default value is 5s.
+	Cooldown time.Duration
+}
+
+// Failover is a Pool that begins transactions on a primary pool, and fails
+// over to the standby pools when the primary returns connection errors. A
+// failed pool is avoided for the Cooldown duration of the policy, and after
+// that it is preferred again over the pools that come after it. It is safe
+// to use concurrently.
+//
+// The error that causes the failover is returned to the caller, therefore the
+// next attempt of the retry loop goes to the next pool:
+//
+//	pool, err := dbtools.NewFailover(dbtools.FailoverPolicy{}, primary, standby)
+//	// handle the error!
+//	tr, err := dbtools.New(pool, dbtools.Retry(10, time.Second))
+type Failover struct {
+	shouldFailover func(error) bool
+	pools          []Pool
+	mu             sync.Mutex
+	failedUntil    []time.Time
+	cooldown       time.Duration
+}
+
+// NewFailover returns a Failover that uses the primary pool when it is
+// healthy and the standbys in order when it is not. It returns an
+// ErrEmptyDatabase error if any of the pools are nil.
+func NewFailover(policy FailoverPolicy, primary Pool, standbys ...Pool) (*Failover, error) {
+	pools := append([]Pool{primary}, standbys...)
+	for _, p := range pools {
+		if p == nil {
+			return nil, ErrEmptyDatabase
+		}
+	}
+	f := &Failover{
+		pools:          pools,
+		failedUntil:    make([]time.Time, len(pools)),
+		shouldFailover: policy.ShouldFailover,
+		cooldown:       policy.Cooldown,
+	}
+	if f.shouldFailover == nil {
+		f.shouldFailover = IsConnectionError
+	}
+	if f.cooldown <= 0 {
+		f.cooldown = 5 * time.Second
+	}
+
+	return f, nil
+}
+
+// Begin begins a transaction on the first healthy pool.
+func (f *Failover) Begin(ctx context.Context) (pgx.Tx, error) {
+	i := f.pick()
+	tx, err := f.pools[i].Begin(ctx)
+	f.report(i, err)
+
+	return tx, err
+}
+
+// BeginTx begins a transaction with the opts on the first healthy pool. It
+// returns an ErrNoTxBeginner error wrapped in a *retry.StopError if the pool
+// does not implement the TxBeginner interface.
+func (f *Failover) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	i := f.pick()
+	b, ok := f.pools[i].(TxBeginner)
+	if !ok {
+		return nil, &retry.StopError{Err: ErrNoTxBeginner}
+	}
+	tx, err := b.BeginTx(ctx, opts)
+	f.report(i, err)
+
+	return tx, err
+}
+
+// Healthy returns the health status of the pools, starting with the primary.
+func (f *Failover) Healthy() []bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	ret := make([]bool, len(f.pools))
+	for i, until := range f.failedUntil {
+		ret[i] = !now.Before(until)
+	}
+
+	return ret
+}
+
+// pick returns the index of the first healthy pool. If none of the pools are
+// healthy, it returns the one that recovers sooner.
+func (f *Failover) pick() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	soonest := 0
+	for i, until := range f.failedUntil {
+		if !now.Before(until) {
+			return i
+		}
+		if until.Before(f.failedUntil[soonest]) {
+			soonest = i
+		}
+	}
+
+	return soonest
+}
+
+func (f *Failover) report(i int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case err == nil:
+		f.failedUntil[i] = time.Time{}
+	case f.shouldFailover(err):
+		f.failedUntil[i] = time.Now().Add(f.cooldown)
+	}
+}
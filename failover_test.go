@@ -0,0 +1,153 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFailover(t *testing.T) {
+	t.Parallel()
+	_, err := dbtools.NewFailover(dbtools.FailoverPolicy{}, nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+	_, err = dbtools.NewFailover(dbtools.FailoverPolicy{}, mocks.NewPool(t), nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+	_, err = dbtools.NewFailover(dbtools.FailoverPolicy{}, mocks.NewPool(t), mocks.NewPool(t))
+	assert.NoError(t, err)
+}
+
+func TestFailover(t *testing.T) {
+	t.Parallel()
+	t.Run("Primary", testFailoverPrimary)
+	t.Run("Standby", testFailoverStandby)
+	t.Run("OtherErrors", testFailoverOtherErrors)
+	t.Run("ContextErrors", testFailoverContextErrors)
+	t.Run("Recovery", testFailoverRecovery)
+	t.Run("BeginTx", testFailoverBeginTx)
+}
+
+func testFailoverPrimary(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	standby := mocks.NewPool(t)
+	f, err := dbtools.NewFailover(dbtools.FailoverPolicy{}, primary, standby)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	primary.On("Begin", mock.Anything).Return(tx, nil).Once()
+	got, err := f.Begin(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, tx, got)
+	assert.Equal(t, []bool{true, true}, f.Healthy())
+}
+
+func testFailoverStandby(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	standby := mocks.NewPool(t)
+	f, err := dbtools.NewFailover(dbtools.FailoverPolicy{}, primary, standby)
+	require.NoError(t, err)
+
+	tr, err := dbtools.New(f, dbtools.Retry(10, time.Millisecond))
+	require.NoError(t, err)
+
+	connErr := &pgconn.PgError{Code: "08006"}
+	tx := mocks.NewPGXTx(t)
+	primary.On("Begin", mock.Anything).Return(nil, connErr).Once()
+	standby.On("Begin", mock.Anything).Return(tx, nil).Twice()
+	tx.On("Commit", mock.Anything).Return(nil).Twice()
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, true}, f.Healthy())
+
+	// The primary is still in cooldown.
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+}
+
+func testFailoverOtherErrors(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	standby := mocks.NewPool(t)
+	f, err := dbtools.NewFailover(dbtools.FailoverPolicy{}, primary, standby)
+	require.NoError(t, err)
+
+	primary.On("Begin", mock.Anything).Return(nil, assert.AnError).Twice()
+	for range 2 {
+		_, err = f.Begin(context.Background())
+		require.ErrorIs(t, err, assert.AnError)
+	}
+	assert.Equal(t, []bool{true, true}, f.Healthy())
+}
+
+func testFailoverContextErrors(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	standby := mocks.NewPool(t)
+	f, err := dbtools.NewFailover(dbtools.FailoverPolicy{}, primary, standby)
+	require.NoError(t, err)
+
+	primary.On("Begin", mock.Anything).Return(nil, context.DeadlineExceeded).Once()
+	primary.On("Begin", mock.Anything).Return(nil, context.Canceled).Once()
+	for range 2 {
+		_, err = f.Begin(context.Background())
+		require.Error(t, err)
+	}
+	assert.Equal(t, []bool{true, true}, f.Healthy())
+}
+
+func testFailoverRecovery(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	standby := mocks.NewPool(t)
+	cooldown := 50 * time.Millisecond
+	f, err := dbtools.NewFailover(dbtools.FailoverPolicy{
+		ShouldFailover: func(error) bool { return true },
+		Cooldown:       cooldown,
+	}, primary, standby)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	primary.On("Begin", mock.Anything).Return(nil, assert.AnError).Once()
+	standby.On("Begin", mock.Anything).Return(nil, assert.AnError).Once()
+	_, err = f.Begin(context.Background())
+	require.Error(t, err)
+	_, err = f.Begin(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, []bool{false, false}, f.Healthy())
+
+	time.Sleep(cooldown)
+	primary.On("Begin", mock.Anything).Return(tx, nil).Once()
+	got, err := f.Begin(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, tx, got)
+	assert.True(t, f.Healthy()[0])
+}
+
+func testFailoverBeginTx(t *testing.T) {
+	t.Parallel()
+	primary, b := newTxBeginnerPool(t)
+	standby := mocks.NewPool(t)
+	f, err := dbtools.NewFailover(dbtools.FailoverPolicy{}, primary, standby)
+	require.NoError(t, err)
+
+	opts := pgx.TxOptions{IsoLevel: pgx.Serializable}
+	b.On("BeginTx", mock.Anything, opts).Return(nil, &pgconn.ConnectError{}).Once()
+	_, err = f.BeginTx(context.Background(), opts)
+	require.Error(t, err)
+
+	_, err = f.BeginTx(context.Background(), opts)
+	assert.ErrorIs(t, err, dbtools.ErrNoTxBeginner)
+	var stop *retry.StopError
+	assert.ErrorAs(t, err, &stop)
+}
@@ -0,0 +1,71 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IsFDWError returns true if the err is a foreign data wrapper error, which
+// has the HV SQLSTATE class.
+func IsFDWError(err error) bool {
+	return strings.HasPrefix(SQLState(err), "HV")
+}
+
+// fdwTransient contains the foreign data wrapper error codes that can succeed
+// on a retry. Other errors in this class are about the definition of the
+// foreign tables and options, and retrying doesn't change the outcome.
+var fdwTransient = map[string]struct{}{
+	"HV001": {}, // fdw_out_of_memory
+	"HV014": {}, // fdw_too_many_handles
+	"HV00L": {}, // fdw_unable_to_create_execution
+	"HV00M": {}, // fdw_unable_to_create_reply
+	"HV00N": {}, // fdw_unable_to_establish_connection
+}
+
+// FDWClassifier returns a Classifier that retries the transient foreign data
+// wrapper errors, such as when the connection to the remote server can't be
+// established, and stops on the rest of the FDW errors. Any other errors are
+// passed to the next Classifier. If next is nil, other errors are retried.
+func FDWClassifier(next Classifier) Classifier {
+	return func(err error) bool {
+		if IsFDWError(err) {
+			_, ok := fdwTransient[SQLState(err)]
+			return ok
+		}
+		if next == nil {
+			return true
+		}
+
+		return next(err)
+	}
+}
+
+// probeSteps returns the steps that probe the foreign tables.
+func (p *PGX) probeSteps(ctx context.Context) []Step {
+	ret := make([]Step, 0, len(p.probes))
+	for _, table := range p.probes {
+		name := table.Sanitize()
+		query := "SELECT 1 FROM " + name + " LIMIT 1"
+		ret = append(ret, Step{
+			Name:     "probe " + name,
+			internal: true,
+			Fn: func(tx pgx.Tx) error {
+				rows, err := tx.Query(ctx, query)
+				if err != nil {
+					return fmt.Errorf("probing foreign table: %w", err)
+				}
+				rows.Close()
+				if err := rows.Err(); err != nil {
+					return fmt.Errorf("probing foreign table: %w", err)
+				}
+
+				return nil
+			},
+		})
+	}
+
+	return ret
+}
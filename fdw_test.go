@@ -0,0 +1,129 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFDWClassifier(t *testing.T) {
+	t.Parallel()
+	never := func(error) bool { return false }
+	tcs := map[string]struct {
+		err  error
+		next dbtools.Classifier
+		want bool
+	}{
+		"connection":       {&pgconn.PgError{Code: "HV00N"}, never, true},
+		"out of memory":    {&pgconn.PgError{Code: "HV001"}, never, true},
+		"table not found":  {&pgconn.PgError{Code: "HV00R"}, nil, false},
+		"option not found": {&pgconn.PgError{Code: "HV00J"}, nil, false},
+		"other nil next":   {assert.AnError, nil, true},
+		"other with next":  {assert.AnError, never, false},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := dbtools.FDWClassifier(tc.next)
+			assert.Equal(t, tc.want, c(tc.err))
+		})
+	}
+}
+
+func TestIsFDWError(t *testing.T) {
+	t.Parallel()
+	assert.True(t, dbtools.IsFDWError(&pgconn.PgError{Code: "HV000"}))
+	assert.False(t, dbtools.IsFDWError(&pgconn.PgError{Code: "40001"}))
+	assert.False(t, dbtools.IsFDWError(assert.AnError))
+}
+
+func TestForeignTables(t *testing.T) {
+	t.Parallel()
+	t.Run("Probe", testForeignTablesProbe)
+	t.Run("ProbeError", testForeignTablesProbeError)
+	t.Run("PermanentError", testForeignTablesPermanentError)
+}
+
+func testForeignTablesProbe(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db,
+		dbtools.ForeignTables(pgx.Identifier{"remote", "users"}),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	rows := mocks.NewPGXRows(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Query", mock.Anything, `SELECT 1 FROM "remote"."users" LIMIT 1`).
+		Return(rows, nil).Once()
+	rows.On("Close").Return().Once()
+	rows.On("Err").Return(nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	calls := 0
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func testForeignTablesProbeError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	total := 3
+	tr, err := dbtools.New(db,
+		dbtools.Retry(total, time.Millisecond),
+		dbtools.ForeignTables(pgx.Identifier{"remote_users"}),
+	)
+	require.NoError(t, err)
+
+	connErr := &pgconn.PgError{Code: "HV00N"}
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("Query", mock.Anything, mock.Anything).Return(nil, connErr).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	require.ErrorIs(t, err, connErr)
+	assert.Contains(t, err.Error(), "remote_users")
+}
+
+func testForeignTablesPermanentError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db,
+		dbtools.Retry(10, time.Millisecond),
+		dbtools.ForeignTables(),
+	)
+	require.NoError(t, err)
+
+	tableErr := &pgconn.PgError{Code: "HV00R"}
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		return tableErr
+	})
+	require.ErrorIs(t, err, tableErr)
+}
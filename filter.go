@@ -0,0 +1,145 @@
+package dbtools
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Filter builds the WHERE clause of a query from optional values. The nil
+// values, including the nil pointers, maps and slices, are skipped, therefore
+// the fields of a search request can be passed directly. The values are
+// always sent as parameters, and the columns are quoted as identifiers, which
+// makes them case-sensitive. A column can be qualified with the table name,
+// for example "u.name".
+//
+//	var f dbtools.Filter
+//	f.Eq("status", req.Status).
+//		In("id", req.IDs).
+//		Range("created_at", req.From, req.To)
+//	sql, args := f.Append(`SELECT id, name FROM users`)
+//	err := p.Query(ctx, scan, sql+` ORDER BY id LIMIT 100`, args...)
+//
+// The zero value is ready to use and matches all rows.
+type Filter struct {
+	conds []condition
+}
+
+type condition struct {
+	column string
+	op     string
+	value  any
+}
+
+// Eq adds the "column = value" condition if the value is not nil.
+func (f *Filter) Eq(column string, value any) *Filter {
+	return f.add(column, "=", value)
+}
+
+// NotEq adds the "column <> value" condition if the value is not nil.
+func (f *Filter) NotEq(column string, value any) *Filter {
+	return f.add(column, "<>", value)
+}
+
+// In adds the "column = ANY(values)" condition if the values slice is not
+// nil. An empty, non-nil slice matches no rows.
+func (f *Filter) In(column string, values any) *Filter {
+	return f.add(column, "= ANY", values)
+}
+
+// Gt adds the "column > value" condition if the value is not nil.
+func (f *Filter) Gt(column string, value any) *Filter {
+	return f.add(column, ">", value)
+}
+
+// Gte adds the "column >= value" condition if the value is not nil.
+func (f *Filter) Gte(column string, value any) *Filter {
+	return f.add(column, ">=", value)
+}
+
+// Lt adds the "column < value" condition if the value is not nil.
+func (f *Filter) Lt(column string, value any) *Filter {
+	return f.add(column, "<", value)
+}
+
+// Lte adds the "column <= value" condition if the value is not nil.
+func (f *Filter) Lte(column string, value any) *Filter {
+	return f.add(column, "<=", value)
+}
+
+// Range adds the inclusive bounds of the column. Either of the bounds can be
+// nil for an open range.
+func (f *Filter) Range(column string, from, to any) *Filter {
+	return f.Gte(column, from).Lte(column, to)
+}
+
+func (f *Filter) add(column, op string, value any) *Filter {
+	if isNil(value) {
+		return f
+	}
+	f.conds = append(f.conds, condition{column: column, op: op, value: value})
+	return f
+}
+
+// Where returns the "WHERE ..." clause and its arguments, with the
+// placeholders starting at $1. It returns an empty string if there are no
+// conditions.
+func (f *Filter) Where() (string, []any) {
+	return f.where(0)
+}
+
+// Append appends the WHERE clause to the sql and returns the arguments after
+// the args. The placeholders of the conditions are numbered after the args,
+// therefore the sql can have its own parameters. The sql should not have a
+// WHERE clause of its own, but it can be a sub-query.
+func (f *Filter) Append(sql string, args ...any) (string, []any) {
+	where, values := f.where(len(args))
+	if where != "" {
+		sql += " " + where
+	}
+
+	return sql, append(args, values...)
+}
+
+func (f *Filter) where(offset int) (string, []any) {
+	if len(f.conds) == 0 {
+		return "", nil
+	}
+	var b strings.Builder
+	args := make([]any, 0, len(f.conds))
+	b.WriteString("WHERE ")
+	for i, c := range f.conds {
+		if i > 0 {
+			b.WriteString(" AND ")
+		}
+		b.WriteString(pgx.Identifier(strings.Split(c.column, ".")).Sanitize())
+		b.WriteByte(' ')
+		b.WriteString(c.op)
+		placeholder := "$" + strconv.Itoa(offset+len(args)+1)
+		if c.op == "= ANY" {
+			placeholder = fmt.Sprintf("(%s)", placeholder)
+		} else {
+			b.WriteByte(' ')
+		}
+		b.WriteString(placeholder)
+		args = append(args, c.value)
+	}
+
+	return b.String(), args
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
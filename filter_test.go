@@ -0,0 +1,93 @@
+package dbtools_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterWhere(t *testing.T) {
+	t.Parallel()
+	status := "active"
+	var noStatus *string
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tcs := map[string]struct {
+		build func(*dbtools.Filter)
+		sql   string
+		args  []any
+	}{
+		"empty": {
+			build: func(*dbtools.Filter) {},
+		},
+		"nil values": {
+			build: func(f *dbtools.Filter) {
+				var ids []int
+				f.Eq("status", nil).Eq("status", noStatus).In("id", ids).Range("created_at", nil, nil)
+			},
+		},
+		"equality": {
+			build: func(f *dbtools.Filter) {
+				f.Eq("status", &status).NotEq("kind", 3)
+			},
+			sql:  `WHERE "status" = $1 AND "kind" <> $2`,
+			args: []any{&status, 3},
+		},
+		"in": {
+			build: func(f *dbtools.Filter) {
+				f.In("u.id", []int{1, 2})
+			},
+			sql:  `WHERE "u"."id" = ANY($1)`,
+			args: []any{[]int{1, 2}},
+		},
+		"empty in": {
+			build: func(f *dbtools.Filter) {
+				f.In("id", []int{})
+			},
+			sql:  `WHERE "id" = ANY($1)`,
+			args: []any{[]int{}},
+		},
+		"open range": {
+			build: func(f *dbtools.Filter) {
+				f.Range("created_at", from, nil).Lt("age", 30).Gt("score", 1.5)
+			},
+			sql:  `WHERE "created_at" >= $1 AND "age" < $2 AND "score" > $3`,
+			args: []any{from, 30, 1.5},
+		},
+		"quoted column": {
+			build: func(f *dbtools.Filter) {
+				f.Eq(`name" = '' OR 1=1 --`, "x")
+			},
+			sql:  `WHERE "name"" = '' OR 1=1 --" = $1`,
+			args: []any{"x"},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var f dbtools.Filter
+			tc.build(&f)
+			sql, args := f.Where()
+			assert.Equal(t, tc.sql, sql)
+			assert.Equal(t, tc.args, args)
+		})
+	}
+}
+
+func TestFilterAppend(t *testing.T) {
+	t.Parallel()
+	var f dbtools.Filter
+	sql, args := f.Append(`SELECT id FROM users WHERE tenant = $1`, "acme")
+	assert.Equal(t, `SELECT id FROM users WHERE tenant = $1`, sql)
+	assert.Equal(t, []any{"acme"}, args)
+
+	f.Gte("age", 18).Lte("age", 65)
+	sql, args = f.Append(`SELECT id FROM users`)
+	assert.Equal(t, `SELECT id FROM users WHERE "age" >= $1 AND "age" <= $2`, sql)
+	assert.Equal(t, []any{18, 65}, args)
+
+	sql, args = f.Append(`SELECT id FROM (SELECT * FROM users WHERE tenant = $1) u`, "acme")
+	assert.Equal(t, `SELECT id FROM (SELECT * FROM users WHERE tenant = $1) u WHERE "age" >= $2 AND "age" <= $3`, sql)
+	assert.Equal(t, []any{"acme", 18, 65}, args)
+}
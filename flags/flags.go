@@ -0,0 +1,228 @@
+// Package flags stores feature flags in a versioned table. The flags are
+// written in the caller's transactions, cached in memory, and invalidated in
+// all processes with NOTIFY when the transactions are committed.
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultTable is the name of the feature flags table.
+const DefaultTable = "dbtools_flags"
+
+// Channel is the notification channel the changes are published on. The
+// payload is the name of the flag.
+const Channel = "dbtools_flags"
+
+// Schema creates the feature flags table. Run it in your migrations.
+const Schema = `CREATE TABLE IF NOT EXISTS ` + DefaultTable + ` (
+	name       TEXT PRIMARY KEY,
+	enabled    BOOLEAN NOT NULL,
+	version    BIGINT NOT NULL DEFAULT 1,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);`
+
+// ErrEmptyName is returned when a flag is set without a name.
+var ErrEmptyName = errors.New("empty flag name")
+
+// Flag is the state of a feature flag. The Version is incremented on each
+// write, and is zero for the flags that are not in the table.
+type Flag struct {
+	Name      string
+	Enabled   bool
+	Version   int64
+	UpdatedAt time.Time
+}
+
+// Listener is the contract for receiving the notifications. The *pgx.Conn
+// satisfies this interface. The connection should be dedicated to the
+// listener.
+//
+//go:generate mockery --name Listener --filename flags_listener_mock.go --structname FlagsListener --output ../mocks
+type Listener interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+}
+
+// ConfigFunc is used for configuring the Store.
+type ConfigFunc func(*Store)
+
+// CacheTTL sets how long the flags are cached. The cache is invalidated
+// sooner when the Listen method is running. Zero disables the cache. The
+// default value is 1m.
+func CacheTTL(d time.Duration) ConfigFunc {
+	return func(s *Store) {
+		s.ttl = d
+	}
+}
+
+// Store reads the feature flags through a cache. It is safe for concurrent
+// use.
+type Store struct {
+	tr  *dbtools.PGX
+	ttl time.Duration
+
+	mu    sync.Mutex
+	cache map[string]entry
+	// gen is incremented by each invalidation, so the reads that started
+	// before it don't cache the old values.
+	gen uint64
+}
+
+type entry struct {
+	flag    Flag
+	expires time.Time
+}
+
+// New returns a Store that reads the flags with the tr. The tr's pool should
+// implement the dbtools.Querier interface.
+func New(tr *dbtools.PGX, conf ...ConfigFunc) (*Store, error) {
+	if tr == nil {
+		return nil, dbtools.ErrEmptyDatabase
+	}
+	s := &Store{
+		tr:    tr,
+		ttl:   time.Minute,
+		cache: make(map[string]entry),
+	}
+	for _, fn := range conf {
+		fn(s)
+	}
+
+	return s, nil
+}
+
+// Get returns the flag from the cache, or reads it from the table.
+func (s *Store) Get(ctx context.Context, name string) (Flag, error) {
+	f, gen, ok := s.cached(name)
+	if ok {
+		return f, nil
+	}
+
+	f = Flag{Name: name}
+	const query = `SELECT enabled, version, updated_at FROM ` + DefaultTable + ` WHERE name = $1`
+	err := s.tr.QueryRow(ctx, func(row pgx.Row) error {
+		err := row.Scan(&f.Enabled, &f.Version, &f.UpdatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}, query, name)
+	if err != nil {
+		return Flag{}, fmt.Errorf("reading flag %q: %w", name, err)
+	}
+	s.store(f, gen)
+
+	return f, nil
+}
+
+// Enabled returns true if the flag is enabled. The flags that are not in the
+// table are disabled.
+func (s *Store) Enabled(ctx context.Context, name string) (bool, error) {
+	f, err := s.Get(ctx, name)
+	return f.Enabled, err
+}
+
+// Set writes the flag in the tx, and notifies the listeners when the tx is
+// committed. It returns the new version of the flag.
+//
+// The flag is invalidated in the cache of the Store after the tx is committed
+// with the dbtools.AfterCommit function, and in the other processes by their
+// Listen methods when the notification arrives. If the tx is not started by a
+// dbtools.PGX, call the Invalidate method after committing it.
+func (s *Store) Set(ctx context.Context, tx pgx.Tx, name string, enabled bool) (int64, error) {
+	if name == "" {
+		return 0, ErrEmptyName
+	}
+	const query = `INSERT INTO ` + DefaultTable + ` (name, enabled) VALUES ($1, $2)
+	ON CONFLICT (name) DO UPDATE SET
+		enabled = EXCLUDED.enabled,
+		version = ` + DefaultTable + `.version + 1,
+		updated_at = now()
+	RETURNING version`
+	var version int64
+	if err := tx.QueryRow(ctx, query, name, enabled).Scan(&version); err != nil {
+		return 0, fmt.Errorf("writing flag %q: %w", name, err)
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, Channel, name); err != nil {
+		return 0, fmt.Errorf("notifying flag %q: %w", name, err)
+	}
+	//nolint:errcheck // the caller invalidates the flags of the other txs.
+	dbtools.AfterCommit(tx, func() { s.Invalidate(name) })
+
+	return version, nil
+}
+
+// Invalidate removes the flags from the cache. It removes all flags if no
+// names are given.
+func (s *Store) Invalidate(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	if len(names) == 0 {
+		clear(s.cache)
+		return
+	}
+	for _, name := range names {
+		delete(s.cache, name)
+	}
+}
+
+// Listen listens to the changes on the conn and invalidates the cached flags
+// until the ctx is cancelled or the connection fails. The whole cache is
+// invalidated when it starts and stops listening, as the notifications might
+// have been missed.
+func (s *Store) Listen(ctx context.Context, conn Listener) error {
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return fmt.Errorf("listening to flags: %w", err)
+	}
+	s.Invalidate()
+	defer s.Invalidate()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("waiting for notifications: %w", err)
+		}
+		if n.Channel == Channel {
+			s.Invalidate(n.Payload)
+		}
+	}
+}
+
+// cached returns the cached flag, and the generation of the cache to store a
+// new value with.
+func (s *Store) cached(name string) (Flag, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.cache[name]
+	if !ok || time.Now().After(e.expires) {
+		return Flag{}, s.gen, false
+	}
+
+	return e.flag, s.gen, true
+}
+
+// store caches the f if the cache is not invalidated since the gen.
+func (s *Store) store(f Flag, gen uint64) {
+	if s.ttl <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gen != gen {
+		return
+	}
+	s.cache[f.Name] = entry{flag: f, expires: time.Now().Add(s.ttl)}
+}
@@ -0,0 +1,315 @@
+package flags_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/flags"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newStore(t *testing.T, conf ...flags.ConfigFunc) (*flags.Store, *dbtesting.Simulator) {
+	t.Helper()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim, dbtools.Retry(1, time.Millisecond))
+	require.NoError(t, err)
+	s, err := flags.New(tr, conf...)
+	require.NoError(t, err)
+
+	return s, sim
+}
+
+func countSelects(sim *dbtesting.Simulator) int {
+	count := 0
+	for _, sql := range sim.SQL() {
+		if len(sql) > 6 && sql[:6] == "SELECT" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := flags.New(nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func TestStoreGet(t *testing.T) {
+	t.Parallel()
+	t.Run("Cached", testStoreGetCached)
+	t.Run("Unknown", testStoreGetUnknown)
+	t.Run("NoCache", testStoreGetNoCache)
+	t.Run("Error", testStoreGetError)
+	t.Run("Invalidated", testStoreGetInvalidated)
+}
+
+// blockingPool blocks the QueryRow calls until the release channel is closed.
+type blockingPool struct {
+	*dbtesting.Simulator
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingPool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	select {
+	case <-b.started:
+	default:
+		close(b.started)
+	}
+	<-b.release
+	return b.Simulator.QueryRow(ctx, sql, args...)
+}
+
+func testStoreGetInvalidated(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT enabled`).
+		Return([]string{"enabled", "version", "updated_at"}, []any{false, int64(1), time.Now()}).
+		Times(1)
+	sim.On(`^SELECT enabled`).
+		Return([]string{"enabled", "version", "updated_at"}, []any{true, int64(2), time.Now()})
+	pool := &blockingPool{Simulator: sim, started: make(chan struct{}), release: make(chan struct{})}
+	tr, err := dbtools.New(pool)
+	require.NoError(t, err)
+	s, err := flags.New(tr)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	done := make(chan bool)
+	go func() {
+		ok, err := s.Enabled(ctx, "beta")
+		assert.NoError(t, err)
+		done <- ok
+	}()
+	<-pool.started
+	s.Invalidate("beta")
+	close(pool.release)
+	assert.False(t, <-done, "the read should return the value it read")
+
+	ok, err := s.Enabled(ctx, "beta")
+	require.NoError(t, err)
+	assert.True(t, ok, "the old value should not be cached after the invalidation")
+}
+
+func testStoreGetCached(t *testing.T) {
+	t.Parallel()
+	s, sim := newStore(t)
+	now := time.Now()
+	sim.On(`^SELECT enabled`).
+		Return([]string{"enabled", "version", "updated_at"}, []any{true, int64(3), now})
+
+	ctx := context.Background()
+	for range 3 {
+		f, err := s.Get(ctx, "beta")
+		require.NoError(t, err)
+		assert.Equal(t, flags.Flag{Name: "beta", Enabled: true, Version: 3, UpdatedAt: now}, f)
+	}
+	assert.Equal(t, 1, countSelects(sim))
+
+	s.Invalidate("beta")
+	ok, err := s.Enabled(ctx, "beta")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, countSelects(sim))
+}
+
+func testStoreGetUnknown(t *testing.T) {
+	t.Parallel()
+	s, sim := newStore(t)
+	sim.On(`^SELECT enabled`).Return([]string{"enabled", "version", "updated_at"})
+
+	f, err := s.Get(context.Background(), "beta")
+	require.NoError(t, err)
+	assert.Equal(t, flags.Flag{Name: "beta"}, f)
+}
+
+func testStoreGetNoCache(t *testing.T) {
+	t.Parallel()
+	s, sim := newStore(t, flags.CacheTTL(0))
+	sim.On(`^SELECT enabled`).
+		Return([]string{"enabled", "version", "updated_at"}, []any{false, int64(1), time.Now()})
+
+	ctx := context.Background()
+	for range 2 {
+		ok, err := s.Enabled(ctx, "beta")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+	assert.Equal(t, 2, countSelects(sim))
+}
+
+func testStoreGetError(t *testing.T) {
+	t.Parallel()
+	s, sim := newStore(t)
+	sim.On(`^SELECT enabled`).Error(assert.AnError)
+
+	_, err := s.Get(context.Background(), "beta")
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "beta")
+}
+
+func TestStoreSet(t *testing.T) {
+	t.Parallel()
+	t.Run("EmptyName", testStoreSetEmptyName)
+	t.Run("InvalidatesAfterCommit", testStoreSetInvalidatesAfterCommit)
+	t.Run("Rollback", testStoreSetRollback)
+	t.Run("NotifyError", testStoreSetNotifyError)
+}
+
+func testStoreSetEmptyName(t *testing.T) {
+	t.Parallel()
+	s, _ := newStore(t)
+	_, err := s.Set(context.Background(), nil, "", true)
+	assert.ErrorIs(t, err, flags.ErrEmptyName)
+}
+
+func testStoreSetInvalidatesAfterCommit(t *testing.T) {
+	t.Parallel()
+	s, sim := newStore(t)
+	sim.On(`^SELECT enabled`).
+		Return([]string{"enabled", "version", "updated_at"}, []any{false, int64(1), time.Now()}).
+		Times(1)
+	sim.On(`^SELECT enabled`).
+		Return([]string{"enabled", "version", "updated_at"}, []any{true, int64(2), time.Now()})
+	sim.On(`^INSERT INTO dbtools_flags`).Return([]string{"version"}, []any{int64(2)})
+	sim.On(`pg_notify`).Exec("SELECT 1")
+
+	ctx := context.Background()
+	ok, err := s.Enabled(ctx, "beta")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	var version int64
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		version, err = s.Set(ctx, tx, "beta", true)
+		if err != nil {
+			return err
+		}
+		ok, err := s.Enabled(ctx, "beta")
+		require.NoError(t, err)
+		assert.False(t, ok, "the cache should only be invalidated after the commit")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, version)
+
+	var notify dbtesting.Statement
+	for _, st := range sim.Statements() {
+		if st.SQL == "SELECT pg_notify($1, $2)" {
+			notify = st
+		}
+	}
+	assert.Equal(t, []any{flags.Channel, "beta"}, notify.Args)
+
+	ok, err = s.Enabled(ctx, "beta")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func testStoreSetRollback(t *testing.T) {
+	t.Parallel()
+	s, sim := newStore(t)
+	sim.On(`^SELECT enabled`).
+		Return([]string{"enabled", "version", "updated_at"}, []any{false, int64(1), time.Now()})
+	sim.On(`^INSERT INTO dbtools_flags`).Return([]string{"version"}, []any{int64(2)})
+	sim.On(`pg_notify`).Exec("SELECT 1")
+
+	ctx := context.Background()
+	_, err := s.Enabled(ctx, "beta")
+	require.NoError(t, err)
+
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		if _, err := s.Set(ctx, tx, "beta", true); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+
+	before := len(sim.SQL())
+	_, err = s.Enabled(ctx, "beta")
+	require.NoError(t, err)
+	assert.Len(t, sim.SQL(), before, "the cache should be kept")
+}
+
+func testStoreSetNotifyError(t *testing.T) {
+	t.Parallel()
+	s, sim := newStore(t)
+	sim.On(`^INSERT INTO dbtools_flags`).Return([]string{"version"}, []any{int64(2)})
+	sim.On(`pg_notify`).Error(assert.AnError)
+
+	tx, err := sim.Begin(context.Background())
+	require.NoError(t, err)
+	_, err = s.Set(context.Background(), tx, "beta", true)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestStoreListen(t *testing.T) {
+	t.Parallel()
+	t.Run("ListenError", testStoreListenListenError)
+	t.Run("Invalidates", testStoreListenInvalidates)
+	t.Run("ConnectionError", testStoreListenConnectionError)
+}
+
+func testStoreListenListenError(t *testing.T) {
+	t.Parallel()
+	s, _ := newStore(t)
+	l := mocks.NewFlagsListener(t)
+	l.On("Exec", mock.Anything, "LISTEN "+flags.Channel).
+		Return(pgconn.CommandTag{}, assert.AnError).Once()
+
+	err := s.Listen(context.Background(), l)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testStoreListenInvalidates(t *testing.T) {
+	t.Parallel()
+	s, sim := newStore(t)
+	sim.On(`^SELECT enabled`).
+		Return([]string{"enabled", "version", "updated_at"}, []any{true, int64(1), time.Now()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := s.Get(ctx, "beta")
+	require.NoError(t, err)
+
+	l := mocks.NewFlagsListener(t)
+	l.On("Exec", mock.Anything, "LISTEN "+flags.Channel).Return(pgconn.CommandTag{}, nil).Once()
+	l.On("WaitForNotification", mock.Anything).
+		Return(&pgconn.Notification{Channel: flags.Channel, Payload: "beta"}, nil).Once()
+	l.On("WaitForNotification", mock.Anything).
+		Run(func(mock.Arguments) { cancel() }).
+		Return(nil, context.Canceled).Once()
+
+	err = s.Listen(ctx, l)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.Get(context.Background(), "beta")
+	require.NoError(t, err)
+	assert.Equal(t, 2, countSelects(sim))
+}
+
+func testStoreListenConnectionError(t *testing.T) {
+	t.Parallel()
+	s, _ := newStore(t)
+	l := mocks.NewFlagsListener(t)
+	l.On("Exec", mock.Anything, "LISTEN "+flags.Channel).Return(pgconn.CommandTag{}, nil).Once()
+	l.On("WaitForNotification", mock.Anything).Return(nil, assert.AnError).Once()
+
+	err := s.Listen(context.Background(), l)
+	assert.ErrorIs(t, err, assert.AnError)
+}
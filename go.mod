@@ -6,6 +6,7 @@ toolchain go1.22.4
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/arsham/retry/v2 v2.0.0
 	github.com/arsham/retry/v3 v3.0.0
 	github.com/docker/docker v26.1.3+incompatible
 	github.com/jackc/pgx/v5 v5.6.0
@@ -13,6 +14,7 @@ require (
 	github.com/stretchr/testify v1.9.0
 	github.com/testcontainers/testcontainers-go v0.31.0
 	github.com/testcontainers/testcontainers-go/modules/postgres v0.31.0
+	google.golang.org/grpc v1.64.0
 )
 
 require (
@@ -71,7 +73,6 @@ require (
 	golang.org/x/text v0.16.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240617180043-68d350f18fd4 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240617180043-68d350f18fd4 // indirect
-	google.golang.org/grpc v1.64.0 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
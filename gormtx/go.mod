@@ -0,0 +1,31 @@
+module github.com/arsham/dbtools/v4/gormtx
+
+go 1.22.0
+
+toolchain go1.22.4
+
+replace github.com/arsham/dbtools/v4 => ../
+
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/arsham/dbtools/v4 v4.0.0-00010101000000-000000000000
+	github.com/arsham/retry/v3 v3.0.0
+	github.com/jackc/pgx/v5 v5.6.0
+	github.com/stretchr/testify v1.9.0
+	gorm.io/driver/postgres v1.5.9
+	gorm.io/gorm v1.25.12
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.1 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,188 @@
+// Package gormtx runs retried transactions on a *gorm.DB with the same
+// semantics as the dbtools.PGX.
+package gormtx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+	"gorm.io/gorm"
+)
+
+// ConfigFunc is used for configuring the Transactor.
+type ConfigFunc func(*Transactor)
+
+// WithRetry sets the retrier. The default retrier tries only once.
+func WithRetry(r retry.Retry) ConfigFunc {
+	return func(t *Transactor) {
+		t.loop = r
+	}
+}
+
+// Retry sets the retry strategy. If you want to pass a Retry object you can
+// use the WithRetry function instead.
+func Retry(attempts int, delay time.Duration) ConfigFunc {
+	return func(t *Transactor) {
+		t.loop.Attempts = attempts
+		t.loop.Delay = delay
+	}
+}
+
+// GracePeriod sets the timeout of waiting for a rollback. The default value
+// is 30s.
+func GracePeriod(delay time.Duration) ConfigFunc {
+	return func(t *Transactor) {
+		t.gracePeriod = delay
+	}
+}
+
+// TxOptions sets the options used for beginning transactions.
+func TxOptions(opts sql.TxOptions) ConfigFunc {
+	return func(t *Transactor) {
+		t.txOptions = &opts
+	}
+}
+
+// WithClassifier sets the function that decides which errors are retried.
+// By default all errors are retried. Use the dbtools.IsRetryable function to
+// only retry the serialization failures, deadlocks and connection errors.
+func WithClassifier(c dbtools.Classifier) ConfigFunc {
+	return func(t *Transactor) {
+		t.classifier = c
+	}
+}
+
+// WithDialect sets the classifier of the d, so only the errors that are
+// transient on the database engine are retried.
+func WithDialect(d dbtools.Dialect) ConfigFunc {
+	return func(t *Transactor) {
+		t.classifier = d.Classifier
+	}
+}
+
+// Transactor is a concurrent-safe object that retries a transaction on a
+// *gorm.DB until it succeeds. See the dbtools.PGX documentation for the
+// semantics of the retries, panics and rollbacks.
+type Transactor struct {
+	txOptions   *sql.TxOptions
+	classifier  dbtools.Classifier
+	loop        retry.Retry
+	gracePeriod time.Duration
+}
+
+// New returns a Transactor. It sets the retry attempts to 1 if the value is
+// less than 1.
+func New(conf ...ConfigFunc) *Transactor {
+	obj := &Transactor{
+		gracePeriod: 30 * time.Second,
+		loop: retry.Retry{
+			Attempts: 1,
+			Delay:    300 * time.Millisecond,
+			Method:   retry.IncrementalDelay,
+		},
+	}
+	for _, fn := range conf {
+		fn(obj)
+	}
+	if obj.loop.Attempts < 1 {
+		obj.loop.Attempts = 1
+	}
+
+	return obj
+}
+
+// Transaction runs the fns in a transaction on the db and commits it. If any
+// of the fns return an error or panic, the transaction is rolled back and
+// retried. It stops retrying if any of the errors are wrapped in a
+// *retry.StopError or when the context is cancelled. It returns a
+// dbtools.ErrEmptyDatabase error if the db is nil, and a dbtools.ErrNilStep
+// error if any of the fns are nil, without starting a transaction.
+func (t *Transactor) Transaction(ctx context.Context, db *gorm.DB, fns ...func(tx *gorm.DB) error) error {
+	if db == nil {
+		return dbtools.ErrEmptyDatabase
+	}
+	for i, fn := range fns {
+		if fn == nil {
+			return fmt.Errorf("%w: function #%d", dbtools.ErrNilStep, i)
+		}
+	}
+
+	return t.loop.DoContext(ctx, func() error {
+		return t.attempt(ctx, db, fns)
+	})
+}
+
+func (t *Transactor) attempt(ctx context.Context, db *gorm.DB, fns []func(*gorm.DB) error) error {
+	var opts []*sql.TxOptions
+	if t.txOptions != nil {
+		opts = append(opts, t.txOptions)
+	}
+	tx := db.WithContext(ctx).Begin(opts...)
+	if err := tx.Error; err != nil {
+		return t.classify(fmt.Errorf("starting transaction: %w", err))
+	}
+
+	for _, fn := range fns {
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					// In this case we want to rollback and panic so the
+					// retry library can handle it.
+					panic(t.rollbackWithErr(tx, fmt.Errorf("%v", r)))
+				}
+			}()
+			err = fn(tx)
+		}()
+
+		if err == nil {
+			continue
+		}
+
+		return t.rollbackWithErr(tx, t.classify(err))
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return t.classify(fmt.Errorf("committing transaction: %w", err))
+	}
+
+	return nil
+}
+
+func (t *Transactor) classify(err error) error {
+	if err == nil || t.classifier == nil || t.classifier(err) {
+		return err
+	}
+	var stop *retry.StopError
+	if errors.As(err, &stop) {
+		return err
+	}
+
+	return &retry.StopError{Err: err}
+}
+
+// rollbackWithErr rolls back the tx. The database/sql package doesn't accept
+// a context for rolling back, therefore the grace period is applied by
+// giving up waiting for the rollback when it is passed.
+func (t *Transactor) rollbackWithErr(tx *gorm.DB, err error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- tx.Rollback().Error
+	}()
+
+	select {
+	case er := <-done:
+		if er != nil {
+			return fmt.Errorf("(rolling back transaction: %w): %w", er, err)
+		}
+	case <-time.After(t.gracePeriod):
+		return fmt.Errorf("(rolling back transaction: %w): %w", context.DeadlineExceeded, err)
+	}
+
+	return err
+}
@@ -0,0 +1,226 @@
+package gormtx_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/gormtx"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+
+	gdb, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	require.NoError(t, err)
+
+	return gdb, mock
+}
+
+func TestTransaction(t *testing.T) {
+	t.Parallel()
+	t.Run("NilDB", testTransactionNilDB)
+	t.Run("NilFunction", testTransactionNilFunction)
+	t.Run("Commit", testTransactionCommit)
+	t.Run("BeginError", testTransactionBeginError)
+	t.Run("Retry", testTransactionRetry)
+	t.Run("StopError", testTransactionStopError)
+	t.Run("Retryable", testTransactionRetryable)
+	t.Run("Dialect", testTransactionDialect)
+	t.Run("Panic", testTransactionPanic)
+	t.Run("CommitError", testTransactionCommitError)
+	t.Run("TxOptions", testTransactionTxOptions)
+}
+
+func testTransactionNilDB(t *testing.T) {
+	t.Parallel()
+	err := gormtx.New().Transaction(context.Background(), nil, func(*gorm.DB) error { return nil })
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func testTransactionNilFunction(t *testing.T) {
+	t.Parallel()
+	db, _ := newDB(t)
+	err := gormtx.New().Transaction(context.Background(), db, nil)
+	assert.ErrorIs(t, err, dbtools.ErrNilStep)
+}
+
+func testTransactionCommit(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := gormtx.New().Transaction(context.Background(), db, func(tx *gorm.DB) error {
+		return tx.Exec("UPDATE users SET seen = true").Error
+	})
+	assert.NoError(t, err)
+}
+
+func testTransactionBeginError(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+
+	mock.ExpectBegin().WillReturnError(assert.AnError)
+	err := gormtx.New().Transaction(context.Background(), db, func(*gorm.DB) error { return nil })
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "starting transaction")
+}
+
+func testTransactionRetry(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr := gormtx.New(gormtx.Retry(3, time.Millisecond))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	calls := 0
+	err := tr.Transaction(context.Background(), db, func(*gorm.DB) error {
+		calls++
+		if calls < 3 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func testTransactionStopError(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr := gormtx.New(gormtx.Retry(3, time.Millisecond))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	calls := 0
+	err := tr.Transaction(context.Background(), db, func(*gorm.DB) error {
+		calls++
+		return &retry.StopError{Err: assert.AnError}
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, calls)
+}
+
+func testTransactionRetryable(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr := gormtx.New(
+		gormtx.Retry(5, time.Millisecond),
+		gormtx.WithClassifier(dbtools.IsRetryable),
+	)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	calls := 0
+	err := tr.Transaction(context.Background(), db, func(*gorm.DB) error {
+		calls++
+		if calls == 1 {
+			return &pgconn.PgError{Code: "40001"}
+		}
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 2, calls)
+}
+
+func testTransactionDialect(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr := gormtx.New(
+		gormtx.Retry(5, time.Millisecond),
+		gormtx.WithDialect(dbtools.Postgres),
+	)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	calls := 0
+	err := tr.Transaction(context.Background(), db, func(*gorm.DB) error {
+		calls++
+		if calls == 1 {
+			return &pgconn.PgError{Code: "40P01"}
+		}
+		return &pgconn.PgError{Code: "23505"}
+	})
+	assert.Equal(t, "23505", dbtools.SQLState(err))
+	assert.Equal(t, 2, calls)
+}
+
+func testTransactionPanic(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr := gormtx.New(gormtx.Retry(2, time.Millisecond))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback().WillReturnError(errors.New("rollback"))
+
+	var err error
+	assert.NotPanics(t, func() {
+		err = tr.Transaction(context.Background(), db, func(*gorm.DB) error {
+			panic("oops")
+		})
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oops")
+	assert.Contains(t, err.Error(), "rolling back transaction")
+}
+
+func testTransactionCommitError(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(assert.AnError)
+
+	err := gormtx.New().Transaction(context.Background(), db, func(*gorm.DB) error { return nil })
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "committing transaction")
+}
+
+func testTransactionTxOptions(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr := gormtx.New(gormtx.TxOptions(sql.TxOptions{ReadOnly: true}))
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err := tr.Transaction(context.Background(), db, func(*gorm.DB) error { return nil })
+	assert.NoError(t, err)
+}
@@ -0,0 +1,42 @@
+package dbtools
+
+import (
+	"context"
+	"time"
+)
+
+type gracePeriodKey struct{}
+
+// WithGracePeriod returns a copy of the ctx that overrides the GracePeriod of
+// the transactions that are called with it. Use it for the transactions that
+// hold many locks, where waiting longer for the rollback is preferable to
+// leaving the transaction on the server. Non-positive values are ignored.
+func WithGracePeriod(ctx context.Context, d time.Duration) context.Context {
+	if d <= 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, gracePeriodKey{}, d)
+}
+
+// grace returns the grace period of the rollbacks of the transactions called
+// with the ctx.
+func (p *PGX) grace(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(gracePeriodKey{}).(time.Duration); ok {
+		return d
+	}
+
+	return p.gracePeriod
+}
+
+// rollbackTimedOut reports a rollback that didn't finish within the grace
+// period. The transaction might be left open on the server until its
+// connection is closed.
+func (p *PGX) rollbackTimedOut(err error) {
+	if m, ok := p.metrics.(RollbackMetrics); ok {
+		m.ObserveRollbackTimeout(p.label)
+	}
+	if p.onRollbackTimeout != nil {
+		p.onRollbackTimeout(p.label, err)
+	}
+}
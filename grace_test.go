@@ -0,0 +1,97 @@
+package dbtools_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// rollbackMetrics records the rollback timeouts.
+type rollbackMetrics struct {
+	recordingMetrics
+	mu       sync.Mutex
+	timeouts []string
+}
+
+func (r *rollbackMetrics) ObserveRollbackTimeout(label string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeouts = append(r.timeouts, label)
+}
+
+// newHangingRollbackPool returns a pool whose transactions don't roll back
+// until the context of the rollback is done.
+func newHangingRollbackPool(t *testing.T) *mocks.Pool {
+	t.Helper()
+	db := mocks.NewPool(t)
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}).Once()
+	return db
+}
+
+func TestWithGracePeriod(t *testing.T) {
+	t.Parallel()
+	t.Run("Timeout", testWithGracePeriodTimeout)
+	t.Run("NoTimeout", testWithGracePeriodNoTimeout)
+}
+
+func testWithGracePeriodTimeout(t *testing.T) {
+	t.Parallel()
+	metrics := &rollbackMetrics{}
+	var labels []string
+	var errs []error
+	tr, err := dbtools.New(newHangingRollbackPool(t),
+		dbtools.Label("transfer"),
+		dbtools.GracePeriod(time.Hour),
+		dbtools.WithMetrics(metrics),
+		dbtools.OnRollbackTimeout(func(label string, err error) {
+			labels = append(labels, label)
+			errs = append(errs, err)
+		}),
+	)
+	require.NoError(t, err)
+
+	ctx := dbtools.WithGracePeriod(context.Background(), 10*time.Millisecond)
+	start := time.Now()
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		return assert.AnError
+	})
+	assert.Less(t, time.Since(start), time.Minute)
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []string{"transfer"}, labels)
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], context.DeadlineExceeded)
+	assert.Equal(t, []string{"transfer"}, metrics.timeouts)
+}
+
+func testWithGracePeriodNoTimeout(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+	called := false
+	tr, err := dbtools.New(db, dbtools.OnRollbackTimeout(func(string, error) {
+		called = true
+	}))
+	require.NoError(t, err)
+
+	ctx := dbtools.WithGracePeriod(context.Background(), 0)
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.False(t, called)
+}
@@ -0,0 +1,197 @@
+// Package grpctx runs the gRPC handlers in retried transactions. The
+// transaction is stored in the context of the handler, and is committed when
+// the handler returns without an error:
+//
+//	srv := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(grpctx.UnaryServerInterceptor(p)),
+//		grpc.ChainStreamInterceptor(grpctx.StreamServerInterceptor(p)),
+//	)
+//
+//	func (s *server) CreateOrder(ctx context.Context, req *pb.CreateOrderRequest) (*pb.Order, error) {
+//		tx := grpctx.Tx(ctx)
+//		...
+//	}
+package grpctx
+
+import (
+	"context"
+	"errors"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ConfigFunc is used for configuring the interceptors.
+type ConfigFunc func(*config)
+
+// Skip sets the function that decides which methods are served without a
+// transaction. The fullMethod is in the "/package.service/method" format.
+func Skip(fn func(fullMethod string) bool) ConfigFunc {
+	return func(c *config) {
+		c.skip = fn
+	}
+}
+
+type config struct {
+	skip func(fullMethod string) bool
+}
+
+func newConfig(conf []ConfigFunc) *config {
+	c := &config{}
+	for _, fn := range conf {
+		fn(c)
+	}
+
+	return c
+}
+
+func (c *config) skipped(fullMethod string) bool {
+	return c.skip != nil && c.skip(fullMethod)
+}
+
+type txKey struct{}
+
+// Tx returns the transaction of the ctx, or nil if the handler is not served
+// by the interceptors.
+func Tx(ctx context.Context) pgx.Tx {
+	tx, _ := ctx.Value(txKey{}).(pgx.Tx)
+	return tx
+}
+
+// Code returns the gRPC status code of the err. If the err has a gRPC status,
+// its code is returned. Otherwise the code is decided by the class of the
+// err, for example codes.Aborted is returned when the transaction has failed
+// with serialization failures or deadlocks after all the retries.
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	var s interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &s) {
+		return s.GRPCStatus().Code()
+	}
+	switch dbtools.ErrorClass(err) {
+	case dbtools.ClassCanceled:
+		return codes.Canceled
+	case dbtools.ClassTimeout:
+		return codes.DeadlineExceeded
+	case dbtools.ClassConnection:
+		return codes.Unavailable
+	case dbtools.ClassSerialization, dbtools.ClassDeadlock:
+		return codes.Aborted
+	case dbtools.ClassIntegrity:
+		return codes.FailedPrecondition
+	case dbtools.ClassQuota:
+		return codes.ResourceExhausted
+	}
+
+	return codes.Internal
+}
+
+// toStatus returns the err as a gRPC status error. The errors that already
+// have a status are returned as they are.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	var s interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &s) {
+		return s.GRPCStatus().Err()
+	}
+
+	return status.Error(Code(err), err.Error())
+}
+
+// handlerErr returns the err of the handler for the transaction. The errors
+// with a gRPC status are returned by the application, therefore they are not
+// retried.
+func handlerErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return &retry.StopError{Err: err}
+	}
+
+	return err
+}
+
+// UnaryServerInterceptor returns an interceptor that runs each unary handler
+// in a transaction with the p. The handler is called again when the
+// transaction is retried. The errors with a gRPC status, for example the
+// ones made with the status.Error function, roll back the transaction
+// without retrying it. The other errors are retried with the policy of the
+// p, and are converted to a status with the Code function when all attempts
+// fail.
+func UnaryServerInterceptor(p *dbtools.PGX, conf ...ConfigFunc) grpc.UnaryServerInterceptor {
+	c := newConfig(conf)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if c.skipped(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		var resp any
+		err := p.Transaction(ctx, func(tx pgx.Tx) error {
+			var err error
+			resp, err = handler(context.WithValue(ctx, txKey{}, tx), req)
+			return handlerErr(err)
+		})
+		if err != nil {
+			return nil, toStatus(err)
+		}
+
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that runs each stream
+// handler in a transaction with the p. The messages are not buffered,
+// therefore the transaction is retried only if the handler fails before
+// sending or receiving any messages. The errors are converted to a status
+// like the UnaryServerInterceptor.
+func StreamServerInterceptor(p *dbtools.PGX, conf ...ConfigFunc) grpc.StreamServerInterceptor {
+	c := newConfig(conf)
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if c.skipped(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		err := p.Transaction(ss.Context(), func(tx pgx.Tx) error {
+			s := &stream{
+				ServerStream: ss,
+				ctx:          context.WithValue(ss.Context(), txKey{}, tx),
+			}
+			err := handlerErr(handler(srv, s))
+			if err != nil && s.used {
+				return &retry.StopError{Err: err}
+			}
+			return err
+		})
+
+		return toStatus(err)
+	}
+}
+
+// stream passes the context with the transaction to the handler, and records
+// whether any messages are sent or received.
+type stream struct {
+	grpc.ServerStream
+	ctx  context.Context //nolint:containedctx // it is the context of the stream.
+	used bool
+}
+
+func (s *stream) Context() context.Context { return s.ctx }
+
+func (s *stream) SendMsg(m any) error {
+	s.used = true
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *stream) RecvMsg(m any) error {
+	s.used = true
+	return s.ServerStream.RecvMsg(m)
+}
@@ -0,0 +1,184 @@
+package grpctx_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/grpctx"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newPGX(t *testing.T, sim *dbtesting.Simulator) *dbtools.PGX {
+	t.Helper()
+	p, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+	return p
+}
+
+var unaryInfo = &grpc.UnaryServerInfo{FullMethod: "/orders.Orders/Create"}
+
+func TestCode(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		err  error
+		want codes.Code
+	}{
+		"nil":           {nil, codes.OK},
+		"status":        {fmt.Errorf("foo: %w", status.Error(codes.NotFound, "nope")), codes.NotFound},
+		"canceled":      {context.Canceled, codes.Canceled},
+		"timeout":       {context.DeadlineExceeded, codes.DeadlineExceeded},
+		"connection":    {&pgconn.ConnectError{}, codes.Unavailable},
+		"serialization": {&pgconn.PgError{Code: "40001"}, codes.Aborted},
+		"deadlock":      {&pgconn.PgError{Code: "40P01"}, codes.Aborted},
+		"integrity":     {&pgconn.PgError{Code: "23505"}, codes.FailedPrecondition},
+		"other":         {assert.AnError, codes.Internal},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, grpctx.Code(tc.err))
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	t.Parallel()
+	t.Run("Commit", testUnaryServerInterceptorCommit)
+	t.Run("Status", testUnaryServerInterceptorStatus)
+	t.Run("Exhausted", testUnaryServerInterceptorExhausted)
+	t.Run("Skip", testUnaryServerInterceptorSkip)
+}
+
+func testUnaryServerInterceptorCommit(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^INSERT").Error(&pgconn.PgError{Code: "40001"}).Times(1)
+	sim.On("^INSERT").Exec("INSERT 0 1")
+	calls := 0
+	intercept := grpctx.UnaryServerInterceptor(newPGX(t, sim))
+	resp, err := intercept(context.Background(), "req", unaryInfo, func(ctx context.Context, req any) (any, error) {
+		calls++
+		_, err := grpctx.Tx(ctx).Exec(ctx, "INSERT INTO orders DEFAULT VALUES")
+		return fmt.Sprintf("%s-%d", req, calls), err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "req-2", resp)
+	assert.Equal(t, "COMMIT", sim.SQL()[len(sim.SQL())-1])
+}
+
+func testUnaryServerInterceptorStatus(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	calls := 0
+	intercept := grpctx.UnaryServerInterceptor(newPGX(t, sim))
+	_, err := intercept(context.Background(), nil, unaryInfo, func(context.Context, any) (any, error) {
+		calls++
+		return nil, status.Error(codes.InvalidArgument, "bad order")
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "bad order", status.Convert(err).Message())
+	assert.Equal(t, 1, calls, "the status errors should not be retried")
+	assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, sim.SQL())
+}
+
+func testUnaryServerInterceptorExhausted(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	calls := 0
+	intercept := grpctx.UnaryServerInterceptor(newPGX(t, sim))
+	_, err := intercept(context.Background(), nil, unaryInfo, func(context.Context, any) (any, error) {
+		calls++
+		return nil, &pgconn.PgError{Code: "40P01"}
+	})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Equal(t, 3, calls)
+	assert.NotContains(t, sim.SQL(), "COMMIT")
+}
+
+func testUnaryServerInterceptorSkip(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	intercept := grpctx.UnaryServerInterceptor(newPGX(t, sim), grpctx.Skip(func(m string) bool {
+		return m == unaryInfo.FullMethod
+	}))
+	_, err := intercept(context.Background(), nil, unaryInfo, func(ctx context.Context, _ any) (any, error) {
+		assert.Nil(t, grpctx.Tx(ctx))
+		return nil, assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError, "the error should not be converted")
+	assert.Empty(t, sim.SQL())
+}
+
+// serverStream is a grpc.ServerStream with a context that sends and receives
+// nothing.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context //nolint:containedctx // it is a fake.
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+func (s *serverStream) SendMsg(any) error        { return nil }
+func (s *serverStream) RecvMsg(any) error        { return nil }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	t.Parallel()
+	t.Run("Commit", testStreamServerInterceptorCommit)
+	t.Run("Retry", testStreamServerInterceptorRetry)
+	t.Run("Used", testStreamServerInterceptorUsed)
+}
+
+func testStreamServerInterceptorCommit(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	intercept := grpctx.StreamServerInterceptor(newPGX(t, sim))
+	ss := &serverStream{ctx: context.Background()}
+	err := intercept(nil, ss, &grpc.StreamServerInfo{}, func(_ any, s grpc.ServerStream) error {
+		assert.NotNil(t, grpctx.Tx(s.Context()))
+		return s.SendMsg("order")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "COMMIT"}, sim.SQL())
+}
+
+func testStreamServerInterceptorRetry(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	calls := 0
+	intercept := grpctx.StreamServerInterceptor(newPGX(t, sim))
+	ss := &serverStream{ctx: context.Background()}
+	err := intercept(nil, ss, &grpc.StreamServerInfo{}, func(any, grpc.ServerStream) error {
+		calls++
+		if calls == 1 {
+			return &pgconn.PgError{Code: "40001"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func testStreamServerInterceptorUsed(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	calls := 0
+	intercept := grpctx.StreamServerInterceptor(newPGX(t, sim))
+	ss := &serverStream{ctx: context.Background()}
+	err := intercept(nil, ss, &grpc.StreamServerInfo{}, func(_ any, s grpc.ServerStream) error {
+		calls++
+		if err := s.RecvMsg(nil); err != nil {
+			return err
+		}
+		return &pgconn.PgError{Code: "40001"}
+	})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Equal(t, 1, calls, "the stream should not be retried after receiving messages")
+}
@@ -0,0 +1,58 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// HealthCheck runs a "SELECT 1" query with the retry policy of the PGX
+// object, or the one set on the ctx with the WithCallRetry function. The query
+// runs without a transaction if the pool implements the Querier interface. The
+// returned error includes the class of the error of the last attempt, see the
+// ErrorClass function, and wraps it. It can be used with any health library
+// that accepts a "func(context.Context) error" check, for example:
+//
+//	httpcheck.Check("database", p.HealthCheck)
+func (p *PGX) HealthCheck(ctx context.Context) error {
+	var one int
+	err := p.QueryRow(ctx, func(row pgx.Row) error {
+		return row.Scan(&one)
+	}, "SELECT 1")
+	if errors.Is(err, ErrNoQuerier) {
+		err = p.Transaction(ctx, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, "SELECT 1")
+			return err
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("database is unhealthy (%s): %w", ErrorClass(err), err)
+	}
+
+	return nil
+}
+
+// HealthChecker adapts a PGX object to the checker interfaces of the health
+// libraries, which have a name and a Check method.
+type HealthChecker struct {
+	name string
+	p    *PGX
+}
+
+// NewHealthChecker returns a HealthChecker with the name that checks the p
+// with the HealthCheck method.
+func NewHealthChecker(name string, p *PGX) *HealthChecker {
+	return &HealthChecker{name: name, p: p}
+}
+
+// Name returns the name of the check.
+func (h *HealthChecker) Name() string {
+	return h.name
+}
+
+// Check runs the HealthCheck method of the PGX object.
+func (h *HealthChecker) Check(ctx context.Context) error {
+	return h.p.HealthCheck(ctx)
+}
@@ -0,0 +1,75 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXHealthCheck(t *testing.T) {
+	t.Parallel()
+	t.Run("Healthy", testPGXHealthCheckHealthy)
+	t.Run("Retried", testPGXHealthCheckRetried)
+	t.Run("Unhealthy", testPGXHealthCheckUnhealthy)
+	t.Run("NoQuerier", testPGXHealthCheckNoQuerier)
+}
+
+func testPGXHealthCheckHealthy(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT 1$`).Return([]string{"?column?"}, []any{1})
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	assert.NoError(t, tr.HealthCheck(context.Background()))
+	assert.Equal(t, []string{"SELECT 1"}, sim.SQL())
+}
+
+func testPGXHealthCheckRetried(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT 1$`).Error(&pgconn.ConnectError{}).Times(2)
+	sim.On(`^SELECT 1$`).Return([]string{"?column?"}, []any{1})
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	assert.NoError(t, tr.HealthCheck(context.Background()))
+	assert.Len(t, sim.SQL(), 3)
+}
+
+func testPGXHealthCheckUnhealthy(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	connErr := &pgconn.ConnectError{}
+	sim.On(`^SELECT 1$`).Error(connErr)
+	tr, err := dbtools.New(sim, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	checker := dbtools.NewHealthChecker("database", tr)
+	assert.Equal(t, "database", checker.Name())
+	err = checker.Check(context.Background())
+	require.ErrorIs(t, err, connErr)
+	assert.Contains(t, err.Error(), "("+dbtools.ClassConnection+")")
+	assert.Len(t, sim.SQL(), 2)
+}
+
+func testPGXHealthCheckNoQuerier(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, "SELECT 1").Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	assert.NoError(t, tr.HealthCheck(context.Background()))
+}
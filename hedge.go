@@ -0,0 +1,76 @@
+package dbtools
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// HedgedRead runs the fn in a read-only transaction, and if it hasn't
+// finished after the given delay, runs it again in a second transaction. The
+// result of the transaction that succeeds first is returned, and the context
+// of the other one is cancelled. With read replicas the second transaction
+// begins on the next replica, otherwise it runs on another connection of the
+// pool. It cuts the tail latency of the reads caused by a slow replica or
+// connection:
+//
+//	user, err := dbtools.HedgedRead(ctx, tr, 50*time.Millisecond,
+//		func(ctx context.Context, tx pgx.Tx) (User, error) {
+//			return getUser(ctx, tx, id)
+//		},
+//	)
+//
+// Each transaction is retried with the same policy as the Transaction
+// method. The fn should only read, and should use the given ctx so the
+// statements of the slower transaction are cancelled. If both transactions
+// fail, the error of the first one that failed is returned. It returns an
+// ErrEmptyDatabase error if p is nil.
+func HedgedRead[T any](ctx context.Context, p *PGX, after time.Duration, fn func(context.Context, pgx.Tx) (T, error)) (T, error) {
+	var zero T
+	if p == nil {
+		return zero, ErrEmptyDatabase
+	}
+	r := p.ReadOnly().p
+
+	type result struct {
+		v   T
+		err error
+	}
+	results := make(chan result, 2)
+	run := func(ctx context.Context) {
+		var v T
+		err := r.Transaction(ctx, func(tx pgx.Tx) error {
+			var err error
+			v, err = fn(ctx, tx)
+			return err
+		})
+		results <- result{v: v, err: err}
+	}
+
+	firstCtx, cancelFirst := context.WithCancel(ctx)
+	defer cancelFirst()
+	go run(firstCtx)
+
+	timer := time.NewTimer(after)
+	defer timer.Stop()
+	select {
+	case res := <-results:
+		return res.v, res.err
+	case <-timer.C:
+	}
+
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+	defer cancelHedge()
+	go run(hedgeCtx)
+
+	res := <-results
+	if res.err == nil {
+		return res.v, nil
+	}
+	if other := <-results; other.err == nil {
+		return other.v, nil
+	}
+
+	return zero, res.err
+}
@@ -0,0 +1,109 @@
+package dbtools_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedgedRead(t *testing.T) {
+	t.Parallel()
+	t.Run("NilPGX", testHedgedReadNilPGX)
+	t.Run("Fast", testHedgedReadFast)
+	t.Run("Slow", testHedgedReadSlow)
+	t.Run("FirstFails", testHedgedReadFirstFails)
+	t.Run("BothFail", testHedgedReadBothFail)
+}
+
+func testHedgedReadNilPGX(t *testing.T) {
+	t.Parallel()
+	_, err := dbtools.HedgedRead(context.Background(), nil, time.Millisecond,
+		func(context.Context, pgx.Tx) (int, error) { return 0, nil })
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func testHedgedReadFast(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+
+	var calls atomic.Int32
+	got, err := dbtools.HedgedRead(context.Background(), tr, time.Hour,
+		func(context.Context, pgx.Tx) (string, error) {
+			calls.Add(1)
+			return "fast", nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "fast", got)
+	assert.EqualValues(t, 1, calls.Load())
+}
+
+func testHedgedReadSlow(t *testing.T) {
+	t.Parallel()
+	r1, r2 := dbtesting.NewSimulator(), dbtesting.NewSimulator()
+	tr, err := dbtools.NewWithReplicas(dbtesting.NewSimulator(), []dbtools.Pool{r1, r2})
+	require.NoError(t, err)
+
+	var calls atomic.Int32
+	cancelled := make(chan struct{})
+	got, err := dbtools.HedgedRead(context.Background(), tr, 10*time.Millisecond,
+		func(ctx context.Context, _ pgx.Tx) (string, error) {
+			if calls.Add(1) == 1 {
+				<-ctx.Done()
+				close(cancelled)
+				return "slow", ctx.Err()
+			}
+			return "hedged", nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "hedged", got)
+	assert.EqualValues(t, 2, calls.Load())
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("expected the slow transaction to be cancelled")
+	}
+	assert.Contains(t, r1.SQL(), "BEGIN")
+	assert.Contains(t, r2.SQL(), "BEGIN", "expected the hedge to run on the next replica")
+}
+
+func testHedgedReadFirstFails(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(), dbtools.Retry(1, time.Millisecond))
+	require.NoError(t, err)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	got, err := dbtools.HedgedRead(context.Background(), tr, time.Millisecond,
+		func(context.Context, pgx.Tx) (int, error) {
+			if calls.Add(1) == 1 {
+				<-release
+				return 0, assert.AnError
+			}
+			close(release)
+			time.Sleep(10 * time.Millisecond)
+			return 42, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, 42, got)
+}
+
+func testHedgedReadBothFail(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(), dbtools.Retry(1, time.Millisecond))
+	require.NoError(t, err)
+
+	_, err = dbtools.HedgedRead(context.Background(), tr, time.Millisecond,
+		func(context.Context, pgx.Tx) (int, error) {
+			time.Sleep(10 * time.Millisecond)
+			return 0, assert.AnError
+		})
+	assert.ErrorIs(t, err, assert.AnError)
+}
@@ -117,3 +117,48 @@ func (e *exampleConn) Begin(context.Context) (pgx.Tx, error) {
 	tx.On("Commit", mock.Anything).Return(nil)
 	return tx, nil
 }
+
+// querierPool is a Pool that also implements the Querier interface.
+type querierPool struct {
+	*mocks.Pool
+	*mocks.Querier
+}
+
+func newQuerierPool(t *testing.T) (*querierPool, *mocks.Querier) {
+	t.Helper()
+	q := mocks.NewQuerier(t)
+	return &querierPool{
+		Pool:    mocks.NewPool(t),
+		Querier: q,
+	}, q
+}
+
+// txBeginnerPool is a Pool that also implements the TxBeginner interface.
+type txBeginnerPool struct {
+	*mocks.Pool
+	*mocks.TxBeginner
+}
+
+func newTxBeginnerPool(t *testing.T) (*txBeginnerPool, *mocks.TxBeginner) {
+	t.Helper()
+	b := mocks.NewTxBeginner(t)
+	return &txBeginnerPool{
+		Pool:       mocks.NewPool(t),
+		TxBeginner: b,
+	}, b
+}
+
+// pingerPool is a Pool that also implements the Pinger interface.
+type pingerPool struct {
+	*mocks.Pool
+	*mocks.Pinger
+}
+
+func newPingerPool(t *testing.T) (*pingerPool, *mocks.Pinger) {
+	t.Helper()
+	p := mocks.NewPinger(t)
+	return &pingerPool{
+		Pool:   mocks.NewPool(t),
+		Pinger: p,
+	}, p
+}
@@ -0,0 +1,253 @@
+// Package httpcheck serves the readiness and liveness of the database pools
+// over HTTP. The handlers return a JSON report, and can be mounted on any
+// router that accepts an http.Handler, for example net/http and chi, or with
+// echo.WrapHandler on echo.
+package httpcheck
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+)
+
+// Status is the health status of a check or of the whole report.
+type Status string
+
+const (
+	// StatusOK means the check has passed.
+	StatusOK Status = "ok"
+	// StatusDegraded means the service can serve the requests, but a
+	// non-critical check has failed, for example a replica is down.
+	StatusDegraded Status = "degraded"
+	// StatusDown means a critical check has failed.
+	StatusDown Status = "down"
+)
+
+// Result is the result of a check.
+type Result struct {
+	Status Status `json:"status"`
+	// Class is the class of the error of a failed check, as returned by the
+	// dbtools.ErrorClass function.
+	Class string `json:"class,omitempty"`
+	// Error is the message of the error of a failed check. It is only set
+	// when the Checker is created with the ErrorDetails option.
+	Error    string `json:"error,omitempty"`
+	Duration int64  `json:"duration_ms"`
+	// Pools is the health of the pools of a Failover, starting with the
+	// primary.
+	Pools []bool `json:"pools,omitempty"`
+
+	err error
+}
+
+// Report is the result of all checks. Its Status is the worst status of the
+// checks.
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// ConfigFunc is used for configuring the Checker.
+type ConfigFunc func(*Checker)
+
+// Timeout sets the time limit of each check. The default value is 2s.
+func Timeout(d time.Duration) ConfigFunc {
+	return func(c *Checker) {
+		c.timeout = d
+	}
+}
+
+// ErrorDetails includes the messages of the errors in the report. The
+// messages can contain the addresses of the servers and other internal
+// details, therefore they are not included by default. Enable it only if the
+// handlers are not exposed publicly.
+func ErrorDetails() ConfigFunc {
+	return func(c *Checker) {
+		c.details = true
+	}
+}
+
+// Pool adds a critical check that pings the pool. If the pool doesn't
+// implement the dbtools.Pinger interface, a transaction is started and
+// rolled back.
+func Pool(name string, pool dbtools.Pool) ConfigFunc {
+	return Check(name, func(ctx context.Context) error {
+		return ping(ctx, pool)
+	})
+}
+
+// Replica adds a check that pings the pool of a read replica. A replica that
+// is down degrades the report, but doesn't make the service unready.
+func Replica(name string, pool dbtools.Pool) ConfigFunc {
+	return func(c *Checker) {
+		c.checks = append(c.checks, check{
+			name: name,
+			run: func(ctx context.Context) Result {
+				res := result(ping(ctx, pool))
+				if res.Status == StatusDown {
+					res.Status = StatusDegraded
+				}
+				return res
+			},
+		})
+	}
+}
+
+// Failover adds a check that reports the health of the pools of the f. The
+// report is degraded when the primary is unhealthy, and is down when none of
+// the pools are healthy.
+func Failover(name string, f *dbtools.Failover) ConfigFunc {
+	return func(c *Checker) {
+		c.checks = append(c.checks, check{
+			name: name,
+			run: func(context.Context) Result {
+				pools := f.Healthy()
+				res := Result{Status: StatusDown, Pools: pools}
+				for i, ok := range pools {
+					if !ok {
+						continue
+					}
+					res.Status = StatusOK
+					if i > 0 {
+						res.Status = StatusDegraded
+					}
+					break
+				}
+				return res
+			},
+		})
+	}
+}
+
+// Check adds a critical check. The service is unready when the fn returns an
+// error.
+func Check(name string, fn func(context.Context) error) ConfigFunc {
+	return func(c *Checker) {
+		c.checks = append(c.checks, check{
+			name: name,
+			run: func(ctx context.Context) Result {
+				return result(fn(ctx))
+			},
+		})
+	}
+}
+
+type check struct {
+	name string
+	run  func(context.Context) Result
+}
+
+// Checker runs the checks and serves their report. It is safe for concurrent
+// use.
+type Checker struct {
+	timeout time.Duration
+	details bool
+	checks  []check
+}
+
+// New returns a Checker with the checks:
+//
+//	c := httpcheck.New(
+//		httpcheck.Pool("primary", primary),
+//		httpcheck.Replica("replica", replica),
+//	)
+//	mux.Handle("GET /readyz", c.Ready())
+//	mux.Handle("GET /livez", c.Live())
+func New(conf ...ConfigFunc) *Checker {
+	c := &Checker{
+		timeout: 2 * time.Second,
+	}
+	for _, fn := range conf {
+		fn(c)
+	}
+
+	return c
+}
+
+// Run runs all checks concurrently and returns their report.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]Result, len(c.checks)),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range c.checks {
+		wg.Add(1)
+		go func(ch check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+			start := time.Now()
+			res := ch.run(ctx)
+			res.Duration = time.Since(start).Milliseconds()
+			if c.details && res.err != nil {
+				res.Error = res.err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[ch.name] = res
+			report.Status = worse(report.Status, res.Status)
+		}(ch)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Ready returns a handler that runs the checks. It responds with the 200
+// status code when the report is ok or degraded, and with the 503 status
+// code when it is down.
+func (c *Checker) Ready() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		code := http.StatusOK
+		if report.Status == StatusDown {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	})
+}
+
+// Live returns a handler that always responds with the 200 status code. The
+// liveness doesn't depend on the database, otherwise an outage of the
+// database would restart all instances of the service.
+func (c *Checker) Live() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+func ping(ctx context.Context, pool dbtools.Pool) error {
+	return dbtools.WaitForPool(ctx, pool, retry.Retry{Attempts: 1})
+}
+
+func result(err error) Result {
+	if err != nil {
+		return Result{Status: StatusDown, Class: dbtools.ErrorClass(err), err: err}
+	}
+
+	return Result{Status: StatusOK}
+}
+
+func worse(a, b Status) Status {
+	rank := map[Status]int{StatusOK: 0, StatusDegraded: 1, StatusDown: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+
+	return a
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v) //nolint:errchkjson // the client might be gone.
+}
@@ -0,0 +1,180 @@
+package httpcheck_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/httpcheck"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve returns the status code and the report of the handler.
+func serve(t *testing.T, h http.Handler) (int, httpcheck.Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var report httpcheck.Report
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	return rec.Code, report
+}
+
+// downPool returns a pool that fails to ping.
+func downPool() *dbtesting.Simulator {
+	sim := dbtesting.NewSimulator()
+	sim.On("PING").Error(&pgconn.ConnectError{})
+	return sim
+}
+
+func TestCheckerReady(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		conf   []httpcheck.ConfigFunc
+		code   int
+		status httpcheck.Status
+		checks map[string]httpcheck.Status
+	}{
+		"no checks": {
+			code:   http.StatusOK,
+			status: httpcheck.StatusOK,
+			checks: map[string]httpcheck.Status{},
+		},
+		"healthy": {
+			conf: []httpcheck.ConfigFunc{
+				httpcheck.Pool("primary", dbtesting.NewSimulator()),
+				httpcheck.Replica("replica", dbtesting.NewSimulator()),
+			},
+			code:   http.StatusOK,
+			status: httpcheck.StatusOK,
+			checks: map[string]httpcheck.Status{
+				"primary": httpcheck.StatusOK,
+				"replica": httpcheck.StatusOK,
+			},
+		},
+		"replica down": {
+			conf: []httpcheck.ConfigFunc{
+				httpcheck.Pool("primary", dbtesting.NewSimulator()),
+				httpcheck.Replica("replica", downPool()),
+			},
+			code:   http.StatusOK,
+			status: httpcheck.StatusDegraded,
+			checks: map[string]httpcheck.Status{
+				"primary": httpcheck.StatusOK,
+				"replica": httpcheck.StatusDegraded,
+			},
+		},
+		"primary down": {
+			conf: []httpcheck.ConfigFunc{
+				httpcheck.Pool("primary", downPool()),
+				httpcheck.Replica("replica", downPool()),
+			},
+			code:   http.StatusServiceUnavailable,
+			status: httpcheck.StatusDown,
+			checks: map[string]httpcheck.Status{
+				"primary": httpcheck.StatusDown,
+				"replica": httpcheck.StatusDegraded,
+			},
+		},
+		"custom check": {
+			conf: []httpcheck.ConfigFunc{
+				httpcheck.Check("cache", func(context.Context) error { return assert.AnError }),
+			},
+			code:   http.StatusServiceUnavailable,
+			status: httpcheck.StatusDown,
+			checks: map[string]httpcheck.Status{"cache": httpcheck.StatusDown},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			code, report := serve(t, httpcheck.New(tc.conf...).Ready())
+			assert.Equal(t, tc.code, code)
+			assert.Equal(t, tc.status, report.Status)
+			got := make(map[string]httpcheck.Status, len(report.Checks))
+			for name, res := range report.Checks {
+				got[name] = res.Status
+				assert.Empty(t, res.Error)
+				if res.Status == httpcheck.StatusOK {
+					assert.Empty(t, res.Class)
+				} else {
+					assert.NotEmpty(t, res.Class)
+				}
+			}
+			assert.Equal(t, tc.checks, got)
+		})
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	t.Parallel()
+	c := httpcheck.New(
+		httpcheck.Timeout(10*time.Millisecond),
+		httpcheck.Check("slow", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	)
+	report := c.Run(context.Background())
+	assert.Equal(t, httpcheck.StatusDown, report.Status)
+	assert.Equal(t, dbtools.ClassTimeout, report.Checks["slow"].Class)
+	assert.Empty(t, report.Checks["slow"].Error)
+}
+
+func TestCheckerErrorDetails(t *testing.T) {
+	t.Parallel()
+	c := httpcheck.New(
+		httpcheck.ErrorDetails(),
+		httpcheck.Pool("primary", dbtesting.NewSimulator()),
+		httpcheck.Check("cache", func(context.Context) error { return assert.AnError }),
+	)
+	code, report := serve(t, c.Ready())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, assert.AnError.Error(), report.Checks["cache"].Error)
+	assert.Equal(t, dbtools.ClassOther, report.Checks["cache"].Class)
+	assert.Empty(t, report.Checks["primary"].Error)
+}
+
+func TestCheckerFailover(t *testing.T) {
+	t.Parallel()
+	primary := dbtesting.NewSimulator()
+	primary.On("BEGIN").Error(&pgconn.ConnectError{})
+	standby := dbtesting.NewSimulator()
+	standby.On("BEGIN").Error(&pgconn.ConnectError{})
+	f, err := dbtools.NewFailover(dbtools.FailoverPolicy{Cooldown: time.Hour}, primary, standby)
+	require.NoError(t, err)
+	c := httpcheck.New(httpcheck.Failover("router", f))
+
+	report := c.Run(context.Background())
+	assert.Equal(t, httpcheck.StatusOK, report.Status)
+	assert.Equal(t, []bool{true, true}, report.Checks["router"].Pools)
+
+	_, err = f.Begin(context.Background())
+	require.Error(t, err)
+	report = c.Run(context.Background())
+	assert.Equal(t, httpcheck.StatusDegraded, report.Status)
+	assert.Equal(t, []bool{false, true}, report.Checks["router"].Pools)
+
+	_, err = f.Begin(context.Background())
+	require.Error(t, err)
+	code, report := serve(t, c.Ready())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, httpcheck.StatusDown, report.Status)
+}
+
+func TestCheckerLive(t *testing.T) {
+	t.Parallel()
+	c := httpcheck.New(httpcheck.Pool("primary", downPool()))
+	code, report := serve(t, c.Live())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, httpcheck.StatusOK, report.Status)
+	assert.Empty(t, report.Checks)
+}
@@ -0,0 +1,209 @@
+// Package httptx runs each HTTP request in a retried transaction. The
+// transaction is stored in the context of the request, and is committed when
+// the handler responds with a status code below 400. The response is buffered
+// until the transaction is committed, therefore the handler is called again
+// when the transaction is retried, and the client only receives the response
+// of the last attempt.
+//
+//	mux.Handle("POST /orders", httptx.Middleware(p)(createOrder))
+//
+//	func createOrder(w http.ResponseWriter, r *http.Request) {
+//		tx := httptx.Tx(r.Context())
+//		...
+//	}
+package httptx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// StatusClientClosedRequest is the status code that is used when the client
+// closes the connection before its request body is read.
+const StatusClientClosedRequest = 499
+
+// ErrReadBody wraps the errors of reading the request body, which are passed
+// to the ErrorHandler. If the body is larger than the MaxBodyBytes, the error
+// also wraps an *http.MaxBytesError.
+var ErrReadBody = errors.New("reading request body")
+
+// ConfigFunc is used for configuring the Middleware.
+type ConfigFunc func(*config)
+
+// ErrorHandler sets the function that responds to the requests when the
+// transaction fails, for example when it can't be started or committed, or
+// all attempts have failed. It also receives the errors of reading the
+// request body, which wrap the ErrReadBody error. The default handler
+// responds with the 413 status code when the body is too large, with the 499
+// status code when the client has gone away while the body was read, with the
+// 400 status code for the other errors of reading the body, with the 503
+// status code for the connection errors and the timeouts, and with the 500
+// status code for the other errors.
+func ErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) ConfigFunc {
+	return func(c *config) {
+		c.onError = fn
+	}
+}
+
+// Skip sets the function that decides which requests are served without a
+// transaction, for example the GET requests.
+func Skip(fn func(*http.Request) bool) ConfigFunc {
+	return func(c *config) {
+		c.skip = fn
+	}
+}
+
+// MaxBodyBytes sets the maximum size of the request body, which is buffered
+// so it can be read again when the transaction is retried. The requests with
+// larger bodies are passed to the ErrorHandler with an *http.MaxBytesError
+// error, and the default handler responds with the 413 status code. The
+// default value is 1MB.
+func MaxBodyBytes(n int64) ConfigFunc {
+	return func(c *config) {
+		c.maxBody = n
+	}
+}
+
+type config struct {
+	onError func(w http.ResponseWriter, r *http.Request, err error)
+	skip    func(*http.Request) bool
+	maxBody int64
+}
+
+type txKey struct{}
+
+// Tx returns the transaction of the request ctx, or nil if the request is not
+// served by the Middleware.
+func Tx(ctx context.Context) pgx.Tx {
+	tx, _ := ctx.Value(txKey{}).(pgx.Tx)
+	return tx
+}
+
+// statusError is returned from the transaction when the handler responds with
+// a status code that rolls back the transaction.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("handler responded with %d", e.code)
+}
+
+// Middleware returns an http middleware that serves each request in a
+// transaction with the p. The transaction is rolled back without retrying
+// when the handler responds with a status code of 400 or above, and the
+// response of the handler is sent to the client. If the handler panics, the
+// transaction is rolled back and retried with the policy of the p.
+func Middleware(p *dbtools.PGX, conf ...ConfigFunc) func(http.Handler) http.Handler {
+	c := &config{
+		onError: respondError,
+		maxBody: 1 << 20,
+	}
+	for _, fn := range conf {
+		fn(c)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.skip != nil && c.skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, err := readBody(w, r, c.maxBody)
+			if err != nil {
+				c.onError(w, r, fmt.Errorf("%w: %w", ErrReadBody, err))
+				return
+			}
+
+			var res *response
+			err = p.Transaction(r.Context(), func(tx pgx.Tx) error {
+				res = &response{header: w.Header().Clone(), code: http.StatusOK}
+				req := r.WithContext(context.WithValue(r.Context(), txKey{}, tx))
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				next.ServeHTTP(res, req)
+				if res.code >= http.StatusBadRequest {
+					return &retry.StopError{Err: &statusError{code: res.code}}
+				}
+				return nil
+			})
+			var status *statusError
+			if err != nil && !errors.As(err, &status) {
+				c.onError(w, r, err)
+				return
+			}
+			res.flush(w)
+		})
+	}
+}
+
+// readBody reads the body of the r up to the max bytes. It returns an
+// *http.MaxBytesError error if the body is larger.
+func readBody(w http.ResponseWriter, r *http.Request, maxBytes int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body := http.MaxBytesReader(w, r.Body, maxBytes)
+	defer body.Close()
+
+	return io.ReadAll(body) //nolint:wrapcheck // wrapped by the caller.
+}
+
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusInternalServerError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		code = http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrReadBody) && r.Context().Err() != nil:
+		// There is nobody to read the response, but it shows up in the logs.
+		http.Error(w, "Client Closed Request", StatusClientClosedRequest)
+		return
+	case errors.Is(err, ErrReadBody):
+		code = http.StatusBadRequest
+	default:
+		switch dbtools.ErrorClass(err) {
+		case dbtools.ClassConnection, dbtools.ClassTimeout:
+			code = http.StatusServiceUnavailable
+		}
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// response buffers the response of an attempt.
+type response struct {
+	header  http.Header
+	code    int
+	written bool
+	body    bytes.Buffer
+}
+
+func (r *response) Header() http.Header { return r.header }
+
+func (r *response) Write(b []byte) (int, error) {
+	r.written = true
+	return r.body.Write(b)
+}
+
+func (r *response) WriteHeader(code int) {
+	if r.written {
+		return
+	}
+	r.written = true
+	r.code = code
+}
+
+// flush sends the buffered response to the w.
+func (r *response) flush(w http.ResponseWriter) {
+	maps.Copy(w.Header(), r.header)
+	w.WriteHeader(r.code)
+	_, _ = w.Write(r.body.Bytes()) // the client might be gone.
+}
@@ -0,0 +1,223 @@
+package httptx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/httptx"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve returns the response of the handler wrapped in the middleware.
+func serve(t *testing.T, sim *dbtesting.Simulator, h http.HandlerFunc, conf ...httptx.ConfigFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	p, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload"))
+	httptx.Middleware(p, conf...)(h).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+	t.Run("Commit", testMiddlewareCommit)
+	t.Run("Rollback", testMiddlewareRollback)
+	t.Run("Retry", testMiddlewareRetry)
+	t.Run("Panic", testMiddlewarePanic)
+	t.Run("Failure", testMiddlewareFailure)
+	t.Run("ErrorHandler", testMiddlewareErrorHandler)
+	t.Run("Skip", testMiddlewareSkip)
+	t.Run("MaxBodyBytes", testMiddlewareMaxBodyBytes)
+	t.Run("BodyError", testMiddlewareBodyError)
+}
+
+func testMiddlewareCommit(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^INSERT").Exec("INSERT 0 1")
+	rec := serve(t, sim, func(w http.ResponseWriter, r *http.Request) {
+		tx := httptx.Tx(r.Context())
+		require.NotNil(t, tx)
+		_, err := tx.Exec(r.Context(), "INSERT INTO orders DEFAULT VALUES")
+		require.NoError(t, err)
+		w.Header().Set("Location", "/orders/1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "created")
+	})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "created", rec.Body.String())
+	assert.Equal(t, "/orders/1", rec.Header().Get("Location"))
+	assert.Equal(t, []string{"BEGIN", "INSERT INTO orders DEFAULT VALUES", "COMMIT"}, sim.SQL())
+}
+
+func testMiddlewareRollback(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]int{
+		"bad request":  http.StatusBadRequest,
+		"server error": http.StatusInternalServerError,
+	}
+	for name, code := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sim := dbtesting.NewSimulator()
+			calls := 0
+			rec := serve(t, sim, func(w http.ResponseWriter, _ *http.Request) {
+				calls++
+				http.Error(w, "nope", code)
+			})
+			assert.Equal(t, code, rec.Code)
+			assert.Equal(t, "nope\n", rec.Body.String())
+			assert.Equal(t, 1, calls, "the request should not be retried")
+			assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, sim.SQL())
+		})
+	}
+}
+
+func testMiddlewareRetry(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^UPDATE").Error(&pgconn.PgError{Code: "40001"}).Times(1)
+	sim.On("^UPDATE").Exec("UPDATE 1")
+	var bodies []string
+	rec := serve(t, sim, func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(b))
+		fmt.Fprintf(w, "attempt %d;", len(bodies))
+		_, err = httptx.Tx(r.Context()).Exec(r.Context(), "UPDATE stock")
+		if err != nil {
+			panic(err)
+		}
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "attempt 2;", rec.Body.String(), "only the last response should be sent")
+	assert.Equal(t, []string{"payload", "payload"}, bodies)
+	assert.Equal(t, "COMMIT", sim.SQL()[len(sim.SQL())-1])
+}
+
+func testMiddlewarePanic(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	calls := 0
+	rec := serve(t, sim, func(http.ResponseWriter, *http.Request) {
+		calls++
+		panic("boom")
+	})
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, 3, calls)
+	assert.NotContains(t, sim.SQL(), "COMMIT")
+}
+
+func testMiddlewareFailure(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("BEGIN").Error(&pgconn.ConnectError{})
+	called := false
+	rec := serve(t, sim, func(http.ResponseWriter, *http.Request) {
+		called = true
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.False(t, called)
+}
+
+func testMiddlewareErrorHandler(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("COMMIT").Error(assert.AnError)
+	var got error
+	rec := serve(t, sim, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "done")
+	}, httptx.ErrorHandler(func(w http.ResponseWriter, _ *http.Request, err error) {
+		got = err
+		w.WriteHeader(http.StatusConflict)
+	}))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Empty(t, rec.Body.String(), "the response of the handler should be discarded")
+	assert.True(t, errors.Is(got, assert.AnError))
+}
+
+func testMiddlewareSkip(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	rec := serve(t, sim, func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, httptx.Tx(r.Context()))
+		w.WriteHeader(http.StatusAccepted)
+	}, httptx.Skip(func(r *http.Request) bool {
+		return r.Method == http.MethodPost
+	}))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Empty(t, sim.SQL())
+}
+
+func testMiddlewareMaxBodyBytes(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	called := false
+	rec := serve(t, sim, func(http.ResponseWriter, *http.Request) {
+		called = true
+	}, httptx.MaxBodyBytes(3))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.False(t, called)
+	assert.Empty(t, sim.SQL())
+
+	var got error
+	serve(t, sim, func(http.ResponseWriter, *http.Request) {}, httptx.MaxBodyBytes(3),
+		httptx.ErrorHandler(func(_ http.ResponseWriter, _ *http.Request, err error) {
+			got = err
+		}))
+	var tooLarge *http.MaxBytesError
+	require.ErrorAs(t, got, &tooLarge)
+	assert.ErrorIs(t, got, httptx.ErrReadBody)
+}
+
+// failingBody fails to be read, as if the client has gone away.
+type failingBody struct{}
+
+func (failingBody) Read([]byte) (int, error) { return 0, io.ErrUnexpectedEOF }
+
+func testMiddlewareBodyError(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		cancel bool
+		want   int
+	}{
+		"broken body": {false, http.StatusBadRequest},
+		"client gone": {true, httptx.StatusClientClosedRequest},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sim := dbtesting.NewSimulator()
+			p, err := dbtools.New(sim)
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				cancel()
+			}
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/", failingBody{}).WithContext(ctx)
+			called := false
+			httptx.Middleware(p)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				called = true
+			})).ServeHTTP(rec, req)
+			assert.Equal(t, tc.want, rec.Code)
+			assert.False(t, called)
+			assert.Empty(t, sim.SQL())
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// idempotencyTable stores the keys of the completed side effects.
+const idempotencyTable = "dbtools_idempotency"
+
+// CreateIdempotencyTable creates the table that is used by the Idempotent
+// function if it doesn't exist. Run it in your migrations.
+func CreateIdempotencyTable(ctx context.Context, tx pgx.Tx) error {
+	const query = `CREATE TABLE IF NOT EXISTS ` + idempotencyTable + ` (
+		key        TEXT PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return fmt.Errorf("creating idempotency table: %w", err)
+	}
+
+	return nil
+}
+
+type idempotencyKey struct{}
+
+// idempotencyScope holds the keys of the side effects that are done in the
+// previous attempts of a transaction, or of all the transactions that are
+// run with a ctx created by the WithIdempotency function.
+type idempotencyScope struct {
+	mu   sync.Mutex
+	keys map[string]*idempotencyEntry
+}
+
+// idempotencyEntry is locked while the side effect of its key is running,
+// therefore the side effects of the other keys are not blocked.
+type idempotencyEntry struct {
+	mu   sync.Mutex
+	done bool
+}
+
+// entry returns the entry of the key, and creates it if it doesn't exist.
+func (s *idempotencyScope) entry(key string) *idempotencyEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.keys[key]
+	if !ok {
+		e = &idempotencyEntry{}
+		s.keys[key] = e
+	}
+
+	return e
+}
+
+func newIdempotencyScope() *idempotencyScope {
+	return &idempotencyScope{keys: make(map[string]*idempotencyEntry)}
+}
+
+// callKeys returns the idempotency scope of the ctx, or a new one for a
+// single call of the Transaction method.
+func callKeys(ctx context.Context) *idempotencyScope {
+	if scope, ok := ctx.Value(idempotencyKey{}).(*idempotencyScope); ok {
+		return scope
+	}
+
+	return newIdempotencyScope()
+}
+
+// WithIdempotency returns a copy of the ctx that remembers the keys of the
+// side effects run by the Idempotent function across the transactions that
+// are run with it. The retries of a single transaction don't need it. Pass
+// this ctx to the Transaction calls, so a side effect is not repeated when
+// its transaction is run again, for example in a loop that retries the
+// Transaction calls:
+//
+//	ctx = dbtools.WithIdempotency(ctx)
+//	for range 3 {
+//		err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+//			if err := createOrder(ctx, tx, order); err != nil {
+//				return err
+//			}
+//			return dbtools.Idempotent(ctx, tx, "email:"+order.ID, func() error {
+//				return sendEmail(order)
+//			})
+//		})
+//		if err == nil {
+//			break
+//		}
+//	}
+func WithIdempotency(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, newIdempotencyScope())
+}
+
+// Idempotent runs the fn only if the key is not recorded yet, and records the
+// key in the tx. The key is committed with the rest of the transaction,
+// therefore the fn is not run again by the later transactions. If the key is
+// being recorded by a concurrent transaction, it waits for that transaction
+// to finish.
+//
+// The keys recorded in the failed attempts are rolled back with the
+// transaction, but the keys of the side effects that are run in the previous
+// attempts are remembered, therefore the fn runs at most once across the
+// retries of the transaction. The tx should be the one that is passed to the
+// transaction function, a nested transaction of it, or a decorator of it with
+// an Unwrap() pgx.Tx method. Otherwise the keys are only remembered if the
+// ctx is created with the WithIdempotency function. The key is recorded in
+// the tx anyway.
+func Idempotent(ctx context.Context, tx pgx.Tx, key string, fn func() error) error {
+	const query = `INSERT INTO ` + idempotencyTable + ` (key) VALUES ($1)
+		ON CONFLICT (key) DO NOTHING`
+	tag, err := tx.Exec(ctx, query, key)
+	if err != nil {
+		return fmt.Errorf("recording idempotency key %q: %w", key, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	var scope *idempotencyScope
+	if a := txScope(tx); a != nil {
+		scope = a.keys
+	} else {
+		scope, _ = ctx.Value(idempotencyKey{}).(*idempotencyScope)
+	}
+	if scope == nil {
+		return fn()
+	}
+	e := scope.entry(key)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done {
+		return nil
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	e.done = true
+
+	return nil
+}
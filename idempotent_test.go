@@ -0,0 +1,200 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotent(t *testing.T) {
+	t.Parallel()
+	t.Run("RecordError", testIdempotentRecordError)
+	t.Run("AlreadyDone", testIdempotentAlreadyDone)
+	t.Run("Run", testIdempotentRun)
+	t.Run("Retries", testIdempotentRetries)
+	t.Run("RetriesWithoutScope", testIdempotentRetriesWithoutScope)
+	t.Run("Calls", testIdempotentCalls)
+	t.Run("ConcurrentKeys", testIdempotentConcurrentKeys)
+}
+
+func testIdempotentRecordError(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	tx.On("Exec", mock.Anything, mock.Anything, "key").
+		Return(pgconn.CommandTag{}, assert.AnError).Once()
+	err := dbtools.Idempotent(context.Background(), tx, "key", func() error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testIdempotentAlreadyDone(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	tx.On("Exec", mock.Anything, mock.Anything, "key").
+		Return(pgconn.NewCommandTag("INSERT 0 0"), nil).Once()
+	err := dbtools.Idempotent(context.Background(), tx, "key", func() error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func testIdempotentRun(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	tx.On("Exec", mock.Anything, mock.Anything, "key").
+		Return(pgconn.NewCommandTag("INSERT 0 1"), nil).Twice()
+	err := dbtools.Idempotent(context.Background(), tx, "key", func() error {
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+
+	calls := 0
+	err = dbtools.Idempotent(context.Background(), tx, "key", func() error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func testIdempotentRetries(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^INSERT INTO dbtools_idempotency`).Exec("INSERT 0 1")
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	ctx := dbtools.WithIdempotency(context.Background())
+	sent := 0
+	attempts := 0
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		attempts++
+		err := dbtools.Idempotent(ctx, tx, "email:1", func() error {
+			sent++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 1, sent)
+}
+
+func testIdempotentRetriesWithoutScope(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^INSERT INTO dbtools_idempotency`).Exec("INSERT 0 1")
+	tr, err := dbtools.New(sim, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	sent := 0
+	attempts := 0
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		attempts++
+		err := dbtools.Idempotent(ctx, tx, "email:1", func() error {
+			sent++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if attempts < 2 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 1, sent)
+}
+
+func testIdempotentCalls(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^INSERT INTO dbtools_idempotency`).Exec("INSERT 0 1")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	sent := 0
+	run := func(ctx context.Context) {
+		err := tr.Transaction(ctx, func(tx pgx.Tx) error {
+			return dbtools.Idempotent(ctx, tx, "email:1", func() error {
+				sent++
+				return nil
+			})
+		})
+		require.NoError(t, err)
+	}
+
+	run(context.Background())
+	run(context.Background())
+	assert.Equal(t, 2, sent, "separate calls should not share the keys")
+
+	ctx := dbtools.WithIdempotency(context.Background())
+	run(ctx)
+	run(ctx)
+	assert.Equal(t, 3, sent, "the calls with the same scope should share the keys")
+}
+
+func testIdempotentConcurrentKeys(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	tx.On("Exec", mock.Anything, mock.Anything, mock.Anything).
+		Return(pgconn.NewCommandTag("INSERT 0 1"), nil)
+	ctx := dbtools.WithIdempotency(context.Background())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- dbtools.Idempotent(ctx, tx, "first", func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+
+	<-started
+	calls := 0
+	err := dbtools.Idempotent(ctx, tx, "second", func() error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls, "the other key should not be blocked")
+
+	close(release)
+	require.NoError(t, <-done)
+}
+
+func TestCreateIdempotencyTable(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^CREATE TABLE IF NOT EXISTS dbtools_idempotency`)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		return dbtools.CreateIdempotencyTable(ctx, tx)
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,289 @@
+package dbtools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arsham/dbtools/v4/notify"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// maxNotifyPayload is the limit of the payload of a notification, which
+	// is 8000 bytes including the terminating zero.
+	maxNotifyPayload = 7999
+	// seenInvalidations is the number of the message ids that are remembered
+	// for dropping the duplicates.
+	seenInvalidations = 1024
+)
+
+// invalidation is the payload of the invalidation messages.
+type invalidation struct {
+	ID   string   `json:"id"`
+	Keys []string `json:"keys"`
+}
+
+// InvalidatorOption configures an Invalidator.
+type InvalidatorOption func(*Invalidator)
+
+// ReconnectRetry sets the retry policy of connecting to the database. The
+// default is 10 attempts with an incremental delay of 1s. The Invalidator
+// also waits for the Delay before reconnecting after the connection fails.
+func ReconnectRetry(r retry.Retry) InvalidatorOption {
+	return func(i *Invalidator) {
+		i.retry = r
+	}
+}
+
+// OnResubscribe sets the function that is called after the channel is
+// listened to again on a new connection. The messages that are published
+// while the Invalidator is disconnected are lost, therefore the fn should
+// invalidate the whole cache.
+func OnResubscribe(fn func(ctx context.Context)) InvalidatorOption {
+	return func(i *Invalidator) {
+		i.onResubscribe = fn
+	}
+}
+
+// OnInvalidatorError sets the function that is called when the connection
+// fails, or a malformed message is received.
+func OnInvalidatorError(fn func(error)) InvalidatorOption {
+	return func(i *Invalidator) {
+		i.onError = fn
+	}
+}
+
+// Invalidator publishes the keys of the cache entries that should be
+// invalidated on a LISTEN/NOTIFY channel, and delivers them to the handlers
+// of all the nodes, including the publisher. It is safe for concurrent use:
+//
+//	inv, err := dbtools.NewInvalidator("cache_invalidation",
+//		func(ctx context.Context, keys []string) {
+//			cache.Delete(keys...)
+//		},
+//		dbtools.OnResubscribe(func(context.Context) { cache.Purge() }),
+//	)
+//	// handle the error!
+//	go inv.Run(ctx, func(ctx context.Context) (notify.Conn, error) {
+//		return pgx.Connect(ctx, dsn)
+//	})
+//
+//	err = p.Transaction(ctx, func(tx pgx.Tx) error {
+//		if err := updateUser(ctx, tx, user); err != nil {
+//			return err
+//		}
+//		return inv.Publish(ctx, tx, "user:"+user.ID)
+//	})
+type Invalidator struct {
+	channel       string
+	handler       func(ctx context.Context, keys []string)
+	retry         retry.Retry
+	onResubscribe func(ctx context.Context)
+	onError       func(error)
+	subscriber    *notify.Subscriber
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+	ids  []string
+}
+
+// NewInvalidator returns an Invalidator that delivers the keys published on
+// the channel to the handler. It returns an ErrInvalidInvalidator error if
+// the channel is empty or the handler is nil.
+func NewInvalidator(channel string, handler func(ctx context.Context, keys []string), opts ...InvalidatorOption) (*Invalidator, error) {
+	if channel == "" {
+		return nil, fmt.Errorf("%w: empty channel", ErrInvalidInvalidator)
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("%w: nil handler", ErrInvalidInvalidator)
+	}
+	i := &Invalidator{
+		channel: channel,
+		handler: handler,
+		retry: retry.Retry{
+			Attempts: 10,
+			Delay:    time.Second,
+			Method:   retry.IncrementalDelay,
+		},
+		seen: make(map[string]struct{}, seenInvalidations),
+	}
+	for _, fn := range opts {
+		fn(i)
+	}
+	if i.retry.Attempts < 1 {
+		i.retry.Attempts = 1
+	}
+
+	i.subscriber = notify.New()
+	_, err := i.subscriber.Subscribe(channel, i.receive,
+		notify.Recover(func(ctx context.Context, _ *pgconn.Notification) ([]*pgconn.Notification, error) {
+			if i.onResubscribe != nil {
+				i.onResubscribe(ctx)
+			}
+			return nil, nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInvalidator, err)
+	}
+
+	return i, nil
+}
+
+// Publish sends the keys to the handlers of all the nodes. The messages are
+// sent with the NOTIFY statement in the tx, therefore they are delivered
+// after the transaction is committed, and discarded if it is rolled back.
+// The duplicate keys are sent once, and the keys are split into several
+// messages if they don't fit in one notification.
+func (i *Invalidator) Publish(ctx context.Context, tx pgx.Tx, keys ...string) error {
+	keys = slices.Clone(keys)
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	for len(keys) > 0 {
+		payload, n, err := invalidationPayload(keys)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", i.channel, payload); err != nil {
+			return fmt.Errorf("publishing invalidation: %w", err)
+		}
+		keys = keys[n:]
+	}
+
+	return nil
+}
+
+// invalidationPayload returns the payload of as many of the keys as fit in a
+// notification, and the number of the keys it contains.
+func invalidationPayload(keys []string) (string, int, error) {
+	id, err := invalidationID()
+	if err != nil {
+		return "", 0, err
+	}
+	msg := invalidation{ID: id}
+	size := len(`{"id":"","keys":[]}`) + len(id)
+	for _, k := range keys {
+		quoted, err := json.Marshal(k)
+		if err != nil {
+			return "", 0, fmt.Errorf("encoding key %q: %w", k, err)
+		}
+		extra := len(quoted)
+		if len(msg.Keys) > 0 {
+			extra++ // the comma.
+		}
+		if size+extra > maxNotifyPayload {
+			break
+		}
+		size += extra
+		msg.Keys = append(msg.Keys, k)
+	}
+	if len(msg.Keys) == 0 {
+		return "", 0, fmt.Errorf("key %q is larger than a notification", keys[0])
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return "", 0, fmt.Errorf("encoding invalidation: %w", err)
+	}
+
+	return string(payload), len(msg.Keys), nil
+}
+
+func invalidationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating invalidation id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Run listens to the channel on the connections returned by the connect
+// function, and reconnects with the retry policy when the connection fails.
+// The *pgx.Conn satisfies the notify.Conn interface, and it is closed when
+// the connection fails. It returns the error of the ctx when it is
+// cancelled, or an error if it can't connect with the retry policy.
+func (i *Invalidator) Run(ctx context.Context, connect func(context.Context) (notify.Conn, error)) error {
+	for {
+		var conn notify.Conn
+		err := i.retry.DoContext(ctx, func() error {
+			var err error
+			conn, err = connect(ctx)
+			if err != nil {
+				i.report(err)
+			}
+			return err
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("connecting: %w", err)
+		}
+
+		err = i.subscriber.Run(ctx, conn)
+		if c, ok := conn.(interface{ Close(context.Context) error }); ok {
+			closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+			_ = c.Close(closeCtx)
+			cancel()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		i.report(err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(i.retry.Delay):
+		}
+	}
+}
+
+// receive delivers the keys of the notification unless its message has been
+// delivered before.
+func (i *Invalidator) receive(ctx context.Context, n *pgconn.Notification) {
+	var msg invalidation
+	if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+		i.report(fmt.Errorf("decoding invalidation: %w", err))
+		return
+	}
+	if !i.remember(msg.ID) {
+		return
+	}
+	i.handler(ctx, msg.Keys)
+}
+
+// remember records the id and returns false if it was already recorded. The
+// oldest ids are forgotten.
+func (i *Invalidator) remember(id string) bool {
+	if id == "" {
+		return true
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, ok := i.seen[id]; ok {
+		return false
+	}
+	if len(i.ids) == seenInvalidations {
+		delete(i.seen, i.ids[0])
+		i.ids = i.ids[1:]
+	}
+	i.seen[id] = struct{}{}
+	i.ids = append(i.ids, id)
+
+	return true
+}
+
+func (i *Invalidator) report(err error) {
+	if i.onError != nil {
+		i.onError(err)
+	}
+}
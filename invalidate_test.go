@@ -0,0 +1,226 @@
+package dbtools_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/dbtools/v4/notify"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidator(t *testing.T) {
+	t.Parallel()
+	t.Run("Invalid", testInvalidatorInvalid)
+	t.Run("Publish", testInvalidatorPublish)
+	t.Run("PublishSplit", testInvalidatorPublishSplit)
+	t.Run("Deliver", testInvalidatorDeliver)
+	t.Run("Resubscribe", testInvalidatorResubscribe)
+	t.Run("ConnectError", testInvalidatorConnectError)
+}
+
+func noopInvalidation(context.Context, []string) {}
+
+func testInvalidatorInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := dbtools.NewInvalidator("", noopInvalidation)
+	assert.ErrorIs(t, err, dbtools.ErrInvalidInvalidator)
+	_, err = dbtools.NewInvalidator("cache", nil)
+	assert.ErrorIs(t, err, dbtools.ErrInvalidInvalidator)
+}
+
+// publish runs the Publish method in a transaction and returns the payloads
+// of the notifications.
+func publish(t *testing.T, inv *dbtools.Invalidator, keys ...string) []map[string]any {
+	t.Helper()
+	sim := dbtesting.NewSimulator()
+	sim.On("pg_notify").Exec("SELECT 1")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		return inv.Publish(ctx, tx, keys...)
+	})
+	require.NoError(t, err)
+
+	var ret []map[string]any
+	for _, s := range sim.Statements() {
+		if !strings.Contains(s.SQL, "pg_notify") {
+			continue
+		}
+		require.Len(t, s.Args, 2)
+		assert.Equal(t, "cache", s.Args[0])
+		payload, ok := s.Args[1].(string)
+		require.True(t, ok)
+		assert.LessOrEqual(t, len(payload), 7999)
+		var msg map[string]any
+		require.NoError(t, json.Unmarshal([]byte(payload), &msg))
+		ret = append(ret, msg)
+	}
+
+	return ret
+}
+
+func testInvalidatorPublish(t *testing.T) {
+	t.Parallel()
+	inv, err := dbtools.NewInvalidator("cache", noopInvalidation)
+	require.NoError(t, err)
+
+	msgs := publish(t, inv, "user:2", "user:1", "user:2")
+	require.Len(t, msgs, 1)
+	assert.Equal(t, []any{"user:1", "user:2"}, msgs[0]["keys"])
+	assert.NotEmpty(t, msgs[0]["id"])
+}
+
+func testInvalidatorPublishSplit(t *testing.T) {
+	t.Parallel()
+	inv, err := dbtools.NewInvalidator("cache", noopInvalidation)
+	require.NoError(t, err)
+
+	keys := make([]string, 30)
+	for i := range keys {
+		keys[i] = string(rune('a'+i%26)) + strings.Repeat("x", 500) + string(rune('a'+i/26))
+	}
+	msgs := publish(t, inv, keys...)
+	require.Len(t, msgs, 2)
+	total := 0
+	for _, msg := range msgs {
+		total += len(msg["keys"].([]any))
+	}
+	assert.Equal(t, 30, total)
+	assert.NotEqual(t, msgs[0]["id"], msgs[1]["id"])
+}
+
+// invalidatorConn returns a connection that yields the notifications sent
+// on the feed, and fails when the fail channel is closed.
+func invalidatorConn(t *testing.T, feed <-chan *pgconn.Notification, fail <-chan struct{}) *mocks.NotifyConn {
+	t.Helper()
+	conn := mocks.NewNotifyConn(t)
+	conn.On("Exec", mock.Anything, `LISTEN "cache"`).Return(pgconn.CommandTag{}, nil).Maybe()
+	conn.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil).Maybe()
+	conn.On("WaitForNotification", mock.Anything).Return(
+		func(ctx context.Context) (*pgconn.Notification, error) {
+			select {
+			case n := <-feed:
+				return n, nil
+			case <-fail:
+				return nil, assert.AnError
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	).Maybe()
+	return conn
+}
+
+func testInvalidatorDeliver(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var got [][]string
+	inv, err := dbtools.NewInvalidator("cache", func(_ context.Context, keys []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, keys)
+	})
+	require.NoError(t, err)
+
+	feed := make(chan *pgconn.Notification)
+	conn := invalidatorConn(t, feed, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- inv.Run(ctx, func(context.Context) (notify.Conn, error) { return conn, nil })
+	}()
+
+	msg := func(id string, keys ...string) *pgconn.Notification {
+		payload, err := json.Marshal(map[string]any{"id": id, "keys": keys})
+		require.NoError(t, err)
+		return &pgconn.Notification{Channel: "cache", Payload: string(payload)}
+	}
+	feed <- msg("1", "a", "b")
+	feed <- msg("1", "a", "b")
+	feed <- &pgconn.Notification{Channel: "cache", Payload: "garbage"}
+	feed <- msg("2", "c")
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, got)
+}
+
+func testInvalidatorResubscribe(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var errs []error
+	resubscribed := make(chan struct{})
+	inv, err := dbtools.NewInvalidator("cache", noopInvalidation,
+		dbtools.ReconnectRetry(retry.Retry{Attempts: 1, Delay: time.Millisecond}),
+		dbtools.OnResubscribe(func(context.Context) { close(resubscribed) }),
+		dbtools.OnInvalidatorError(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}),
+	)
+	require.NoError(t, err)
+
+	fail := make(chan struct{})
+	close(fail)
+	conns := []notify.Conn{
+		invalidatorConn(t, nil, fail),
+		invalidatorConn(t, nil, nil),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- inv.Run(ctx, func(context.Context) (notify.Conn, error) {
+			conn := conns[0]
+			conns = conns[1:]
+			return conn, nil
+		})
+	}()
+
+	select {
+	case <-resubscribed:
+	case <-time.After(time.Second):
+		t.Fatal("not resubscribed")
+	}
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], assert.AnError)
+}
+
+func testInvalidatorConnectError(t *testing.T) {
+	t.Parallel()
+	calls := 0
+	inv, err := dbtools.NewInvalidator("cache", noopInvalidation,
+		dbtools.ReconnectRetry(retry.Retry{Attempts: 3, Delay: time.Millisecond}),
+	)
+	require.NoError(t, err)
+
+	err = inv.Run(context.Background(), func(context.Context) (notify.Conn, error) {
+		calls++
+		return nil, assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,77 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// OpKind is the kind of the operation that is retried.
+type OpKind string
+
+// The kinds of the operations that are retried.
+const (
+	KindTx    OpKind = "tx"
+	KindExec  OpKind = "exec"
+	KindQuery OpKind = "query"
+	KindCopy  OpKind = "copy"
+	KindPing  OpKind = "ping"
+)
+
+// KindMetrics can be implemented by a Metrics to receive the measurements of
+// every retried call, including the statements that run without a
+// transaction, broken down by the kind of the operation.
+type KindMetrics interface {
+	// ObserveCall is called after the last attempt of a call with the number
+	// of attempts and the duration of all of them including the delays.
+	ObserveCall(kind OpKind, label, class string, attempts int, d time.Duration)
+}
+
+// kindError tags an error with the kind of the operation that returned it.
+type kindError struct {
+	kind OpKind
+	err  error
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+func (e *kindError) Unwrap() error { return e.err }
+
+// ErrorKind returns the kind of the operation that returned the err. It
+// returns an empty string if the err is not returned by a retried operation.
+func ErrorKind(err error) OpKind {
+	var k *kindError
+	if errors.As(err, &k) {
+		return k.kind
+	}
+
+	return ""
+}
+
+type kindKey struct{}
+
+// withKind returns a copy of the ctx that runs the transactions as the kind.
+func withKind(ctx context.Context, kind OpKind) context.Context {
+	return context.WithValue(ctx, kindKey{}, kind)
+}
+
+// kindOf returns the kind of the transactions that run with the ctx.
+func kindOf(ctx context.Context) OpKind {
+	if k, ok := ctx.Value(kindKey{}).(OpKind); ok {
+		return k
+	}
+
+	return KindTx
+}
+
+// endCall reports the call of the kind that was started at the start time to
+// the metrics, and tags the err with the kind.
+func (p *PGX) endCall(kind OpKind, start time.Time, attempts int, err error) error {
+	if m, ok := p.metrics.(KindMetrics); ok {
+		m.ObserveCall(kind, p.label, ErrorClass(err), attempts, time.Since(start))
+	}
+	if err == nil {
+		return nil
+	}
+
+	return &kindError{kind: kind, err: err}
+}
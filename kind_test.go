@@ -0,0 +1,131 @@
+package dbtools_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type callObservation struct {
+	kind     dbtools.OpKind
+	class    string
+	attempts int
+}
+
+// kindMetrics records the calls by their kinds.
+type kindMetrics struct {
+	recordingMetrics
+	mu    sync.Mutex
+	calls []callObservation
+}
+
+func (k *kindMetrics) ObserveCall(kind dbtools.OpKind, _, class string, attempts int, _ time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.calls = append(k.calls, callObservation{kind: kind, class: class, attempts: attempts})
+}
+
+func TestErrorKind(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(".").Error(assert.AnError)
+	tr, err := dbtools.New(sim, dbtools.Retry(1, time.Millisecond))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = tr.Exec(ctx, "DELETE FROM sessions")
+	assert.Equal(t, dbtools.KindExec, dbtools.ErrorKind(err))
+	assert.Equal(t, "executing query: "+assert.AnError.Error(), err.Error(),
+		"the kind should not change the message")
+
+	err = tr.Query(ctx, func(pgx.Rows) error { return nil }, "SELECT 1")
+	assert.Equal(t, dbtools.KindQuery, dbtools.ErrorKind(err))
+
+	err = tr.QueryRow(ctx, func(row pgx.Row) error { return row.Scan() }, "SELECT 1")
+	assert.Equal(t, dbtools.KindQuery, dbtools.ErrorKind(err))
+
+	err = tr.Transaction(ctx, func(pgx.Tx) error { return assert.AnError })
+	assert.Equal(t, dbtools.KindTx, dbtools.ErrorKind(err))
+	assert.ErrorIs(t, err, assert.AnError)
+
+	_, err = tr.CopyFrom(ctx, pgx.Identifier{"people"}, []string{"name"}, func() pgx.CopyFromSource {
+		return pgx.CopyFromRows([][]any{{"alice"}})
+	})
+	assert.Equal(t, dbtools.KindCopy, dbtools.ErrorKind(err))
+
+	assert.Empty(t, dbtools.ErrorKind(assert.AnError))
+	assert.Empty(t, dbtools.ErrorKind(nil))
+}
+
+func TestKindMetrics(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^DELETE").Error(&pgconn.ConnectError{}).Times(1)
+	sim.On("^DELETE").Exec("DELETE 1")
+	sim.On("^SELECT").Return([]string{"n"}, []any{1})
+	metrics := &kindMetrics{}
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.WithMetrics(metrics),
+	)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = tr.Exec(ctx, "DELETE FROM sessions")
+	require.NoError(t, err)
+	err = tr.Query(ctx, func(pgx.Rows) error { return nil }, "SELECT 1")
+	require.NoError(t, err)
+	err = tr.Transaction(ctx, failingTx(assert.AnError))
+	require.NoError(t, err)
+
+	assert.Equal(t, []callObservation{
+		{kind: dbtools.KindExec, class: dbtools.ClassNone, attempts: 2},
+		{kind: dbtools.KindQuery, class: dbtools.ClassNone, attempts: 1},
+		{kind: dbtools.KindTx, class: dbtools.ClassNone, attempts: 2},
+	}, metrics.calls)
+	assert.Equal(t, []observation{
+		{class: dbtools.ClassNone, attempts: 2},
+		{class: dbtools.ClassNone, attempts: 1},
+		{class: dbtools.ClassNone, attempts: 2},
+	}, metrics.transactions, "the queries should be observed like the transactions")
+	assert.Len(t, metrics.attempts, 5)
+}
+
+func TestKindRetry(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^DELETE").Error(&pgconn.ConnectError{})
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(1, time.Millisecond),
+		dbtools.KindRetry(dbtools.KindExec, 3, time.Millisecond),
+	)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = tr.Exec(ctx, "DELETE FROM sessions")
+	require.Error(t, err)
+	assert.Len(t, sim.SQL(), 3, "the policy of the kind should be used")
+
+	calls := 0
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	require.Error(t, err)
+	assert.Equal(t, 1, calls, "the other kinds should use the default policy")
+
+	_, err = tr.Exec(dbtools.WithCallRetry(ctx, 2, time.Millisecond), "DELETE FROM sessions")
+	require.Error(t, err)
+	assert.Len(t, sim.SQL(), 7, "the call policy should take precedence")
+
+	d := tr.Describe()
+	assert.Contains(t, d.Features, "KindRetry")
+}
@@ -0,0 +1,153 @@
+// Package leader elects a leader among the replicas of a service with a
+// PostgreSQL advisory lock. The replica that holds the lock is the leader
+// until it stops or loses its connection.
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/arsham/dbtools/v4/lock"
+)
+
+// ConfigFunc is used for configuring the Elector.
+type ConfigFunc func(*Elector)
+
+// OnElected sets the function that is called when the replica becomes the
+// leader. The ctx is cancelled when the leadership is lost or the Run method
+// returns, and the function should return soon after. The function is called
+// in a new goroutine.
+func OnElected(fn func(ctx context.Context)) ConfigFunc {
+	return func(e *Elector) {
+		e.onElected = fn
+	}
+}
+
+// OnResigned sets the function that is called after the replica stops being
+// the leader and the OnElected function has returned.
+func OnResigned(fn func()) ConfigFunc {
+	return func(e *Elector) {
+		e.onResigned = fn
+	}
+}
+
+// OnError sets the function that is called when campaigning fails. The
+// Elector campaigns again after the interval anyway.
+func OnError(fn func(error)) ConfigFunc {
+	return func(e *Elector) {
+		e.onError = fn
+	}
+}
+
+// CampaignInterval sets the delay between the campaigns when the replica is
+// not the leader. The default value is 5s.
+func CampaignInterval(d time.Duration) ConfigFunc {
+	return func(e *Elector) {
+		e.interval = d
+	}
+}
+
+// MutexOptions sets the options of the underlying lock.Mutex. Use it for
+// setting the retry strategy of acquiring the lock and the keepalive interval.
+func MutexOptions(conf ...lock.ConfigFunc) ConfigFunc {
+	return func(e *Elector) {
+		e.mutexConf = append(e.mutexConf, conf...)
+	}
+}
+
+// Elector campaigns to become the leader for the key. Replicas using the
+// same key on the same database elect one leader among them:
+//
+//	e := leader.New(lock.PoolConnector(pool), cleanupJobKey,
+//		leader.OnElected(func(ctx context.Context) {
+//			runCleanup(ctx)
+//		}),
+//	)
+//	go e.Run(ctx)
+type Elector struct {
+	connect    lock.Connector
+	key        int64
+	mutexConf  []lock.ConfigFunc
+	onElected  func(ctx context.Context)
+	onResigned func()
+	onError    func(error)
+	interval   time.Duration
+	leader     atomic.Bool
+}
+
+// New returns an Elector for the key that acquires its connections with the
+// connect function.
+func New(connect lock.Connector, key int64, conf ...ConfigFunc) *Elector {
+	e := &Elector{
+		connect:  connect,
+		key:      key,
+		interval: 5 * time.Second,
+	}
+	for _, fn := range conf {
+		fn(e)
+	}
+
+	return e
+}
+
+// IsLeader returns true if the replica is the leader.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run campaigns until the ctx is cancelled, and returns the error of the ctx.
+// When the replica becomes the leader, it stays the leader until the lock is
+// lost or the ctx is cancelled. After losing the lock it campaigns again.
+func (e *Elector) Run(ctx context.Context) error {
+	m := lock.New(e.connect, e.key, e.mutexConf...)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		ok, err := m.TryLock(ctx)
+		if err != nil && ctx.Err() == nil && e.onError != nil {
+			e.onError(err)
+		}
+		if ok {
+			e.lead(ctx, m)
+		}
+		timer.Reset(e.interval)
+	}
+}
+
+// lead holds the leadership until the lock is lost or the ctx is cancelled.
+func (e *Elector) lead(ctx context.Context, m *lock.Mutex) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e.leader.Store(true)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if e.onElected != nil {
+			e.onElected(leaderCtx)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-m.Lost():
+	}
+	e.leader.Store(false)
+	cancel()
+	<-done
+
+	unlockCtx, unlockCancel := context.WithTimeout(context.Background(), e.interval)
+	defer unlockCancel()
+	if err := m.Unlock(unlockCtx); err != nil && e.onError != nil {
+		e.onError(err)
+	}
+	if e.onResigned != nil {
+		e.onResigned()
+	}
+}
@@ -0,0 +1,157 @@
+package leader_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4/leader"
+	"github.com/arsham/dbtools/v4/lock"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	tryQuery    = `SELECT pg_try_advisory_lock($1)`
+	unlockQuery = `SELECT pg_advisory_unlock($1)`
+	testKey     = int64(42)
+)
+
+func boolRow(t *testing.T, val bool) *mocks.PGXRow {
+	t.Helper()
+	row := mocks.NewPGXRow(t)
+	row.On("Scan", mock.Anything).Return(nil).Once().Run(func(args mock.Arguments) {
+		*args.Get(0).(*bool) = val
+	})
+	return row
+}
+
+func connector(conns ...lock.Conn) lock.Connector {
+	var mu sync.Mutex
+	return func(context.Context) (lock.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(conns) == 0 {
+			return nil, errors.New("no more connections")
+		}
+		conn := conns[0]
+		conns = conns[1:]
+		return conn, nil
+	}
+}
+
+func TestElector(t *testing.T) {
+	t.Parallel()
+	t.Run("Elected", testElectorElected)
+	t.Run("Recampaign", testElectorRecampaign)
+}
+
+func testElectorElected(t *testing.T) {
+	t.Parallel()
+	taken := mocks.NewLockConn(t)
+	taken.On("QueryRow", mock.Anything, tryQuery, testKey).Return(boolRow(t, false)).Once()
+	taken.On("Release", false).Once()
+	free := mocks.NewLockConn(t)
+	free.On("QueryRow", mock.Anything, tryQuery, testKey).Return(boolRow(t, true)).Once()
+	free.On("QueryRow", mock.Anything, unlockQuery, testKey).Return(boolRow(t, true)).Once()
+	free.On("Release", false).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	elected := make(chan struct{})
+	resigned := make(chan struct{})
+	var e *leader.Elector
+	e = leader.New(connector(taken, free), testKey,
+		leader.CampaignInterval(time.Millisecond),
+		leader.MutexOptions(lock.KeepAlive(0)),
+		leader.OnElected(func(leaderCtx context.Context) {
+			assert.True(t, e.IsLeader())
+			close(elected)
+			<-leaderCtx.Done()
+		}),
+		leader.OnResigned(func() {
+			assert.False(t, e.IsLeader())
+			close(resigned)
+		}),
+		leader.OnError(func(err error) {
+			t.Errorf("unexpected error: %v", err)
+		}),
+	)
+	errCh := make(chan error, 1)
+	go func() { errCh <- e.Run(ctx) }()
+
+	select {
+	case <-elected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected to be elected")
+	}
+	cancel()
+	select {
+	case <-resigned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected to resign")
+	}
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+}
+
+func testElectorRecampaign(t *testing.T) {
+	t.Parallel()
+	connErr := &pgconn.PgError{Code: "08006"}
+	first := mocks.NewLockConn(t)
+	first.On("QueryRow", mock.Anything, tryQuery, testKey).Return(boolRow(t, true)).Once()
+	first.On("Exec", mock.Anything, `SELECT 1`).Return(pgconn.CommandTag{}, connErr).Once()
+	first.On("Release", true).Once()
+	// Campaigning again after the lock is lost fails.
+	second := mocks.NewLockConn(t)
+	second.On("QueryRow", mock.Anything, tryQuery, testKey).Return(boolRow(t, false)).Once()
+	second.On("Release", false).Once()
+	third := mocks.NewLockConn(t)
+	third.On("QueryRow", mock.Anything, tryQuery, testKey).Return(boolRow(t, true)).Once()
+	third.On("Exec", mock.Anything, `SELECT 1`).Return(pgconn.CommandTag{}, nil).Maybe()
+	third.On("QueryRow", mock.Anything, unlockQuery, testKey).Return(boolRow(t, true)).Once()
+	third.On("Release", false).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	elected := make(chan struct{}, 2)
+	var mu sync.Mutex
+	var errs []error
+	e := leader.New(connector(first, second, third), testKey,
+		leader.CampaignInterval(time.Millisecond),
+		leader.MutexOptions(
+			lock.KeepAlive(time.Millisecond),
+			lock.WithRetry(retry.Retry{Attempts: 1}),
+		),
+		leader.OnElected(func(context.Context) {
+			elected <- struct{}{}
+		}),
+		leader.OnError(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}),
+	)
+	errCh := make(chan error, 1)
+	go func() { errCh <- e.Run(ctx) }()
+
+	for range 2 {
+		select {
+		case <-elected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected to be elected")
+		}
+	}
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], lock.ErrLockLost)
+}
@@ -0,0 +1,117 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arsham/retry/v3"
+)
+
+// Limit is the name of a guardrail.
+type Limit string
+
+// These are the guardrails that can have a soft limit.
+const (
+	// LimitStatements is the number of the statements of an attempt.
+	LimitStatements Limit = "statements"
+	// LimitRows is the number of the rows an attempt writes.
+	LimitRows Limit = "rows"
+	// LimitResultRows is the number of the rows a Query call reads.
+	LimitResultRows Limit = "result_rows"
+	// LimitResultBytes is the size of the values a Query call reads.
+	LimitResultBytes Limit = "result_bytes"
+	// LimitAge is the duration of an attempt, in nanoseconds.
+	LimitAge Limit = "age"
+)
+
+// Limits are the soft limits of the guardrails. Zero values are ignored.
+type Limits struct {
+	Statements  int
+	Rows        int64
+	ResultRows  int64
+	ResultBytes int64
+	Age         time.Duration
+}
+
+// LimitWarning is reported when a soft limit is exceeded. The Soft and the
+// Value of the LimitAge are durations in nanoseconds.
+type LimitWarning struct {
+	Limit Limit
+	Label string
+	// SQL is the statement that exceeded the limit. It is empty when the age
+	// is exceeded at the commit.
+	SQL   string
+	Soft  int64
+	Value int64
+}
+
+// softLimits reports the guardrails that exceed their soft limits.
+type softLimits struct {
+	limits Limits
+	warn   func(LimitWarning)
+}
+
+// guard returns a statement hook that reports the soft limits of one attempt
+// and enforces the MaxTransactionAge. Each limit is reported once per
+// attempt.
+func (p *PGX) guard() stmtHook {
+	start := time.Now()
+	var statements int
+	var rows int64
+	warned := make(map[Limit]bool)
+	report := func(limit Limit, sql string, soft, value int64) {
+		if p.soft == nil || soft <= 0 || value <= soft || warned[limit] {
+			return
+		}
+		warned[limit] = true
+		p.soft.warn(LimitWarning{Limit: limit, Label: p.label, SQL: sql, Soft: soft, Value: value})
+	}
+	var soft Limits
+	if p.soft != nil {
+		soft = p.soft.limits
+	}
+	age := func(sql string) error {
+		elapsed := time.Since(start)
+		report(LimitAge, sql, int64(soft.Age), int64(elapsed))
+		if p.maxAge > 0 && elapsed > p.maxAge && sql != "" {
+			return &retry.StopError{
+				Err: fmt.Errorf("%w: running for %s", ErrTransactionTooOld, elapsed.Round(time.Millisecond)),
+			}
+		}
+
+		return nil
+	}
+
+	return stmtHook{
+		before: func(_ context.Context, s *statement) error {
+			statements += max(s.Batch, 1)
+			report(LimitStatements, s.SQL, int64(soft.Statements), int64(statements))
+			return age(s.SQL)
+		},
+		after: func(_ context.Context, s *statement) error {
+			if s.Err == nil && isWrite(s.SQL) {
+				rows += s.Rows
+				report(LimitRows, s.SQL, soft.Rows, rows)
+			}
+			return nil
+		},
+		commit: func(context.Context) error {
+			return age("")
+		},
+	}
+}
+
+// warnResult reports the soft limits of the result of a Query call.
+func (p *PGX) warnResult(sql string, c *resultCounter) {
+	if p.soft == nil {
+		return
+	}
+	l := p.soft.limits
+	if l.ResultRows > 0 && c.rows > l.ResultRows {
+		p.soft.warn(LimitWarning{Limit: LimitResultRows, Label: p.label, SQL: sql, Soft: l.ResultRows, Value: c.rows})
+	}
+	if l.ResultBytes > 0 && c.bytes > l.ResultBytes {
+		p.soft.warn(LimitWarning{Limit: LimitResultBytes, Label: p.label, SQL: sql, Soft: l.ResultBytes, Value: c.bytes})
+	}
+}
@@ -0,0 +1,184 @@
+package dbtools_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// limitRecorder records the warnings of the soft limits.
+type limitRecorder struct {
+	mu       sync.Mutex
+	warnings []dbtools.LimitWarning
+}
+
+func (l *limitRecorder) warn(w dbtools.LimitWarning) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, w)
+}
+
+func (l *limitRecorder) limits() []dbtools.Limit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ret := make([]dbtools.Limit, len(l.warnings))
+	for i, w := range l.warnings {
+		ret[i] = w.Limit
+	}
+	return ret
+}
+
+func TestSoftLimits(t *testing.T) {
+	t.Parallel()
+	t.Run("Statements", testSoftLimitsStatements)
+	t.Run("Rows", testSoftLimitsRows)
+	t.Run("Age", testSoftLimitsAge)
+	t.Run("Result", testSoftLimitsResult)
+	t.Run("BeforeHardLimit", testSoftLimitsBeforeHardLimit)
+}
+
+func testSoftLimitsStatements(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT`).Exec("SELECT 1")
+	rec := &limitRecorder{}
+	tr, err := dbtools.New(sim,
+		dbtools.Label("orders"),
+		dbtools.SoftLimits(dbtools.Limits{Statements: 2}, rec.warn),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		for range 5 {
+			if _, err := tx.Exec(ctx, "SELECT 1"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err, "the soft limits should not stop the transaction")
+	require.Len(t, rec.warnings, 1, "the limit should be reported once")
+	assert.Equal(t, dbtools.LimitWarning{
+		Limit: dbtools.LimitStatements,
+		Label: "orders",
+		SQL:   "SELECT 1",
+		Soft:  2,
+		Value: 3,
+	}, rec.warnings[0])
+}
+
+func testSoftLimitsRows(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^UPDATE`).Exec("UPDATE 5")
+	rec := &limitRecorder{}
+	tr, err := dbtools.New(sim, dbtools.SoftLimits(dbtools.Limits{Rows: 8}, rec.warn))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		for range 2 {
+			if _, err := tx.Exec(ctx, "UPDATE users SET active = true"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, rec.warnings, 1)
+	assert.Equal(t, dbtools.LimitRows, rec.warnings[0].Limit)
+	assert.EqualValues(t, 10, rec.warnings[0].Value)
+}
+
+func testSoftLimitsAge(t *testing.T) {
+	t.Parallel()
+	rec := &limitRecorder{}
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.SoftLimits(dbtools.Limits{Age: time.Millisecond}, rec.warn))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, rec.warnings, 1)
+	assert.Equal(t, dbtools.LimitAge, rec.warnings[0].Limit)
+	assert.Empty(t, rec.warnings[0].SQL)
+	assert.GreaterOrEqual(t, time.Duration(rec.warnings[0].Value), 5*time.Millisecond)
+}
+
+func testSoftLimitsResult(t *testing.T) {
+	t.Parallel()
+	rec := &limitRecorder{}
+	tr, err := dbtools.New(newResultSimulator(t),
+		dbtools.SoftLimits(dbtools.Limits{ResultRows: 2, ResultBytes: 5}, rec.warn))
+	require.NoError(t, err)
+
+	names, err := queryNames(context.Background(), tr)
+	require.NoError(t, err)
+	assert.Len(t, names, 3)
+	assert.Equal(t, []dbtools.Limit{dbtools.LimitResultRows, dbtools.LimitResultBytes}, rec.limits())
+}
+
+func testSoftLimitsBeforeHardLimit(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT`).Exec("SELECT 1")
+	rec := &limitRecorder{}
+	tr, err := dbtools.New(sim,
+		dbtools.SoftLimits(dbtools.Limits{Statements: 1}, rec.warn),
+		dbtools.StatementQuota(2),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		for {
+			if _, err := tx.Exec(ctx, "SELECT 1"); err != nil {
+				return err
+			}
+		}
+	})
+	require.ErrorIs(t, err, dbtools.ErrQuotaExceeded)
+	assert.Equal(t, []dbtools.Limit{dbtools.LimitStatements}, rec.limits())
+}
+
+func TestMaxTransactionAge(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT`).Exec("SELECT 1")
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(5, time.Millisecond),
+		dbtools.MaxTransactionAge(5*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	calls := 0
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		calls++
+		if _, err := tx.Exec(ctx, "SELECT 1"); err != nil {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, err := tx.Exec(ctx, "SELECT 1")
+		return err
+	})
+	require.ErrorIs(t, err, dbtools.ErrTransactionTooOld)
+	assert.Equal(t, 1, calls, "the transaction should not be retried")
+
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, err, "the age should not be enforced at the commit")
+}
@@ -0,0 +1,160 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// LoadMany runs the query once for the distinct keys and returns the values
+// by their keys. The keys are passed as the only argument of the query, which
+// should select the rows with the "= ANY($1)" condition. The scan function
+// returns the key and the value of each row. The keys without a row are not
+// in the returned map. The query is retried with the same policy as the Query
+// method:
+//
+//	users, err := dbtools.LoadMany(ctx, p,
+//		`SELECT id, name FROM users WHERE id = ANY($1)`, ids,
+//		func(rows pgx.Rows) (int64, User, error) {
+//			var u User
+//			err := rows.Scan(&u.ID, &u.Name)
+//			return u.ID, u, err
+//		},
+//	)
+//
+// It returns an ErrEmptyDatabase error if p is nil.
+func LoadMany[K comparable, T any](ctx context.Context, p *PGX, sql string, keys []K, scan func(pgx.Rows) (K, T, error)) (map[K]T, error) {
+	if p == nil {
+		return nil, ErrEmptyDatabase
+	}
+	seen := make(map[K]struct{}, len(keys))
+	unique := make([]K, 0, len(keys))
+	for _, k := range keys {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		unique = append(unique, k)
+	}
+	ret := make(map[K]T, len(unique))
+	if len(unique) == 0 {
+		return ret, nil
+	}
+
+	err := p.Query(ctx, func(rows pgx.Rows) error {
+		k, v, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		ret[k] = v
+		return nil
+	}, sql, unique)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Loader collects the keys of the concurrent Load calls for a short window,
+// and loads them with one LoadMany call. This avoids the N+1 queries of the
+// GraphQL resolvers that fan out to the same table. It is safe for concurrent
+// use.
+type Loader[K comparable, T any] struct {
+	p        *PGX
+	sql      string
+	scan     func(pgx.Rows) (K, T, error)
+	window   time.Duration
+	maxBatch int
+
+	mu    sync.Mutex
+	batch *loaderBatch[K, T]
+}
+
+type loaderBatch[K comparable, T any] struct {
+	ctx    context.Context
+	keys   []K
+	done   chan struct{}
+	values map[K]T
+	err    error
+}
+
+// NewLoader returns a Loader that waits for the window after the first key of
+// a batch before running the query, or until the batch has maxBatch keys. A
+// maxBatch less than 1 means no limit. See the LoadMany function for the sql
+// and the scan arguments.
+func NewLoader[K comparable, T any](p *PGX, sql string, window time.Duration, maxBatch int, scan func(pgx.Rows) (K, T, error)) *Loader[K, T] {
+	return &Loader[K, T]{
+		p:        p,
+		sql:      sql,
+		scan:     scan,
+		window:   window,
+		maxBatch: maxBatch,
+	}
+}
+
+// Load returns the value of the key. It returns a pgx.ErrNoRows error if the
+// query didn't return a row for the key. The batch runs with the values of
+// the ctx of its first call, but is not cancelled with it; the ctx only stops
+// waiting for the result.
+func (l *Loader[K, T]) Load(ctx context.Context, key K) (T, error) {
+	var zero T
+	b := l.add(ctx, key)
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case <-b.done:
+	}
+	if b.err != nil {
+		return zero, b.err
+	}
+	v, ok := b.values[key]
+	if !ok {
+		return zero, fmt.Errorf("loading %v: %w", key, pgx.ErrNoRows)
+	}
+
+	return v, nil
+}
+
+// add adds the key to the current batch, and runs the batch when it is full.
+func (l *Loader[K, T]) add(ctx context.Context, key K) *loaderBatch[K, T] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.batch
+	if b == nil {
+		b = &loaderBatch[K, T]{
+			ctx:  context.WithoutCancel(ctx),
+			done: make(chan struct{}),
+		}
+		l.batch = b
+		time.AfterFunc(l.window, func() { l.flush(b) })
+	}
+	b.keys = append(b.keys, key)
+	if l.maxBatch > 0 && len(b.keys) >= l.maxBatch {
+		l.batch = nil
+		go l.run(b)
+	}
+
+	return b
+}
+
+// flush runs the b if it is still the current batch.
+func (l *Loader[K, T]) flush(b *loaderBatch[K, T]) {
+	l.mu.Lock()
+	if l.batch != b {
+		l.mu.Unlock()
+		return
+	}
+	l.batch = nil
+	l.mu.Unlock()
+
+	l.run(b)
+}
+
+func (l *Loader[K, T]) run(b *loaderBatch[K, T]) {
+	b.values, b.err = LoadMany(b.ctx, l.p, l.sql, b.keys, l.scan)
+	close(b.done)
+}
@@ -0,0 +1,155 @@
+package dbtools_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const loadUsers = `SELECT id, name FROM users WHERE id = ANY($1)`
+
+// newUsersSimulator returns a simulator that returns the users 1 and 2.
+func newUsersSimulator() *dbtesting.Simulator {
+	sim := dbtesting.NewSimulator()
+	sim.On(`FROM users`).Return([]string{"id", "name"},
+		[]any{int64(1), "alice"},
+		[]any{int64(2), "bob"},
+	)
+	return sim
+}
+
+func scanUser(rows pgx.Rows) (int64, string, error) {
+	var id int64
+	var name string
+	err := rows.Scan(&id, &name)
+	return id, name, err
+}
+
+func TestLoadMany(t *testing.T) {
+	t.Parallel()
+	t.Run("Distinct", testLoadManyDistinct)
+	t.Run("NoKeys", testLoadManyNoKeys)
+	t.Run("Error", testLoadManyError)
+}
+
+func testLoadManyDistinct(t *testing.T) {
+	t.Parallel()
+	sim := newUsersSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	users, err := dbtools.LoadMany(context.Background(), tr, loadUsers, []int64{2, 1, 2, 3}, scanUser)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: "alice", 2: "bob"}, users)
+	statements := sim.Statements()
+	require.Len(t, statements, 1)
+	assert.Equal(t, []any{[]int64{2, 1, 3}}, statements[0].Args)
+}
+
+func testLoadManyNoKeys(t *testing.T) {
+	t.Parallel()
+	sim := newUsersSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	users, err := dbtools.LoadMany(context.Background(), tr, loadUsers, nil, scanUser)
+	require.NoError(t, err)
+	assert.Empty(t, users)
+	assert.Empty(t, sim.Statements())
+
+	_, err = dbtools.LoadMany(context.Background(), nil, loadUsers, []int64{1}, scanUser)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func testLoadManyError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`FROM users`).Error(assert.AnError)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	_, err = dbtools.LoadMany(context.Background(), tr, loadUsers, []int64{1}, scanUser)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestLoader(t *testing.T) {
+	t.Parallel()
+	t.Run("Window", testLoaderWindow)
+	t.Run("MaxBatch", testLoaderMaxBatch)
+	t.Run("Cancelled", testLoaderCancelled)
+}
+
+// loadAll loads the keys concurrently and returns the values and the errors
+// in the order of the keys.
+func loadAll(ctx context.Context, l *dbtools.Loader[int64, string], keys ...int64) ([]string, []error) {
+	values := make([]string, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i], errs[i] = l.Load(ctx, k)
+		}()
+	}
+	wg.Wait()
+	return values, errs
+}
+
+func testLoaderWindow(t *testing.T) {
+	t.Parallel()
+	sim := newUsersSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	l := dbtools.NewLoader(tr, loadUsers, 50*time.Millisecond, 0, scanUser)
+
+	values, errs := loadAll(context.Background(), l, 1, 2, 1, 3)
+	assert.Equal(t, []string{"alice", "bob", "alice", ""}, values)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.NoError(t, errs[2])
+	assert.ErrorIs(t, errs[3], pgx.ErrNoRows)
+	statements := sim.Statements()
+	require.Len(t, statements, 1)
+	assert.ElementsMatch(t, []int64{1, 2, 3}, statements[0].Args[0])
+
+	values, errs = loadAll(context.Background(), l, 2)
+	assert.Equal(t, []string{"bob"}, values)
+	assert.NoError(t, errs[0])
+	assert.Len(t, sim.Statements(), 2, "the next call should start a new batch")
+}
+
+func testLoaderMaxBatch(t *testing.T) {
+	t.Parallel()
+	sim := newUsersSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	l := dbtools.NewLoader(tr, loadUsers, time.Hour, 2, scanUser)
+
+	values, errs := loadAll(context.Background(), l, 1, 2, 2, 1)
+	assert.Equal(t, []string{"alice", "bob", "bob", "alice"}, values)
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Len(t, sim.Statements(), 2)
+}
+
+func testLoaderCancelled(t *testing.T) {
+	t.Parallel()
+	sim := newUsersSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	l := dbtools.NewLoader(tr, loadUsers, time.Hour, 0, scanUser)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = l.Load(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,96 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WithAdvisoryLock runs the fn inside a transaction after acquiring the
+// transaction level advisory lock of the key. It waits for the lock to be
+// released if another transaction holds it. The lock is released when the
+// transaction is committed or rolled back. The transaction is retried with
+// the same semantics as the Transaction method. This is useful for jobs that
+// should have only one writer at a time:
+//
+//	err := tr.WithAdvisoryLock(ctx, reportJobKey, func(tx pgx.Tx) error {
+//		return generateReport(ctx, tx)
+//	})
+func (p *PGX) WithAdvisoryLock(ctx context.Context, key int64, fn func(pgx.Tx) error) error {
+	if fn == nil {
+		return ErrNilStep
+	}
+	lock := Step{
+		Name: "advisory lock",
+		Fn: func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, key)
+			if err != nil {
+				return fmt.Errorf("acquiring advisory lock %d: %w", key, err)
+			}
+
+			return nil
+		},
+	}
+
+	return p.run(ctx, []Step{lock, {Fn: fn}})
+}
+
+// WithTryAdvisoryLock is like the WithAdvisoryLock method, but it doesn't wait
+// for the lock. If the lock is held by another transaction, the attempt
+// returns an ErrLockNotAcquired error, and the transaction is retried with the
+// retry policy of the PGX object.
+func (p *PGX) WithTryAdvisoryLock(ctx context.Context, key int64, fn func(pgx.Tx) error) error {
+	if fn == nil {
+		return ErrNilStep
+	}
+	lock := Step{
+		Name: "advisory lock",
+		Fn: func(tx pgx.Tx) error {
+			var ok bool
+			err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, key).Scan(&ok)
+			if err != nil {
+				return fmt.Errorf("acquiring advisory lock %d: %w", key, err)
+			}
+			if !ok {
+				return fmt.Errorf("%w: %d", ErrLockNotAcquired, key)
+			}
+
+			return nil
+		},
+	}
+
+	return p.run(ctx, []Step{lock, {Fn: fn}})
+}
+
+// LockInOrder acquires the transaction level advisory locks of the keys in
+// ascending order. Duplicate keys are locked once. When all transactions lock
+// their keys with this function they can't deadlock each other on these
+// locks. If a deadlock still happens, for example with the row locks, the
+// error contains the keys and can be checked with the IsDeadlock function:
+//
+//	err := tr.Transaction(ctx, func(tx pgx.Tx) error {
+//		if err := dbtools.LockInOrder(ctx, tx, to, from); err != nil {
+//			return err
+//		}
+//		return transfer(ctx, tx, from, to)
+//	})
+func LockInOrder(ctx context.Context, tx pgx.Tx, keys ...int64) error {
+	keys = slices.Clone(keys)
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	for _, key := range keys {
+		_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, key)
+		if err == nil {
+			continue
+		}
+		if IsDeadlock(err) {
+			return fmt.Errorf("acquiring advisory lock %d of keys %v: %w", key, keys, err)
+		}
+
+		return fmt.Errorf("acquiring advisory lock %d: %w", key, err)
+	}
+
+	return nil
+}
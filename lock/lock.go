@@ -0,0 +1,316 @@
+// Package lock provides a distributed mutex backed by PostgreSQL session level
+// advisory locks.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrLocked is returned when locking a Mutex that is already held.
+	ErrLocked = errors.New("mutex is already locked")
+
+	// ErrNotLocked is returned when unlocking a Mutex that is not held.
+	ErrNotLocked = errors.New("mutex is not locked")
+
+	// ErrLockLost is returned when the lock was lost before it was unlocked,
+	// because the connection that held it was lost.
+	ErrLockLost = errors.New("lock was lost")
+)
+
+// Conn is a dedicated database connection. Session level advisory locks are
+// held by the connection until they are unlocked or the connection is closed.
+//
+//go:generate mockery --name Conn --filename lock_conn_mock.go --structname LockConn --output ../mocks
+type Conn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	// Release returns the connection to its pool. If destroy is true the
+	// connection should be closed instead, so any locks held by it are
+	// released by the server.
+	Release(destroy bool)
+}
+
+// Connector returns a dedicated connection for holding the lock.
+type Connector func(ctx context.Context) (Conn, error)
+
+// PoolConnector returns a Connector that acquires connections from the pool.
+func PoolConnector(pool *pgxpool.Pool) Connector {
+	return func(ctx context.Context) (Conn, error) {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return poolConn{Conn: conn}, nil
+	}
+}
+
+type poolConn struct {
+	*pgxpool.Conn
+}
+
+func (p poolConn) Release(destroy bool) {
+	if destroy {
+		//nolint:errcheck // the connection is discarded.
+		p.Conn.Hijack().Close(context.Background())
+		return
+	}
+	p.Conn.Release()
+}
+
+// ConfigFunc is used for configuring the Mutex.
+type ConfigFunc func(*Mutex)
+
+// WithRetry sets the retry strategy for acquiring the lock. Only the
+// connection errors are retried.
+func WithRetry(r retry.Retry) ConfigFunc {
+	return func(m *Mutex) {
+		m.loop = r
+	}
+}
+
+// KeepAlive sets the interval of checking the connection that holds the lock.
+// If the connection is lost, the lock is reported as lost. The default value
+// is 10s. Zero or negative values disable the keepalive.
+func KeepAlive(interval time.Duration) ConfigFunc {
+	return func(m *Mutex) {
+		m.keepAlive = interval
+	}
+}
+
+// Mutex is a distributed mutual exclusion lock backed by a session level
+// advisory lock. Processes using the same key on the same database exclude
+// each other. A Mutex should not be copied after first use.
+//
+// While the lock is held, the connection is checked periodically. If the
+// connection is lost, the server releases the lock and another process can
+// take it, therefore the channel returned by the Lost method is closed and the
+// Unlock method returns an ErrLockLost error. The lock is not acquired again
+// behind the holder's back; call Lock again to take it.
+type Mutex struct {
+	connect   Connector
+	key       int64
+	loop      retry.Retry
+	keepAlive time.Duration
+
+	mu   sync.Mutex
+	conn Conn
+	stop chan struct{}
+	done chan struct{}
+	lost chan struct{}
+}
+
+// New returns a Mutex for the key that acquires its connections with the
+// connect function.
+func New(connect Connector, key int64, conf ...ConfigFunc) *Mutex {
+	m := &Mutex{
+		connect:   connect,
+		key:       key,
+		keepAlive: 10 * time.Second,
+		loop: retry.Retry{
+			Attempts: 3,
+			Delay:    300 * time.Millisecond,
+			Method:   retry.IncrementalDelay,
+		},
+	}
+	for _, fn := range conf {
+		fn(m)
+	}
+	if m.loop.Attempts < 1 {
+		m.loop.Attempts = 1
+	}
+
+	return m
+}
+
+// Lock waits until the lock is acquired or the ctx is done. It returns an
+// ErrLocked error if the Mutex is already held.
+func (m *Mutex) Lock(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return ErrLocked
+	}
+	conn, err := m.acquire(ctx, `SELECT true FROM pg_advisory_lock($1)`)
+	if err != nil {
+		return err
+	}
+	m.hold(conn)
+
+	return nil
+}
+
+// TryLock acquires the lock if it is not held by another session, and returns
+// false otherwise. It returns an ErrLocked error if the Mutex is already held.
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return false, ErrLocked
+	}
+	conn, err := m.acquire(ctx, `SELECT pg_try_advisory_lock($1)`)
+	if err != nil || conn == nil {
+		return false, err
+	}
+	m.hold(conn)
+
+	return true, nil
+}
+
+// Unlock releases the lock. It returns an ErrNotLocked error if the Mutex is
+// not held, and an ErrLockLost error if the lock was lost in the meantime.
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop == nil {
+		return ErrNotLocked
+	}
+	close(m.stop)
+	<-m.done
+	conn := m.conn
+	if conn != nil {
+		// The keepalive has closed the lost channel if the conn is lost.
+		close(m.lost)
+	}
+	m.conn, m.stop, m.done, m.lost = nil, nil, nil, nil
+	if conn == nil {
+		return ErrLockLost
+	}
+
+	var unlocked bool
+	err := conn.QueryRow(ctx, `SELECT pg_advisory_unlock($1)`, m.key).Scan(&unlocked)
+	if err != nil {
+		conn.Release(true)
+		return fmt.Errorf("releasing lock: %w", err)
+	}
+	conn.Release(false)
+	if !unlocked {
+		return ErrLockLost
+	}
+
+	return nil
+}
+
+// Lost returns a channel that is closed when the lock is lost or unlocked. If
+// the Mutex is not held, the returned channel is closed.
+func (m *Mutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lost == nil {
+		lost := make(chan struct{})
+		close(lost)
+		return lost
+	}
+
+	return m.lost
+}
+
+// acquire runs the query on a new connection and returns the connection if
+// the query returns true. It returns a nil connection if the query returns
+// false. The connection errors are retried.
+func (m *Mutex) acquire(ctx context.Context, query string) (Conn, error) {
+	var ret Conn
+	err := m.loop.DoContext(ctx, func() error {
+		conn, err := m.connect(ctx)
+		if err != nil {
+			return classify(fmt.Errorf("acquiring connection: %w", err))
+		}
+		var ok bool
+		err = conn.QueryRow(ctx, query, m.key).Scan(&ok)
+		if err != nil {
+			// The lock might have been acquired before the error.
+			conn.Release(true)
+			return classify(fmt.Errorf("acquiring lock: %w", err))
+		}
+		if !ok {
+			conn.Release(false)
+			return nil
+		}
+		ret = conn
+
+		return nil
+	})
+
+	return ret, err
+}
+
+func classify(err error) error {
+	if dbtools.IsConnectionError(err) {
+		return err
+	}
+
+	return &retry.StopError{Err: err}
+}
+
+// hold stores the conn and starts the keepalive.
+func (m *Mutex) hold(conn Conn) {
+	m.conn = conn
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	m.lost = make(chan struct{})
+	if m.keepAlive <= 0 {
+		close(m.done)
+		return
+	}
+	go m.keepalive(m.stop, m.done, m.lost)
+}
+
+// keepalive checks the connection in intervals until the stop channel is
+// closed. The connection is only used by this goroutine until the done channel
+// is closed.
+func (m *Mutex) keepalive(stop <-chan struct{}, done, lost chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(m.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !m.refresh(stop) {
+			close(lost)
+			return
+		}
+	}
+}
+
+// refresh checks the connection. It returns false if the connection is lost,
+// as the server has released the lock.
+func (m *Mutex) refresh(stop <-chan struct{}) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	_, err := m.conn.Exec(ctx, `SELECT 1`)
+	if err == nil {
+		return true
+	}
+	select {
+	case <-stop:
+		// The error is caused by unlocking, which handles the connection.
+		return true
+	default:
+	}
+	m.conn.Release(true)
+	m.conn = nil
+
+	return false
+}
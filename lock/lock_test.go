@@ -0,0 +1,177 @@
+package lock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4/lock"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	lockQuery    = `SELECT true FROM pg_advisory_lock($1)`
+	tryQuery     = `SELECT pg_try_advisory_lock($1)`
+	unlockQuery  = `SELECT pg_advisory_unlock($1)`
+	testKey      = int64(42)
+	testAttempts = 3
+)
+
+var connErr = &pgconn.PgError{Code: "08006"}
+
+func boolRow(t *testing.T, val bool, err error) *mocks.PGXRow {
+	t.Helper()
+	row := mocks.NewPGXRow(t)
+	row.On("Scan", mock.Anything).Return(err).Once().Run(func(args mock.Arguments) {
+		*args.Get(0).(*bool) = val
+	})
+	return row
+}
+
+func connector(conns ...lock.Conn) lock.Connector {
+	return func(context.Context) (lock.Conn, error) {
+		if len(conns) == 0 {
+			return nil, errors.New("no more connections")
+		}
+		conn := conns[0]
+		conns = conns[1:]
+		return conn, nil
+	}
+}
+
+func newMutex(connect lock.Connector, conf ...lock.ConfigFunc) *lock.Mutex {
+	conf = append([]lock.ConfigFunc{
+		lock.WithRetry(retry.Retry{Attempts: testAttempts, Delay: time.Millisecond}),
+		lock.KeepAlive(0),
+	}, conf...)
+	return lock.New(connect, testKey, conf...)
+}
+
+func TestMutexLock(t *testing.T) {
+	t.Parallel()
+	t.Run("Success", testMutexLockSuccess)
+	t.Run("ConnectionError", testMutexLockConnectionError)
+	t.Run("QueryError", testMutexLockQueryError)
+	t.Run("AlreadyLocked", testMutexLockAlreadyLocked)
+}
+
+func testMutexLockSuccess(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	conn := mocks.NewLockConn(t)
+	conn.On("QueryRow", mock.Anything, lockQuery, testKey).Return(boolRow(t, true, nil)).Once()
+	conn.On("QueryRow", mock.Anything, unlockQuery, testKey).Return(boolRow(t, true, nil)).Once()
+	conn.On("Release", false).Once()
+
+	m := newMutex(connector(conn))
+	require.NoError(t, m.Lock(ctx))
+	lost := m.Lost()
+	select {
+	case <-lost:
+		t.Error("didn't expect the lock to be lost")
+	default:
+	}
+	require.NoError(t, m.Unlock(ctx))
+	for _, ch := range []<-chan struct{}{lost, m.Lost()} {
+		select {
+		case <-ch:
+		default:
+			t.Error("expected the channel to be closed after unlocking")
+		}
+	}
+
+	err := m.Unlock(ctx)
+	assert.ErrorIs(t, err, lock.ErrNotLocked)
+}
+
+func testMutexLockConnectionError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bad := mocks.NewLockConn(t)
+	bad.On("QueryRow", mock.Anything, lockQuery, testKey).Return(boolRow(t, false, connErr)).Once()
+	bad.On("Release", true).Once()
+	good := mocks.NewLockConn(t)
+	good.On("QueryRow", mock.Anything, lockQuery, testKey).Return(boolRow(t, true, nil)).Once()
+
+	m := newMutex(connector(bad, good))
+	require.NoError(t, m.Lock(ctx))
+}
+
+func testMutexLockQueryError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	conn := mocks.NewLockConn(t)
+	conn.On("QueryRow", mock.Anything, lockQuery, testKey).Return(boolRow(t, false, assert.AnError)).Once()
+	conn.On("Release", true).Once()
+
+	m := newMutex(connector(conn))
+	err := m.Lock(ctx)
+	require.ErrorIs(t, err, assert.AnError)
+
+	err = m.Unlock(ctx)
+	assert.ErrorIs(t, err, lock.ErrNotLocked)
+}
+
+func testMutexLockAlreadyLocked(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	conn := mocks.NewLockConn(t)
+	conn.On("QueryRow", mock.Anything, lockQuery, testKey).Return(boolRow(t, true, nil)).Once()
+
+	m := newMutex(connector(conn))
+	require.NoError(t, m.Lock(ctx))
+	err := m.Lock(ctx)
+	assert.ErrorIs(t, err, lock.ErrLocked)
+	_, err = m.TryLock(ctx)
+	assert.ErrorIs(t, err, lock.ErrLocked)
+}
+
+func TestMutexTryLock(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	taken := mocks.NewLockConn(t)
+	taken.On("QueryRow", mock.Anything, tryQuery, testKey).Return(boolRow(t, false, nil)).Once()
+	taken.On("Release", false).Once()
+	free := mocks.NewLockConn(t)
+	free.On("QueryRow", mock.Anything, tryQuery, testKey).Return(boolRow(t, true, nil)).Once()
+
+	m := newMutex(connector(taken, free))
+	ok, err := m.TryLock(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = m.TryLock(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestMutexKeepAlive(t *testing.T) {
+	t.Parallel()
+	t.Run("Lost", testMutexKeepAliveLost)
+}
+
+func testMutexKeepAliveLost(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	first := mocks.NewLockConn(t)
+	first.On("QueryRow", mock.Anything, lockQuery, testKey).Return(boolRow(t, true, nil)).Once()
+	first.On("Exec", mock.Anything, `SELECT 1`).Return(pgconn.CommandTag{}, connErr).Once()
+	first.On("Release", true).Once()
+
+	// The lock is not acquired again on a new connection.
+	m := newMutex(connector(first), lock.KeepAlive(time.Millisecond))
+	require.NoError(t, m.Lock(ctx))
+	select {
+	case <-m.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lock to be lost")
+	}
+	err := m.Unlock(ctx)
+	assert.ErrorIs(t, err, lock.ErrLockLost)
+}
@@ -0,0 +1,170 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXWithAdvisoryLock(t *testing.T) {
+	t.Parallel()
+	t.Run("NilFunction", testPGXWithAdvisoryLockNilFunction)
+	t.Run("LockError", testPGXWithAdvisoryLockLockError)
+	t.Run("Success", testPGXWithAdvisoryLockSuccess)
+	t.Run("RealDatabase", testPGXWithAdvisoryLockRealDatabase)
+}
+
+func testPGXWithAdvisoryLockNilFunction(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(mocks.NewPool(t))
+	require.NoError(t, err)
+	err = tr.WithAdvisoryLock(context.Background(), 1, nil)
+	assert.ErrorIs(t, err, dbtools.ErrNilStep)
+	err = tr.WithTryAdvisoryLock(context.Background(), 1, nil)
+	assert.ErrorIs(t, err, dbtools.ErrNilStep)
+}
+
+func testPGXWithAdvisoryLockLockError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	total := 3
+	tr, err := dbtools.New(db, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("Exec", mock.Anything, "SELECT pg_advisory_xact_lock($1)", int64(42)).
+		Return(pgconn.CommandTag{}, assert.AnError).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	err = tr.WithAdvisoryLock(context.Background(), 42, func(pgx.Tx) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	require.ErrorIs(t, err, assert.AnError)
+}
+
+func testPGXWithAdvisoryLockSuccess(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, "SELECT pg_advisory_xact_lock($1)", int64(42)).
+		Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	calls := 0
+	err = tr.WithAdvisoryLock(context.Background(), 42, func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestPGXWithTryAdvisoryLock(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	row := mocks.NewPGXRow(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(3)
+	tx.On("QueryRow", mock.Anything, "SELECT pg_try_advisory_xact_lock($1)", int64(42)).
+		Return(row).Times(3)
+	scan := func(ok bool) func(mock.Arguments) {
+		return func(args mock.Arguments) {
+			*args.Get(0).(*bool) = ok
+		}
+	}
+	row.On("Scan", mock.Anything).Return(nil).Twice().Run(scan(false))
+	row.On("Scan", mock.Anything).Return(nil).Once().Run(scan(true))
+	tx.On("Rollback", mock.Anything).Return(nil).Twice()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	calls := 0
+	err = tr.WithTryAdvisoryLock(context.Background(), 42, func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func testPGXWithAdvisoryLockRealDatabase(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("slow test")
+	}
+	ctx := context.Background()
+	addr := getDB(t)
+	db, err := pgxpool.New(ctx, addr)
+	require.NoError(t, err)
+	defer db.Close()
+
+	tr, err := dbtools.New(db, dbtools.Retry(3, 10*time.Millisecond))
+	require.NoError(t, err)
+
+	err = tr.WithAdvisoryLock(ctx, 42, func(pgx.Tx) error {
+		err := tr.WithTryAdvisoryLock(ctx, 42, func(pgx.Tx) error {
+			t.Error("didn't expect to receive this call")
+			return nil
+		})
+		assert.ErrorIs(t, err, dbtools.ErrLockNotAcquired)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestLockInOrder(t *testing.T) {
+	t.Parallel()
+	t.Run("Order", testLockInOrderOrder)
+	t.Run("Deadlock", testLockInOrderDeadlock)
+}
+
+func testLockInOrderOrder(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tx := mocks.NewPGXTx(t)
+	var got []int64
+	tx.On("Exec", mock.Anything, "SELECT pg_advisory_xact_lock($1)", mock.Anything).
+		Return(pgconn.CommandTag{}, nil).Times(3).
+		Run(func(args mock.Arguments) {
+			got = append(got, args.Get(2).(int64))
+		})
+
+	keys := []int64{30, 10, 20, 10}
+	err := dbtools.LockInOrder(ctx, tx, keys...)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{10, 20, 30}, got)
+	assert.Equal(t, []int64{30, 10, 20, 10}, keys, "keys should not be modified")
+}
+
+func testLockInOrderDeadlock(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tx := mocks.NewPGXTx(t)
+	deadlock := &pgconn.PgError{Code: "40P01"}
+	tx.On("Exec", mock.Anything, "SELECT pg_advisory_xact_lock($1)", int64(1)).
+		Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Exec", mock.Anything, "SELECT pg_advisory_xact_lock($1)", int64(2)).
+		Return(pgconn.CommandTag{}, deadlock).Once()
+
+	err := dbtools.LockInOrder(ctx, tx, 3, 2, 1)
+	require.ErrorIs(t, err, deadlock)
+	assert.True(t, dbtools.IsDeadlock(err))
+	assert.Contains(t, err.Error(), "[1 2 3]")
+}
@@ -0,0 +1,51 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxLockTimeout is the largest lock_timeout the server accepts.
+const maxLockTimeout = math.MaxInt32 * time.Millisecond
+
+// lockEscalation holds the configuration of the EscalateLockTimeout option.
+// A zero max doesn't cap the timeout.
+type lockEscalation struct {
+	first time.Duration
+	max   time.Duration
+}
+
+// timeout returns the lock_timeout of the attempt, which doubles on each
+// attempt up to the max.
+func (l *lockEscalation) timeout(attempt int) time.Duration {
+	limit := maxLockTimeout
+	if l.max > 0 {
+		limit = min(l.max, limit)
+	}
+	d := l.first
+	for i := 1; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+
+	return min(d, limit)
+}
+
+// escalate sets the lock_timeout of the attempt of the ctx on the tx.
+func (p *PGX) escalate(ctx context.Context, tx pgx.Tx) error {
+	if p.lockTimeouts == nil {
+		return nil
+	}
+	info, _ := TxInfoFromContext(ctx)
+	d := p.lockTimeouts.timeout(max(info.Attempt, 1))
+	const query = `SELECT set_config('lock_timeout', $1, true)`
+	if _, err := tx.Exec(ctx, query, strconv.FormatInt(d.Milliseconds(), 10)+"ms"); err != nil {
+		return fmt.Errorf("setting lock timeout: %w", err)
+	}
+
+	return nil
+}
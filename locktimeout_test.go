@@ -0,0 +1,170 @@
+package dbtools_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsLockTimeout(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":          {nil, false},
+		"other":        {assert.AnError, false},
+		"lock timeout": {fmt.Errorf("foo: %w", &pgconn.PgError{Code: "55P03"}), true},
+		"deadlock":     {&pgconn.PgError{Code: "40P01"}, false},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, dbtools.IsLockTimeout(tc.err))
+		})
+	}
+}
+
+func TestEscalateLockTimeout(t *testing.T) {
+	t.Parallel()
+	t.Run("Escalates", testEscalateLockTimeoutEscalates)
+	t.Run("Disabled", testEscalateLockTimeoutDisabled)
+	t.Run("NoCap", testEscalateLockTimeoutNoCap)
+	t.Run("MaxBelowFirst", testEscalateLockTimeoutMaxBelowFirst)
+	t.Run("Classifier", testEscalateLockTimeoutClassifier)
+	t.Run("SetError", testEscalateLockTimeoutSetError)
+}
+
+func lockTimeouts(sim *dbtesting.Simulator) []any {
+	var ret []any
+	for _, s := range sim.Statements() {
+		if len(s.Args) == 1 {
+			ret = append(ret, s.Args[0])
+		}
+	}
+	return ret
+}
+
+func testEscalateLockTimeoutEscalates(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("set_config").Exec("SELECT 1")
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(5, time.Millisecond),
+		dbtools.EscalateLockTimeout(100*time.Millisecond, 300*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), failingTx(
+		&pgconn.PgError{Code: "55P03"},
+		&pgconn.PgError{Code: "55P03"},
+		&pgconn.PgError{Code: "55P03"},
+		&pgconn.PgError{Code: "55P03"},
+	))
+	require.NoError(t, err)
+	want := []any{"100ms", "200ms", "300ms", "300ms", "300ms"}
+	assert.Equal(t, want, lockTimeouts(sim))
+	assert.Contains(t, tr.Describe().Features, "EscalateLockTimeout")
+}
+
+func testEscalateLockTimeoutDisabled(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim,
+		dbtools.EscalateLockTimeout(time.Second, time.Minute),
+		dbtools.EscalateLockTimeout(0, 0),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "COMMIT"}, sim.SQL())
+	assert.NotContains(t, tr.Describe().Features, "EscalateLockTimeout")
+}
+
+func testEscalateLockTimeoutNoCap(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("set_config").Exec("SELECT 1")
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.EscalateLockTimeout(100*time.Millisecond, 0),
+		dbtools.StrictConfig(),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), failingTx(
+		&pgconn.PgError{Code: "55P03"},
+		&pgconn.PgError{Code: "55P03"},
+	))
+	require.NoError(t, err)
+	want := []any{"100ms", "200ms", "400ms"}
+	assert.Equal(t, want, lockTimeouts(sim))
+}
+
+func testEscalateLockTimeoutMaxBelowFirst(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("set_config").Exec("SELECT 1")
+	_, err := dbtools.New(sim,
+		dbtools.EscalateLockTimeout(time.Second, 100*time.Millisecond),
+		dbtools.StrictConfig(),
+	)
+	require.ErrorIs(t, err, dbtools.ErrInvalidLockTimeout)
+
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(2, time.Millisecond),
+		dbtools.EscalateLockTimeout(time.Second, 100*time.Millisecond),
+	)
+	require.NoError(t, err)
+	err = tr.Transaction(context.Background(), failingTx(&pgconn.PgError{Code: "55P03"}))
+	require.NoError(t, err)
+	want := []any{"1000ms", "1000ms"}
+	assert.Equal(t, want, lockTimeouts(sim), "the max should be raised to the first")
+}
+
+func testEscalateLockTimeoutClassifier(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("set_config").Exec("SELECT 1")
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.WithClassifier(dbtools.IsSerializationFailure),
+		dbtools.EscalateLockTimeout(time.Second, time.Minute),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), failingTx(&pgconn.PgError{Code: "55P03"}))
+	require.NoError(t, err, "the lock timeouts should be retried")
+
+	err = tr.Transaction(context.Background(), failingTx(&pgconn.PgError{Code: "40P01"}))
+	assert.True(t, dbtools.IsDeadlock(err))
+}
+
+func testEscalateLockTimeoutSetError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("set_config").Error(assert.AnError)
+	tr, err := dbtools.New(sim, dbtools.EscalateLockTimeout(time.Second, time.Minute))
+	require.NoError(t, err)
+
+	called := false
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		called = true
+		return nil
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.False(t, called)
+	var txErr *dbtools.TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, dbtools.PhaseBegin, txErr.Phase)
+	assert.Contains(t, sim.SQL(), "ROLLBACK")
+}
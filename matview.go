@@ -0,0 +1,84 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// RefreshOption configures the RefreshMaterializedView method.
+type RefreshOption func(*refreshConfig)
+
+type refreshConfig struct {
+	serialize bool
+}
+
+// SerializeRefresh makes the refreshes of the same materialized view wait for
+// each other with a transaction level advisory lock, which is derived from
+// the name of the view. This prevents the concurrent refreshes from queueing
+// up on the lock of the view, and doing the same work more than once.
+func SerializeRefresh() RefreshOption {
+	return func(c *refreshConfig) {
+		c.serialize = true
+	}
+}
+
+// RefreshMaterializedView refreshes the materialized view with the name,
+// which can be qualified with the schema name, for example "reports.daily".
+// The refresh is retried with the policy of the p, for example when it fails
+// to acquire the lock of the view within the lock_timeout.
+//
+// When concurrently is true, the view is refreshed without blocking the
+// readers. If the view has never been populated, it is refreshed without the
+// CONCURRENTLY option, which PostgreSQL requires for the first refresh. The
+// concurrent refreshes need a unique index on the view, and the error of a
+// missing index is not retried:
+//
+//	err := tr.RefreshMaterializedView(ctx, "reports.daily", true, dbtools.SerializeRefresh())
+func (p *PGX) RefreshMaterializedView(ctx context.Context, name string, concurrently bool, opts ...RefreshOption) error {
+	var c refreshConfig
+	for _, fn := range opts {
+		fn(&c)
+	}
+	view := pgx.Identifier(strings.Split(name, ".")).Sanitize()
+
+	var steps []Step
+	if c.serialize {
+		steps = append(steps, Step{
+			Name: "advisory lock",
+			Fn: func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "dbtools.refresh:"+view)
+				if err != nil {
+					return fmt.Errorf("acquiring advisory lock: %w", err)
+				}
+				return nil
+			},
+		})
+	}
+	steps = append(steps, Step{
+		Name: "refresh " + name,
+		Fn: func(tx pgx.Tx) error {
+			sql := "REFRESH MATERIALIZED VIEW "
+			if concurrently {
+				var populated bool
+				err := tx.QueryRow(ctx, `SELECT relispopulated FROM pg_class WHERE oid = $1::regclass`, view).Scan(&populated)
+				if err != nil {
+					return fmt.Errorf("checking materialized view: %w", err)
+				}
+				if populated {
+					sql += "CONCURRENTLY "
+				}
+			}
+			_, err := tx.Exec(ctx, sql+view)
+			if SQLState(err) == "55000" { // object_not_in_prerequisite_state
+				return &retry.StopError{Err: err}
+			}
+			return err
+		},
+	})
+
+	return p.run(ctx, steps)
+}
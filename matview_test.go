@@ -0,0 +1,108 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXRefreshMaterializedView(t *testing.T) {
+	t.Parallel()
+	t.Run("Plain", testPGXRefreshMaterializedViewPlain)
+	t.Run("Concurrently", testPGXRefreshMaterializedViewConcurrently)
+	t.Run("NotPopulated", testPGXRefreshMaterializedViewNotPopulated)
+	t.Run("Serialize", testPGXRefreshMaterializedViewSerialize)
+	t.Run("LockTimeout", testPGXRefreshMaterializedViewLockTimeout)
+	t.Run("NoUniqueIndex", testPGXRefreshMaterializedViewNoUniqueIndex)
+}
+
+func testPGXRefreshMaterializedViewPlain(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^REFRESH").Exec("REFRESH MATERIALIZED VIEW")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.RefreshMaterializedView(context.Background(), "reports.daily", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", `REFRESH MATERIALIZED VIEW "reports"."daily"`, "COMMIT"}, sim.SQL())
+}
+
+func testPGXRefreshMaterializedViewConcurrently(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("relispopulated").Return([]string{"relispopulated"}, []any{true})
+	sim.On("^REFRESH").Exec("REFRESH MATERIALIZED VIEW")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.RefreshMaterializedView(context.Background(), "daily", true)
+	require.NoError(t, err)
+	stmts := sim.Statements()
+	require.Len(t, stmts, 4)
+	assert.Equal(t, []any{`"daily"`}, stmts[1].Args)
+	assert.Equal(t, `REFRESH MATERIALIZED VIEW CONCURRENTLY "daily"`, stmts[2].SQL)
+}
+
+func testPGXRefreshMaterializedViewNotPopulated(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("relispopulated").Return([]string{"relispopulated"}, []any{false})
+	sim.On("^REFRESH").Exec("REFRESH MATERIALIZED VIEW")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.RefreshMaterializedView(context.Background(), "daily", true)
+	require.NoError(t, err)
+	assert.Contains(t, sim.SQL(), `REFRESH MATERIALIZED VIEW "daily"`)
+}
+
+func testPGXRefreshMaterializedViewSerialize(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("pg_advisory_xact_lock").Exec("SELECT 1")
+	sim.On("^REFRESH").Exec("REFRESH MATERIALIZED VIEW")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.RefreshMaterializedView(context.Background(), "reports.daily", false, dbtools.SerializeRefresh())
+	require.NoError(t, err)
+	stmts := sim.Statements()
+	require.Len(t, stmts, 4)
+	assert.Equal(t, `SELECT pg_advisory_xact_lock(hashtext($1))`, stmts[1].SQL)
+	assert.Equal(t, []any{`dbtools.refresh:"reports"."daily"`}, stmts[1].Args)
+}
+
+func testPGXRefreshMaterializedViewLockTimeout(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^REFRESH").Error(&pgconn.PgError{Code: "55P03"}).Times(1)
+	sim.On("^REFRESH").Exec("REFRESH MATERIALIZED VIEW")
+	tr, err := dbtools.New(sim, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	err = tr.RefreshMaterializedView(context.Background(), "daily", false)
+	require.NoError(t, err)
+	assert.Equal(t, "COMMIT", sim.SQL()[len(sim.SQL())-1])
+}
+
+func testPGXRefreshMaterializedViewNoUniqueIndex(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("relispopulated").Return([]string{"relispopulated"}, []any{true})
+	sim.On("^REFRESH").Error(&pgconn.PgError{Code: "55000"})
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	err = tr.RefreshMaterializedView(context.Background(), "daily", true)
+	require.Error(t, err)
+	assert.Equal(t, "55000", dbtools.SQLState(err))
+	assert.Contains(t, err.Error(), `step "refresh daily"`)
+	assert.Len(t, sim.SQL(), 4, "it should not be retried")
+}
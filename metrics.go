@@ -0,0 +1,118 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Metrics receives the measurements of the transactions. The label is the
+// value set with the Label option, and the class is the result of the
+// ErrorClass function for the error of the attempt or the transaction.
+// The methods are called synchronously and should return quickly.
+type Metrics interface {
+	// ObserveAttempt is called after each attempt of a transaction.
+	ObserveAttempt(label, class string, d time.Duration)
+	// ObserveTransaction is called after the last attempt of a transaction
+	// with the number of attempts and the duration of all of them including
+	// the delays.
+	ObserveTransaction(label, class string, attempts int, d time.Duration)
+}
+
+// RollbackMetrics can be implemented by a Metrics to count the rollbacks
+// that didn't finish within the grace period. See the OnRollbackTimeout
+// option.
+type RollbackMetrics interface {
+	ObserveRollbackTimeout(label string)
+}
+
+// QueueMetrics can be implemented by a Metrics to receive the state of the
+// job queues. See the ReportStats option of the queue package.
+type QueueMetrics interface {
+	// ObserveQueue is called with the number of the ready and the dead jobs
+	// of the queue, and the age of its oldest ready job.
+	ObserveQueue(queue string, ready, dead int64, oldestReady time.Duration)
+}
+
+// Metrics returns the Metrics set with the WithMetrics option, or nil if it
+// is not set.
+func (p *PGX) Metrics() Metrics {
+	return p.metrics
+}
+
+// The error classes returned by the ErrorClass function.
+const (
+	ClassNone          = "none"
+	ClassCanceled      = "canceled"
+	ClassTimeout       = "timeout"
+	ClassConnection    = "connection"
+	ClassSerialization = "serialization"
+	ClassDeadlock      = "deadlock"
+	ClassIntegrity     = "integrity"
+	ClassQuota         = "quota"
+	ClassPanic         = "panic"
+	ClassOther         = "other"
+)
+
+// ErrorClass returns a low cardinality name for the err that is suitable for
+// metric labels. It returns ClassNone if the err is nil.
+func ErrorClass(err error) string {
+	code := SQLState(err)
+	switch {
+	case err == nil:
+		return ClassNone
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	case errors.Is(err, context.DeadlineExceeded), code == "57014": // query_canceled
+		return ClassTimeout
+	case errors.Is(err, ErrQuotaExceeded):
+		return ClassQuota
+	case IsConnectionError(err):
+		return ClassConnection
+	case IsSerializationFailure(err):
+		return ClassSerialization
+	case IsDeadlock(err):
+		return ClassDeadlock
+	case strings.HasPrefix(code, "23"): // integrity_constraint_violation
+		return ClassIntegrity
+	}
+
+	return ClassOther
+}
+
+// observeAttempt reports the attempt that was started at the start time to the
+// metrics.
+func (p *PGX) observeAttempt(start time.Time, class string) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.ObserveAttempt(p.label, class, time.Since(start))
+}
+
+// observed returns a function that calls the fn, counts its calls in the
+// attempts, and reports each call to the metrics as an attempt.
+func (p *PGX) observed(attempts *int, fn func() error) func() error {
+	return func() (err error) {
+		*attempts++
+		start := time.Now()
+		defer func() {
+			if r := recover(); r != nil {
+				p.observeAttempt(start, ClassPanic)
+				panic(r)
+			}
+			p.observeAttempt(start, ErrorClass(err))
+		}()
+
+		return fn()
+	}
+}
+
+// observeTransaction reports the transaction that was started at the start
+// time to the metrics.
+func (p *PGX) observeTransaction(start time.Time, err error, attempts int) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.ObserveTransaction(p.label, ErrorClass(err), attempts, time.Since(start))
+}
@@ -0,0 +1,168 @@
+package dbtools_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type observation struct {
+	label    string
+	class    string
+	attempts int
+}
+
+type recordingMetrics struct {
+	mu           sync.Mutex
+	attempts     []observation
+	transactions []observation
+}
+
+func (r *recordingMetrics) ObserveAttempt(label, class string, _ time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, observation{label: label, class: class})
+}
+
+func (r *recordingMetrics) ObserveTransaction(label, class string, attempts int, _ time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transactions = append(r.transactions, observation{label: label, class: class, attempts: attempts})
+}
+
+func TestErrorClass(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		err  error
+		want string
+	}{
+		"nil":           {nil, dbtools.ClassNone},
+		"canceled":      {fmt.Errorf("foo: %w", context.Canceled), dbtools.ClassCanceled},
+		"deadline":      {context.DeadlineExceeded, dbtools.ClassTimeout},
+		"query timeout": {&pgconn.PgError{Code: "57014"}, dbtools.ClassTimeout},
+		"quota":         {dbtools.ErrQuotaExceeded, dbtools.ClassQuota},
+		"connection":    {&pgconn.PgError{Code: "08006"}, dbtools.ClassConnection},
+		"serialization": {&pgconn.PgError{Code: "40001"}, dbtools.ClassSerialization},
+		"deadlock":      {&pgconn.PgError{Code: "40P01"}, dbtools.ClassDeadlock},
+		"unique":        {&pgconn.PgError{Code: "23505"}, dbtools.ClassIntegrity},
+		"other":         {assert.AnError, dbtools.ClassOther},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, dbtools.ErrorClass(tc.err))
+		})
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	t.Parallel()
+	t.Run("Retried", testWithMetricsRetried)
+	t.Run("Panic", testWithMetricsPanic)
+	t.Run("Queries", testWithMetricsQueries)
+}
+
+func testWithMetricsRetried(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	m := &recordingMetrics{}
+	tr, err := dbtools.New(db,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.Label("transfer"),
+		dbtools.WithMetrics(m),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(3)
+	tx.On("Rollback", mock.Anything).Return(nil).Twice()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	calls := 0
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		calls++
+		switch calls {
+		case 1:
+			return &pgconn.PgError{Code: "40001"}
+		case 2:
+			return &pgconn.PgError{Code: "40P01"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []observation{
+		{label: "transfer", class: dbtools.ClassSerialization},
+		{label: "transfer", class: dbtools.ClassDeadlock},
+		{label: "transfer", class: dbtools.ClassNone},
+	}, m.attempts)
+	assert.Equal(t, []observation{
+		{label: "transfer", class: dbtools.ClassNone, attempts: 3},
+	}, m.transactions)
+}
+
+func testWithMetricsPanic(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	m := &recordingMetrics{}
+	tr, err := dbtools.New(db, dbtools.WithMetrics(m))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	assert.NotPanics(t, func() {
+		err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+			panic("oops")
+		})
+	})
+	require.Error(t, err)
+	assert.Equal(t, []observation{{class: dbtools.ClassPanic}}, m.attempts)
+	assert.Equal(t, []observation{{class: dbtools.ClassOther, attempts: 1}}, m.transactions)
+}
+
+func testWithMetricsQueries(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^DELETE").Error(&pgconn.PgError{Code: "40001"}).Times(1)
+	sim.On("^DELETE").Exec("DELETE 1")
+	sim.On("^SELECT").Error(&pgconn.PgError{Code: "23505"})
+	m := &recordingMetrics{}
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.Label("cleanup"),
+		dbtools.WithMetrics(m),
+	)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = tr.Exec(ctx, "DELETE FROM sessions")
+	require.NoError(t, err)
+	err = tr.QueryRow(ctx, func(row pgx.Row) error { return row.Scan() }, "SELECT 1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `query "cleanup": `)
+
+	assert.Equal(t, []observation{
+		{label: "cleanup", class: dbtools.ClassSerialization},
+		{label: "cleanup", class: dbtools.ClassNone},
+		{label: "cleanup", class: dbtools.ClassIntegrity},
+		{label: "cleanup", class: dbtools.ClassIntegrity},
+		{label: "cleanup", class: dbtools.ClassIntegrity},
+	}, m.attempts)
+	assert.Equal(t, []observation{
+		{label: "cleanup", class: dbtools.ClassNone, attempts: 2},
+		{label: "cleanup", class: dbtools.ClassIntegrity, attempts: 3},
+	}, m.transactions)
+}
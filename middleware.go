@@ -0,0 +1,24 @@
+package dbtools
+
+import "github.com/jackc/pgx/v5"
+
+// TxFunc is a function that runs inside a transaction.
+type TxFunc func(pgx.Tx) error
+
+// Middleware wraps a TxFunc with another one, similar to the http middleware.
+// The returned function can run code before and after the next function,
+// replace the pgx.Tx it receives, or change the returned error. The next
+// function should be called at most once. A replaced pgx.Tx should have an
+// Unwrap() pgx.Tx method that returns the original one, otherwise the
+// OnAttemptEnd and Idempotent functions can't find its attempt.
+type Middleware func(next TxFunc) TxFunc
+
+// chain returns the fn wrapped in the middleware. The first middleware is the
+// outermost one.
+func (p *PGX) chain(fn TxFunc) TxFunc {
+	for i := len(p.middleware) - 1; i >= 0; i-- {
+		fn = p.middleware[i](fn)
+	}
+
+	return fn
+}
@@ -0,0 +1,148 @@
+package dbtools_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	t.Parallel()
+	t.Run("Order", testWithMiddlewareOrder)
+	t.Run("Error", testWithMiddlewareError)
+	t.Run("Tx", testWithMiddlewareTx)
+	t.Run("Internal", testWithMiddlewareInternal)
+	t.Run("Clone", testWithMiddlewareClone)
+}
+
+func recordingMiddleware(name string, calls *[]string) dbtools.Middleware {
+	return func(next dbtools.TxFunc) dbtools.TxFunc {
+		return func(tx pgx.Tx) error {
+			*calls = append(*calls, name+":before")
+			err := next(tx)
+			*calls = append(*calls, name+":after")
+			return err
+		}
+	}
+}
+
+func testWithMiddlewareOrder(t *testing.T) {
+	t.Parallel()
+	var calls []string
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(2, time.Millisecond),
+		dbtools.WithMiddleware(recordingMiddleware("a", &calls), nil),
+		dbtools.WithMiddleware(recordingMiddleware("b", &calls)),
+	)
+	require.NoError(t, err)
+
+	fn := failingTx(&pgconn.PgError{Code: "40001"})
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		calls = append(calls, "fn")
+		return fn(tx)
+	})
+	require.NoError(t, err)
+	once := []string{"a:before", "b:before", "fn", "b:after", "a:after"}
+	assert.Equal(t, append(once, once...), calls, "each attempt should be wrapped")
+	assert.Contains(t, tr.Describe().Features, "WithMiddleware")
+}
+
+func testWithMiddlewareError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.WithMiddleware(func(next dbtools.TxFunc) dbtools.TxFunc {
+			return func(tx pgx.Tx) error {
+				if err := next(tx); err != nil {
+					return fmt.Errorf("audited: %w", err)
+				}
+				return nil
+			}
+		}),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "audited")
+	assert.NotContains(t, sim.SQL(), "COMMIT")
+}
+
+type taggedTx struct {
+	pgx.Tx
+}
+
+func testWithMiddlewareTx(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.WithMiddleware(func(next dbtools.TxFunc) dbtools.TxFunc {
+			return func(tx pgx.Tx) error {
+				return next(taggedTx{Tx: tx})
+			}
+		}),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(tx pgx.Tx) error {
+		_, ok := tx.(taggedTx)
+		assert.True(t, ok, "the function should receive the tx of the middleware")
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func testWithMiddlewareInternal(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("set_config").Exec("SELECT 1")
+	calls := 0
+	tr, err := dbtools.New(sim,
+		dbtools.SetLocal("lock_timeout", "1s"),
+		dbtools.WithMiddleware(func(next dbtools.TxFunc) dbtools.TxFunc {
+			return func(tx pgx.Tx) error {
+				calls++
+				return next(tx)
+			}
+		}),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(),
+		func(pgx.Tx) error { return nil },
+		func(pgx.Tx) error { return nil },
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls, "only the functions of the caller should be wrapped")
+}
+
+func testWithMiddlewareClone(t *testing.T) {
+	t.Parallel()
+	var calls []string
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.WithMiddleware(recordingMiddleware("a", &calls)),
+	)
+	require.NoError(t, err)
+	other, err := tr.With(dbtools.WithMiddleware(recordingMiddleware("b", &calls)))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:before", "a:after"}, calls)
+
+	calls = nil
+	err = other.Transaction(ctx, func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:before", "b:before", "b:after", "a:after"}, calls)
+}
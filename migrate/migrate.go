@@ -0,0 +1,420 @@
+// Package migrate applies the SQL migrations of an fs.FS, for example an
+// embed.FS, and records the applied versions in a table. Each migration is
+// run in its own transaction with the retry policy of the dbtools.PGX, and
+// the transaction holds an advisory lock, therefore several instances of a
+// service can run the migrations at the same time when they start, and each
+// migration is applied only once.
+//
+// The migration files are named "<version>_<name>.up.sql" and
+// "<version>_<name>.down.sql", for example "0001_create_users.up.sql". The
+// down migrations are optional:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	sub, err := fs.Sub(migrations, "migrations")
+//	// handle the error!
+//	m, err := migrate.New(tr, sub)
+//	// handle the error!
+//	applied, err := m.Up(ctx)
+//
+// The statements that can't be run in a transaction, for example CREATE
+// INDEX CONCURRENTLY, are not supported.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTable is the name of the table that records the applied versions.
+// It can be passed to the dbtools.SchemaVersion option with the "version"
+// column.
+const DefaultTable = "dbtools_migrations"
+
+var (
+	// ErrInvalidName is returned when the name of a migration file doesn't
+	// have the "<version>_<name>.up.sql" or "<version>_<name>.down.sql"
+	// format.
+	ErrInvalidName = errors.New("invalid migration file name")
+
+	// ErrDuplicateVersion is returned when two migrations have the same
+	// version.
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+
+	// ErrMissingUp is returned when a version has a down migration without an
+	// up migration.
+	ErrMissingUp = errors.New("missing up migration")
+
+	// ErrMissingDown is returned when reverting a version that doesn't have a
+	// down migration, or is not in the fs.FS.
+	ErrMissingDown = errors.New("missing down migration")
+
+	// ErrDrift is returned by the Verify method when an applied migration is
+	// edited or removed after it was applied.
+	ErrDrift = errors.New("migration drift")
+)
+
+// Migration is a version of the schema. The Checksum is the hex encoded
+// SHA-256 of the Up migration, and is recorded when the migration is applied.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Load reads the migrations from the root of the fsys, sorted by their
+// versions. The files without the ".sql" extension are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		version, name, up, err := parseName(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %s: %w", e.Name(), err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("%w: %d is %q and %q", ErrDuplicateVersion, version, m.Name, name)
+		}
+		if up {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	ret := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%w: %d_%s", ErrMissingUp, m.Version, m.Name)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		ret = append(ret, *m)
+	}
+	slices.SortFunc(ret, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return ret, nil
+}
+
+// parseName returns the parts of the file name.
+func parseName(file string) (version int64, name string, up bool, err error) {
+	base, up := strings.CutSuffix(file, ".up.sql")
+	if !up {
+		var down bool
+		base, down = strings.CutSuffix(file, ".down.sql")
+		if !down {
+			return 0, "", false, fmt.Errorf("%w: %s", ErrInvalidName, file)
+		}
+	}
+	v, name, ok := strings.Cut(base, "_")
+	if !ok || name == "" {
+		return 0, "", false, fmt.Errorf("%w: %s", ErrInvalidName, file)
+	}
+	version, err = strconv.ParseInt(v, 10, 64)
+	if err != nil || version < 1 {
+		return 0, "", false, fmt.Errorf("%w: %s", ErrInvalidName, file)
+	}
+
+	return version, name, up, nil
+}
+
+// ConfigFunc is used for configuring the Migrator.
+type ConfigFunc func(*Migrator)
+
+// Table sets the name of the table that records the applied versions. The
+// default value is DefaultTable.
+func Table(name string) ConfigFunc {
+	return func(m *Migrator) {
+		m.table = name
+	}
+}
+
+// OnApply sets the function that is called after each migration is applied
+// or reverted, for example for logging.
+func OnApply(fn func(m Migration, up bool)) ConfigFunc {
+	return func(m *Migrator) {
+		m.onApply = fn
+	}
+}
+
+// Migrator applies and reverts the migrations.
+type Migrator struct {
+	tr         *dbtools.PGX
+	migrations []Migration
+	table      string
+	onApply    func(m Migration, up bool)
+}
+
+// New returns a Migrator with the migrations of the fsys. See the Load
+// function for the format of the files.
+func New(tr *dbtools.PGX, fsys fs.FS, conf ...ConfigFunc) (*Migrator, error) {
+	if tr == nil {
+		return nil, dbtools.ErrEmptyDatabase
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	m := &Migrator{
+		tr:         tr,
+		migrations: migrations,
+		table:      DefaultTable,
+	}
+	for _, fn := range conf {
+		fn(m)
+	}
+
+	return m, nil
+}
+
+// Migrations returns the migrations of the Migrator.
+func (m *Migrator) Migrations() []Migration {
+	return slices.Clone(m.migrations)
+}
+
+// Applied returns the applied versions in ascending order.
+func (m *Migrator) Applied(ctx context.Context) ([]int64, error) {
+	var versions []int64
+	err := m.tr.Transaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		versions, err = m.prepare(ctx, tx)
+		return err
+	})
+
+	return versions, err
+}
+
+// Up applies the pending migrations in order, each in its own transaction,
+// and returns the applied migrations. The migrations that are applied by
+// another Migrator in the meantime are skipped. When a migration fails, the
+// earlier migrations stay applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var ret []Migration
+	for _, mig := range m.migrations {
+		applied := false
+		err := m.tr.Transaction(ctx, func(tx pgx.Tx) error {
+			applied = false
+			versions, err := m.prepare(ctx, tx)
+			if err != nil || slices.Contains(versions, mig.Version) {
+				return err
+			}
+			if _, err := tx.Exec(ctx, mig.Up); err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			query := `INSERT INTO ` + m.ident() + ` (version, name, checksum) VALUES ($1, $2, $3)`
+			if _, err := tx.Exec(ctx, query, mig.Version, mig.Name, mig.Checksum); err != nil {
+				return fmt.Errorf("recording migration %d: %w", mig.Version, err)
+			}
+			applied = true
+			return nil
+		})
+		if err != nil {
+			return ret, err
+		}
+		if applied {
+			ret = append(ret, mig)
+			if m.onApply != nil {
+				m.onApply(mig, true)
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// Down reverts the last n applied migrations in the reverse order, each in
+// its own transaction, and returns the reverted migrations. It returns an
+// ErrMissingDown error if a migration doesn't have a down migration.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var ret []Migration
+	for range n {
+		var mig Migration
+		err := m.tr.Transaction(ctx, func(tx pgx.Tx) error {
+			mig = Migration{}
+			versions, err := m.prepare(ctx, tx)
+			if err != nil || len(versions) == 0 {
+				return err
+			}
+			last := versions[len(versions)-1]
+			i := slices.IndexFunc(m.migrations, func(mig Migration) bool {
+				return mig.Version == last
+			})
+			if i < 0 || m.migrations[i].Down == "" {
+				return &retry.StopError{Err: fmt.Errorf("%w: %d", ErrMissingDown, last)}
+			}
+			if _, err := tx.Exec(ctx, m.migrations[i].Down); err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", last, m.migrations[i].Name, err)
+			}
+			query := `DELETE FROM ` + m.ident() + ` WHERE version = $1`
+			if _, err := tx.Exec(ctx, query, last); err != nil {
+				return fmt.Errorf("removing migration %d: %w", last, err)
+			}
+			mig = m.migrations[i]
+			return nil
+		})
+		if err != nil {
+			return ret, err
+		}
+		if mig.Version == 0 {
+			break
+		}
+		ret = append(ret, mig)
+		if m.onApply != nil {
+			m.onApply(mig, false)
+		}
+	}
+
+	return ret, nil
+}
+
+// Plan returns the migrations that the Up method would apply, without
+// applying them. It only reads the database: the migrations table is not
+// created and the migration lock is not taken, and all migrations are pending
+// if the table doesn't exist.
+func (m *Migrator) Plan(ctx context.Context) ([]Migration, error) {
+	var versions []int64
+	err := m.tr.Transaction(ctx, func(tx pgx.Tx) error {
+		var exists bool
+		err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, m.ident()).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("checking migrations table: %w", err)
+		}
+		versions = nil
+		if !exists {
+			return nil
+		}
+		versions, err = m.versions(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ret []Migration
+	for _, mig := range m.migrations {
+		if !slices.Contains(versions, mig.Version) {
+			ret = append(ret, mig)
+		}
+	}
+
+	return ret, nil
+}
+
+// Verify returns an ErrDrift error if an applied migration is not in the
+// fs.FS, or its Up migration has changed since it was applied. The
+// migrations that were applied before the checksums were recorded are not
+// checked. Call it when the service starts to fail fast:
+//
+//	if err := m.Verify(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+func (m *Migrator) Verify(ctx context.Context) error {
+	return m.tr.Transaction(ctx, func(tx pgx.Tx) error {
+		if _, err := m.prepare(ctx, tx); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, `SELECT version, checksum FROM `+m.ident()+` ORDER BY version`)
+		if err != nil {
+			return fmt.Errorf("reading applied migrations: %w", err)
+		}
+		type record struct {
+			version  int64
+			checksum string
+		}
+		records, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (record, error) {
+			var r record
+			err := row.Scan(&r.version, &r.checksum)
+			return r, err
+		})
+		if err != nil {
+			return fmt.Errorf("reading applied migrations: %w", err)
+		}
+
+		var errs []error
+		for _, r := range records {
+			i := slices.IndexFunc(m.migrations, func(mig Migration) bool {
+				return mig.Version == r.version
+			})
+			switch {
+			case i < 0:
+				errs = append(errs, fmt.Errorf("%w: applied migration %d is missing", ErrDrift, r.version))
+			case r.checksum != "" && r.checksum != m.migrations[i].Checksum:
+				errs = append(errs, fmt.Errorf("%w: migration %d_%s has changed since it was applied",
+					ErrDrift, r.version, m.migrations[i].Name))
+			}
+		}
+		if len(errs) > 0 {
+			return &retry.StopError{Err: errors.Join(errs...)}
+		}
+		return nil
+	})
+}
+
+// prepare acquires the advisory lock of the table, creates the table if it
+// doesn't exist, and returns the applied versions in ascending order.
+func (m *Migrator) prepare(ctx context.Context, tx pgx.Tx) ([]int64, error) {
+	table := m.ident()
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "dbtools.migrate:"+table); err != nil {
+		return nil, fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	_, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+	version    BIGINT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE `+table+` ADD COLUMN IF NOT EXISTS checksum TEXT NOT NULL DEFAULT '';`)
+	if err != nil {
+		return nil, fmt.Errorf("creating migrations table: %w", err)
+	}
+
+	return m.versions(ctx, tx)
+}
+
+// versions returns the applied versions in ascending order.
+func (m *Migrator) versions(ctx context.Context, tx pgx.Tx) ([]int64, error) {
+	rows, err := tx.Query(ctx, `SELECT version FROM `+m.ident()+` ORDER BY version`)
+	if err != nil {
+		return nil, fmt.Errorf("reading applied migrations: %w", err)
+	}
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("reading applied migrations: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (m *Migrator) ident() string {
+	return pgx.Identifier(strings.Split(m.table, ".")).Sanitize()
+}
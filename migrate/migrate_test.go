@@ -0,0 +1,318 @@
+package migrate_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/migrate"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var migrations = fstest.MapFS{
+	"0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email TEXT")},
+	"0002_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email")},
+	"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id BIGINT)")},
+	"0001_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+	"README.md":                  {Data: []byte("ignored")},
+}
+
+// newMigrator returns a Migrator on the sim, where the versions are already
+// applied.
+func newMigrator(t *testing.T, sim *dbtesting.Simulator, versions []int64, conf ...migrate.ConfigFunc) *migrate.Migrator {
+	t.Helper()
+	rows := make([][]any, len(versions))
+	for i, v := range versions {
+		rows[i] = []any{v}
+	}
+	sim.On("pg_advisory_xact_lock").Exec("SELECT 1")
+	sim.On("^CREATE TABLE IF NOT EXISTS").Exec("CREATE TABLE")
+	sim.On("^SELECT version").Return([]string{"version"}, rows...)
+	sim.On("^(CREATE TABLE users|ALTER TABLE|DROP TABLE|INSERT|DELETE)").Exec("OK")
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+	m, err := migrate.New(tr, migrations, conf...)
+	require.NoError(t, err)
+	return m
+}
+
+func checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+	got, err := migrate.Load(migrations)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, migrate.Migration{
+		Version:  1,
+		Name:     "create_users",
+		Up:       "CREATE TABLE users (id BIGINT)",
+		Down:     "DROP TABLE users",
+		Checksum: checksum("CREATE TABLE users (id BIGINT)"),
+	}, got[0])
+	assert.EqualValues(t, 2, got[1].Version)
+	assert.Equal(t, "add_email", got[1].Name)
+
+	tcs := map[string]struct {
+		fsys fstest.MapFS
+		want error
+	}{
+		"no version":   {fstest.MapFS{"users.up.sql": {}}, migrate.ErrInvalidName},
+		"bad version":  {fstest.MapFS{"x_users.up.sql": {}}, migrate.ErrInvalidName},
+		"zero version": {fstest.MapFS{"0_users.up.sql": {}}, migrate.ErrInvalidName},
+		"no direction": {fstest.MapFS{"1_users.sql": {}}, migrate.ErrInvalidName},
+		"no name":      {fstest.MapFS{"1_.up.sql": {}}, migrate.ErrInvalidName},
+		"duplicate": {fstest.MapFS{
+			"1_users.up.sql":  {Data: []byte("a")},
+			"01_other.up.sql": {Data: []byte("b")},
+		}, migrate.ErrDuplicateVersion},
+		"missing up": {fstest.MapFS{"1_users.down.sql": {Data: []byte("a")}}, migrate.ErrMissingUp},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := migrate.Load(tc.fsys)
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := migrate.New(nil, migrations)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+	_, err = migrate.New(tr, fstest.MapFS{"bad.sql": {}})
+	assert.ErrorIs(t, err, migrate.ErrInvalidName)
+}
+
+func TestMigratorUp(t *testing.T) {
+	t.Parallel()
+	t.Run("All", testMigratorUpAll)
+	t.Run("Pending", testMigratorUpPending)
+	t.Run("Retry", testMigratorUpRetry)
+	t.Run("Failure", testMigratorUpFailure)
+}
+
+func testMigratorUpAll(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	m := newMigrator(t, sim, nil)
+
+	applied, err := m.Up(context.Background())
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	assert.EqualValues(t, 1, applied[0].Version)
+	assert.EqualValues(t, 2, applied[1].Version)
+
+	var inserts []dbtesting.Statement
+	for _, s := range sim.Statements() {
+		if s.SQL == `INSERT INTO "dbtools_migrations" (version, name, checksum) VALUES ($1, $2, $3)` {
+			inserts = append(inserts, s)
+		}
+	}
+	require.Len(t, inserts, 2)
+	assert.Equal(t, []any{int64(1), "create_users", checksum("CREATE TABLE users (id BIGINT)")}, inserts[0].Args)
+	assert.Equal(t, []any{int64(2), "add_email", checksum("ALTER TABLE users ADD email TEXT")}, inserts[1].Args)
+	assert.Contains(t, sim.SQL(), "CREATE TABLE users (id BIGINT)")
+	assert.Equal(t, []any{`dbtools.migrate:"dbtools_migrations"`}, sim.Statements()[1].Args)
+}
+
+func testMigratorUpPending(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	m := newMigrator(t, sim, []int64{1})
+
+	applied, err := m.Up(context.Background())
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.EqualValues(t, 2, applied[0].Version)
+	assert.NotContains(t, sim.SQL(), "CREATE TABLE users (id BIGINT)")
+	assert.Contains(t, sim.SQL(), "ALTER TABLE users ADD email TEXT")
+}
+
+func testMigratorUpRetry(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^ALTER TABLE users ADD").Error(&pgconn.PgError{Code: "55P03"}).Times(1)
+	m := newMigrator(t, sim, []int64{1})
+
+	applied, err := m.Up(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, applied, 1)
+}
+
+func testMigratorUpFailure(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^ALTER TABLE users ADD").Error(assert.AnError)
+	m := newMigrator(t, sim, nil)
+
+	applied, err := m.Up(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "2_add_email")
+	require.Len(t, applied, 1, "the earlier migrations should stay applied")
+}
+
+func TestMigratorDown(t *testing.T) {
+	t.Parallel()
+	t.Run("Last", testMigratorDownLast)
+	t.Run("Nothing", testMigratorDownNothing)
+	t.Run("MissingDown", testMigratorDownMissingDown)
+}
+
+func testMigratorDownLast(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^SELECT version").Return([]string{"version"}, []any{int64(1)}, []any{int64(2)}).Times(3)
+	sim.On("^SELECT version").Return([]string{"version"}, []any{int64(1)}).Times(3)
+	var events []string
+	m := newMigrator(t, sim, nil, migrate.OnApply(func(mig migrate.Migration, up bool) {
+		events = append(events, fmt.Sprintf("%d:%t", mig.Version, up))
+	}))
+
+	reverted, err := m.Down(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.EqualValues(t, 2, reverted[0].Version)
+	assert.Contains(t, sim.SQL(), "ALTER TABLE users DROP email")
+	assert.NotContains(t, sim.SQL(), "DROP TABLE users")
+	assert.Equal(t, []string{"2:false"}, events)
+
+	stmts := sim.Statements()
+	assert.Equal(t, `DELETE FROM "dbtools_migrations" WHERE version = $1`, stmts[len(stmts)-2].SQL)
+	assert.Equal(t, []any{int64(2)}, stmts[len(stmts)-2].Args)
+}
+
+func testMigratorDownNothing(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	m := newMigrator(t, sim, nil)
+
+	reverted, err := m.Down(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Empty(t, reverted)
+}
+
+func testMigratorDownMissingDown(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	m := newMigrator(t, sim, []int64{1, 2, 3})
+
+	_, err := m.Down(context.Background(), 1)
+	require.ErrorIs(t, err, migrate.ErrMissingDown)
+	assert.Len(t, sim.SQL(), 5, "it should not be retried")
+}
+
+func TestMigratorApplied(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	m := newMigrator(t, sim, []int64{1, 2}, migrate.Table("app.migrations"))
+
+	got, err := m.Applied(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, got)
+	assert.Len(t, m.Migrations(), 2)
+	assert.Contains(t, sim.SQL(), `SELECT version FROM "app"."migrations" ORDER BY version`)
+}
+
+func TestMigratorPlan(t *testing.T) {
+	t.Parallel()
+	t.Run("Pending", testMigratorPlanPending)
+	t.Run("NoTable", testMigratorPlanNoTable)
+}
+
+func testMigratorPlanPending(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("to_regclass").Return([]string{"exists"}, []any{true})
+	m := newMigrator(t, sim, []int64{1})
+
+	pending, err := m.Plan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.EqualValues(t, 2, pending[0].Version)
+	want := []string{
+		"BEGIN",
+		"SELECT to_regclass($1) IS NOT NULL",
+		`SELECT version FROM "dbtools_migrations" ORDER BY version`,
+		"COMMIT",
+	}
+	assert.Equal(t, want, sim.SQL(), "it should not lock or create the table")
+	assert.Equal(t, []any{`"dbtools_migrations"`}, sim.Statements()[1].Args)
+}
+
+func testMigratorPlanNoTable(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("to_regclass").Return([]string{"exists"}, []any{false})
+	m := newMigrator(t, sim, []int64{1})
+
+	pending, err := m.Plan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, m.Migrations(), pending)
+	assert.Equal(t, []string{"BEGIN", "SELECT to_regclass($1) IS NOT NULL", "COMMIT"}, sim.SQL())
+}
+
+func TestMigratorVerify(t *testing.T) {
+	t.Parallel()
+	cols := []string{"version", "checksum"}
+	tcs := map[string]struct {
+		rows [][]any
+		want []string
+	}{
+		"clean": {
+			rows: [][]any{
+				{int64(1), checksum("CREATE TABLE users (id BIGINT)")},
+				{int64(2), checksum("ALTER TABLE users ADD email TEXT")},
+			},
+		},
+		"legacy": {
+			rows: [][]any{{int64(1), ""}},
+		},
+		"edited": {
+			rows: [][]any{
+				{int64(1), checksum("CREATE TABLE users (id INT)")},
+				{int64(2), checksum("ALTER TABLE users ADD email TEXT")},
+			},
+			want: []string{"1_create_users has changed"},
+		},
+		"missing": {
+			rows: [][]any{{int64(3), "abc"}, {int64(4), "def"}},
+			want: []string{"migration 3 is missing", "migration 4 is missing"},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sim := dbtesting.NewSimulator()
+			sim.On("^SELECT version, checksum").Return(cols, tc.rows...)
+			m := newMigrator(t, sim, nil)
+
+			err := m.Verify(context.Background())
+			if len(tc.want) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, migrate.ErrDrift)
+			for _, want := range tc.want {
+				assert.Contains(t, err.Error(), want)
+			}
+			assert.Equal(t, 1, strings.Count(strings.Join(sim.SQL(), ";"), "BEGIN"), "it should not be retried")
+		})
+	}
+}
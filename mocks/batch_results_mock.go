@@ -0,0 +1,125 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	pgconn "github.com/jackc/pgx/v5/pgconn"
+	mock "github.com/stretchr/testify/mock"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// BatchResults is an autogenerated mock type for the batchResults type
+type BatchResults struct {
+	mock.Mock
+}
+
+// Close provides a mock function with no fields
+func (_m *BatchResults) Close() error {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Close")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Exec provides a mock function with no fields
+func (_m *BatchResults) Exec() (pgconn.CommandTag, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Exec")
+	}
+
+	var r0 pgconn.CommandTag
+	var r1 error
+	if rf, ok := ret.Get(0).(func() (pgconn.CommandTag, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() pgconn.CommandTag); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(pgconn.CommandTag)
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Query provides a mock function with no fields
+func (_m *BatchResults) Query() (pgx.Rows, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Query")
+	}
+
+	var r0 pgx.Rows
+	var r1 error
+	if rf, ok := ret.Get(0).(func() (pgx.Rows, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() pgx.Rows); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(pgx.Rows)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// QueryRow provides a mock function with no fields
+func (_m *BatchResults) QueryRow() pgx.Row {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for QueryRow")
+	}
+
+	var r0 pgx.Row
+	if rf, ok := ret.Get(0).(func() pgx.Row); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(pgx.Row)
+		}
+	}
+
+	return r0
+}
+
+// NewBatchResults creates a new instance of BatchResults. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewBatchResults(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *BatchResults {
+	mock := &BatchResults{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
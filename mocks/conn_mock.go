@@ -0,0 +1,197 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+
+	pgconn "github.com/jackc/pgx/v5/pgconn"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// Conn is an autogenerated mock type for the Conn type
+type Conn struct {
+	mock.Mock
+}
+
+// Begin provides a mock function with given fields: ctx
+func (_m *Conn) Begin(ctx context.Context) (pgx.Tx, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Begin")
+	}
+
+	var r0 pgx.Tx
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (pgx.Tx, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) pgx.Tx); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(pgx.Tx)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BeginTx provides a mock function with given fields: ctx, txOptions
+func (_m *Conn) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	ret := _m.Called(ctx, txOptions)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BeginTx")
+	}
+
+	var r0 pgx.Tx
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, pgx.TxOptions) (pgx.Tx, error)); ok {
+		return rf(ctx, txOptions)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, pgx.TxOptions) pgx.Tx); ok {
+		r0 = rf(ctx, txOptions)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(pgx.Tx)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, pgx.TxOptions) error); ok {
+		r1 = rf(ctx, txOptions)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Exec provides a mock function with given fields: ctx, sql, args
+func (_m *Conn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	var _ca []interface{}
+	_ca = append(_ca, ctx, sql)
+	_ca = append(_ca, args...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Exec")
+	}
+
+	var r0 pgconn.CommandTag
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) (pgconn.CommandTag, error)); ok {
+		return rf(ctx, sql, args...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) pgconn.CommandTag); ok {
+		r0 = rf(ctx, sql, args...)
+	} else {
+		r0 = ret.Get(0).(pgconn.CommandTag)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, ...interface{}) error); ok {
+		r1 = rf(ctx, sql, args...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Ping provides a mock function with given fields: ctx
+func (_m *Conn) Ping(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Ping")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Query provides a mock function with given fields: ctx, sql, args
+func (_m *Conn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	var _ca []interface{}
+	_ca = append(_ca, ctx, sql)
+	_ca = append(_ca, args...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Query")
+	}
+
+	var r0 pgx.Rows
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) (pgx.Rows, error)); ok {
+		return rf(ctx, sql, args...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) pgx.Rows); ok {
+		r0 = rf(ctx, sql, args...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(pgx.Rows)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, ...interface{}) error); ok {
+		r1 = rf(ctx, sql, args...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// QueryRow provides a mock function with given fields: ctx, sql, args
+func (_m *Conn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	var _ca []interface{}
+	_ca = append(_ca, ctx, sql)
+	_ca = append(_ca, args...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for QueryRow")
+	}
+
+	var r0 pgx.Row
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) pgx.Row); ok {
+		r0 = rf(ctx, sql, args...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(pgx.Row)
+		}
+	}
+
+	return r0
+}
+
+// NewConn creates a new instance of Conn. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewConn(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *Conn {
+	mock := &Conn{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
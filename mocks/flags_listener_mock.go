@@ -0,0 +1,91 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+
+	pgconn "github.com/jackc/pgx/v5/pgconn"
+)
+
+// FlagsListener is an autogenerated mock type for the Listener type
+type FlagsListener struct {
+	mock.Mock
+}
+
+// Exec provides a mock function with given fields: ctx, sql, args
+func (_m *FlagsListener) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	var _ca []interface{}
+	_ca = append(_ca, ctx, sql)
+	_ca = append(_ca, args...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Exec")
+	}
+
+	var r0 pgconn.CommandTag
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) (pgconn.CommandTag, error)); ok {
+		return rf(ctx, sql, args...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) pgconn.CommandTag); ok {
+		r0 = rf(ctx, sql, args...)
+	} else {
+		r0 = ret.Get(0).(pgconn.CommandTag)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, ...interface{}) error); ok {
+		r1 = rf(ctx, sql, args...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WaitForNotification provides a mock function with given fields: ctx
+func (_m *FlagsListener) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for WaitForNotification")
+	}
+
+	var r0 *pgconn.Notification
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (*pgconn.Notification, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) *pgconn.Notification); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*pgconn.Notification)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewFlagsListener creates a new instance of FlagsListener. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewFlagsListener(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *FlagsListener {
+	mock := &FlagsListener{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,91 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+
+	pgconn "github.com/jackc/pgx/v5/pgconn"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// LockConn is an autogenerated mock type for the Conn type
+type LockConn struct {
+	mock.Mock
+}
+
+// Exec provides a mock function with given fields: ctx, sql, args
+func (_m *LockConn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	var _ca []interface{}
+	_ca = append(_ca, ctx, sql)
+	_ca = append(_ca, args...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Exec")
+	}
+
+	var r0 pgconn.CommandTag
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) (pgconn.CommandTag, error)); ok {
+		return rf(ctx, sql, args...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) pgconn.CommandTag); ok {
+		r0 = rf(ctx, sql, args...)
+	} else {
+		r0 = ret.Get(0).(pgconn.CommandTag)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, ...interface{}) error); ok {
+		r1 = rf(ctx, sql, args...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// QueryRow provides a mock function with given fields: ctx, sql, args
+func (_m *LockConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	var _ca []interface{}
+	_ca = append(_ca, ctx, sql)
+	_ca = append(_ca, args...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for QueryRow")
+	}
+
+	var r0 pgx.Row
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...interface{}) pgx.Row); ok {
+		r0 = rf(ctx, sql, args...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(pgx.Row)
+		}
+	}
+
+	return r0
+}
+
+// Release provides a mock function with given fields: destroy
+func (_m *LockConn) Release(destroy bool) {
+	_m.Called(destroy)
+}
+
+// NewLockConn creates a new instance of LockConn. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewLockConn(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *LockConn {
+	mock := &LockConn{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
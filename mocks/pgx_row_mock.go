@@ -0,0 +1,44 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+
+// PGXRow is an autogenerated mock type for the pgxRow type
+type PGXRow struct {
+	mock.Mock
+}
+
+// Scan provides a mock function with given fields: dest
+func (_m *PGXRow) Scan(dest ...interface{}) error {
+	var _ca []interface{}
+	_ca = append(_ca, dest...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Scan")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(...interface{}) error); ok {
+		r0 = rf(dest...)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewPGXRow creates a new instance of PGXRow. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewPGXRow(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *PGXRow {
+	mock := &PGXRow{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,55 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// Transactioner is an autogenerated mock type for the Transactioner type
+type Transactioner struct {
+	mock.Mock
+}
+
+// Transaction provides a mock function with given fields: ctx, fns
+func (_m *Transactioner) Transaction(ctx context.Context, fns ...func(pgx.Tx) error) error {
+	_va := make([]interface{}, len(fns))
+	for _i := range fns {
+		_va[_i] = fns[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Transaction")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, ...func(pgx.Tx) error) error); ok {
+		r0 = rf(ctx, fns...)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewTransactioner creates a new instance of Transactioner. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewTransactioner(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *Transactioner {
+	mock := &Transactioner{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
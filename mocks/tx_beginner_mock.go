@@ -0,0 +1,60 @@
+// Code generated by mockery v2.53.7. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// TxBeginner is an autogenerated mock type for the TxBeginner type
+type TxBeginner struct {
+	mock.Mock
+}
+
+// BeginTx provides a mock function with given fields: ctx, txOptions
+func (_m *TxBeginner) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	ret := _m.Called(ctx, txOptions)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BeginTx")
+	}
+
+	var r0 pgx.Tx
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, pgx.TxOptions) (pgx.Tx, error)); ok {
+		return rf(ctx, txOptions)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, pgx.TxOptions) pgx.Tx); ok {
+		r0 = rf(ctx, txOptions)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(pgx.Tx)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, pgx.TxOptions) error); ok {
+		r1 = rf(ctx, txOptions)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewTxBeginner creates a new instance of TxBeginner. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewTxBeginner(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *TxBeginner {
+	mock := &TxBeginner{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
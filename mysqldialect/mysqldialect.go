@@ -0,0 +1,44 @@
+// Package mysqldialect provides the dbtools.Dialect of MySQL for the
+// database/sql adapters. It is in its own package, so the users of the pgx
+// helpers don't link and register the MySQL driver:
+//
+//	tr, err := sqlxtx.New(db, sqlxtx.WithDialect(mysqldialect.Dialect))
+package mysqldialect
+
+import (
+	"database/sql/driver"
+	"errors"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Dialect retries the deadlocks, lock wait timeouts and connection errors.
+var Dialect = dbtools.Dialect{
+	Name:       "mysql",
+	Classifier: IsRetryable,
+}
+
+// ErrorNumber returns the error number of the err if it is a
+// *mysql.MySQLError. It returns zero otherwise.
+func ErrorNumber(err error) uint16 {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number
+	}
+
+	return 0
+}
+
+// IsRetryable returns true if retrying the transaction on a MySQL server may
+// succeed, which is the case for the deadlocks, lock wait timeouts and
+// connection errors. It can be used as a dbtools.Classifier.
+func IsRetryable(err error) bool {
+	switch ErrorNumber(err) {
+	case 1213, // ER_LOCK_DEADLOCK
+		1205: // ER_LOCK_WAIT_TIMEOUT
+		return true
+	}
+
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn)
+}
@@ -0,0 +1,55 @@
+package mysqldialect_test
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mysqldialect"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorNumber(t *testing.T) {
+	t.Parallel()
+	assert.Zero(t, mysqldialect.ErrorNumber(nil))
+	assert.Zero(t, mysqldialect.ErrorNumber(assert.AnError))
+	err := fmt.Errorf("foo: %w", &mysql.MySQLError{Number: 1062})
+	assert.EqualValues(t, 1062, mysqldialect.ErrorNumber(err))
+}
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":          {nil, false},
+		"other":        {assert.AnError, false},
+		"deadlock":     {fmt.Errorf("foo: %w", &mysql.MySQLError{Number: 1213}), true},
+		"lock timeout": {&mysql.MySQLError{Number: 1205}, true},
+		"duplicate":    {&mysql.MySQLError{Number: 1062}, false},
+		"bad conn":     {fmt.Errorf("foo: %w", driver.ErrBadConn), true},
+		"invalid conn": {mysql.ErrInvalidConn, true},
+		"postgres":     {&pgconn.PgError{Code: "40001"}, false},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, mysqldialect.IsRetryable(tc.err))
+		})
+	}
+}
+
+func TestDialect(t *testing.T) {
+	t.Parallel()
+	deadlock := &pgconn.PgError{Code: "40P01"}
+	assert.True(t, dbtools.Postgres.Classifier(deadlock))
+	assert.False(t, mysqldialect.Dialect.Classifier(deadlock))
+
+	deadlock2 := &mysql.MySQLError{Number: 1213}
+	assert.True(t, mysqldialect.Dialect.Classifier(deadlock2))
+	assert.False(t, dbtools.Postgres.Classifier(deadlock2))
+}
@@ -0,0 +1,488 @@
+// Package notify multiplexes the LISTEN/NOTIFY channels over one dedicated
+// connection. The handlers are subscribed and unsubscribed at runtime, and
+// each subscription is delivered from its own bounded buffer, so a slow
+// handler doesn't hold up the other channels.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrNilHandler is returned when subscribing without a handler.
+	ErrNilHandler = errors.New("nil handler")
+
+	// ErrEmptyChannel is returned when subscribing without a channel.
+	ErrEmptyChannel = errors.New("empty channel")
+
+	// ErrRunning is returned when the Subscriber is already running.
+	ErrRunning = errors.New("subscriber is already running")
+)
+
+// Conn is the contract for receiving the notifications. The *pgx.Conn
+// satisfies this interface. The connection should be dedicated to the
+// Subscriber.
+//
+//go:generate mockery --name Conn --filename notify_conn_mock.go --structname NotifyConn --output ../mocks
+type Conn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+}
+
+// Handler receives the notifications of a subscription one at a time.
+type Handler func(ctx context.Context, n *pgconn.Notification)
+
+// RecoverFunc returns the notifications that might have been missed while
+// the Subscriber was not listening, for example by querying a changes table
+// for the rows after the cursor in the payload of the last notification. The
+// last notification is nil if the subscription hasn't received any.
+type RecoverFunc func(ctx context.Context, last *pgconn.Notification) ([]*pgconn.Notification, error)
+
+// Overflow decides what happens to a notification when the buffer of a
+// subscription is full.
+type Overflow int
+
+const (
+	// Block waits until the handler makes room in the buffer. It holds up
+	// the delivery of all the channels in the meantime.
+	Block Overflow = iota
+	// DropNewest drops the notification that doesn't fit in the buffer.
+	DropNewest
+	// DropOldest drops the oldest notification in the buffer to make room for
+	// the new one.
+	DropOldest
+)
+
+// ConfigFunc is used for configuring the Subscriber.
+type ConfigFunc func(*Subscriber)
+
+// OnDrop sets the function that is called with the notifications that are
+// dropped because of the Overflow policy of a subscription.
+func OnDrop(fn func(*pgconn.Notification)) ConfigFunc {
+	return func(s *Subscriber) {
+		s.onDrop = fn
+	}
+}
+
+// OnError sets the function that is called when recovering the missed
+// notifications fails. The live notifications are delivered anyway.
+func OnError(fn func(error)) ConfigFunc {
+	return func(s *Subscriber) {
+		s.onError = fn
+	}
+}
+
+// SubscribeFunc is used for configuring a Subscription.
+type SubscribeFunc func(*Subscription)
+
+// BufferSize sets the number of notifications that are buffered for the
+// handler. The default value is 64.
+func BufferSize(n int) SubscribeFunc {
+	return func(s *Subscription) {
+		s.size = n
+	}
+}
+
+// OnOverflow sets what happens when the buffer is full. The default is Block.
+func OnOverflow(o Overflow) SubscribeFunc {
+	return func(s *Subscription) {
+		s.overflow = o
+	}
+}
+
+// Recover sets the function that recovers the notifications that were sent
+// while the Subscriber was disconnected. When Run is called again after it
+// has returned, the fn is called after the channel is listened to again, and
+// the notifications it returns are delivered before the live ones. As the
+// notifications sent in between might be delivered twice, the handler should
+// be idempotent.
+func Recover(fn RecoverFunc) SubscribeFunc {
+	return func(s *Subscription) {
+		s.recover = fn
+	}
+}
+
+// Subscriber listens to the channels of its subscriptions on one connection
+// and delivers the notifications to their handlers. It is safe for
+// concurrent use.
+type Subscriber struct {
+	onDrop  func(*pgconn.Notification)
+	onError func(error)
+
+	mu        sync.Mutex
+	subs      map[*Subscription]struct{}
+	changed   chan struct{}
+	running   bool
+	listening map[string]bool
+}
+
+// Subscription receives the notifications of a channel, or the channels that
+// match a pattern.
+type Subscription struct {
+	s        *Subscriber
+	pattern  string
+	handler  Handler
+	size     int
+	overflow Overflow
+	recover  RecoverFunc
+	done     chan struct{}
+	once     sync.Once
+
+	// queue is set when the Subscriber is running.
+	queue chan *pgconn.Notification
+	// stale is set when the Subscriber stops running, as the notifications
+	// might be missed until it runs again.
+	stale bool
+	last  *pgconn.Notification
+}
+
+// New returns a Subscriber without any subscriptions.
+func New(conf ...ConfigFunc) *Subscriber {
+	s := &Subscriber{
+		subs:    make(map[*Subscription]struct{}),
+		changed: make(chan struct{}),
+	}
+	for _, fn := range conf {
+		fn(s)
+	}
+
+	return s
+}
+
+// Subscribe delivers the notifications of the channel to the handler. The
+// channel is listened to right away if the Subscriber is running. The channel
+// can be a pattern with the syntax of path.Match, for example "orders_*".
+// PostgreSQL has no wildcard LISTEN, therefore a pattern only receives the
+// notifications of the channels that are subscribed to by name.
+func (s *Subscriber) Subscribe(channel string, handler Handler, conf ...SubscribeFunc) (*Subscription, error) {
+	if channel == "" {
+		return nil, ErrEmptyChannel
+	}
+	if handler == nil {
+		return nil, ErrNilHandler
+	}
+	if _, err := path.Match(channel, ""); err != nil {
+		return nil, fmt.Errorf("subscribing to %q: %w", channel, err)
+	}
+	sub := &Subscription{
+		s:       s,
+		pattern: channel,
+		handler: handler,
+		size:    64,
+		done:    make(chan struct{}),
+	}
+	for _, fn := range conf {
+		fn(sub)
+	}
+	if sub.size < 1 {
+		sub.size = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[sub] = struct{}{}
+	s.notifyChange()
+
+	return sub, nil
+}
+
+// Unsubscribe stops the delivery to the handler. The channel is unlistened
+// when it has no other subscriptions. The notifications in the buffer are
+// discarded.
+func (sub *Subscription) Unsubscribe() {
+	sub.once.Do(func() {
+		sub.s.mu.Lock()
+		defer sub.s.mu.Unlock()
+		delete(sub.s.subs, sub)
+		close(sub.done)
+		sub.s.notifyChange()
+	})
+}
+
+// Channel returns the channel or the pattern of the subscription.
+func (sub *Subscription) Channel() string {
+	return sub.pattern
+}
+
+// Run listens to the channels on the conn and delivers the notifications
+// until the ctx is cancelled or the connection fails. The subscriptions are
+// kept when it returns, therefore it can be called again with a new
+// connection. It returns ErrRunning if it is already running.
+func (s *Subscriber) Run(ctx context.Context, conn Conn) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return ErrRunning
+	}
+	s.running = true
+	s.listening = make(map[string]bool)
+	s.mu.Unlock()
+
+	workCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.running = false
+		for sub := range s.subs {
+			if sub.queue != nil {
+				sub.queue = nil
+				sub.stale = true
+			}
+		}
+	}()
+
+	for {
+		changed, err := s.sync(ctx, conn, workCtx, &wg)
+		if err != nil {
+			return err
+		}
+		n, err := wait(ctx, conn, changed)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("waiting for notifications: %w", err)
+		}
+		if n != nil {
+			s.dispatch(ctx, n)
+		}
+	}
+}
+
+// notifyChange wakes up the Run loop to apply the subscriptions. The mu
+// should be held.
+func (s *Subscriber) notifyChange() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// sync listens to the new channels, unlistens the ones without any
+// subscriptions and starts the delivery of the new subscriptions. It returns
+// the channel that is closed on the next change.
+func (s *Subscriber) sync(ctx context.Context, conn Conn, workCtx context.Context, wg *sync.WaitGroup) (<-chan struct{}, error) {
+	s.mu.Lock()
+	changed := s.changed
+	wanted := make(map[string]bool)
+	for sub := range s.subs {
+		if !isPattern(sub.pattern) {
+			wanted[sub.pattern] = true
+		}
+	}
+	var listen, unlisten []string
+	for ch := range wanted {
+		if !s.listening[ch] {
+			listen = append(listen, ch)
+		}
+	}
+	for ch := range s.listening {
+		if !wanted[ch] {
+			unlisten = append(unlisten, ch)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, ch := range listen {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{ch}.Sanitize()); err != nil {
+			return nil, fmt.Errorf("listening to %q: %w", ch, err)
+		}
+		s.setListening(ch, true)
+	}
+	for _, ch := range unlisten {
+		if _, err := conn.Exec(ctx, "UNLISTEN "+pgx.Identifier{ch}.Sanitize()); err != nil {
+			return nil, fmt.Errorf("unlistening %q: %w", ch, err)
+		}
+		s.setListening(ch, false)
+	}
+
+	// The deliveries are started after the channels are listened to, so the
+	// recovery doesn't miss the notifications sent in between.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		if sub.queue != nil {
+			continue
+		}
+		sub.queue = make(chan *pgconn.Notification, sub.size)
+		recovering := sub.stale && sub.recover != nil
+		sub.stale = false
+		wg.Add(1)
+		go func(sub *Subscription, queue chan *pgconn.Notification) {
+			defer wg.Done()
+			if recovering {
+				s.recoverMissed(workCtx, sub)
+			}
+			sub.deliver(workCtx, queue)
+		}(sub, sub.queue)
+	}
+
+	return changed, nil
+}
+
+// recoverMissed delivers the notifications returned by the recover function
+// of the subscription.
+func (s *Subscriber) recoverMissed(ctx context.Context, sub *Subscription) {
+	s.mu.Lock()
+	last := sub.last
+	s.mu.Unlock()
+	missed, err := sub.recover(ctx, last)
+	if err != nil {
+		if ctx.Err() == nil && s.onError != nil {
+			s.onError(fmt.Errorf("recovering notifications of %q: %w", sub.pattern, err))
+		}
+		return
+	}
+	for _, n := range missed {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.done:
+			return
+		default:
+		}
+		sub.handle(ctx, n)
+	}
+}
+
+func (s *Subscriber) setListening(ch string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ok {
+		s.listening[ch] = true
+		return
+	}
+	delete(s.listening, ch)
+}
+
+// wait waits for a notification. It returns a nil notification when the
+// changed channel is closed.
+func wait(ctx context.Context, conn Conn, changed <-chan struct{}) (*pgconn.Notification, error) {
+	waitCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-changed:
+			stop()
+		case <-waitCtx.Done():
+		}
+	}()
+	n, err := conn.WaitForNotification(waitCtx)
+	stop()
+	<-stopped
+	if err != nil && ctx.Err() == nil && isClosed(changed) {
+		// The wait was interrupted to apply the subscriptions.
+		return nil, nil
+	}
+
+	return n, err
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatch puts the notification in the buffer of the matching
+// subscriptions.
+func (s *Subscriber) dispatch(ctx context.Context, n *pgconn.Notification) {
+	type target struct {
+		sub   *Subscription
+		queue chan *pgconn.Notification
+	}
+	s.mu.Lock()
+	var targets []target
+	for sub := range s.subs {
+		if sub.queue != nil && sub.matches(n.Channel) {
+			targets = append(targets, target{sub, sub.queue})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, t := range targets {
+		switch t.sub.overflow {
+		case DropNewest:
+			select {
+			case t.queue <- n:
+			default:
+				s.drop(n)
+			}
+		case DropOldest:
+			for sent := false; !sent; {
+				select {
+				case t.queue <- n:
+					sent = true
+				default:
+					select {
+					case old := <-t.queue:
+						s.drop(old)
+					default:
+					}
+				}
+			}
+		default:
+			select {
+			case t.queue <- n:
+			case <-t.sub.done:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (s *Subscriber) drop(n *pgconn.Notification) {
+	if s.onDrop != nil {
+		s.onDrop(n)
+	}
+}
+
+// deliver calls the handler with the notifications in the queue until the
+// ctx is cancelled or the subscription is unsubscribed.
+func (sub *Subscription) deliver(ctx context.Context, queue <-chan *pgconn.Notification) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.done:
+			return
+		case n := <-queue:
+			sub.handle(ctx, n)
+		}
+	}
+}
+
+// handle calls the handler and records the notification as the last one.
+func (sub *Subscription) handle(ctx context.Context, n *pgconn.Notification) {
+	sub.handler(ctx, n)
+	sub.s.mu.Lock()
+	defer sub.s.mu.Unlock()
+	sub.last = n
+}
+
+func (sub *Subscription) matches(channel string) bool {
+	if !isPattern(sub.pattern) {
+		return sub.pattern == channel
+	}
+	ok, _ := path.Match(sub.pattern, channel)
+	return ok
+}
+
+func isPattern(channel string) bool {
+	return strings.ContainsAny(channel, `*?[\`)
+}
@@ -0,0 +1,295 @@
+package notify_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/dbtools/v4/notify"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newConn returns a connection that yields the notifications sent on the
+// returned channel.
+func newConn(t *testing.T) (*mocks.NotifyConn, chan *pgconn.Notification) {
+	t.Helper()
+	feed := make(chan *pgconn.Notification)
+	conn := mocks.NewNotifyConn(t)
+	conn.On("WaitForNotification", mock.Anything).Return(
+		func(ctx context.Context) (*pgconn.Notification, error) {
+			select {
+			case n := <-feed:
+				return n, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	).Maybe()
+	return conn, feed
+}
+
+// run runs the subscriber until the test is finished.
+func run(t *testing.T, s *notify.Subscriber, conn notify.Conn) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx, conn)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+	s := notify.New()
+	handler := func(context.Context, *pgconn.Notification) {}
+
+	_, err := s.Subscribe("", handler)
+	assert.ErrorIs(t, err, notify.ErrEmptyChannel)
+	_, err = s.Subscribe("orders", nil)
+	assert.ErrorIs(t, err, notify.ErrNilHandler)
+	_, err = s.Subscribe("orders_[", handler)
+	assert.Error(t, err)
+	sub, err := s.Subscribe("orders", handler)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", sub.Channel())
+}
+
+func TestSubscriberRun(t *testing.T) {
+	t.Parallel()
+	t.Run("Multiplex", testSubscriberRunMultiplex)
+	t.Run("Runtime", testSubscriberRunRuntime)
+	t.Run("Running", testSubscriberRunRunning)
+	t.Run("ListenError", testSubscriberRunListenError)
+}
+
+func testSubscriberRunMultiplex(t *testing.T) {
+	t.Parallel()
+	conn, feed := newConn(t)
+	conn.On("Exec", mock.Anything, `LISTEN "orders_created"`).Return(pgconn.CommandTag{}, nil).Once()
+	conn.On("Exec", mock.Anything, `LISTEN "users"`).Return(pgconn.CommandTag{}, nil).Once()
+
+	s := notify.New()
+	created := make(chan string, 10)
+	all := make(chan string, 10)
+	users := make(chan string, 10)
+	_, err := s.Subscribe("orders_created", func(_ context.Context, n *pgconn.Notification) {
+		created <- n.Payload
+	})
+	require.NoError(t, err)
+	_, err = s.Subscribe("orders_*", func(_ context.Context, n *pgconn.Notification) {
+		all <- n.Payload
+	})
+	require.NoError(t, err)
+	_, err = s.Subscribe("users", func(_ context.Context, n *pgconn.Notification) {
+		users <- n.Payload
+	})
+	require.NoError(t, err)
+	run(t, s, conn)
+
+	feed <- &pgconn.Notification{Channel: "orders_created", Payload: "1"}
+	feed <- &pgconn.Notification{Channel: "users", Payload: "2"}
+	feed <- &pgconn.Notification{Channel: "orders_created", Payload: "3"}
+
+	assert.Equal(t, "1", <-created)
+	assert.Equal(t, "3", <-created)
+	assert.Equal(t, "1", <-all)
+	assert.Equal(t, "3", <-all)
+	assert.Equal(t, "2", <-users)
+}
+
+func testSubscriberRunRuntime(t *testing.T) {
+	t.Parallel()
+	conn, feed := newConn(t)
+	listened := make(chan string, 10)
+	record := func(args mock.Arguments) { listened <- args.String(1) }
+	conn.On("Exec", mock.Anything, `LISTEN "orders"`).Return(pgconn.CommandTag{}, nil).Once().Run(record)
+	conn.On("Exec", mock.Anything, `UNLISTEN "orders"`).Return(pgconn.CommandTag{}, nil).Once().Run(record)
+
+	s := notify.New()
+	run(t, s, conn)
+
+	got := make(chan string, 10)
+	sub, err := s.Subscribe("orders", func(_ context.Context, n *pgconn.Notification) {
+		got <- n.Payload
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `LISTEN "orders"`, <-listened)
+
+	feed <- &pgconn.Notification{Channel: "orders", Payload: "1"}
+	assert.Equal(t, "1", <-got)
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	assert.Equal(t, `UNLISTEN "orders"`, <-listened)
+}
+
+func testSubscriberRunRunning(t *testing.T) {
+	t.Parallel()
+	conn, _ := newConn(t)
+	listened := make(chan struct{})
+	conn.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil).Once().
+		Run(func(mock.Arguments) { close(listened) })
+	s := notify.New()
+	_, err := s.Subscribe("orders", func(context.Context, *pgconn.Notification) {})
+	require.NoError(t, err)
+	run(t, s, conn)
+	<-listened
+
+	err = s.Run(context.Background(), conn)
+	assert.ErrorIs(t, err, notify.ErrRunning)
+}
+
+func testSubscriberRunListenError(t *testing.T) {
+	t.Parallel()
+	conn := mocks.NewNotifyConn(t)
+	conn.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, assert.AnError).Once()
+
+	s := notify.New()
+	_, err := s.Subscribe("orders", func(context.Context, *pgconn.Notification) {})
+	require.NoError(t, err)
+
+	err = s.Run(context.Background(), conn)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestOverflow(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		overflow notify.Overflow
+		want     []string
+		dropped  []string
+	}{
+		"drop newest": {notify.DropNewest, []string{"1", "2"}, []string{"3", "4"}},
+		"drop oldest": {notify.DropOldest, []string{"1", "4"}, []string{"2", "3"}},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			conn, feed := newConn(t)
+			conn.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil).Once()
+
+			var mu sync.Mutex
+			var dropped []string
+			s := notify.New(notify.OnDrop(func(n *pgconn.Notification) {
+				mu.Lock()
+				defer mu.Unlock()
+				dropped = append(dropped, n.Payload)
+			}))
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			got := make(chan string, 10)
+			_, err := s.Subscribe("orders", func(_ context.Context, n *pgconn.Notification) {
+				if n.Payload == "1" {
+					close(started)
+					<-release
+				}
+				got <- n.Payload
+			}, notify.BufferSize(1), notify.OnOverflow(tc.overflow))
+			require.NoError(t, err)
+			run(t, s, conn)
+
+			feed <- &pgconn.Notification{Channel: "orders", Payload: "1"}
+			<-started
+			for _, p := range []string{"2", "3", "4"} {
+				feed <- &pgconn.Notification{Channel: "orders", Payload: p}
+			}
+			assert.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(dropped) == 2
+			}, time.Second, time.Millisecond)
+			close(release)
+
+			assert.Equal(t, tc.want[0], <-got)
+			assert.Equal(t, tc.want[1], <-got)
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tc.dropped, dropped)
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	t.Run("Missed", testRecoverMissed)
+	t.Run("Error", testRecoverError)
+}
+
+// runOnce runs the subscriber until the first notification sent on the feed
+// is delivered to the got channel.
+func runOnce(t *testing.T, s *notify.Subscriber, n *pgconn.Notification, got <-chan string) {
+	t.Helper()
+	conn, feed := newConn(t)
+	conn.On("Exec", mock.Anything, `LISTEN "orders"`).Return(pgconn.CommandTag{}, nil).Once()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx, conn)
+	}()
+	feed <- n
+	assert.Equal(t, n.Payload, <-got)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func testRecoverMissed(t *testing.T) {
+	t.Parallel()
+	s := notify.New()
+	got := make(chan string, 10)
+	var lasts []string
+	_, err := s.Subscribe("orders", func(_ context.Context, n *pgconn.Notification) {
+		got <- n.Payload
+	}, notify.Recover(func(_ context.Context, last *pgconn.Notification) ([]*pgconn.Notification, error) {
+		lasts = append(lasts, last.Payload)
+		return []*pgconn.Notification{
+			{Channel: "orders", Payload: "2"},
+			{Channel: "orders", Payload: "3"},
+		}, nil
+	}))
+	require.NoError(t, err)
+
+	runOnce(t, s, &pgconn.Notification{Channel: "orders", Payload: "1"}, got)
+
+	conn, feed := newConn(t)
+	conn.On("Exec", mock.Anything, `LISTEN "orders"`).Return(pgconn.CommandTag{}, nil).Once()
+	run(t, s, conn)
+	feed <- &pgconn.Notification{Channel: "orders", Payload: "4"}
+
+	assert.Equal(t, "2", <-got)
+	assert.Equal(t, "3", <-got)
+	assert.Equal(t, "4", <-got)
+	assert.Equal(t, []string{"1"}, lasts)
+}
+
+func testRecoverError(t *testing.T) {
+	t.Parallel()
+	errs := make(chan error, 1)
+	s := notify.New(notify.OnError(func(err error) { errs <- err }))
+	got := make(chan string, 10)
+	_, err := s.Subscribe("orders", func(_ context.Context, n *pgconn.Notification) {
+		got <- n.Payload
+	}, notify.Recover(func(context.Context, *pgconn.Notification) ([]*pgconn.Notification, error) {
+		return nil, assert.AnError
+	}))
+	require.NoError(t, err)
+
+	runOnce(t, s, &pgconn.Notification{Channel: "orders", Payload: "1"}, got)
+
+	conn, feed := newConn(t)
+	conn.On("Exec", mock.Anything, `LISTEN "orders"`).Return(pgconn.CommandTag{}, nil).Once()
+	run(t, s, conn)
+	assert.ErrorIs(t, <-errs, assert.AnError)
+
+	feed <- &pgconn.Notification{Channel: "orders", Payload: "2"}
+	assert.Equal(t, "2", <-got)
+}
@@ -0,0 +1,542 @@
+// Package outbox implements the transactional outbox pattern. Messages are
+// written to the outbox table in the same transaction as the business data,
+// and a Relay delivers them to the broker after the transaction is committed.
+// Messages with the same key, for example the ID of an aggregate, are
+// delivered in order, while the messages with different keys can be
+// delivered in parallel.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTable is the name of the outbox table.
+const DefaultTable = "dbtools_outbox"
+
+// Schema creates the outbox table. Run it in your migrations.
+const Schema = `CREATE TABLE IF NOT EXISTS ` + DefaultTable + ` (
+	id           BIGSERIAL PRIMARY KEY,
+	topic        TEXT NOT NULL,
+	payload      BYTEA NOT NULL,
+	created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+	delivered_at TIMESTAMPTZ
+);
+ALTER TABLE ` + DefaultTable + ` ADD COLUMN IF NOT EXISTS key TEXT NOT NULL DEFAULT '';
+ALTER TABLE ` + DefaultTable + ` ADD COLUMN IF NOT EXISTS claimed_by TEXT;
+ALTER TABLE ` + DefaultTable + ` ADD COLUMN IF NOT EXISTS lease_until TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS ` + DefaultTable + `_pending_idx
+	ON ` + DefaultTable + ` (id) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS ` + DefaultTable + `_pending_key_idx
+	ON ` + DefaultTable + ` (key, id) WHERE delivered_at IS NULL;`
+
+var (
+	// ErrNilHandler is returned when creating a Relay without a handler.
+	ErrNilHandler = errors.New("nil handler")
+
+	// ErrEmptyTopic is returned when enqueueing a message without a topic.
+	ErrEmptyTopic = errors.New("empty topic")
+
+	// ErrLeaseLost is the cause of the cancellation of the handler's context
+	// when the Relay can't renew the lease of the messages it is delivering.
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// Message is a message stored in the outbox.
+type Message struct {
+	ID    int64
+	Topic string
+	// Key orders the messages. Messages with the same key are delivered in
+	// the order they are enqueued. The messages without a key are only
+	// ordered within a single Relay.
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// Enqueue writes the message to the outbox table in the tx. The message is
+// only delivered if the tx is committed. The messages without a key are only
+// delivered in order when a single Relay is running, as several relays claim
+// and deliver their batches concurrently. Use the EnqueueKeyed function if
+// the order matters.
+func Enqueue(ctx context.Context, tx pgx.Tx, topic string, payload []byte) error {
+	if topic == "" {
+		return ErrEmptyTopic
+	}
+	const query = `INSERT INTO ` + DefaultTable + ` (topic, payload) VALUES ($1, $2)`
+	if _, err := tx.Exec(ctx, query, topic, payload); err != nil {
+		return fmt.Errorf("enqueueing message: %w", err)
+	}
+
+	return nil
+}
+
+// EnqueueKeyed is like Enqueue, but the message is ordered with the other
+// messages of the key, for example the ID of the aggregate the event belongs
+// to. A message is not delivered until all the messages of its key that are
+// enqueued before it are delivered, even when several relays are running.
+func EnqueueKeyed(ctx context.Context, tx pgx.Tx, topic, key string, payload []byte) error {
+	if topic == "" {
+		return ErrEmptyTopic
+	}
+	const query = `INSERT INTO ` + DefaultTable + ` (topic, key, payload) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, query, topic, key, payload); err != nil {
+		return fmt.Errorf("enqueueing message: %w", err)
+	}
+
+	return nil
+}
+
+// Handler delivers the message to the broker. The messages are delivered at
+// least once, therefore the consumers should be idempotent.
+type Handler func(ctx context.Context, msg Message) error
+
+// ConfigFunc is used for configuring the Relay.
+type ConfigFunc func(*Relay)
+
+// BatchSize sets the maximum number of messages that are locked and delivered
+// in each transaction. The default value is 100.
+func BatchSize(n int) ConfigFunc {
+	return func(r *Relay) {
+		r.batch = n
+	}
+}
+
+// PollInterval sets the delay between polls when the outbox is drained. The
+// default value is 1s.
+func PollInterval(d time.Duration) ConfigFunc {
+	return func(r *Relay) {
+		r.interval = d
+	}
+}
+
+// DeliveryRetry sets the retry strategy for delivering each message. The
+// default is 3 attempts with an incremental delay.
+func DeliveryRetry(re retry.Retry) ConfigFunc {
+	return func(r *Relay) {
+		r.delivery = re
+	}
+}
+
+// Parallel sets the number of keys that are delivered at the same time. The
+// messages of each key are still delivered one at a time and in order. The
+// default value is 1.
+func Parallel(n int) ConfigFunc {
+	return func(r *Relay) {
+		r.parallel = n
+	}
+}
+
+// Lease makes the Relay claim the messages with a lease instead of holding
+// the row locks while delivering them. The messages are claimed in a short
+// transaction, delivered outside of it, and the lease is renewed every third
+// of d until they are marked as delivered. Other relays skip the messages
+// until the lease expires, therefore a message is delivered more than once
+// only when the relay that claimed it can't renew the lease in time. When the
+// renewal fails, the context of the handler is cancelled with ErrLeaseLost.
+// Use it when the delivery is slow, or to keep the transactions short.
+func Lease(d time.Duration) ConfigFunc {
+	return func(r *Relay) {
+		r.lease = d
+	}
+}
+
+// RelayID sets the name the Relay claims the messages with when the Lease is
+// set. It should be unique among the running relays. The default value is
+// made of the host name, the process id and a random number.
+func RelayID(id string) ConfigFunc {
+	return func(r *Relay) {
+		r.id = id
+	}
+}
+
+// OnError sets the function that is called when relaying fails. The Relay
+// keeps polling anyway.
+func OnError(fn func(error)) ConfigFunc {
+	return func(r *Relay) {
+		r.onError = fn
+	}
+}
+
+// Relay polls the outbox table and delivers the pending messages in order.
+// Several relays can run at the same time, as the messages are locked with
+// FOR UPDATE SKIP LOCKED, or claimed with a lease when the Lease is set.
+type Relay struct {
+	tr       *dbtools.PGX
+	handler  Handler
+	batch    int
+	interval time.Duration
+	delivery retry.Retry
+	parallel int
+	lease    time.Duration
+	id       string
+	onError  func(error)
+}
+
+// NewRelay returns a Relay that delivers the messages with the handler. The
+// messages are locked and marked as delivered in transactions run by the tr.
+func NewRelay(tr *dbtools.PGX, handler Handler, conf ...ConfigFunc) (*Relay, error) {
+	if tr == nil {
+		return nil, dbtools.ErrEmptyDatabase
+	}
+	if handler == nil {
+		return nil, ErrNilHandler
+	}
+	r := &Relay{
+		tr:       tr,
+		handler:  handler,
+		batch:    100,
+		interval: time.Second,
+		delivery: retry.Retry{
+			Attempts: 3,
+			Delay:    300 * time.Millisecond,
+			Method:   retry.IncrementalDelay,
+		},
+	}
+	for _, fn := range conf {
+		fn(r)
+	}
+	if r.batch < 1 {
+		r.batch = 1
+	}
+	if r.parallel < 1 {
+		r.parallel = 1
+	}
+	if r.delivery.Attempts < 1 {
+		r.delivery.Attempts = 1
+	}
+	if r.id == "" {
+		host, _ := os.Hostname()
+		r.id = fmt.Sprintf("%s-%d-%x", host, os.Getpid(), rand.Uint32())
+	}
+
+	return r, nil
+}
+
+// Run relays the messages until the ctx is cancelled, and returns the error
+// of the ctx.
+func (r *Relay) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		n, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil && r.onError != nil {
+			r.onError(err)
+		}
+		if err == nil && n == r.batch {
+			// There might be more messages.
+			timer.Reset(0)
+			continue
+		}
+		timer.Reset(r.interval)
+	}
+}
+
+// RelayOnce delivers one batch of the pending messages and returns the number
+// of delivered messages. If a message can't be delivered after all the
+// attempts, the messages of its key before it are marked as delivered, and
+// the error is returned. The failed message and the rest of the messages of
+// its key are delivered in the next call. The errors of all keys are joined.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	if r.lease > 0 {
+		return r.relayLeased(ctx)
+	}
+	var delivered int
+	var deliveryErr error
+	err := r.tr.Transaction(ctx, func(tx pgx.Tx) error {
+		delivered, deliveryErr = 0, nil
+		msgs, err := r.pending(ctx, tx)
+		if err != nil {
+			return err
+		}
+		msgs, err = r.inOrder(ctx, tx, msgs)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		ids, deliveryErr = r.deliver(ctx, msgs)
+		if len(ids) == 0 {
+			return nil
+		}
+
+		const query = `UPDATE ` + DefaultTable + ` SET delivered_at = now() WHERE id = ANY($1)`
+		if _, err := tx.Exec(ctx, query, ids); err != nil {
+			return fmt.Errorf("marking messages as delivered: %w", err)
+		}
+		delivered = len(ids)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return delivered, deliveryErr
+}
+
+// relayLeased claims a batch of the messages, delivers them while renewing the
+// lease, and marks them as delivered if the lease is still held.
+func (r *Relay) relayLeased(ctx context.Context) (int, error) {
+	msgs, err := r.claim(ctx)
+	if err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+	claimed := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		claimed[i] = msg.ID
+	}
+
+	deliverCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.renew(deliverCtx, cancel, done, claimed)
+	}()
+	ids, deliveryErr := r.deliver(deliverCtx, msgs)
+	close(done)
+	wg.Wait()
+	if cause := context.Cause(deliverCtx); errors.Is(cause, ErrLeaseLost) {
+		deliveryErr = errors.Join(deliveryErr, cause)
+	}
+	undelivered := slices.DeleteFunc(claimed, func(id int64) bool {
+		_, found := slices.BinarySearch(ids, id)
+		return found
+	})
+
+	var delivered int
+	err = r.tr.Transaction(ctx, func(tx pgx.Tx) error {
+		delivered = 0
+		if len(undelivered) > 0 {
+			const query = `UPDATE ` + DefaultTable + ` SET claimed_by = NULL, lease_until = NULL
+			WHERE id = ANY($1) AND claimed_by = $2`
+			if _, err := tx.Exec(ctx, query, undelivered, r.id); err != nil {
+				return fmt.Errorf("releasing messages: %w", err)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		const query = `UPDATE ` + DefaultTable + ` SET delivered_at = now(), claimed_by = NULL, lease_until = NULL
+		WHERE id = ANY($1) AND claimed_by = $2`
+		tag, err := tx.Exec(ctx, query, ids, r.id)
+		if err != nil {
+			return fmt.Errorf("marking messages as delivered: %w", err)
+		}
+		delivered = int(tag.RowsAffected())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return delivered, deliveryErr
+}
+
+// claim leases the pending messages of the batch to the Relay.
+func (r *Relay) claim(ctx context.Context) ([]Message, error) {
+	var msgs []Message
+	err := r.tr.Transaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		msgs, err = r.pending(ctx, tx)
+		if err != nil {
+			return err
+		}
+		msgs, err = r.inOrder(ctx, tx, msgs)
+		if err != nil || len(msgs) == 0 {
+			return err
+		}
+		ids := make([]int64, len(msgs))
+		for i, msg := range msgs {
+			ids[i] = msg.ID
+		}
+		const query = `UPDATE ` + DefaultTable + `
+		SET claimed_by = $1, lease_until = now() + $2 * interval '1 millisecond'
+		WHERE id = ANY($3)`
+		if _, err := tx.Exec(ctx, query, r.id, r.lease.Milliseconds(), ids); err != nil {
+			return fmt.Errorf("claiming messages: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+// renew extends the lease of the messages until the done channel is closed.
+// It cancels the delivery with ErrLeaseLost if the lease can't be renewed.
+func (r *Relay) renew(ctx context.Context, cancel context.CancelCauseFunc, done <-chan struct{}, ids []int64) {
+	ticker := time.NewTicker(r.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		const query = `UPDATE ` + DefaultTable + `
+		SET lease_until = now() + $1 * interval '1 millisecond'
+		WHERE id = ANY($2) AND claimed_by = $3 AND delivered_at IS NULL`
+		var renewed int64
+		err := r.tr.Transaction(ctx, func(tx pgx.Tx) error {
+			tag, err := tx.Exec(ctx, query, r.lease.Milliseconds(), ids, r.id)
+			renewed = tag.RowsAffected()
+			return err
+		})
+		if err != nil {
+			cancel(fmt.Errorf("%w: %w", ErrLeaseLost, err))
+			return
+		}
+		if renewed < int64(len(ids)) {
+			cancel(ErrLeaseLost)
+			return
+		}
+	}
+}
+
+// deliver delivers the messages of each key in order, and the keys in
+// parallel. It returns the sorted ids of the delivered messages.
+func (r *Relay) deliver(ctx context.Context, msgs []Message) ([]int64, error) {
+	var keys []string
+	groups := make(map[string][]Message)
+	for _, msg := range msgs {
+		if _, ok := groups[msg.Key]; !ok {
+			keys = append(keys, msg.Key)
+		}
+		groups[msg.Key] = append(groups[msg.Key], msg)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	ids := make([]int64, 0, len(msgs))
+	sem := make(chan struct{}, r.parallel)
+	for _, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(group []Message) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			for _, msg := range group {
+				err := r.delivery.DoContext(ctx, func() error {
+					return r.handler(ctx, msg)
+				})
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("delivering message %d: %w", msg.ID, err))
+					mu.Unlock()
+					return
+				}
+				ids = append(ids, msg.ID)
+				mu.Unlock()
+			}
+		}(groups[key])
+	}
+	wg.Wait()
+	slices.Sort(ids)
+
+	return ids, errors.Join(errs...)
+}
+
+// inOrder removes the messages of the keys that have earlier pending messages
+// that are locked by another relay.
+func (r *Relay) inOrder(ctx context.Context, tx pgx.Tx, msgs []Message) ([]Message, error) {
+	first := make(map[string]int64)
+	for _, msg := range msgs {
+		if _, ok := first[msg.Key]; !ok && msg.Key != "" {
+			first[msg.Key] = msg.ID
+		}
+	}
+	if len(first) == 0 {
+		return msgs, nil
+	}
+	keys := make([]string, 0, len(first))
+	for key := range first {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	const query = `SELECT key, min(id) FROM ` + DefaultTable + `
+	WHERE delivered_at IS NULL AND key = ANY($1)
+	GROUP BY key`
+	rows, err := tx.Query(ctx, query, keys)
+	if err != nil {
+		return nil, fmt.Errorf("querying message order: %w", err)
+	}
+	defer rows.Close()
+	blocked := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		var id int64
+		if err := rows.Scan(&key, &id); err != nil {
+			return nil, fmt.Errorf("scanning message order: %w", err)
+		}
+		if id < first[key] {
+			blocked[key] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading message order: %w", err)
+	}
+	if len(blocked) == 0 {
+		return msgs, nil
+	}
+
+	return slices.DeleteFunc(msgs, func(msg Message) bool {
+		return blocked[msg.Key]
+	}), nil
+}
+
+// pending locks and returns the pending messages of the batch that are not
+// leased to a relay.
+func (r *Relay) pending(ctx context.Context, tx pgx.Tx) ([]Message, error) {
+	const query = `SELECT id, topic, key, payload, created_at FROM ` + DefaultTable + `
+	WHERE delivered_at IS NULL AND (lease_until IS NULL OR lease_until < now())
+	ORDER BY id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(ctx, query, r.batch)
+	if err != nil {
+		return nil, fmt.Errorf("querying pending messages: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &msg.Payload, &msg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning message: %w", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading messages: %w", err)
+	}
+
+	return msgs, nil
+}
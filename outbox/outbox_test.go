@@ -0,0 +1,448 @@
+package outbox_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/dbtools/v4/outbox"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnqueue(t *testing.T) {
+	t.Parallel()
+	t.Run("EmptyTopic", testEnqueueEmptyTopic)
+	t.Run("Error", testEnqueueError)
+	t.Run("Success", testEnqueueSuccess)
+}
+
+func testEnqueueEmptyTopic(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	err := outbox.Enqueue(context.Background(), tx, "", []byte("{}"))
+	assert.ErrorIs(t, err, outbox.ErrEmptyTopic)
+}
+
+func testEnqueueError(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	tx.On("Exec", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(pgconn.CommandTag{}, assert.AnError).Once()
+	err := outbox.Enqueue(context.Background(), tx, "users", []byte("{}"))
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testEnqueueSuccess(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	payload := []byte(`{"id":1}`)
+	tx.On("Exec", mock.Anything,
+		"INSERT INTO dbtools_outbox (topic, payload) VALUES ($1, $2)",
+		"users", payload,
+	).Return(pgconn.NewCommandTag("INSERT 0 1"), nil).Once()
+	err := outbox.Enqueue(context.Background(), tx, "users", payload)
+	assert.NoError(t, err)
+}
+
+func TestEnqueueKeyed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tx := mocks.NewPGXTx(t)
+	err := outbox.EnqueueKeyed(ctx, tx, "", "user-1", []byte("{}"))
+	assert.ErrorIs(t, err, outbox.ErrEmptyTopic)
+
+	payload := []byte(`{"id":1}`)
+	tx.On("Exec", mock.Anything,
+		"INSERT INTO dbtools_outbox (topic, key, payload) VALUES ($1, $2, $3)",
+		"users", "user-1", payload,
+	).Return(pgconn.NewCommandTag("INSERT 0 1"), nil).Once()
+	err = outbox.EnqueueKeyed(ctx, tx, "users", "user-1", payload)
+	assert.NoError(t, err)
+}
+
+func TestNewRelay(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(mocks.NewPool(t))
+	require.NoError(t, err)
+	handler := func(context.Context, outbox.Message) error { return nil }
+
+	_, err = outbox.NewRelay(nil, handler)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+	_, err = outbox.NewRelay(tr, nil)
+	assert.ErrorIs(t, err, outbox.ErrNilHandler)
+	r, err := outbox.NewRelay(tr, handler)
+	require.NoError(t, err)
+	assert.NotNil(t, r)
+}
+
+// pendingRows returns rows that yield messages with the ids.
+func pendingRows(t *testing.T, ids ...int64) *mocks.PGXRows {
+	t.Helper()
+	msgs := make([]outbox.Message, len(ids))
+	for i, id := range ids {
+		msgs[i] = outbox.Message{ID: id}
+	}
+	return keyedRows(t, msgs...)
+}
+
+// keyedRows returns rows that yield the messages with the users topic.
+func keyedRows(t *testing.T, msgs ...outbox.Message) *mocks.PGXRows {
+	t.Helper()
+	rows := mocks.NewPGXRows(t)
+	for _, msg := range msgs {
+		rows.On("Next").Return(true).Once()
+		rows.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(nil).Once().
+			Run(func(args mock.Arguments) {
+				*args.Get(0).(*int64) = msg.ID
+				*args.Get(1).(*string) = "users"
+				*args.Get(2).(*string) = msg.Key
+			})
+	}
+	rows.On("Next").Return(false).Once()
+	rows.On("Err").Return(nil).Once()
+	rows.On("Close").Return().Once()
+	return rows
+}
+
+func TestRelayOnce(t *testing.T) {
+	t.Parallel()
+	t.Run("Success", testRelayOnceSuccess)
+	t.Run("DeliveryError", testRelayOnceDeliveryError)
+	t.Run("Empty", testRelayOnceEmpty)
+}
+
+func testRelayOnceSuccess(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Query", mock.Anything, mock.Anything, 10).Return(pendingRows(t, 1, 2), nil).Once()
+	tx.On("Exec", mock.Anything,
+		"UPDATE dbtools_outbox SET delivered_at = now() WHERE id = ANY($1)",
+		[]int64{1, 2},
+	).Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	var got []int64
+	r, err := outbox.NewRelay(tr, func(_ context.Context, msg outbox.Message) error {
+		got = append(got, msg.ID)
+		return nil
+	}, outbox.BatchSize(10))
+	require.NoError(t, err)
+
+	n, err := r.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int64{1, 2}, got)
+}
+
+func testRelayOnceDeliveryError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(pendingRows(t, 1, 2, 3), nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, []int64{1}).Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	attempts := 0
+	r, err := outbox.NewRelay(tr, func(_ context.Context, msg outbox.Message) error {
+		if msg.ID == 2 {
+			attempts++
+			return assert.AnError
+		}
+		if msg.ID == 3 {
+			t.Error("didn't expect the message after the failed one to be delivered")
+		}
+		return nil
+	}, outbox.DeliveryRetry(retry.Retry{Attempts: 3, Delay: time.Millisecond}))
+	require.NoError(t, err)
+
+	n, err := r.RelayOnce(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 3, attempts)
+}
+
+func testRelayOnceEmpty(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(pendingRows(t), nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	r, err := outbox.NewRelay(tr, func(context.Context, outbox.Message) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	require.NoError(t, err)
+
+	n, err := r.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+// orderRows returns rows that yield the first pending ids of the keys.
+func orderRows(t *testing.T, first map[string]int64) *mocks.PGXRows {
+	t.Helper()
+	rows := mocks.NewPGXRows(t)
+	for key, id := range first {
+		rows.On("Next").Return(true).Once()
+		rows.On("Scan", mock.Anything, mock.Anything).Return(nil).Once().
+			Run(func(args mock.Arguments) {
+				*args.Get(0).(*string) = key
+				*args.Get(1).(*int64) = id
+			})
+	}
+	rows.On("Next").Return(false).Once()
+	rows.On("Err").Return(nil).Once()
+	rows.On("Close").Return().Once()
+	return rows
+}
+
+const orderQuery = `SELECT key, min(id) FROM dbtools_outbox
+	WHERE delivered_at IS NULL AND key = ANY($1)
+	GROUP BY key`
+
+func TestRelayOnceKeyed(t *testing.T) {
+	t.Parallel()
+	t.Run("Parallel", testRelayOnceKeyedParallel)
+	t.Run("DeliveryError", testRelayOnceKeyedDeliveryError)
+	t.Run("Blocked", testRelayOnceKeyedBlocked)
+}
+
+func testRelayOnceKeyedParallel(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(keyedRows(t,
+		outbox.Message{ID: 1, Key: "a"},
+		outbox.Message{ID: 2, Key: "b"},
+		outbox.Message{ID: 3, Key: "a"},
+		outbox.Message{ID: 4, Key: "b"},
+	), nil).Once()
+	tx.On("Query", mock.Anything, orderQuery, []string{"a", "b"}).
+		Return(orderRows(t, map[string]int64{"a": 1, "b": 2}), nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, []int64{1, 2, 3, 4}).Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	var mu sync.Mutex
+	got := make(map[string][]int64)
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	r, err := outbox.NewRelay(tr, func(_ context.Context, msg outbox.Message) error {
+		if msg.ID <= 2 {
+			// Both keys should be in flight at the same time.
+			barrier.Done()
+			barrier.Wait()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		got[msg.Key] = append(got[msg.Key], msg.ID)
+		return nil
+	}, outbox.Parallel(2))
+	require.NoError(t, err)
+
+	n, err := r.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, map[string][]int64{"a": {1, 3}, "b": {2, 4}}, got)
+}
+
+func testRelayOnceKeyedDeliveryError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(keyedRows(t,
+		outbox.Message{ID: 1, Key: "a"},
+		outbox.Message{ID: 2, Key: "b"},
+		outbox.Message{ID: 3, Key: "a"},
+		outbox.Message{ID: 4, Key: "b"},
+	), nil).Once()
+	tx.On("Query", mock.Anything, orderQuery, mock.Anything).
+		Return(orderRows(t, map[string]int64{"a": 1, "b": 2}), nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, []int64{2, 4}).Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	r, err := outbox.NewRelay(tr, func(_ context.Context, msg outbox.Message) error {
+		if msg.ID == 3 {
+			t.Error("didn't expect the message after the failed one to be delivered")
+		}
+		if msg.Key == "a" {
+			return assert.AnError
+		}
+		return nil
+	}, outbox.DeliveryRetry(retry.Retry{Attempts: 1}))
+	require.NoError(t, err)
+
+	n, err := r.RelayOnce(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 2, n)
+}
+
+func testRelayOnceKeyedBlocked(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(keyedRows(t,
+		outbox.Message{ID: 5, Key: "a"},
+		outbox.Message{ID: 6, Key: "b"},
+		outbox.Message{ID: 7},
+	), nil).Once()
+	// The message 3 of the key a is locked by another relay.
+	tx.On("Query", mock.Anything, orderQuery, []string{"a", "b"}).
+		Return(orderRows(t, map[string]int64{"a": 3, "b": 6}), nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, []int64{6, 7}).Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	r, err := outbox.NewRelay(tr, func(_ context.Context, msg outbox.Message) error {
+		if msg.Key == "a" {
+			t.Error("didn't expect the blocked key to be delivered")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	n, err := r.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestRelayOnceLease(t *testing.T) {
+	t.Parallel()
+	t.Run("Success", testRelayOnceLeaseSuccess)
+	t.Run("Renew", testRelayOnceLeaseRenew)
+	t.Run("Lost", testRelayOnceLeaseLost)
+}
+
+func testRelayOnceLeaseSuccess(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Twice()
+	tx.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(pendingRows(t, 1, 2, 3), nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, "relay", int64(60000), []int64{1, 2, 3}).
+		Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, []int64{3}, "relay").
+		Return(pgconn.NewCommandTag("UPDATE 1"), nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, []int64{1, 2}, "relay").
+		Return(pgconn.NewCommandTag("UPDATE 2"), nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Twice()
+
+	r, err := outbox.NewRelay(tr, func(_ context.Context, msg outbox.Message) error {
+		if msg.ID == 3 {
+			return assert.AnError
+		}
+		return nil
+	},
+		outbox.Lease(time.Minute),
+		outbox.RelayID("relay"),
+		outbox.DeliveryRetry(retry.Retry{Attempts: 1}),
+	)
+	require.NoError(t, err)
+
+	n, err := r.RelayOnce(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 2, n)
+}
+
+func testRelayOnceLeaseRenew(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil)
+	tx.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(pendingRows(t, 1), nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, "relay", int64(30), []int64{1}).
+		Return(pgconn.CommandTag{}, nil).Once()
+	renewed := make(chan struct{})
+	var once sync.Once
+	tx.On("Exec", mock.Anything, mock.Anything, int64(30), []int64{1}, "relay").
+		Return(pgconn.NewCommandTag("UPDATE 1"), nil).
+		Run(func(mock.Arguments) { once.Do(func() { close(renewed) }) })
+	tx.On("Exec", mock.Anything, mock.Anything, []int64{1}, "relay").
+		Return(pgconn.NewCommandTag("UPDATE 1"), nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil)
+
+	r, err := outbox.NewRelay(tr, func(ctx context.Context, _ outbox.Message) error {
+		select {
+		case <-renewed:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, outbox.Lease(30*time.Millisecond), outbox.RelayID("relay"))
+	require.NoError(t, err)
+
+	n, err := r.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func testRelayOnceLeaseLost(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil)
+	tx.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(pendingRows(t, 1), nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, "relay", int64(30), []int64{1}).
+		Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, int64(30), []int64{1}, "relay").
+		Return(pgconn.NewCommandTag("UPDATE 0"), nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, []int64{1}, "relay").
+		Return(pgconn.NewCommandTag("UPDATE 0"), nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil)
+
+	r, err := outbox.NewRelay(tr, func(ctx context.Context, _ outbox.Message) error {
+		<-ctx.Done()
+		assert.ErrorIs(t, context.Cause(ctx), outbox.ErrLeaseLost)
+		return ctx.Err()
+	},
+		outbox.Lease(30*time.Millisecond),
+		outbox.RelayID("relay"),
+		outbox.DeliveryRetry(retry.Retry{Attempts: 1}),
+	)
+	require.NoError(t, err)
+
+	n, err := r.RelayOnce(context.Background())
+	require.ErrorIs(t, err, outbox.ErrLeaseLost)
+	assert.Zero(t, n)
+}
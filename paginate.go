@@ -0,0 +1,208 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// Pager iterates over the pages of a keyset paginated query. Each page is
+// fetched in its own transaction, therefore the pages are retried separately
+// and no transaction is held open between the pages. It is not safe for
+// concurrent use.
+type Pager[T any] struct {
+	ctx      context.Context //nolint:containedctx // it is used for fetching the pages.
+	tr       Transactioner
+	query    string
+	column   string
+	size     int
+	scan     func(pgx.Rows) (T, error)
+	args     []any
+	codec    *CursorCodec
+	page     []T
+	cursor   any
+	started  bool
+	finished bool
+	err      error
+}
+
+// Paginate returns a Pager that fetches the rows of the query in pages of the
+// pageSize, ordered by the cursorCol. The cursorCol should be selected by the
+// query and be unique, for example the primary key. The query should not
+// have an ORDER BY or LIMIT clause, as it is wrapped in a sub-query that adds
+// them:
+//
+//	pages := dbtools.Paginate(ctx, p,
+//		`SELECT id, name FROM users WHERE status = $1`, "id", 500,
+//		func(rows pgx.Rows) (User, error) {
+//			var u User
+//			err := rows.Scan(&u.ID, &u.Name)
+//			return u, err
+//		}, "active",
+//	)
+//	for pages.Next() {
+//		for _, u := range pages.Page() {
+//			// ...
+//		}
+//	}
+//	if err := pages.Err(); err != nil {
+//		// handle the error!
+//	}
+//
+// If the tr is a *PGX, the pages are fetched in read only transactions.
+func Paginate[T any](ctx context.Context, tr Transactioner, query, cursorCol string, pageSize int, scan func(pgx.Rows) (T, error), args ...any) *Pager[T] {
+	if p, ok := tr.(*PGX); ok {
+		tr = p.ReadOnly()
+	}
+
+	return &Pager[T]{
+		ctx:    ctx,
+		tr:     tr,
+		query:  query,
+		column: cursorCol,
+		size:   pageSize,
+		scan:   scan,
+		args:   args,
+	}
+}
+
+// Next fetches the next page and returns true if it has any rows. It returns
+// false when there are no more rows, or an error has occurred, which is
+// returned by the Err method. If Next is called again after an error, it
+// resumes from the last fetched page.
+func (p *Pager[T]) Next() bool {
+	p.page = nil
+	p.err = nil
+	if p.finished {
+		return false
+	}
+	if p.size < 1 {
+		p.err = fmt.Errorf("%w: %d", ErrInvalidPageSize, p.size)
+		return false
+	}
+
+	var cursor any
+	err := p.tr.Transaction(p.ctx, func(tx pgx.Tx) error {
+		p.page = p.page[:0]
+		sql, args := p.sql()
+		rows, err := tx.Query(p.ctx, sql, args...)
+		if err != nil {
+			return fmt.Errorf("fetching page: %w", err)
+		}
+		defer rows.Close()
+		col, err := p.columnIndex(rows)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			v, err := p.scan(rows)
+			if err != nil {
+				return err
+			}
+			p.page = append(p.page, v)
+			values, err := rows.Values()
+			if err != nil {
+				return fmt.Errorf("reading cursor: %w", err)
+			}
+			cursor = values[col]
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		p.page = nil
+		p.err = err
+		return false
+	}
+	p.started = true
+	p.finished = len(p.page) < p.size
+	if len(p.page) > 0 {
+		p.cursor = cursor
+	}
+
+	return len(p.page) > 0
+}
+
+// WithCodec sets the codec of the tokens of the Cursor and the Seek methods,
+// for example a CursorCodec with a key so the clients can't forge the tokens.
+// It returns the p. The tokens are not signed by default.
+func (p *Pager[T]) WithCodec(c *CursorCodec) *Pager[T] {
+	p.codec = c
+	return p
+}
+
+func (p *Pager[T]) cursorCodec() *CursorCodec {
+	if p.codec == nil {
+		return &CursorCodec{}
+	}
+
+	return p.codec
+}
+
+// Page returns the rows of the current page.
+func (p *Pager[T]) Page() []T {
+	return p.page
+}
+
+// Err returns the error of the last call to the Next method.
+func (p *Pager[T]) Err() error {
+	return p.err
+}
+
+// Cursor returns the token of the last fetched row, which can be passed to
+// the Seek method of another Pager to continue from the same position, for
+// example in the next request of a client. The token is encoded with the
+// codec set by the WithCodec method. It returns an empty token before the
+// first page is fetched.
+func (p *Pager[T]) Cursor() (string, error) {
+	if !p.started {
+		return "", nil
+	}
+
+	return p.cursorCodec().Encode(p.cursor)
+}
+
+// Seek sets the position of the Pager to the token returned by the Cursor
+// method, therefore the next page starts after the row of the token. It
+// returns an ErrInvalidCursor error if the token can't be decoded with the
+// codec set by the WithCodec method.
+func (p *Pager[T]) Seek(token string) error {
+	keys, err := p.cursorCodec().Decode(token)
+	if err != nil {
+		return err
+	}
+	if len(keys) != 1 {
+		return fmt.Errorf("%w: got %d keys, want 1", ErrInvalidCursor, len(keys))
+	}
+	p.cursor = keys[0]
+	p.started = true
+	p.finished = false
+
+	return nil
+}
+
+// sql returns the query of the next page and its arguments.
+func (p *Pager[T]) sql() (string, []any) {
+	col := pgx.Identifier{p.column}.Sanitize()
+	sql := "SELECT * FROM (" + p.query + ") AS page"
+	args := p.args
+	if p.started {
+		args = append(args[:len(args):len(args)], p.cursor)
+		sql += " WHERE " + col + " > $" + strconv.Itoa(len(args))
+	}
+
+	return sql + " ORDER BY " + col + " LIMIT " + strconv.Itoa(p.size), args
+}
+
+// columnIndex returns the index of the cursor column in the rows.
+func (p *Pager[T]) columnIndex(rows pgx.Rows) (int, error) {
+	for i, f := range rows.FieldDescriptions() {
+		if f.Name == p.column {
+			return i, nil
+		}
+	}
+
+	return 0, &retry.StopError{Err: fmt.Errorf("cursor column %q is not selected", p.column)}
+}
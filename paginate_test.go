@@ -0,0 +1,199 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginate(t *testing.T) {
+	t.Parallel()
+	t.Run("Pages", testPaginatePages)
+	t.Run("Retry", testPaginateRetry)
+	t.Run("Resume", testPaginateResume)
+	t.Run("Seek", testPaginateSeek)
+	t.Run("Codec", testPaginateCodec)
+	t.Run("MissingColumn", testPaginateMissingColumn)
+	t.Run("InvalidPageSize", testPaginateInvalidPageSize)
+}
+
+func scanName(rows pgx.Rows) (string, error) {
+	var id int64
+	var name string
+	err := rows.Scan(&id, &name)
+	return name, err
+}
+
+func testPaginatePages(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	cols := []string{"id", "name"}
+	sim.On("FROM users").Return(cols, []any{int64(1), "a"}, []any{int64(2), "b"}).Times(1)
+	sim.On("FROM users").Return(cols, []any{int64(3), "c"}, []any{int64(4), "d"}).Times(1)
+	sim.On("FROM users").Return(cols)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	pages := dbtools.Paginate(context.Background(), tr,
+		`SELECT id, name FROM users WHERE status = $1`, "id", 2, scanName, "active")
+	var got [][]string
+	for pages.Next() {
+		got = append(got, pages.Page())
+	}
+	require.NoError(t, pages.Err())
+	assert.Equal(t, [][]string{{"a", "b"}, {"c", "d"}}, got)
+
+	var stmts []dbtesting.Statement
+	for _, s := range sim.Statements() {
+		if len(s.Args) > 0 {
+			stmts = append(stmts, s)
+		}
+	}
+	require.Len(t, stmts, 3)
+	assert.Equal(t, `SELECT * FROM (SELECT id, name FROM users WHERE status = $1) AS page ORDER BY "id" LIMIT 2`, stmts[0].SQL)
+	assert.Equal(t, []any{"active"}, stmts[0].Args)
+	assert.Equal(t, `SELECT * FROM (SELECT id, name FROM users WHERE status = $1) AS page WHERE "id" > $2 ORDER BY "id" LIMIT 2`, stmts[1].SQL)
+	assert.Equal(t, []any{"active", int64(2)}, stmts[1].Args)
+	assert.Equal(t, []any{"active", int64(4)}, stmts[2].Args)
+	assert.False(t, pages.Next(), "the pager should stay finished")
+}
+
+func testPaginateRetry(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	cols := []string{"id", "name"}
+	sim.On("FROM users").Return(cols, []any{int64(1), "a"}).Times(1)
+	sim.On("FROM users").Error(&pgconn.PgError{Code: "40001"}).Times(1)
+	sim.On("FROM users").Return(cols, []any{int64(2), "b"})
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	pages := dbtools.Paginate(context.Background(), tr, `SELECT id, name FROM users`, "id", 1, scanName)
+	require.True(t, pages.Next())
+	assert.Equal(t, []string{"a"}, pages.Page())
+	require.True(t, pages.Next())
+	assert.Equal(t, []string{"b"}, pages.Page())
+	require.NoError(t, pages.Err())
+}
+
+func testPaginateResume(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	cols := []string{"id", "name"}
+	sim.On("FROM users").Return(cols, []any{int64(1), "a"}).Times(1)
+	sim.On("FROM users").Error(assert.AnError).Times(1)
+	sim.On("FROM users").Return(cols)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	pages := dbtools.Paginate(context.Background(), tr, `SELECT id, name FROM users`, "id", 1, scanName)
+	require.True(t, pages.Next())
+	assert.False(t, pages.Next())
+	require.ErrorIs(t, pages.Err(), assert.AnError)
+	assert.Nil(t, pages.Page())
+
+	assert.False(t, pages.Next())
+	require.NoError(t, pages.Err())
+	stmts := sim.Statements()
+	assert.Equal(t, []any{int64(1)}, stmts[len(stmts)-2].Args, "it should resume from the last cursor")
+}
+
+func testPaginateSeek(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	cols := []string{"id", "name"}
+	sim.On("FROM users").Return(cols, []any{int64(7), "g"}).Times(1)
+	sim.On("FROM users").Return(cols)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	pages := dbtools.Paginate(ctx, tr, `SELECT id, name FROM users`, "id", 1, scanName)
+	token, err := pages.Cursor()
+	require.NoError(t, err)
+	assert.Empty(t, token)
+	require.True(t, pages.Next())
+	token, err = pages.Cursor()
+	require.NoError(t, err)
+
+	other := dbtools.Paginate(ctx, tr, `SELECT id, name FROM users`, "id", 1, scanName)
+	require.NoError(t, other.Seek(token))
+	assert.False(t, other.Next())
+	require.NoError(t, other.Err())
+	stmts := sim.Statements()
+	assert.Equal(t, []any{int64(7)}, stmts[len(stmts)-2].Args)
+
+	assert.ErrorIs(t, other.Seek("garbage!"), dbtools.ErrInvalidCursor)
+	two, err := dbtools.EncodeCursor(1, 2)
+	require.NoError(t, err)
+	assert.ErrorIs(t, other.Seek(two), dbtools.ErrInvalidCursor)
+}
+
+func testPaginateCodec(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	cols := []string{"id", "name"}
+	sim.On("FROM users").Return(cols, []any{int64(7), "g"}).Times(1)
+	sim.On("FROM users").Return(cols)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	codec := dbtools.NewCursorCodec([]byte("secret"))
+	pages := dbtools.Paginate(ctx, tr, `SELECT id, name FROM users`, "id", 1, scanName).WithCodec(codec)
+	require.True(t, pages.Next())
+	token, err := pages.Cursor()
+	require.NoError(t, err)
+	keys, err := codec.Decode(token)
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(7)}, keys)
+
+	other := dbtools.Paginate(ctx, tr, `SELECT id, name FROM users`, "id", 1, scanName).WithCodec(codec)
+	require.NoError(t, other.Seek(token))
+
+	forged, err := dbtools.EncodeCursor(int64(1))
+	require.NoError(t, err)
+	assert.ErrorIs(t, other.Seek(forged), dbtools.ErrInvalidCursor)
+	forged, err = dbtools.NewCursorCodec([]byte("other")).Encode(int64(1))
+	require.NoError(t, err)
+	assert.ErrorIs(t, other.Seek(forged), dbtools.ErrInvalidCursor)
+}
+
+func testPaginateMissingColumn(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("FROM users").Return([]string{"name"}, []any{"a"})
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	pages := dbtools.Paginate(context.Background(), tr, `SELECT name FROM users`, "id", 1,
+		func(rows pgx.Rows) (string, error) {
+			var name string
+			err := rows.Scan(&name)
+			return name, err
+		})
+	assert.False(t, pages.Next())
+	require.Error(t, pages.Err())
+	assert.Contains(t, pages.Err().Error(), `"id" is not selected`)
+	assert.Equal(t, []string{"BEGIN", `SELECT * FROM (SELECT name FROM users) AS page ORDER BY "id" LIMIT 1`, "ROLLBACK"}, sim.SQL(),
+		"it should not be retried")
+}
+
+func testPaginateInvalidPageSize(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	pages := dbtools.Paginate(context.Background(), tr, `SELECT id, name FROM users`, "id", 0, scanName)
+	assert.False(t, pages.Next())
+	assert.ErrorIs(t, pages.Err(), dbtools.ErrInvalidPageSize)
+	assert.Empty(t, sim.SQL())
+}
@@ -0,0 +1,210 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PoolOption configures the pgxpool.Config before the pool is created by the
+// NewPoolWithRetry function.
+type PoolOption func(*pgxpool.Config)
+
+// WithAfterConnect adds the fn to the AfterConnect hook of the pool. The hooks
+// are called in the order they are added, and the first error stops the
+// chain.
+func WithAfterConnect(fn func(context.Context, *pgx.Conn) error) PoolOption {
+	return func(c *pgxpool.Config) {
+		prev := c.AfterConnect
+		c.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			if prev != nil {
+				if err := prev(ctx, conn); err != nil {
+					return err
+				}
+			}
+
+			return fn(ctx, conn)
+		}
+	}
+}
+
+// WithBeforeAcquire adds the fn to the BeforeAcquire hook of the pool. A
+// connection is acquired only if all hooks return true.
+func WithBeforeAcquire(fn func(context.Context, *pgx.Conn) bool) PoolOption {
+	return func(c *pgxpool.Config) {
+		prev := c.BeforeAcquire
+		c.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+			if prev != nil && !prev(ctx, conn) {
+				return false
+			}
+
+			return fn(ctx, conn)
+		}
+	}
+}
+
+// WithCredentialProvider calls the fn for the credentials of each new
+// connection, for example to generate a short lived IAM authentication token.
+// The existing connections are not affected, and the connections that fail to
+// authenticate are retried with the fresh credentials by the next attempt of
+// the transaction, as they are connection errors. The user is not changed if
+// the fn returns an empty user. Cache the credentials in the fn if creating
+// them is expensive.
+func WithCredentialProvider(fn func(ctx context.Context) (user, password string, err error)) PoolOption {
+	return func(c *pgxpool.Config) {
+		prev := c.BeforeConnect
+		c.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
+			if prev != nil {
+				if err := prev(ctx, cc); err != nil {
+					return err
+				}
+			}
+			user, password, err := fn(ctx)
+			if err != nil {
+				return fmt.Errorf("getting credentials: %w", err)
+			}
+			if user != "" {
+				cc.User = user
+			}
+			cc.Password = password
+
+			return nil
+		}
+	}
+}
+
+// WithRuntimeParams sets the default values of the runtime parameters, for
+// example search_path or application_name. The parameters set in the
+// connection string take precedence.
+func WithRuntimeParams(params map[string]string) PoolOption {
+	return func(c *pgxpool.Config) {
+		if c.ConnConfig.RuntimeParams == nil {
+			c.ConnConfig.RuntimeParams = make(map[string]string, len(params))
+		}
+		for k, v := range params {
+			if _, ok := c.ConnConfig.RuntimeParams[k]; !ok {
+				c.ConnConfig.RuntimeParams[k] = v
+			}
+		}
+	}
+}
+
+// WithApplicationName sets the application_name of the connections to the
+// "service/version" value, which is visible in the pg_stat_activity view. The
+// value is truncated to 63 bytes, which is the limit of the server, without
+// splitting a multi-byte character. The application_name that is set in the
+// connection string is kept.
+func WithApplicationName(service, version string) PoolOption {
+	return func(c *pgxpool.Config) {
+		if _, ok := c.ConnConfig.RuntimeParams["application_name"]; ok {
+			return
+		}
+		name := service
+		if version != "" {
+			name += "/" + version
+		}
+		if len(name) > maxIdentifierLength {
+			n := maxIdentifierLength
+			for n > 0 && !utf8.RuneStart(name[n]) {
+				n--
+			}
+			name = name[:n]
+		}
+		if c.ConnConfig.RuntimeParams == nil {
+			c.ConnConfig.RuntimeParams = make(map[string]string, 1)
+		}
+		c.ConnConfig.RuntimeParams["application_name"] = name
+	}
+}
+
+// WithPoolLabels sets the labels as the "dbtools.<key>" run-time parameters of
+// the connections, which can be inspected on the server with the
+// current_setting function.
+func WithPoolLabels(labels map[string]string) PoolOption {
+	return func(c *pgxpool.Config) {
+		if c.ConnConfig.RuntimeParams == nil {
+			c.ConnConfig.RuntimeParams = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			c.ConnConfig.RuntimeParams[labelPrefix+k] = v
+		}
+	}
+}
+
+// WithExtensions registers the types of the exts on each new connection. See
+// the RegisterExtensions function.
+func WithExtensions(exts ...Extension) PoolOption {
+	return func(c *pgxpool.Config) {
+		RegisterExtensions(c, exts...)
+	}
+}
+
+// NewPoolWithRetry creates a pgxpool.Pool from the dsn with the opts applied,
+// and waits for the database to be reachable with the r retry policy. If the
+// database is not reachable, the pool is closed and the error is returned:
+//
+//	pool, err := dbtools.NewPoolWithRetry(ctx, dsn,
+//		retry.Retry{Attempts: 30, Delay: time.Second},
+//		dbtools.WithRuntimeParams(map[string]string{"search_path": "app"}),
+//		dbtools.WithExtensions(dbtools.HStore),
+//	)
+func NewPoolWithRetry(ctx context.Context, dsn string, r retry.Retry, opts ...PoolOption) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing connection string: %w", err)
+	}
+	for _, fn := range opts {
+		fn(config)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("creating pool: %w", err)
+	}
+	if err := WaitForPool(ctx, pool, r); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// NewFromDSN creates a pgxpool.Pool from the dsn and returns a PGX object
+// with the conf applied, after the database is reachable with the retry
+// policy of the PGX object. An empty dsn reads the connection settings from
+// the PG* environment variables, for example PGHOST and PGPASSWORD. The
+// returned function closes the pool, and the pool is closed on errors:
+//
+//	p, closePool, err := dbtools.NewFromDSN(ctx, os.Getenv("DATABASE_URL"),
+//		dbtools.Retry(30, time.Second),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	defer closePool()
+func NewFromDSN(ctx context.Context, dsn string, conf ...ConfigFunc) (*PGX, func(), error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing connection string: %w", err)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating pool: %w", err)
+	}
+	p, err := New(pool, conf...)
+	if err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+	if err := p.WaitForReady(ctx); err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+
+	return p, pool.Close, nil
+}
@@ -0,0 +1,29 @@
+package dbtools
+
+import "fmt"
+
+// Preset returns a copy of the PGX object with the configurations of the named
+// preset applied on top of the current configuration. The copy shares the
+// same pool. It returns an ErrUnknownPreset error if the preset is not
+// registered with the WithPreset function, and the validation errors if the
+// StrictConfig option is set and the preset is invalid.
+func (p *PGX) Preset(name string) (*PGX, error) {
+	conf, ok := p.presets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPreset, name)
+	}
+
+	return p.clone(conf...)
+}
+
+// With returns a copy of the PGX object with the conf applied on top of the
+// current configuration. The copy shares the same pool, and the state of the
+// features that are set by pointer, for example the Budget and the Metrics.
+// It is cheap enough to be called per request. It returns the validation
+// errors if the StrictConfig option is set and the configuration is invalid:
+//
+//	background, err := tr.With(dbtools.Retry(20, time.Second))
+//	hot, err := tr.With(dbtools.Retry(2, 10*time.Millisecond), dbtools.GracePeriod(time.Second))
+func (p *PGX) With(conf ...ConfigFunc) (*PGX, error) {
+	return p.clone(conf...)
+}
@@ -0,0 +1,162 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXPreset(t *testing.T) {
+	t.Parallel()
+	t.Run("Unknown", testPGXPresetUnknown)
+	t.Run("Retry", testPGXPresetRetry)
+	t.Run("TxOptions", testPGXPresetTxOptions)
+	t.Run("NoTxBeginner", testPGXPresetNoTxBeginner)
+}
+
+func testPGXPresetUnknown(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(mocks.NewPool(t),
+		dbtools.WithPreset("critical-write", dbtools.Retry(10, time.Second)),
+	)
+	require.NoError(t, err)
+
+	_, err = tr.Preset("nope")
+	assert.ErrorIs(t, err, dbtools.ErrUnknownPreset)
+}
+
+func testPGXPresetRetry(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	total := 3
+	label := randomString(10)
+	tr, err := dbtools.New(db,
+		dbtools.WithPreset("critical-write",
+			dbtools.Retry(total, time.Millisecond),
+			dbtools.Label(label),
+		),
+	)
+	require.NoError(t, err)
+	p, err := tr.Preset("critical-write")
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total + 1)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total + 1)
+
+	calls := 0
+	err = p.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), label)
+	assert.Equal(t, total, calls)
+
+	// The original object is not affected.
+	calls = 0
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.NotContains(t, err.Error(), label)
+	assert.Equal(t, 1, calls)
+}
+
+func testPGXPresetTxOptions(t *testing.T) {
+	t.Parallel()
+	db, b := newTxBeginnerPool(t)
+	ctx := context.Background()
+
+	opts := pgx.TxOptions{IsoLevel: pgx.Serializable}
+	tr, err := dbtools.New(db,
+		dbtools.WithPreset("serializable", dbtools.TxOptions(opts)),
+	)
+	require.NoError(t, err)
+	p, err := tr.Preset("serializable")
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	b.On("BeginTx", mock.Anything, opts).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = p.Transaction(ctx, func(pgx.Tx) error { return nil })
+	assert.NoError(t, err)
+}
+
+func testPGXPresetNoTxBeginner(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tr, err := dbtools.New(mocks.NewPool(t),
+		dbtools.Retry(10, time.Millisecond),
+		dbtools.TxOptions(pgx.TxOptions{AccessMode: pgx.ReadOnly}),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	assert.ErrorIs(t, err, dbtools.ErrNoTxBeginner)
+}
+
+func TestPGXWith(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	label := randomString(10)
+	tr, err := dbtools.New(db, dbtools.Label(label))
+	require.NoError(t, err)
+	p, err := tr.With(dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(4)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(4)
+
+	calls := 0
+	err = p.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), label, "the copy should keep the configuration")
+	assert.Equal(t, 3, calls)
+
+	// The original object is not affected.
+	calls = 0
+	err = tr.Transaction(ctx, func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, calls)
+}
+
+func TestPGXStrictConfig(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(mocks.NewPool(t),
+		dbtools.StrictConfig(),
+		dbtools.WithPreset("broken", dbtools.GracePeriod(-time.Second)),
+	)
+	require.NoError(t, err)
+
+	_, err = tr.Preset("broken")
+	assert.ErrorIs(t, err, dbtools.ErrInvalidGracePeriod)
+	_, err = tr.With(dbtools.Retry(0, time.Second))
+	assert.ErrorIs(t, err, dbtools.ErrInvalidAttempts)
+	_, err = tr.With(dbtools.Retry(2, time.Second))
+	assert.NoError(t, err)
+}
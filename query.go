@@ -0,0 +1,141 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// querier returns the pool as a Querier, or an ErrNoQuerier error if the pool
+// does not support running queries.
+func (p *PGX) querier() (Querier, error) {
+	if p.pool == nil {
+		return nil, ErrEmptyDatabase
+	}
+	q, ok := p.pool.(Querier)
+	if !ok {
+		return nil, ErrNoQuerier
+	}
+
+	return q, nil
+}
+
+// Exec runs the query without a transaction and retries it with the same
+// policy as the Transaction method until it succeeds. The pool should
+// implement the Querier interface, otherwise an ErrNoQuerier error is
+// returned.
+func (p *PGX) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	q, err := p.querier()
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	p.capture(sql)
+	p.audit(sql)
+
+	var tag pgconn.CommandTag
+	start := time.Now()
+	attempts := 0
+	loop := p.retryPolicy(ctx, KindExec)
+	err = p.do(ctx, loop, p.observed(&attempts, p.budgeted(loop, func() error {
+		var err error
+		tag, err = q.Exec(ctx, sql, args...)
+		if err != nil {
+			return p.classify(fmt.Errorf("executing query: %w", err))
+		}
+
+		return nil
+	})))
+	if err != nil {
+		return pgconn.CommandTag{}, p.endQuery(ctx, KindExec, start, attempts, err)
+	}
+
+	return tag, p.endQuery(ctx, KindExec, start, attempts, nil)
+}
+
+// Query runs the query without a transaction and calls the scan function for
+// each row. If the query, the scan function, or reading the rows returns an
+// error, the rows are closed and the whole query is retried with the same
+// policy as the Transaction method. Therefore the scan function should reset
+// any results collected in previous attempts when the query is retried. The
+// pool should implement the Querier interface, otherwise an ErrNoQuerier error
+// is returned. It returns an ErrResultTooLarge error if the rows exceed the
+// MaxResultRows or MaxResultBytes limits.
+func (p *PGX) Query(ctx context.Context, scan func(pgx.Rows) error, sql string, args ...any) error {
+	q, err := p.querier()
+	if err != nil {
+		return err
+	}
+	p.capture(sql)
+	p.audit(sql)
+
+	limit := p.resultLimit(ctx)
+
+	start := time.Now()
+	attempts := 0
+	loop := p.retryPolicy(ctx, KindQuery)
+	err = p.do(ctx, loop, p.observed(&attempts, p.budgeted(loop, func() error {
+		rows, err := q.Query(ctx, sql, args...)
+		if err != nil {
+			return p.classify(fmt.Errorf("making query: %w", err))
+		}
+		defer rows.Close()
+
+		counter := resultCounter{
+			limit:   limit,
+			measure: p.soft != nil && p.soft.limits.ResultBytes > 0,
+		}
+		defer p.warnResult(sql, &counter)
+		for rows.Next() {
+			if err := counter.add(rows); err != nil {
+				return err
+			}
+			if err := scan(rows); err != nil {
+				return p.classify(err)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return p.classify(fmt.Errorf("reading rows: %w", err))
+		}
+
+		return nil
+	})))
+
+	return p.endQuery(ctx, KindQuery, start, attempts, err)
+}
+
+// QueryRow runs the query without a transaction and passes the row to the
+// scan function. If the scan function returns an error the query is retried
+// with the same policy as the Transaction method. The pool should implement
+// the Querier interface, otherwise an ErrNoQuerier error is returned.
+func (p *PGX) QueryRow(ctx context.Context, scan func(pgx.Row) error, sql string, args ...any) error {
+	q, err := p.querier()
+	if err != nil {
+		return err
+	}
+	p.capture(sql)
+	p.audit(sql)
+
+	start := time.Now()
+	attempts := 0
+	loop := p.retryPolicy(ctx, KindQuery)
+	err = p.do(ctx, loop, p.observed(&attempts, p.budgeted(loop, func() error {
+		return p.classify(scan(q.QueryRow(ctx, sql, args...)))
+	})))
+
+	return p.endQuery(ctx, KindQuery, start, attempts, err)
+}
+
+// endQuery reports the query that was started at the start time to the
+// metrics the same way as the transactions, and adds the label to the err.
+func (p *PGX) endQuery(ctx context.Context, kind OpKind, start time.Time, attempts int, err error) error {
+	err = withCause(ctx, err)
+	p.observeTransaction(start, err, attempts)
+	if err != nil && p.label != "" {
+		err = fmt.Errorf("query %q: %w", p.label, err)
+	}
+
+	return p.endCall(kind, start, attempts, err)
+}
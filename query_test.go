@@ -0,0 +1,192 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXQueries(t *testing.T) {
+	t.Parallel()
+	t.Run("NoQuerier", testPGXQueriesNoQuerier)
+	t.Run("Exec", testPGXQueriesExec)
+	t.Run("Query", testPGXQueriesQuery)
+	t.Run("QueryRow", testPGXQueriesQueryRow)
+}
+
+func testPGXQueriesNoQuerier(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tr, err := dbtools.New(mocks.NewPool(t))
+	require.NoError(t, err)
+
+	_, err = tr.Exec(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, dbtools.ErrNoQuerier)
+	err = tr.Query(ctx, func(pgx.Rows) error { return nil }, "SELECT 1")
+	assert.ErrorIs(t, err, dbtools.ErrNoQuerier)
+	err = tr.QueryRow(ctx, func(pgx.Row) error { return nil }, "SELECT 1")
+	assert.ErrorIs(t, err, dbtools.ErrNoQuerier)
+
+	tr = &dbtools.PGX{}
+	_, err = tr.Exec(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func testPGXQueriesExec(t *testing.T) {
+	t.Parallel()
+	t.Run("Error", testPGXQueriesExecError)
+	t.Run("RetrySuccess", testPGXQueriesExecRetrySuccess)
+}
+
+func testPGXQueriesExecError(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	ctx := context.Background()
+
+	total := 3
+	tr, err := dbtools.New(db, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+
+	q.On("Exec", mock.Anything, "DELETE FROM foo WHERE id = $1", 1).
+		Return(pgconn.CommandTag{}, assert.AnError).Times(total)
+
+	_, err = tr.Exec(ctx, "DELETE FROM foo WHERE id = $1", 1)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testPGXQueriesExecRetrySuccess(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Millisecond))
+	require.NoError(t, err)
+
+	q.On("Exec", mock.Anything, "DELETE FROM foo").
+		Return(pgconn.CommandTag{}, assert.AnError).Twice()
+	q.On("Exec", mock.Anything, "DELETE FROM foo").
+		Return(pgconn.NewCommandTag("DELETE 3"), nil).Once()
+
+	tag, err := tr.Exec(ctx, "DELETE FROM foo")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, tag.RowsAffected())
+}
+
+func testPGXQueriesQuery(t *testing.T) {
+	t.Parallel()
+	t.Run("QueryError", testPGXQueriesQueryQueryError)
+	t.Run("ScanError", testPGXQueriesQueryScanError)
+	t.Run("RowsError", testPGXQueriesQueryRowsError)
+	t.Run("Success", testPGXQueriesQuerySuccess)
+}
+
+func testPGXQueriesQueryQueryError(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	ctx := context.Background()
+
+	total := 3
+	tr, err := dbtools.New(db, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+
+	q.On("Query", mock.Anything, "SELECT 1").
+		Return(nil, assert.AnError).Times(total)
+
+	err = tr.Query(ctx, func(pgx.Rows) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	}, "SELECT 1")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testPGXQueriesQueryScanError(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Millisecond))
+	require.NoError(t, err)
+
+	rows := mocks.NewPGXRows(t)
+	q.On("Query", mock.Anything, "SELECT 1").Return(rows, nil).Once()
+	rows.On("Next").Return(true).Once()
+	rows.On("Close").Return().Once()
+
+	err = tr.Query(ctx, func(pgx.Rows) error {
+		return &retry.StopError{Err: assert.AnError}
+	}, "SELECT 1")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testPGXQueriesQueryRowsError(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	ctx := context.Background()
+
+	total := 2
+	tr, err := dbtools.New(db, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+
+	rows := mocks.NewPGXRows(t)
+	q.On("Query", mock.Anything, "SELECT 1").Return(rows, nil).Times(total)
+	rows.On("Next").Return(false).Times(total)
+	rows.On("Err").Return(assert.AnError).Times(total)
+	rows.On("Close").Return().Times(total)
+
+	err = tr.Query(ctx, func(pgx.Rows) error { return nil }, "SELECT 1")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testPGXQueriesQuerySuccess(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	rows := mocks.NewPGXRows(t)
+	q.On("Query", mock.Anything, "SELECT id FROM foo WHERE bar = $1", "baz").
+		Return(rows, nil).Once()
+	rows.On("Next").Return(true).Times(3)
+	rows.On("Next").Return(false).Once()
+	rows.On("Err").Return(nil).Once()
+	rows.On("Close").Return().Once()
+
+	calls := 0
+	err = tr.Query(ctx, func(pgx.Rows) error {
+		calls++
+		return nil
+	}, "SELECT id FROM foo WHERE bar = $1", "baz")
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func testPGXQueriesQueryRow(t *testing.T) {
+	t.Parallel()
+	db, q := newQuerierPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Millisecond))
+	require.NoError(t, err)
+
+	row := mocks.NewPGXRow(t)
+	q.On("QueryRow", mock.Anything, "SELECT 1").Return(row).Twice()
+	row.On("Scan", mock.Anything).Return(assert.AnError).Once()
+	row.On("Scan", mock.Anything).Return(nil).Once()
+
+	var got int
+	err = tr.QueryRow(ctx, func(r pgx.Row) error {
+		return r.Scan(&got)
+	}, "SELECT 1")
+	assert.NoError(t, err)
+}
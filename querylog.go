@@ -0,0 +1,170 @@
+package dbtools
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Redacted replaces the values of the arguments that are redacted.
+const Redacted = "[REDACTED]"
+
+// Redactor returns the value of the argument at the index of the sql that is
+// written to the log. It can return the Redacted constant, or a masked value,
+// for the arguments that contain personal data.
+type Redactor func(sql string, index int, arg any) any
+
+// RedactAll redacts all the arguments.
+func RedactAll(string, int, any) any { return Redacted }
+
+// RedactStrings redacts the string and []byte arguments, which usually hold
+// the personal data, and keeps the other types, for example the ids.
+func RedactStrings(_ string, _ int, arg any) any {
+	switch arg.(type) {
+	case string, []byte, *string:
+		return Redacted
+	default:
+		return arg
+	}
+}
+
+// QueryLoggerOption configures a QueryLogger.
+type QueryLoggerOption func(*QueryLogger)
+
+// LogArgs logs the arguments of the statements after passing each one to the
+// redact function. A nil function logs the arguments as they are. The
+// arguments are not logged by default.
+func LogArgs(redact Redactor) QueryLoggerOption {
+	return func(q *QueryLogger) {
+		q.logArgs = true
+		q.redact = redact
+	}
+}
+
+// LogSlowerThan only logs the statements that take longer than the d, and the
+// statements that fail.
+func LogSlowerThan(d time.Duration) QueryLoggerOption {
+	return func(q *QueryLogger) {
+		q.minDuration = d
+	}
+}
+
+// LogLevel sets the level of the successful statements. The default level is
+// slog.LevelDebug. The failed statements are logged at slog.LevelWarn or the
+// level, whichever is higher.
+func LogLevel(level slog.Level) QueryLoggerOption {
+	return func(q *QueryLogger) {
+		q.level = level
+	}
+}
+
+// QueryLogger is a pgx.QueryTracer that logs the statements with their
+// duration and the number of the affected rows. Pass it to the TraceQueries
+// option, so the logs have the label, the id and the attempt of the
+// transaction:
+//
+//	p, err := dbtools.New(pool, dbtools.TraceQueries(
+//		dbtools.NewQueryLogger(logger, dbtools.LogArgs(dbtools.RedactStrings)),
+//	))
+//
+// The SQL is logged as it is, therefore the personal data should be passed as
+// arguments. It is safe for concurrent use.
+type QueryLogger struct {
+	logger      *slog.Logger
+	level       slog.Level
+	logArgs     bool
+	redact      Redactor
+	minDuration time.Duration
+}
+
+// NewQueryLogger returns a QueryLogger that writes to the logger. It uses the
+// slog.Default logger if the logger is nil.
+func NewQueryLogger(logger *slog.Logger, opts ...QueryLoggerOption) *QueryLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	q := &QueryLogger{
+		logger: logger,
+		level:  slog.LevelDebug,
+	}
+	for _, fn := range opts {
+		fn(q)
+	}
+
+	return q
+}
+
+type queryLogKey struct{}
+
+// queryLogStart is the state of a statement between the start and the end
+// of the trace.
+type queryLogStart struct {
+	start time.Time
+	sql   string
+	args  []any
+}
+
+// TraceQueryStart records the start of the statement in the returned
+// context.
+func (q *QueryLogger) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryLogKey{}, queryLogStart{
+		start: time.Now(),
+		sql:   data.SQL,
+		args:  data.Args,
+	})
+}
+
+// TraceQueryEnd logs the statement.
+func (q *QueryLogger) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	s, ok := ctx.Value(queryLogKey{}).(queryLogStart)
+	if !ok {
+		return
+	}
+	duration := time.Since(s.start)
+	if data.Err == nil && duration < q.minDuration {
+		return
+	}
+	level := q.level
+	if data.Err != nil {
+		level = max(level, slog.LevelWarn)
+	}
+	if !q.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("sql", s.sql),
+		slog.Duration("duration", duration),
+		slog.Int64("rows", data.CommandTag.RowsAffected()),
+	}
+	if q.logArgs {
+		attrs = append(attrs, slog.Any("args", q.args(s.sql, s.args)))
+	}
+	if info, ok := TxInfoFromContext(ctx); ok {
+		if info.Label != "" {
+			attrs = append(attrs, slog.String("label", info.Label))
+		}
+		attrs = append(attrs,
+			slog.Uint64("tx", info.ID),
+			slog.Int("attempt", info.Attempt),
+		)
+	}
+	if data.Err != nil {
+		attrs = append(attrs, slog.String("error", data.Err.Error()))
+	}
+	q.logger.LogAttrs(ctx, level, "query", attrs...)
+}
+
+func (q *QueryLogger) args(sql string, args []any) []any {
+	ret := make([]any, len(args))
+	for i, arg := range args {
+		if q.redact != nil {
+			arg = q.redact(sql, i, arg)
+		}
+		ret[i] = arg
+	}
+
+	return ret
+}
@@ -0,0 +1,184 @@
+package dbtools_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// entries returns the decoded JSON log entries.
+func (b *syncBuffer) entries(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ret []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		ret = append(ret, entry)
+	}
+	return ret
+}
+
+// logQueries runs the fn in a transaction with a QueryLogger, and returns the
+// log entries.
+func logQueries(t *testing.T, sim *dbtesting.Simulator, fn func(ctx context.Context, tx pgx.Tx) error, opts ...dbtools.QueryLoggerOption) []map[string]any {
+	t.Helper()
+	buf := &syncBuffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	tr, err := dbtools.New(sim,
+		dbtools.TraceQueries(dbtools.NewQueryLogger(logger, opts...)),
+		dbtools.Label("users"),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_ = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		return fn(ctx, tx)
+	})
+
+	return buf.entries(t)
+}
+
+func TestQueryLogger(t *testing.T) {
+	t.Parallel()
+	t.Run("Fields", testQueryLoggerFields)
+	t.Run("Args", testQueryLoggerArgs)
+	t.Run("Error", testQueryLoggerError)
+	t.Run("SlowerThan", testQueryLoggerSlowerThan)
+	t.Run("Level", testQueryLoggerLevel)
+	t.Run("Redactors", testQueryLoggerRedactors)
+}
+
+func testQueryLoggerFields(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^UPDATE").Exec("UPDATE 3")
+	entries := logQueries(t, sim, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET name = $1", "alice")
+		return err
+	})
+
+	require.Len(t, entries, 1)
+	e := entries[0]
+	assert.Equal(t, "query", e["msg"])
+	assert.Equal(t, "DEBUG", e["level"])
+	assert.Equal(t, "UPDATE users SET name = $1", e["sql"])
+	assert.EqualValues(t, 3, e["rows"])
+	assert.Equal(t, "users", e["label"])
+	assert.EqualValues(t, 1, e["attempt"])
+	assert.NotZero(t, e["tx"])
+	assert.Contains(t, e, "duration")
+	assert.NotContains(t, e, "args")
+	assert.NotContains(t, e, "error")
+}
+
+func testQueryLoggerArgs(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^UPDATE").Exec("UPDATE 1")
+	run := func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET email = $1 WHERE id = $2", "a@example.com", 42)
+		return err
+	}
+
+	entries := logQueries(t, sim, run, dbtools.LogArgs(nil))
+	require.Len(t, entries, 1)
+	assert.Equal(t, []any{"a@example.com", 42.0}, entries[0]["args"])
+
+	entries = logQueries(t, sim, run, dbtools.LogArgs(dbtools.RedactStrings))
+	require.Len(t, entries, 1)
+	assert.Equal(t, []any{dbtools.Redacted, 42.0}, entries[0]["args"])
+
+	entries = logQueries(t, sim, run, dbtools.LogArgs(func(sql string, i int, arg any) any {
+		assert.Contains(t, sql, "UPDATE users")
+		if i == 0 {
+			return "a***"
+		}
+		return arg
+	}))
+	require.Len(t, entries, 1)
+	assert.Equal(t, []any{"a***", 42.0}, entries[0]["args"])
+}
+
+func testQueryLoggerError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^UPDATE").Error(assert.AnError)
+	entries := logQueries(t, sim, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET name = 'a'")
+		return err
+	}, dbtools.LogSlowerThan(time.Hour))
+
+	require.NotEmpty(t, entries)
+	assert.Equal(t, "WARN", entries[0]["level"])
+	assert.Equal(t, assert.AnError.Error(), entries[0]["error"])
+}
+
+func testQueryLoggerSlowerThan(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^UPDATE").Exec("UPDATE 1")
+	entries := logQueries(t, sim, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET name = 'a'")
+		return err
+	}, dbtools.LogSlowerThan(time.Hour))
+	assert.Empty(t, entries)
+}
+
+func testQueryLoggerLevel(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^UPDATE").Exec("UPDATE 1")
+	entries := logQueries(t, sim, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET name = 'a'")
+		return err
+	}, dbtools.LogLevel(slog.LevelInfo))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "INFO", entries[0]["level"])
+
+	buf := &syncBuffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	q := dbtools.NewQueryLogger(logger)
+	ctx := q.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	q.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	q.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{})
+	assert.Empty(t, buf.entries(t))
+}
+
+func testQueryLoggerRedactors(t *testing.T) {
+	t.Parallel()
+	name := "alice"
+	assert.Equal(t, dbtools.Redacted, dbtools.RedactAll("", 0, 42))
+	assert.Equal(t, dbtools.Redacted, dbtools.RedactStrings("", 0, "alice"))
+	assert.Equal(t, dbtools.Redacted, dbtools.RedactStrings("", 0, []byte("alice")))
+	assert.Equal(t, dbtools.Redacted, dbtools.RedactStrings("", 0, &name))
+	assert.Equal(t, 42, dbtools.RedactStrings("", 0, 42))
+	assert.Nil(t, dbtools.RedactStrings("", 0, nil))
+}
@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/jackc/pgx/v5"
+)
+
+// Stats is the state of a queue. The jobs that are being handled are counted
+// as ready, because they are only locked until they are handled.
+type Stats struct {
+	Queue string
+	// Ready is the number of the jobs that can be claimed.
+	Ready int64
+	// Dead is the number of the jobs in the dead-letter state.
+	Dead int64
+	// OldestReady is the age of the oldest ready job. It is zero if there are
+	// no ready jobs.
+	OldestReady time.Duration
+}
+
+// DeadJob is a job in the dead-letter state.
+type DeadJob struct {
+	Job
+	DiedAt time.Time
+}
+
+// Inspect returns the Stats of the queue. The query is run with the query
+// helpers of the tr, therefore its pool should implement the
+// dbtools.Querier interface. The same applies to the Requeue function.
+func Inspect(ctx context.Context, tr *dbtools.PGX, queue string) (Stats, error) {
+	if tr == nil {
+		return Stats{}, dbtools.ErrEmptyDatabase
+	}
+	if queue == "" {
+		return Stats{}, ErrEmptyQueue
+	}
+	const query = `SELECT
+	count(*) FILTER (WHERE dead_at IS NULL),
+	count(*) FILTER (WHERE dead_at IS NOT NULL),
+	coalesce(extract(epoch FROM now() - min(created_at) FILTER (WHERE dead_at IS NULL)), 0)::float8
+	FROM ` + DefaultTable + ` WHERE queue = $1`
+	stats := Stats{Queue: queue}
+	err := tr.QueryRow(ctx, func(row pgx.Row) error {
+		var age float64
+		if err := row.Scan(&stats.Ready, &stats.Dead, &age); err != nil {
+			return err
+		}
+		stats.OldestReady = time.Duration(age * float64(time.Second))
+		return nil
+	}, query, queue)
+	if err != nil {
+		return Stats{}, fmt.Errorf("inspecting queue %q: %w", queue, err)
+	}
+
+	return stats, nil
+}
+
+// DeadJobs returns up to the limit of the dead jobs of the queue, with the
+// most recently died ones first. The jobs are read in a transaction of the tr.
+func DeadJobs(ctx context.Context, tr *dbtools.PGX, queue string, limit int) ([]DeadJob, error) {
+	if tr == nil {
+		return nil, dbtools.ErrEmptyDatabase
+	}
+	if queue == "" {
+		return nil, ErrEmptyQueue
+	}
+	const query = `SELECT ` + jobColumns + `, dead_at FROM ` + DefaultTable + `
+	WHERE queue = $1 AND dead_at IS NOT NULL
+	ORDER BY dead_at DESC, id
+	LIMIT $2`
+	var jobs []DeadJob
+	err := tr.Transaction(ctx, func(tx pgx.Tx) error {
+		jobs = nil
+		rows, err := tx.Query(ctx, query, queue, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			job := DeadJob{Job: Job{Queue: queue}}
+			err := rows.Scan(&job.ID, &job.Priority, &job.Payload, &job.Attempts,
+				&job.LastError, &job.CreatedAt, &job.DiedAt)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing dead jobs of %q: %w", queue, err)
+	}
+
+	return jobs, nil
+}
+
+// Requeue moves the dead jobs of the queue with the ids back to the queue,
+// and resets their attempts. If no ids are given, all the dead jobs of the
+// queue are requeued. It returns the number of the requeued jobs.
+func Requeue(ctx context.Context, tr *dbtools.PGX, queue string, ids ...int64) (int64, error) {
+	if tr == nil {
+		return 0, dbtools.ErrEmptyDatabase
+	}
+	if queue == "" {
+		return 0, ErrEmptyQueue
+	}
+	const query = `UPDATE ` + DefaultTable + ` SET attempts = 0, dead_at = NULL
+	WHERE queue = $1 AND dead_at IS NOT NULL AND ($2::BIGINT[] IS NULL OR id = ANY($2))`
+	if len(ids) == 0 {
+		ids = nil
+	}
+	tag, err := tr.Exec(ctx, query, queue, ids)
+	if err != nil {
+		return 0, fmt.Errorf("requeueing jobs of %q: %w", queue, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,240 @@
+package queue_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/queue"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+	t.Run("Validation", testInspectValidation)
+	t.Run("Success", testInspectSuccess)
+	t.Run("Error", testInspectError)
+}
+
+func testInspectValidation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, err := queue.Inspect(ctx, nil, "emails")
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+	_, err = queue.Inspect(ctx, tr, "")
+	assert.ErrorIs(t, err, queue.ErrEmptyQueue)
+}
+
+func testInspectSuccess(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`count\(\*\)`).Return([]string{"ready", "dead", "age"}, []any{12, 3, 1.5})
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	stats, err := queue.Inspect(context.Background(), tr, "emails")
+	require.NoError(t, err)
+	assert.Equal(t, queue.Stats{
+		Queue:       "emails",
+		Ready:       12,
+		Dead:        3,
+		OldestReady: 1500 * time.Millisecond,
+	}, stats)
+	assert.Equal(t, []any{"emails"}, sim.Statements()[0].Args)
+}
+
+func testInspectError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`.`).Error(assert.AnError)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	_, err = queue.Inspect(context.Background(), tr, "emails")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestDeadJobs(t *testing.T) {
+	t.Parallel()
+	t.Run("Success", testDeadJobsSuccess)
+	t.Run("Error", testDeadJobsError)
+}
+
+func testDeadJobsSuccess(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	died := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	created := died.Add(-time.Hour)
+	sim.On(`dead_at IS NOT NULL`).Return(
+		[]string{"id", "priority", "payload", "attempts", "last_error", "created_at", "dead_at"},
+		[]any{int64(2), 10, []byte("a"), 5, "timeout", created, died},
+		[]any{int64(1), 0, []byte("b"), 5, "refused", created, died.Add(-time.Minute)},
+	)
+	sim.On(`.`)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	jobs, err := queue.DeadJobs(context.Background(), tr, "emails", 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, queue.DeadJob{
+		Job: queue.Job{
+			ID:        2,
+			Queue:     "emails",
+			Priority:  10,
+			Payload:   []byte("a"),
+			Attempts:  5,
+			LastError: "timeout",
+			CreatedAt: created,
+		},
+		DiedAt: died,
+	}, jobs[0])
+	assert.EqualValues(t, 1, jobs[1].ID)
+}
+
+func testDeadJobsError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, err := queue.DeadJobs(ctx, nil, "emails", 10)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+
+	sim := dbtesting.NewSimulator()
+	sim.On(`dead_at`).Error(assert.AnError)
+	sim.On(`.`)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	_, err = queue.DeadJobs(ctx, tr, "", 10)
+	assert.ErrorIs(t, err, queue.ErrEmptyQueue)
+	_, err = queue.DeadJobs(ctx, tr, "emails", 10)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestRequeue(t *testing.T) {
+	t.Parallel()
+	t.Run("IDs", testRequeueIDs)
+	t.Run("All", testRequeueAll)
+	t.Run("Error", testRequeueError)
+}
+
+func testRequeueIDs(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`UPDATE dbtools_jobs`).Exec("UPDATE 2")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	n, err := queue.Requeue(context.Background(), tr, "emails", 1, 2)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+	assert.Equal(t, []any{"emails", []int64{1, 2}}, sim.Statements()[0].Args)
+}
+
+func testRequeueAll(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`UPDATE dbtools_jobs`).Exec("UPDATE 7")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	n, err := queue.Requeue(context.Background(), tr, "emails")
+	require.NoError(t, err)
+	assert.EqualValues(t, 7, n)
+	assert.Equal(t, []any{"emails", []int64(nil)}, sim.Statements()[0].Args)
+}
+
+func testRequeueError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, err := queue.Requeue(ctx, nil, "emails")
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+
+	sim := dbtesting.NewSimulator()
+	sim.On(`.`).Error(assert.AnError)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	_, err = queue.Requeue(ctx, tr, "")
+	assert.ErrorIs(t, err, queue.ErrEmptyQueue)
+	_, err = queue.Requeue(ctx, tr, "emails")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+type statsRecorder struct {
+	mu    sync.Mutex
+	stats []queue.Stats
+}
+
+func (s *statsRecorder) ObserveAttempt(string, string, time.Duration)          {}
+func (s *statsRecorder) ObserveTransaction(string, string, int, time.Duration) {}
+
+func (s *statsRecorder) ObserveQueue(name string, ready, dead int64, oldestReady time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = append(s.stats, queue.Stats{Queue: name, Ready: ready, Dead: dead, OldestReady: oldestReady})
+}
+
+func (s *statsRecorder) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.stats)
+}
+
+func TestReportStats(t *testing.T) {
+	t.Parallel()
+	t.Run("Report", testReportStatsReport)
+	t.Run("NoQueueMetrics", testReportStatsNoQueueMetrics)
+}
+
+func testReportStatsReport(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`count\(\*\)`).Return([]string{"ready", "dead", "age"}, []any{1, 0, 0.0})
+	sim.On(`.`)
+	rec := &statsRecorder{}
+	tr, err := dbtools.New(sim, dbtools.WithMetrics(rec))
+	require.NoError(t, err)
+
+	w, err := queue.NewWorker(tr, "emails", func(context.Context, pgx.Tx, queue.Job) error {
+		return nil
+	}, queue.ReportStats(time.Millisecond), queue.PollInterval(time.Hour))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		return rec.len() >= 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, queue.Stats{Queue: "emails", Ready: 1}, rec.stats[0])
+}
+
+// attemptMetrics doesn't implement the dbtools.QueueMetrics interface.
+type attemptMetrics struct{}
+
+func (attemptMetrics) ObserveAttempt(string, string, time.Duration)          {}
+func (attemptMetrics) ObserveTransaction(string, string, int, time.Duration) {}
+
+func testReportStatsNoQueueMetrics(t *testing.T) {
+	t.Parallel()
+	handler := func(context.Context, pgx.Tx, queue.Job) error { return nil }
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+	_, err = queue.NewWorker(tr, "emails", handler, queue.ReportStats(time.Second))
+	assert.ErrorIs(t, err, queue.ErrNoQueueMetrics)
+
+	tr, err = dbtools.New(dbtesting.NewSimulator(), dbtools.WithMetrics(attemptMetrics{}))
+	require.NoError(t, err)
+	_, err = queue.NewWorker(tr, "emails", handler, queue.ReportStats(time.Second))
+	assert.ErrorIs(t, err, queue.ErrNoQueueMetrics)
+}
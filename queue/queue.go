@@ -0,0 +1,497 @@
+// Package queue implements a job queue on a PostgreSQL table. Jobs are
+// claimed with FOR UPDATE SKIP LOCKED, therefore any number of workers can
+// consume the same queue. Jobs have priorities, and the workers can share
+// their time between the priority lanes with weights, so the urgent and the
+// background jobs can live in the same table without starving each other.
+// Jobs that fail too many times are moved to the dead-letter state, where
+// they can be inspected and requeued.
+package queue
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTable is the name of the jobs table.
+const DefaultTable = "dbtools_jobs"
+
+// Schema creates the jobs table. Run it in your migrations.
+const Schema = `CREATE TABLE IF NOT EXISTS ` + DefaultTable + ` (
+	id         BIGSERIAL PRIMARY KEY,
+	queue      TEXT NOT NULL,
+	priority   INT NOT NULL DEFAULT 0,
+	payload    BYTEA NOT NULL,
+	attempts   INT NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	dead_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS ` + DefaultTable + `_claim_idx
+	ON ` + DefaultTable + ` (queue, priority, id) WHERE dead_at IS NULL;
+CREATE INDEX IF NOT EXISTS ` + DefaultTable + `_dead_idx
+	ON ` + DefaultTable + ` (queue, dead_at) WHERE dead_at IS NOT NULL;`
+
+var (
+	// ErrNilHandler is returned when creating a Worker without a handler.
+	ErrNilHandler = errors.New("nil handler")
+
+	// ErrEmptyQueue is returned when the queue name is empty.
+	ErrEmptyQueue = errors.New("empty queue name")
+
+	// ErrNoQueueMetrics is returned when creating a Worker with the
+	// ReportStats option, if the Metrics of the PGX doesn't implement the
+	// dbtools.QueueMetrics interface.
+	ErrNoQueueMetrics = errors.New("metrics do not support queues")
+
+	// ErrNoLanes is returned when creating a Worker with the Lanes option
+	// that has no weights of at least 1.
+	ErrNoLanes = errors.New("no lanes with positive weights")
+)
+
+// Job is a job stored in the queue.
+type Job struct {
+	ID       int64
+	Queue    string
+	Priority int
+	Payload  []byte
+	// Attempts is the number of the failed attempts of handling the job.
+	Attempts int
+	// LastError is the error of the last failed attempt.
+	LastError string
+	CreatedAt time.Time
+}
+
+// Enqueue writes the job to the queue in the tx. The job is only visible to
+// the workers if the tx is committed. Jobs with higher priorities are claimed
+// first, unless the worker is configured with the Lanes option.
+func Enqueue(ctx context.Context, tx pgx.Tx, queue string, priority int, payload []byte) error {
+	if queue == "" {
+		return ErrEmptyQueue
+	}
+	const query = `INSERT INTO ` + DefaultTable + ` (queue, priority, payload) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, query, queue, priority, payload); err != nil {
+		return fmt.Errorf("enqueueing job: %w", err)
+	}
+
+	return nil
+}
+
+// Handler handles the job inside the tx that has claimed it. The job is
+// removed from the queue when the tx is committed, therefore the changes made
+// by the handler in the tx are committed with the removal of the job. The
+// handler runs in a savepoint. If it returns an error or panics, its changes
+// are rolled back, the failure is recorded on the job, and the job is claimed
+// again later or moved to the dead-letter state.
+type Handler func(ctx context.Context, tx pgx.Tx, job Job) error
+
+// ConfigFunc is used for configuring the Worker.
+type ConfigFunc func(*Worker)
+
+// Lanes sets the weights of the priority lanes the worker claims jobs from.
+// On each claim a lane is picked with a smooth weighted round-robin, so a
+// lane with the weight of 3 is picked three times as often as a lane with the
+// weight of 1. If the picked lane is empty, the rest of the lanes are tried
+// in descending order of their priorities. Jobs with priorities that are not
+// in the weights are not claimed by the worker, and lanes with weights less
+// than 1 are ignored. The NewWorker function returns an ErrNoLanes error if
+// none of the weights is at least 1. By default the worker claims the jobs with the highest
+// priority first, which can starve the jobs with lower priorities.
+func Lanes(weights map[int]int) ConfigFunc {
+	return func(w *Worker) {
+		w.lanes = newScheduler(weights)
+	}
+}
+
+// Workers sets the number of goroutines that claim and handle the jobs in the
+// Run method. The default value is 1.
+func Workers(n int) ConfigFunc {
+	return func(w *Worker) {
+		w.workers = n
+	}
+}
+
+// MaxConcurrency limits the number of jobs of the queue that are handled at
+// the same time by all workers, including the workers in other processes.
+// The workers share n slots of transaction level advisory locks, and a claim
+// is skipped if all slots are taken. All workers of the queue should use the
+// same value. The default value is 0, which means there is no limit.
+func MaxConcurrency(n int) ConfigFunc {
+	return func(w *Worker) {
+		w.maxConcurrency = n
+	}
+}
+
+// MaxAttempts sets the number of the failed attempts after which the job is
+// moved to the dead-letter state. The dead jobs are not claimed until they
+// are requeued with the Requeue function. The default value is 0, which means
+// the jobs are retried forever.
+func MaxAttempts(n int) ConfigFunc {
+	return func(w *Worker) {
+		w.maxAttempts = n
+	}
+}
+
+// ReportStats reports the Stats of the queue on each interval while the Run
+// method is running, to the Metrics that is set on the PGX with the
+// dbtools.WithMetrics option. The Metrics should implement the
+// dbtools.QueueMetrics interface, otherwise the NewWorker function returns an
+// ErrNoQueueMetrics error. The default interval is 1m.
+func ReportStats(interval time.Duration) ConfigFunc {
+	return func(w *Worker) {
+		w.reportStats = true
+		w.statsInterval = interval
+	}
+}
+
+// PollInterval sets the delay between polls when the queue is drained. The
+// default value is 1s.
+func PollInterval(d time.Duration) ConfigFunc {
+	return func(w *Worker) {
+		w.interval = d
+	}
+}
+
+// OnError sets the function that is called when claiming or handling a job
+// fails. The Worker keeps polling anyway.
+func OnError(fn func(error)) ConfigFunc {
+	return func(w *Worker) {
+		w.onError = fn
+	}
+}
+
+// Worker claims the jobs of a queue and handles them.
+type Worker struct {
+	tr             *dbtools.PGX
+	queue          string
+	handler        Handler
+	lanes          *scheduler
+	workers        int
+	maxConcurrency int
+	maxAttempts    int
+	interval       time.Duration
+	reportStats    bool
+	metrics        dbtools.QueueMetrics
+	statsInterval  time.Duration
+	onError        func(error)
+}
+
+// NewWorker returns a Worker that handles the jobs of the queue with the
+// handler. The jobs are claimed and handled in transactions run by the tr.
+func NewWorker(tr *dbtools.PGX, queue string, handler Handler, conf ...ConfigFunc) (*Worker, error) {
+	if tr == nil {
+		return nil, dbtools.ErrEmptyDatabase
+	}
+	if queue == "" {
+		return nil, ErrEmptyQueue
+	}
+	if handler == nil {
+		return nil, ErrNilHandler
+	}
+	w := &Worker{
+		tr:       tr,
+		queue:    queue,
+		handler:  handler,
+		workers:  1,
+		interval: time.Second,
+	}
+	for _, fn := range conf {
+		fn(w)
+	}
+	if w.lanes != nil && len(w.lanes.lanes) == 0 {
+		return nil, ErrNoLanes
+	}
+	if w.reportStats {
+		m, ok := tr.Metrics().(dbtools.QueueMetrics)
+		if !ok {
+			return nil, ErrNoQueueMetrics
+		}
+		w.metrics = m
+	}
+	if w.workers < 1 {
+		w.workers = 1
+	}
+	if w.statsInterval <= 0 {
+		w.statsInterval = time.Minute
+	}
+
+	return w, nil
+}
+
+// Run handles the jobs until the ctx is cancelled, and returns the error of
+// the ctx after all goroutines are stopped.
+func (w *Worker) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range w.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.poll(ctx)
+		}()
+	}
+	if w.metrics != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.report(ctx)
+		}()
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func (w *Worker) poll(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		ok, err := w.ClaimOnce(ctx)
+		if err != nil && ctx.Err() == nil && w.onError != nil {
+			w.onError(err)
+		}
+		if err == nil && ok {
+			// There might be more jobs.
+			timer.Reset(0)
+			continue
+		}
+		timer.Reset(w.interval)
+	}
+}
+
+func (w *Worker) report(ctx context.Context) {
+	ticker := time.NewTicker(w.statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats, err := Inspect(ctx, w.tr, w.queue)
+		if err != nil {
+			if ctx.Err() == nil && w.onError != nil {
+				w.onError(err)
+			}
+			continue
+		}
+		w.metrics.ObserveQueue(stats.Queue, stats.Ready, stats.Dead, stats.OldestReady)
+	}
+}
+
+// ClaimOnce claims one job and handles it. It returns false if there are no
+// jobs to claim, or all the concurrency slots of the queue are taken. If the
+// handler fails, the failure is recorded and the error of the handler is
+// returned.
+func (w *Worker) ClaimOnce(ctx context.Context) (bool, error) {
+	order := w.lanes.order()
+	var claimed bool
+	var handlerErr error
+	err := w.tr.Transaction(ctx, func(tx pgx.Tx) error {
+		claimed, handlerErr = false, nil
+		ok, err := w.acquireSlot(ctx, tx)
+		if err != nil || !ok {
+			return err
+		}
+		job, ok, err := w.claim(ctx, tx, order)
+		if err != nil || !ok {
+			return err
+		}
+		failed, err := w.handle(ctx, tx, job)
+		if err != nil {
+			return err
+		}
+		if failed != nil {
+			handlerErr = fmt.Errorf("handling job %d: %w", job.ID, failed)
+			return w.fail(ctx, tx, job, failed)
+		}
+
+		const query = `DELETE FROM ` + DefaultTable + ` WHERE id = $1`
+		if _, err := tx.Exec(ctx, query, job.ID); err != nil {
+			return fmt.Errorf("removing job %d: %w", job.ID, err)
+		}
+		claimed = true
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return claimed, handlerErr
+}
+
+// handle runs the handler in a savepoint. It returns the error of the
+// handler as failed, and the errors of the savepoint as err.
+func (w *Worker) handle(ctx context.Context, tx pgx.Tx, job Job) (failed, err error) {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating savepoint for job %d: %w", job.ID, err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				failed = fmt.Errorf("handler panicked: %v", r)
+			}
+		}()
+		failed = w.handler(ctx, sp, job)
+	}()
+	if failed != nil {
+		if err := sp.Rollback(ctx); err != nil {
+			return nil, fmt.Errorf("rolling back savepoint of job %d: %w", job.ID, err)
+		}
+		return failed, nil
+	}
+	if err := sp.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("releasing savepoint of job %d: %w", job.ID, err)
+	}
+
+	return nil, nil
+}
+
+// fail records the failed attempt of the job, and moves it to the
+// dead-letter state if it has reached the MaxAttempts.
+func (w *Worker) fail(ctx context.Context, tx pgx.Tx, job Job, failed error) error {
+	const query = `UPDATE ` + DefaultTable + ` SET
+	attempts = attempts + 1,
+	last_error = $2,
+	dead_at = CASE WHEN $3 > 0 AND attempts + 1 >= $3 THEN now() END
+	WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, job.ID, failed.Error(), w.maxAttempts); err != nil {
+		return fmt.Errorf("recording failure of job %d: %w", job.ID, err)
+	}
+
+	return nil
+}
+
+// acquireSlot takes one of the advisory lock slots of the queue if the
+// MaxConcurrency option is set.
+func (w *Worker) acquireSlot(ctx context.Context, tx pgx.Tx) (bool, error) {
+	if w.maxConcurrency < 1 {
+		return true, nil
+	}
+	const query = `SELECT coalesce((
+		SELECT slot FROM generate_series(0, $2 - 1) AS slot
+		WHERE pg_try_advisory_xact_lock(hashtext($1), slot)
+		LIMIT 1
+	), -1)`
+	var slot int
+	if err := tx.QueryRow(ctx, query, w.queue, w.maxConcurrency).Scan(&slot); err != nil {
+		return false, fmt.Errorf("acquiring concurrency slot: %w", err)
+	}
+
+	return slot >= 0, nil
+}
+
+// claim locks and returns a job from the lanes in the order. If the order is
+// empty, the job with the highest priority is claimed.
+func (w *Worker) claim(ctx context.Context, tx pgx.Tx, order []int) (Job, bool, error) {
+	if len(order) == 0 {
+		const query = `SELECT ` + jobColumns + ` FROM ` + DefaultTable + `
+	WHERE queue = $1 AND dead_at IS NULL
+	ORDER BY priority DESC, id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED`
+		return w.scan(tx.QueryRow(ctx, query, w.queue))
+	}
+
+	const query = `SELECT ` + jobColumns + ` FROM ` + DefaultTable + `
+	WHERE queue = $1 AND priority = $2 AND dead_at IS NULL
+	ORDER BY id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED`
+	for _, priority := range order {
+		job, ok, err := w.scan(tx.QueryRow(ctx, query, w.queue, priority))
+		if err != nil || ok {
+			return job, ok, err
+		}
+	}
+
+	return Job{}, false, nil
+}
+
+const jobColumns = `id, priority, payload, attempts, last_error, created_at`
+
+func (w *Worker) scan(row pgx.Row) (Job, bool, error) {
+	job := Job{Queue: w.queue}
+	err := row.Scan(&job.ID, &job.Priority, &job.Payload, &job.Attempts, &job.LastError, &job.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, fmt.Errorf("claiming job: %w", err)
+	}
+
+	return job, true, nil
+}
+
+// scheduler picks the priority lanes with a smooth weighted round-robin.
+type scheduler struct {
+	mu    sync.Mutex
+	lanes []lane
+	total int
+}
+
+type lane struct {
+	priority int
+	weight   int
+	current  int
+}
+
+func newScheduler(weights map[int]int) *scheduler {
+	s := &scheduler{}
+	for priority, weight := range weights {
+		if weight < 1 {
+			continue
+		}
+		s.lanes = append(s.lanes, lane{priority: priority, weight: weight})
+		s.total += weight
+	}
+	slices.SortFunc(s.lanes, func(a, b lane) int {
+		return cmp.Compare(b.priority, a.priority)
+	})
+
+	return s
+}
+
+// order returns the priorities of the lanes with the picked lane first. It
+// returns nil if the scheduler is nil or has no lanes.
+func (s *scheduler) order() []int {
+	if s == nil || len(s.lanes) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	picked := 0
+	for i := range s.lanes {
+		s.lanes[i].current += s.lanes[i].weight
+		if s.lanes[i].current > s.lanes[picked].current {
+			picked = i
+		}
+	}
+	s.lanes[picked].current -= s.total
+
+	ret := make([]int, 0, len(s.lanes))
+	ret = append(ret, s.lanes[picked].priority)
+	for i, l := range s.lanes {
+		if i != picked {
+			ret = append(ret, l.priority)
+		}
+	}
+
+	return ret
+}
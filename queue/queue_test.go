@@ -0,0 +1,391 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/dbtools/v4/queue"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	claimQuery = `SELECT id, priority, payload, attempts, last_error, created_at FROM dbtools_jobs
+	WHERE queue = $1 AND dead_at IS NULL
+	ORDER BY priority DESC, id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED`
+	laneQuery = `SELECT id, priority, payload, attempts, last_error, created_at FROM dbtools_jobs
+	WHERE queue = $1 AND priority = $2 AND dead_at IS NULL
+	ORDER BY id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED`
+	deleteQuery = `DELETE FROM dbtools_jobs WHERE id = $1`
+	failQuery   = `UPDATE dbtools_jobs SET
+	attempts = attempts + 1,
+	last_error = $2,
+	dead_at = CASE WHEN $3 > 0 AND attempts + 1 >= $3 THEN now() END
+	WHERE id = $1`
+)
+
+func TestEnqueue(t *testing.T) {
+	t.Parallel()
+	t.Run("EmptyQueue", testEnqueueEmptyQueue)
+	t.Run("Error", testEnqueueError)
+	t.Run("Success", testEnqueueSuccess)
+}
+
+func testEnqueueEmptyQueue(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	err := queue.Enqueue(context.Background(), tx, "", 0, []byte("{}"))
+	assert.ErrorIs(t, err, queue.ErrEmptyQueue)
+}
+
+func testEnqueueError(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	tx.On("Exec", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(pgconn.CommandTag{}, assert.AnError).Once()
+	err := queue.Enqueue(context.Background(), tx, "emails", 0, []byte("{}"))
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testEnqueueSuccess(t *testing.T) {
+	t.Parallel()
+	tx := mocks.NewPGXTx(t)
+	payload := []byte(`{"id":1}`)
+	tx.On("Exec", mock.Anything,
+		"INSERT INTO dbtools_jobs (queue, priority, payload) VALUES ($1, $2, $3)",
+		"emails", 10, payload,
+	).Return(pgconn.NewCommandTag("INSERT 0 1"), nil).Once()
+	err := queue.Enqueue(context.Background(), tx, "emails", 10, payload)
+	assert.NoError(t, err)
+}
+
+func TestNewWorker(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(mocks.NewPool(t))
+	require.NoError(t, err)
+	handler := func(context.Context, pgx.Tx, queue.Job) error { return nil }
+
+	_, err = queue.NewWorker(nil, "emails", handler)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+	_, err = queue.NewWorker(tr, "", handler)
+	assert.ErrorIs(t, err, queue.ErrEmptyQueue)
+	_, err = queue.NewWorker(tr, "emails", nil)
+	assert.ErrorIs(t, err, queue.ErrNilHandler)
+	_, err = queue.NewWorker(tr, "emails", handler, queue.Lanes(map[int]int{10: 0, 0: -1}))
+	assert.ErrorIs(t, err, queue.ErrNoLanes)
+	_, err = queue.NewWorker(tr, "emails", handler, queue.Lanes(nil))
+	assert.ErrorIs(t, err, queue.ErrNoLanes)
+	w, err := queue.NewWorker(tr, "emails", handler)
+	require.NoError(t, err)
+	assert.NotNil(t, w)
+}
+
+// jobRow returns a row that yields a job with the id and priority.
+func jobRow(t *testing.T, id int64, priority int) *mocks.PGXRow {
+	t.Helper()
+	row := mocks.NewPGXRow(t)
+	row.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).Once().
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*int64) = id
+			*args.Get(1).(*int) = priority
+		})
+	return row
+}
+
+// savepoint sets up the savepoint the handler runs in on the tx. The
+// savepoint is committed if commit is true, otherwise it is rolled back.
+func savepoint(t *testing.T, tx *mocks.PGXTx, commit bool) {
+	t.Helper()
+	sp := mocks.NewPGXTx(t)
+	tx.On("Begin", mock.Anything).Return(sp, nil).Once()
+	if commit {
+		sp.On("Commit", mock.Anything).Return(nil).Once()
+		return
+	}
+	sp.On("Rollback", mock.Anything).Return(nil).Once()
+}
+
+// emptyRow returns a row that yields no jobs.
+func emptyRow(t *testing.T) *mocks.PGXRow {
+	t.Helper()
+	row := mocks.NewPGXRow(t)
+	row.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(pgx.ErrNoRows).Once()
+	return row
+}
+
+func TestClaimOnce(t *testing.T) {
+	t.Parallel()
+	t.Run("Success", testClaimOnceSuccess)
+	t.Run("Empty", testClaimOnceEmpty)
+	t.Run("HandlerError", testClaimOnceHandlerError)
+	t.Run("HandlerPanic", testClaimOnceHandlerPanic)
+	t.Run("FailError", testClaimOnceFailError)
+	t.Run("Lanes", testClaimOnceLanes)
+	t.Run("LaneFallback", testClaimOnceLaneFallback)
+	t.Run("MaxConcurrency", testClaimOnceMaxConcurrency)
+}
+
+func testClaimOnceSuccess(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, claimQuery, "emails").Return(jobRow(t, 42, 5)).Once()
+	savepoint(t, tx, true)
+	tx.On("Exec", mock.Anything, deleteQuery, int64(42)).Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	var got queue.Job
+	w, err := queue.NewWorker(tr, "emails", func(_ context.Context, _ pgx.Tx, job queue.Job) error {
+		got = job
+		return nil
+	})
+	require.NoError(t, err)
+
+	ok, err := w.ClaimOnce(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.EqualValues(t, 42, got.ID)
+	assert.Equal(t, 5, got.Priority)
+	assert.Equal(t, "emails", got.Queue)
+}
+
+func testClaimOnceEmpty(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, claimQuery, "emails").Return(emptyRow(t)).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	w, err := queue.NewWorker(tr, "emails", func(context.Context, pgx.Tx, queue.Job) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	require.NoError(t, err)
+
+	ok, err := w.ClaimOnce(context.Background())
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func testClaimOnceHandlerError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, claimQuery, "emails").Return(jobRow(t, 42, 0)).Once()
+	savepoint(t, tx, false)
+	tx.On("Exec", mock.Anything, failQuery, int64(42), assert.AnError.Error(), 0).
+		Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	w, err := queue.NewWorker(tr, "emails", func(context.Context, pgx.Tx, queue.Job) error {
+		return assert.AnError
+	})
+	require.NoError(t, err)
+
+	ok, err := w.ClaimOnce(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	assert.False(t, ok)
+}
+
+func testClaimOnceHandlerPanic(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, claimQuery, "emails").Return(jobRow(t, 42, 0)).Once()
+	savepoint(t, tx, false)
+	tx.On("Exec", mock.Anything, failQuery, int64(42), "handler panicked: boom", 5).
+		Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	w, err := queue.NewWorker(tr, "emails", func(context.Context, pgx.Tx, queue.Job) error {
+		panic("boom")
+	}, queue.MaxAttempts(5))
+	require.NoError(t, err)
+
+	ok, err := w.ClaimOnce(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+	assert.False(t, ok)
+}
+
+func testClaimOnceFailError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, claimQuery, "emails").Return(jobRow(t, 42, 0)).Once()
+	savepoint(t, tx, false)
+	tx.On("Exec", mock.Anything, failQuery, mock.Anything, mock.Anything, mock.Anything).
+		Return(pgconn.CommandTag{}, assert.AnError).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	w, err := queue.NewWorker(tr, "emails", func(context.Context, pgx.Tx, queue.Job) error {
+		return errors.New("handler error")
+	})
+	require.NoError(t, err)
+
+	ok, err := w.ClaimOnce(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	assert.False(t, ok)
+}
+
+func testClaimOnceLanes(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	var got []int
+	w, err := queue.NewWorker(tr, "emails", func(_ context.Context, _ pgx.Tx, job queue.Job) error {
+		got = append(got, job.Priority)
+		return nil
+	}, queue.Lanes(map[int]int{10: 3, 0: 1, -1: 0}))
+	require.NoError(t, err)
+
+	want := []int{10, 10, 0, 10, 10, 10, 0, 10}
+	for i, priority := range want {
+		tx := mocks.NewPGXTx(t)
+		db.On("Begin", mock.Anything).Return(tx, nil).Once()
+		tx.On("QueryRow", mock.Anything, laneQuery, "emails", priority).
+			Return(jobRow(t, int64(i), priority)).Once()
+		savepoint(t, tx, true)
+		tx.On("Exec", mock.Anything, deleteQuery, int64(i)).Return(pgconn.CommandTag{}, nil).Once()
+		tx.On("Commit", mock.Anything).Return(nil).Once()
+
+		ok, err := w.ClaimOnce(context.Background())
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, want, got)
+}
+
+func testClaimOnceLaneFallback(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, laneQuery, "emails", 10).Return(emptyRow(t)).Once()
+	tx.On("QueryRow", mock.Anything, laneQuery, "emails", 5).Return(emptyRow(t)).Once()
+	tx.On("QueryRow", mock.Anything, laneQuery, "emails", 0).Return(jobRow(t, 7, 0)).Once()
+	savepoint(t, tx, true)
+	tx.On("Exec", mock.Anything, deleteQuery, int64(7)).Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	w, err := queue.NewWorker(tr, "emails", func(context.Context, pgx.Tx, queue.Job) error {
+		return nil
+	}, queue.Lanes(map[int]int{0: 1, 5: 1, 10: 5}))
+	require.NoError(t, err)
+
+	ok, err := w.ClaimOnce(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func testClaimOnceMaxConcurrency(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	w, err := queue.NewWorker(tr, "emails", func(context.Context, pgx.Tx, queue.Job) error {
+		return nil
+	}, queue.MaxConcurrency(2))
+	require.NoError(t, err)
+
+	slotRow := func(slot int) *mocks.PGXRow {
+		row := mocks.NewPGXRow(t)
+		row.On("Scan", mock.Anything).Return(nil).Once().
+			Run(func(args mock.Arguments) {
+				*args.Get(0).(*int) = slot
+			})
+		return row
+	}
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, mock.MatchedBy(func(q string) bool { return q != claimQuery }), "emails", 2).
+		Return(slotRow(-1)).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ok, err := w.ClaimOnce(context.Background())
+	require.NoError(t, err)
+	assert.False(t, ok, "all slots are taken")
+
+	tx = mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, mock.MatchedBy(func(q string) bool { return q != claimQuery }), "emails", 2).
+		Return(slotRow(1)).Once()
+	tx.On("QueryRow", mock.Anything, claimQuery, "emails").Return(jobRow(t, 3, 0)).Once()
+	savepoint(t, tx, true)
+	tx.On("Exec", mock.Anything, deleteQuery, int64(3)).Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ok, err = w.ClaimOnce(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestWorkerRun(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil)
+	tx.On("QueryRow", mock.Anything, claimQuery, "emails").Return(func(context.Context, string, ...any) pgx.Row {
+		row := mocks.NewPGXRow(t)
+		row.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(pgx.ErrNoRows)
+		return row
+	})
+	tx.On("Commit", mock.Anything).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := queue.NewWorker(tr, "emails", func(context.Context, pgx.Tx, queue.Job) error {
+		return nil
+	}, queue.Workers(3), queue.PollInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,72 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arsham/retry/v3"
+)
+
+type quota struct {
+	statements int
+	rows       int64
+}
+
+// quotaCopy returns a copy of the quota so the clones of the PGX are not
+// affected.
+func (p *PGX) quotaCopy() *quota {
+	if p.quota == nil {
+		return &quota{}
+	}
+	q := *p.quota
+
+	return &q
+}
+
+// hook returns a statement hook that counts the statements and the written
+// rows of one attempt. The counters start from zero on every attempt.
+func (q *quota) hook() stmtHook {
+	var statements int
+	var rows int64
+
+	return stmtHook{
+		before: func(_ context.Context, s *statement) error {
+			statements += max(s.Batch, 1)
+			if q.statements > 0 && statements > q.statements {
+				return &retry.StopError{
+					Err: fmt.Errorf("%w: more than %d statements", ErrQuotaExceeded, q.statements),
+				}
+			}
+
+			return nil
+		},
+		after: func(_ context.Context, s *statement) error {
+			if s.Err != nil || !isWrite(s.SQL) {
+				return nil
+			}
+			rows += s.Rows
+			if q.rows > 0 && rows > q.rows {
+				return &retry.StopError{
+					Err: fmt.Errorf("%w: more than %d rows written", ErrQuotaExceeded, q.rows),
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// isWrite returns true if the statement writes rows.
+func isWrite(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "INSERT", "UPDATE", "DELETE", "MERGE", "COPY":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,176 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementQuota(t *testing.T) {
+	t.Parallel()
+	t.Run("Within", testStatementQuotaWithin)
+	t.Run("Exceeded", testStatementQuotaExceeded)
+	t.Run("PerAttempt", testStatementQuotaPerAttempt)
+	t.Run("Batch", testStatementQuotaBatch)
+	t.Run("InternalStatements", testStatementQuotaInternalStatements)
+}
+
+func testStatementQuotaWithin(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db, dbtools.StatementQuota(2))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, "SELECT 1").Return(pgconn.CommandTag{}, nil).Twice()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		for range 2 {
+			if _, err := tx.Exec(ctx, "SELECT 1"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func testStatementQuotaExceeded(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db,
+		dbtools.Retry(10, time.Millisecond),
+		dbtools.StatementQuota(3),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, "SELECT 1").Return(pgconn.CommandTag{}, nil).Times(3)
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	calls := 0
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		for {
+			calls++
+			if _, err := tx.Exec(ctx, "SELECT 1"); err != nil {
+				return err
+			}
+		}
+	})
+	require.ErrorIs(t, err, dbtools.ErrQuotaExceeded)
+	assert.Equal(t, 4, calls)
+}
+
+func testStatementQuotaPerAttempt(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db,
+		dbtools.Retry(10, time.Millisecond),
+		dbtools.StatementQuota(1),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	row := mocks.NewPGXRow(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Twice()
+	tx.On("QueryRow", mock.Anything, "SELECT 1").Return(row).Twice()
+	row.On("Scan", mock.Anything).Return(assert.AnError).Once()
+	row.On("Scan", mock.Anything).Return(nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		var i int
+		return tx.QueryRow(ctx, "SELECT 1").Scan(&i)
+	})
+	require.NoError(t, err)
+}
+
+func testStatementQuotaBatch(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db, dbtools.StatementQuota(2))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	err = tr.Batch(context.Background(), func(b *pgx.Batch) error {
+		b.Queue("SELECT 1")
+		b.Queue("SELECT 2")
+		b.Queue("SELECT 3")
+		return nil
+	}, nil)
+	require.ErrorIs(t, err, dbtools.ErrQuotaExceeded)
+}
+
+func testStatementQuotaInternalStatements(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db,
+		dbtools.StatementQuota(1),
+		dbtools.SetLocal("lock_timeout", "1s"),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Exec", mock.Anything, "SELECT 1").Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT 1")
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func TestRowQuota(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db,
+		dbtools.Retry(10, time.Millisecond),
+		dbtools.RowQuota(100),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, "SELECT * FROM foo").
+		Return(pgconn.NewCommandTag("SELECT 500"), nil).Once()
+	tx.On("Exec", mock.Anything, "UPDATE foo SET bar = 1").
+		Return(pgconn.NewCommandTag("UPDATE 60"), nil).Twice()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT * FROM foo"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE foo SET bar = 1"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "UPDATE foo SET bar = 1")
+		return err
+	})
+	require.ErrorIs(t, err, dbtools.ErrQuotaExceeded)
+	assert.Contains(t, err.Error(), "100 rows")
+}
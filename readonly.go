@@ -0,0 +1,140 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ReadOnlyPGX is a handle for running read only queries. It can be given to
+// the reporting code that should not be able to mutate data. Its
+// transactions, and the transactions its queries run in, are always started
+// in the READ ONLY access mode, therefore the server rejects any writes. The
+// queries that start with a write verb are rejected early with an ErrReadOnly
+// error.
+type ReadOnlyPGX struct {
+	p *PGX
+}
+
+// ReadOnly returns a ReadOnlyPGX with the same configuration as the p. The
+// other transaction options, for example the isolation level, are kept. If
+// read replicas are configured, the transactions are started on them.
+func (p *PGX) ReadOnly() *ReadOnlyPGX {
+	var opts pgx.TxOptions
+	if p.txOptions != nil {
+		opts = *p.txOptions
+	}
+	opts.AccessMode = pgx.ReadOnly
+
+	// The TxOptions can't make a valid configuration invalid.
+	obj, _ := p.clone(TxOptions(opts))
+
+	return &ReadOnlyPGX{p: obj}
+}
+
+// Transaction has the same semantics as the PGX.Transaction method, but the
+// transaction is started in the READ ONLY access mode.
+func (r *ReadOnlyPGX) Transaction(ctx context.Context, fns ...func(pgx.Tx) error) error {
+	return r.p.Transaction(ctx, fns...)
+}
+
+// Exec runs the query in a READ ONLY transaction, and retries it with the
+// same policy as the Transaction method. It returns an ErrReadOnly error if
+// the query starts with a write verb.
+func (r *ReadOnlyPGX) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := checkReadOnly(sql); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	var tag pgconn.CommandTag
+	err := r.p.Transaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		tag, err = tx.Exec(ctx, sql, args...)
+		if err != nil {
+			return fmt.Errorf("executing query: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	return tag, nil
+}
+
+// Query runs the query in a READ ONLY transaction and calls the scan function
+// for each row. The whole transaction is retried with the same policy as the
+// Transaction method, therefore the scan function should reset any results
+// collected in previous attempts. It returns an ErrReadOnly error if the
+// query starts with a write verb.
+func (r *ReadOnlyPGX) Query(ctx context.Context, scan func(pgx.Rows) error, sql string, args ...any) error {
+	if err := checkReadOnly(sql); err != nil {
+		return err
+	}
+
+	return r.p.Transaction(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, sql, args...)
+		if err != nil {
+			return fmt.Errorf("making query: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("reading rows: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// QueryRow runs the query in a READ ONLY transaction and passes the row to
+// the scan function. The transaction is retried with the same policy as the
+// Transaction method if the scan function returns an error. It returns an
+// ErrReadOnly error if the query starts with a write verb.
+func (r *ReadOnlyPGX) QueryRow(ctx context.Context, scan func(pgx.Row) error, sql string, args ...any) error {
+	if err := checkReadOnly(sql); err != nil {
+		return err
+	}
+
+	return r.p.Transaction(ctx, func(tx pgx.Tx) error {
+		return scan(tx.QueryRow(ctx, sql, args...))
+	})
+}
+
+// checkReadOnly rejects the queries that start with a write verb, so the
+// obvious mistakes are reported without a round trip. The server enforces
+// the READ ONLY access mode for the rest.
+func checkReadOnly(sql string) error {
+	if !isMutation(sql) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrReadOnly, strings.Fields(sql)[0])
+}
+
+// isMutation returns true if the statement writes rows or changes the schema
+// or the permissions.
+func isMutation(sql string) bool {
+	if isWrite(sql) {
+		return true
+	}
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "CREATE", "ALTER", "DROP", "TRUNCATE", "GRANT", "REVOKE",
+		"COMMENT", "REINDEX", "VACUUM", "CLUSTER", "REFRESH", "LOCK":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXReadOnly(t *testing.T) {
+	t.Parallel()
+	t.Run("Transaction", testPGXReadOnlyTransaction)
+	t.Run("KeepsOptions", testPGXReadOnlyKeepsOptions)
+	t.Run("RejectsWrites", testPGXReadOnlyRejectsWrites)
+	t.Run("Reads", testPGXReadOnlyReads)
+	t.Run("ServerRejects", testPGXReadOnlyServerRejects)
+}
+
+func testPGXReadOnlyTransaction(t *testing.T) {
+	t.Parallel()
+	db, b := newTxBeginnerPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	b.On("BeginTx", mock.Anything, readOnly).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = tr.ReadOnly().Transaction(context.Background(), func(pgx.Tx) error {
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func testPGXReadOnlyKeepsOptions(t *testing.T) {
+	t.Parallel()
+	db, b := newTxBeginnerPool(t)
+	tr, err := dbtools.New(db, dbtools.TxOptions(pgx.TxOptions{
+		IsoLevel: pgx.RepeatableRead,
+	}))
+	require.NoError(t, err)
+
+	want := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	tx := mocks.NewPGXTx(t)
+	b.On("BeginTx", mock.Anything, want).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = tr.ReadOnly().Transaction(context.Background(), func(pgx.Tx) error {
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func testPGXReadOnlyRejectsWrites(t *testing.T) {
+	t.Parallel()
+	// The pool doesn't expect any calls.
+	db, _ := newQuerierPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+	ro := tr.ReadOnly()
+	ctx := context.Background()
+
+	queries := []string{
+		"INSERT INTO foo VALUES (1)",
+		"  update foo SET bar = 1",
+		"DELETE FROM foo",
+		"TRUNCATE foo",
+		"DROP TABLE foo",
+	}
+	for _, q := range queries {
+		_, err := ro.Exec(ctx, q)
+		assert.ErrorIs(t, err, dbtools.ErrReadOnly, q)
+		err = ro.Query(ctx, func(pgx.Rows) error { return nil }, q)
+		assert.ErrorIs(t, err, dbtools.ErrReadOnly, q)
+		err = ro.QueryRow(ctx, func(pgx.Row) error { return nil }, q)
+		assert.ErrorIs(t, err, dbtools.ErrReadOnly, q)
+	}
+}
+
+func testPGXReadOnlyReads(t *testing.T) {
+	t.Parallel()
+	queries := []string{
+		"SELECT pg_sleep(0)",
+		"WITH d AS (DELETE FROM foo RETURNING *) SELECT * FROM d",
+		"/* comment */ DELETE FROM foo",
+		"SELECT some_mutating_fn()",
+	}
+	for _, query := range queries {
+		db, b := newTxBeginnerPool(t)
+		tr, err := dbtools.New(db)
+		require.NoError(t, err)
+
+		tx := mocks.NewPGXTx(t)
+		b.On("BeginTx", mock.Anything, readOnly).Return(tx, nil).Once()
+		tx.On("Exec", mock.Anything, query).Return(pgconn.CommandTag{}, nil).Once()
+		tx.On("Commit", mock.Anything).Return(nil).Once()
+		_, err = tr.ReadOnly().Exec(context.Background(), query)
+		require.NoError(t, err, query)
+	}
+}
+
+func testPGXReadOnlyServerRejects(t *testing.T) {
+	t.Parallel()
+	db, b := newTxBeginnerPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	const query = "SELECT some_mutating_fn()"
+	readOnlyErr := &pgconn.PgError{Code: "25006"} // read_only_sql_transaction
+	tx := mocks.NewPGXTx(t)
+	b.On("BeginTx", mock.Anything, readOnly).Return(tx, nil).Once()
+	tx.On("QueryRow", mock.Anything, query).Return(mocks.NewPGXRow(t)).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+	err = tr.ReadOnly().QueryRow(context.Background(), func(pgx.Row) error {
+		return readOnlyErr
+	}, query)
+	assert.ErrorIs(t, err, readOnlyErr)
+}
@@ -0,0 +1,62 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arsham/retry/v3"
+)
+
+// WaitForPool tries to reach the database with the r retry policy until it
+// succeeds, or the retries are exhausted, or the ctx is cancelled. If the pool
+// implements the Pinger interface the Ping method is used, otherwise a
+// transaction is started and rolled back. This is useful when the service
+// starts before the database is ready to accept connections:
+//
+//	err := dbtools.WaitForPool(ctx, pool, retry.Retry{
+//		Attempts: 30,
+//		Delay:    time.Second,
+//	})
+func WaitForPool(ctx context.Context, pool Pool, r retry.Retry) error {
+	if pool == nil {
+		return ErrEmptyDatabase
+	}
+
+	return r.DoContext(ctx, func() error {
+		return ping(ctx, pool)
+	})
+}
+
+// WaitForReady tries to reach the database with the retry policy of the PGX
+// object for the KindPing operations, or the one set on the ctx with the
+// WithCallRetry function, or the Retrier set with the WithRetrier option. See
+// the WaitForPool function for more information.
+func (p *PGX) WaitForReady(ctx context.Context) error {
+	if p.pool == nil {
+		return ErrEmptyDatabase
+	}
+
+	return p.do(ctx, p.retryPolicy(ctx, KindPing), func() error {
+		return ping(ctx, p.pool)
+	})
+}
+
+func ping(ctx context.Context, pool Pool) error {
+	if p, ok := pool.(Pinger); ok {
+		if err := p.Ping(ctx); err != nil {
+			return fmt.Errorf("pinging database: %w", err)
+		}
+
+		return nil
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		return fmt.Errorf("rolling back transaction: %w", err)
+	}
+
+	return nil
+}
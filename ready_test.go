@@ -0,0 +1,86 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/retry/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForPool(t *testing.T) {
+	t.Parallel()
+	t.Run("NilPool", testWaitForPoolNilPool)
+	t.Run("Pinger", testWaitForPoolPinger)
+	t.Run("PingerError", testWaitForPoolPingerError)
+	t.Run("Begin", testWaitForPoolBegin)
+	t.Run("CancelledContext", testWaitForPoolCancelledContext)
+}
+
+func testWaitForPoolNilPool(t *testing.T) {
+	t.Parallel()
+	err := dbtools.WaitForPool(context.Background(), nil, retry.Retry{Attempts: 1})
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func testWaitForPoolPinger(t *testing.T) {
+	t.Parallel()
+	db, p := newPingerPool(t)
+	p.On("Ping", mock.Anything).Return(assert.AnError).Twice()
+	p.On("Ping", mock.Anything).Return(nil).Once()
+
+	err := dbtools.WaitForPool(context.Background(), db, retry.Retry{
+		Attempts: 10,
+		Delay:    time.Millisecond,
+	})
+	assert.NoError(t, err)
+}
+
+func testWaitForPoolPingerError(t *testing.T) {
+	t.Parallel()
+	db, p := newPingerPool(t)
+	total := 3
+	p.On("Ping", mock.Anything).Return(assert.AnError).Times(total)
+
+	tr, err := dbtools.New(db, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+	err = tr.WaitForReady(context.Background())
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testWaitForPoolBegin(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(nil, assert.AnError).Once()
+	db.On("Begin", mock.Anything).Return(tx, nil).Twice()
+	tx.On("Rollback", mock.Anything).Return(assert.AnError).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	err := dbtools.WaitForPool(context.Background(), db, retry.Retry{
+		Attempts: 10,
+		Delay:    time.Millisecond,
+	})
+	assert.NoError(t, err)
+}
+
+func testWaitForPoolCancelledContext(t *testing.T) {
+	t.Parallel()
+	db, p := newPingerPool(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.On("Ping", mock.Anything).Return(assert.AnError).Once().Run(func(mock.Arguments) {
+		cancel()
+	})
+
+	err := dbtools.WaitForPool(ctx, db, retry.Retry{
+		Attempts: 100,
+		Delay:    time.Millisecond,
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
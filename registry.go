@@ -0,0 +1,75 @@
+package dbtools
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry holds named PGX objects, for example "primary", "replica" and
+// "analytics", so they can be looked up by name instead of passing the pools
+// around. It is safe for concurrent use.
+type Registry struct {
+	defaults []ConfigFunc
+	mu       sync.RWMutex
+	managers map[string]*PGX
+}
+
+// NewRegistry returns an empty Registry. The defaults are applied to every PGX
+// object that is registered.
+func NewRegistry(defaults ...ConfigFunc) *Registry {
+	return &Registry{
+		defaults: defaults,
+		managers: make(map[string]*PGX),
+	}
+}
+
+// Register creates a PGX object for the pool and registers it with the name.
+// The label of the object is set to the name, then the default
+// configurations of the registry and the conf are applied. It returns an
+// ErrDuplicateManager error if the name is already registered.
+func (r *Registry) Register(name string, pool Pool, conf ...ConfigFunc) (*PGX, error) {
+	all := make([]ConfigFunc, 0, len(r.defaults)+len(conf)+1)
+	all = append(all, Label(name))
+	all = append(all, r.defaults...)
+	all = append(all, conf...)
+	p, err := New(pool, all...)
+	if err != nil {
+		return nil, fmt.Errorf("registering %q: %w", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.managers[name]; ok {
+		return nil, fmt.Errorf("%w: %q", ErrDuplicateManager, name)
+	}
+	r.managers[name] = p
+
+	return p, nil
+}
+
+// Get returns the PGX object registered with the name. It returns an
+// ErrUnknownManager error if the name is not registered.
+func (r *Registry) Get(name string) (*PGX, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.managers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownManager, name)
+	}
+
+	return p, nil
+}
+
+// Names returns the sorted names of the registered objects.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.managers))
+	for name := range r.managers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
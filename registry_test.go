@@ -0,0 +1,69 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	t.Run("Register", testRegistryRegister)
+	t.Run("Errors", testRegistryErrors)
+	t.Run("Defaults", testRegistryDefaults)
+}
+
+func testRegistryRegister(t *testing.T) {
+	t.Parallel()
+	r := dbtools.NewRegistry()
+	primary, err := r.Register("primary", mocks.NewPool(t))
+	require.NoError(t, err)
+	analytics, err := r.Register("analytics", mocks.NewPool(t))
+	require.NoError(t, err)
+
+	got, err := r.Get("primary")
+	require.NoError(t, err)
+	assert.Same(t, primary, got)
+	got, err = r.Get("analytics")
+	require.NoError(t, err)
+	assert.Same(t, analytics, got)
+	assert.Equal(t, []string{"analytics", "primary"}, r.Names())
+}
+
+func testRegistryErrors(t *testing.T) {
+	t.Parallel()
+	r := dbtools.NewRegistry()
+	_, err := r.Register("primary", nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+	_, err = r.Register("primary", mocks.NewPool(t))
+	require.NoError(t, err)
+	_, err = r.Register("primary", mocks.NewPool(t))
+	assert.ErrorIs(t, err, dbtools.ErrDuplicateManager)
+	_, err = r.Get("replica")
+	assert.ErrorIs(t, err, dbtools.ErrUnknownManager)
+}
+
+func testRegistryDefaults(t *testing.T) {
+	t.Parallel()
+	r := dbtools.NewRegistry(dbtools.Retry(3, time.Millisecond))
+	db := mocks.NewPool(t)
+	tr, err := r.Register("analytics", db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(3)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(3)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), `"analytics"`)
+}
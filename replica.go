@@ -0,0 +1,66 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// replicaSet routes the read-only transactions to the replicas. The counter
+// is shared between the copies of the PGX object.
+type replicaSet struct {
+	next     *atomic.Uint64
+	pools    []Pool
+	fallback bool
+}
+
+// NewWithReplicas returns a PGX object that begins the read-only transactions
+// on the replicas in a round-robin fashion, and the rest of the transactions
+// on the primary pool. A transaction is read-only when its access mode is set
+// to pgx.ReadOnly with the TxOptions option:
+//
+//	tr, err := dbtools.NewWithReplicas(primary, []dbtools.Pool{replica1, replica2},
+//		dbtools.ReplicaFallback(true),
+//		dbtools.WithPreset("read", dbtools.TxOptions(pgx.TxOptions{
+//			AccessMode: pgx.ReadOnly,
+//		})),
+//	)
+//	// handle the error!
+//	reader, err := tr.Preset("read")
+//
+// When a replica returns a connection error the next one is tried. If all of
+// the replicas are down, the transaction goes to the primary if the
+// ReplicaFallback option is set, otherwise the error is returned to be
+// retried. It returns an ErrEmptyDatabase error if any of the pools are nil.
+func NewWithReplicas(primary Pool, replicas []Pool, conf ...ConfigFunc) (*PGX, error) {
+	for _, r := range replicas {
+		if r == nil {
+			return nil, ErrEmptyDatabase
+		}
+	}
+
+	return New(primary, append([]ConfigFunc{Replicas(replicas...)}, conf...)...)
+}
+
+func (r *replicaSet) begin(ctx context.Context, primary Pool, opts pgx.TxOptions) (pgx.Tx, error) {
+	start := int((r.next.Add(1) - 1) % uint64(len(r.pools)))
+	var errs []error
+	for i := range r.pools {
+		pool := r.pools[(start+i)%len(r.pools)]
+		tx, err := beginOn(ctx, pool, &opts)
+		if err == nil {
+			return tx, nil
+		}
+		if !IsConnectionError(err) {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	if r.fallback {
+		return beginOn(ctx, primary, &opts)
+	}
+
+	return nil, errors.Join(errs...)
+}
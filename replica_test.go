@@ -0,0 +1,152 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var readOnly = pgx.TxOptions{AccessMode: pgx.ReadOnly}
+
+func TestNewWithReplicas(t *testing.T) {
+	t.Parallel()
+	t.Run("NilPools", testNewWithReplicasNilPools)
+	t.Run("RoundRobin", testNewWithReplicasRoundRobin)
+	t.Run("Writes", testNewWithReplicasWrites)
+	t.Run("ReplicaDown", testNewWithReplicasReplicaDown)
+	t.Run("Fallback", testNewWithReplicasFallback)
+	t.Run("NoFallback", testNewWithReplicasNoFallback)
+	t.Run("ContextError", testNewWithReplicasContextError)
+}
+
+func testNewWithReplicasNilPools(t *testing.T) {
+	t.Parallel()
+	_, err := dbtools.NewWithReplicas(nil, nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+	_, err = dbtools.NewWithReplicas(mocks.NewPool(t), []dbtools.Pool{nil})
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func testNewWithReplicasRoundRobin(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	r1, b1 := newTxBeginnerPool(t)
+	r2, b2 := newTxBeginnerPool(t)
+	tr, err := dbtools.NewWithReplicas(primary, []dbtools.Pool{r1, r2},
+		dbtools.TxOptions(readOnly),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	b1.On("BeginTx", mock.Anything, readOnly).Return(tx, nil).Twice()
+	b2.On("BeginTx", mock.Anything, readOnly).Return(tx, nil).Twice()
+	tx.On("Commit", mock.Anything).Return(nil).Times(4)
+
+	for range 4 {
+		err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+		require.NoError(t, err)
+	}
+}
+
+func testNewWithReplicasWrites(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	replica := mocks.NewPool(t)
+	tr, err := dbtools.NewWithReplicas(primary, []dbtools.Pool{replica})
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	primary.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+}
+
+func testNewWithReplicasReplicaDown(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	r1, b1 := newTxBeginnerPool(t)
+	r2, b2 := newTxBeginnerPool(t)
+	tr, err := dbtools.NewWithReplicas(primary, []dbtools.Pool{r1, r2},
+		dbtools.TxOptions(readOnly),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	b1.On("BeginTx", mock.Anything, readOnly).Return(nil, &pgconn.ConnectError{}).Once()
+	b2.On("BeginTx", mock.Anything, readOnly).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+}
+
+func testNewWithReplicasFallback(t *testing.T) {
+	t.Parallel()
+	primary, pb := newTxBeginnerPool(t)
+	replica, rb := newTxBeginnerPool(t)
+	tr, err := dbtools.NewWithReplicas(primary, []dbtools.Pool{replica},
+		dbtools.TxOptions(readOnly),
+		dbtools.ReplicaFallback(true),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	rb.On("BeginTx", mock.Anything, readOnly).Return(nil, &pgconn.ConnectError{}).Once()
+	pb.On("BeginTx", mock.Anything, readOnly).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+}
+
+func testNewWithReplicasNoFallback(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	replica, rb := newTxBeginnerPool(t)
+	total := 3
+	tr, err := dbtools.NewWithReplicas(primary, []dbtools.Pool{replica},
+		dbtools.TxOptions(readOnly),
+		dbtools.Retry(total, time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	connErr := &pgconn.PgError{Code: "57P03"}
+	rb.On("BeginTx", mock.Anything, readOnly).Return(nil, connErr).Times(total)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	require.ErrorIs(t, err, connErr)
+}
+
+func testNewWithReplicasContextError(t *testing.T) {
+	t.Parallel()
+	primary := mocks.NewPool(t)
+	r1, b1 := newTxBeginnerPool(t)
+	r2 := mocks.NewPool(t)
+	tr, err := dbtools.NewWithReplicas(primary, []dbtools.Pool{r1, r2},
+		dbtools.TxOptions(readOnly),
+		dbtools.ReplicaFallback(true),
+		dbtools.Retry(1, time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	b1.On("BeginTx", mock.Anything, readOnly).Return(nil, context.DeadlineExceeded).Once()
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,96 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// LSN is a position in the write-ahead log.
+type LSN uint64
+
+// String returns the LSN in the "XXX/XXX" format of PostgreSQL.
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+// ParseLSN parses an LSN in the "XXX/XXX" format.
+func ParseLSN(s string) (LSN, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q: %w", s, err)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q: %w", s, err)
+	}
+
+	return LSN(h<<32 | l), nil
+}
+
+// Conn is the contract of a replication connection. The PgConn function
+// adapts a *pgconn.PgConn that is connected in the replication mode.
+type Conn interface {
+	// Exec runs a replication command, for example
+	// CREATE_REPLICATION_SLOT, and discards its results.
+	Exec(ctx context.Context, sql string) error
+	// Send sends the msg to the server.
+	Send(msg pgproto3.FrontendMessage) error
+	// Receive receives the next message from the server. It should keep the
+	// connection open if the ctx is done while waiting.
+	Receive(ctx context.Context) (pgproto3.BackendMessage, error)
+	Close(ctx context.Context) error
+}
+
+// Dial returns a function that connects to the database of the dsn in the
+// logical replication mode. The user should have the REPLICATION attribute.
+func Dial(dsn string) func(context.Context) (Conn, error) {
+	return func(ctx context.Context) (Conn, error) {
+		config, err := pgconn.ParseConfig(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("parsing connection string: %w", err)
+		}
+		config.RuntimeParams["replication"] = "database"
+		conn, err := pgconn.ConnectConfig(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("connecting: %w", err)
+		}
+
+		return PgConn(conn), nil
+	}
+}
+
+// PgConn returns the conn as a Conn.
+func PgConn(conn *pgconn.PgConn) Conn {
+	return pgConn{conn: conn}
+}
+
+type pgConn struct {
+	conn *pgconn.PgConn
+}
+
+func (c pgConn) Exec(ctx context.Context, sql string) error {
+	_, err := c.conn.Exec(ctx, sql).ReadAll()
+	return err
+}
+
+func (c pgConn) Send(msg pgproto3.FrontendMessage) error {
+	c.conn.Frontend().Send(msg)
+	return c.conn.Frontend().Flush()
+}
+
+func (c pgConn) Receive(ctx context.Context) (pgproto3.BackendMessage, error) {
+	return c.conn.ReceiveMessage(ctx)
+}
+
+func (c pgConn) Close(ctx context.Context) error {
+	return c.conn.Close(ctx)
+}
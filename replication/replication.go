@@ -0,0 +1,350 @@
+// Package replication streams the changes of a logical replication slot to a
+// handler, for change data capture without an external service. The changes
+// are acknowledged after the handler returns, therefore a change is delivered
+// again after a reconnection if its handler has failed or hasn't finished.
+// The connection is re-established with a retry policy when it fails:
+//
+//	l, err := replication.New(replication.Dial(dsn), "orders_cdc",
+//		func(ctx context.Context, c replication.Change) error {
+//			return publish(ctx, c.Data)
+//		},
+//		replication.Plugin("wal2json", nil),
+//	)
+//	// handle the error!
+//	err = l.Run(ctx)
+//
+// The format of the Data of the changes is decided by the output plugin of
+// the slot. The default plugin is test_decoding, which is shipped with
+// PostgreSQL and produces text.
+package replication
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+var (
+	// ErrNilHandler is returned when creating a Listener without a handler.
+	ErrNilHandler = errors.New("nil handler")
+
+	// ErrEmptySlot is returned when creating a Listener without a slot name.
+	ErrEmptySlot = errors.New("empty slot name")
+)
+
+// postgresEpoch is the epoch of the timestamps of the replication protocol.
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Change is a message of the output plugin.
+type Change struct {
+	// LSN is the position of the change in the write-ahead log.
+	LSN        LSN
+	ServerTime time.Time
+	Data       []byte
+}
+
+// Handler handles a change. The change is acknowledged when it returns nil.
+// When it returns an error, the Listener reconnects and the change is
+// delivered again.
+type Handler func(ctx context.Context, c Change) error
+
+// ConfigFunc is used for configuring the Listener.
+type ConfigFunc func(*Listener)
+
+// Plugin sets the output plugin of the slot and its options, for example
+// "pgoutput" with the "proto_version" and "publication_names" options. The
+// default plugin is test_decoding without any options.
+func Plugin(name string, options map[string]string) ConfigFunc {
+	return func(l *Listener) {
+		l.plugin = name
+		l.options = options
+	}
+}
+
+// Temporary creates the slot as a temporary slot, which is dropped when the
+// connection is closed. The changes that are made while the Listener is
+// reconnecting are not delivered.
+func Temporary() ConfigFunc {
+	return func(l *Listener) {
+		l.temporary = true
+	}
+}
+
+// Retry sets the retry policy of connecting and starting the replication.
+// The default is 10 attempts with an incremental delay of 1s. The Listener
+// also waits for the Delay before reconnecting after a failure.
+func Retry(r retry.Retry) ConfigFunc {
+	return func(l *Listener) {
+		l.retry = r
+	}
+}
+
+// StatusInterval sets the interval of the status updates that are sent to
+// the server, which report the acknowledged position. The default value is
+// 10s.
+func StatusInterval(d time.Duration) ConfigFunc {
+	return func(l *Listener) {
+		l.interval = d
+	}
+}
+
+// OnError sets the function that is called when the connection or the
+// handler fails. The Listener reconnects anyway.
+func OnError(fn func(error)) ConfigFunc {
+	return func(l *Listener) {
+		l.onError = fn
+	}
+}
+
+// Listener streams the changes of a replication slot. It is not safe to call
+// the Run method concurrently, but the Acknowledged method can be called while
+// it is running.
+type Listener struct {
+	connect   func(context.Context) (Conn, error)
+	slot      string
+	handler   Handler
+	plugin    string
+	options   map[string]string
+	temporary bool
+	retry     retry.Retry
+	interval  time.Duration
+	onError   func(error)
+	acked     atomic.Uint64
+}
+
+// New returns a Listener that streams the changes of the slot to the
+// handler. The connect function should return a connection in the logical
+// replication mode, for example the function returned by Dial. The slot is
+// created if it doesn't exist.
+func New(connect func(context.Context) (Conn, error), slot string, handler Handler, conf ...ConfigFunc) (*Listener, error) {
+	if handler == nil {
+		return nil, ErrNilHandler
+	}
+	if slot == "" {
+		return nil, ErrEmptySlot
+	}
+	l := &Listener{
+		connect: connect,
+		slot:    slot,
+		handler: handler,
+		plugin:  "test_decoding",
+		retry: retry.Retry{
+			Attempts: 10,
+			Delay:    time.Second,
+			Method:   retry.IncrementalDelay,
+		},
+		interval: 10 * time.Second,
+	}
+	for _, fn := range conf {
+		fn(l)
+	}
+	if l.retry.Attempts < 1 {
+		l.retry.Attempts = 1
+	}
+
+	return l, nil
+}
+
+// Acknowledged returns the position of the last acknowledged change.
+func (l *Listener) Acknowledged() LSN {
+	return LSN(l.acked.Load())
+}
+
+// Run streams the changes until the ctx is cancelled, or the connection
+// can't be re-established with the retry policy. It returns the error of the
+// ctx when it is cancelled.
+func (l *Listener) Run(ctx context.Context) error {
+	for {
+		var conn Conn
+		err := l.retry.DoContext(ctx, func() error {
+			var err error
+			conn, err = l.start(ctx)
+			if err != nil {
+				l.report(err)
+			}
+			return err
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("starting replication: %w", err)
+		}
+
+		err = l.stream(ctx, conn)
+		closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+		_ = conn.Close(closeCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		l.report(err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.retry.Delay):
+		}
+	}
+}
+
+func (l *Listener) report(err error) {
+	if l.onError != nil {
+		l.onError(err)
+	}
+}
+
+// start connects, creates the slot if it doesn't exist, and starts the
+// replication from the acknowledged position.
+func (l *Listener) start(ctx context.Context) (Conn, error) {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.begin(ctx, conn); err != nil {
+		_ = conn.Close(ctx)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (l *Listener) begin(ctx context.Context, conn Conn) error {
+	slot := pgx.Identifier{l.slot}.Sanitize()
+	create := "CREATE_REPLICATION_SLOT " + slot
+	if l.temporary {
+		create += " TEMPORARY"
+	}
+	err := conn.Exec(ctx, create+" LOGICAL "+pgx.Identifier{l.plugin}.Sanitize())
+	var pgErr *pgconn.PgError
+	if err != nil && !(errors.As(err, &pgErr) && pgErr.Code == "42710") { // duplicate_object
+		return fmt.Errorf("creating replication slot: %w", err)
+	}
+
+	sql := "START_REPLICATION SLOT " + slot + " LOGICAL " + l.Acknowledged().String()
+	if len(l.options) > 0 {
+		keys := make([]string, 0, len(l.options))
+		for k := range l.options {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		opts := make([]string, len(keys))
+		for i, k := range keys {
+			opts[i] = pgx.Identifier{k}.Sanitize() + " '" + strings.ReplaceAll(l.options[k], "'", "''") + "'"
+		}
+		sql += " (" + strings.Join(opts, ", ") + ")"
+	}
+	if err := conn.Send(&pgproto3.Query{String: sql}); err != nil {
+		return fmt.Errorf("starting replication: %w", err)
+	}
+	for {
+		msg, err := conn.Receive(ctx)
+		if err != nil {
+			return fmt.Errorf("starting replication: %w", err)
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("starting replication: %w", pgconn.ErrorResponseToPgError(msg))
+		}
+	}
+}
+
+// stream delivers the changes until the ctx is cancelled or the connection
+// fails.
+func (l *Listener) stream(ctx context.Context, conn Conn) error {
+	next := time.Now().Add(l.interval)
+	for {
+		if !time.Now().Before(next) {
+			if err := l.sendStatus(conn); err != nil {
+				return err
+			}
+			next = time.Now().Add(l.interval)
+		}
+
+		rctx, cancel := context.WithDeadline(ctx, next)
+		msg, err := conn.Receive(rctx)
+		timedOut := errors.Is(rctx.Err(), context.DeadlineExceeded)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && timedOut {
+				continue
+			}
+			return fmt.Errorf("receiving message: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.CopyData:
+			reply, err := l.receive(ctx, msg.Data)
+			if err != nil {
+				return err
+			}
+			if reply {
+				next = time.Now()
+			}
+		}
+	}
+}
+
+// receive handles a message of the replication stream. It returns true if
+// the server has requested a status update.
+func (l *Listener) receive(ctx context.Context, data []byte) (bool, error) {
+	if len(data) == 0 {
+		return false, nil
+	}
+	switch data[0] {
+	case 'k': // primary keepalive
+		if len(data) < 18 {
+			return false, fmt.Errorf("short keepalive message: %d bytes", len(data))
+		}
+		return data[17] == 1, nil
+	case 'w': // XLogData
+		if len(data) < 25 {
+			return false, fmt.Errorf("short XLogData message: %d bytes", len(data))
+		}
+		c := Change{
+			LSN:        LSN(binary.BigEndian.Uint64(data[1:9])),
+			ServerTime: postgresEpoch.Add(time.Duration(int64(binary.BigEndian.Uint64(data[17:25]))) * time.Microsecond),
+			Data:       data[25:],
+		}
+		if err := l.handler(ctx, c); err != nil {
+			return false, fmt.Errorf("handling change %s: %w", c.LSN, err)
+		}
+		if end := c.LSN + LSN(len(c.Data)); end > l.Acknowledged() {
+			l.acked.Store(uint64(end))
+		}
+	}
+
+	return false, nil
+}
+
+// sendStatus reports the acknowledged position as written, flushed and
+// applied.
+func (l *Listener) sendStatus(conn Conn) error {
+	data := make([]byte, 0, 34)
+	data = append(data, 'r')
+	acked := uint64(l.Acknowledged())
+	data = binary.BigEndian.AppendUint64(data, acked)
+	data = binary.BigEndian.AppendUint64(data, acked)
+	data = binary.BigEndian.AppendUint64(data, acked)
+	data = binary.BigEndian.AppendUint64(data, uint64(time.Since(postgresEpoch).Microseconds()))
+	data = append(data, 0)
+	if err := conn.Send(&pgproto3.CopyData{Data: data}); err != nil {
+		return fmt.Errorf("sending status update: %w", err)
+	}
+
+	return nil
+}
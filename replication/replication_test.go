@@ -0,0 +1,320 @@
+package replication_test
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4/replication"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn replays the messages, and blocks when there are none left.
+type fakeConn struct {
+	mu       sync.Mutex
+	execErr  error
+	messages []pgproto3.BackendMessage
+	execs    []string
+	sent     []pgproto3.FrontendMessage
+}
+
+func (c *fakeConn) Exec(_ context.Context, sql string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.execs = append(c.execs, sql)
+	return c.execErr
+}
+
+func (c *fakeConn) Send(msg pgproto3.FrontendMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func (c *fakeConn) Receive(ctx context.Context) (pgproto3.BackendMessage, error) {
+	c.mu.Lock()
+	if len(c.messages) > 0 {
+		msg := c.messages[0]
+		c.messages = c.messages[1:]
+		c.mu.Unlock()
+		return msg, nil
+	}
+	c.mu.Unlock()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *fakeConn) Close(context.Context) error { return nil }
+
+func (c *fakeConn) queries() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ret []string
+	for _, msg := range c.sent {
+		if q, ok := msg.(*pgproto3.Query); ok {
+			ret = append(ret, q.String)
+		}
+	}
+	return ret
+}
+
+func (c *fakeConn) statuses() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ret [][]byte
+	for _, msg := range c.sent {
+		if d, ok := msg.(*pgproto3.CopyData); ok {
+			ret = append(ret, d.Data)
+		}
+	}
+	return ret
+}
+
+func xLogData(start uint64, data string) *pgproto3.CopyData {
+	b := []byte{'w'}
+	b = binary.BigEndian.AppendUint64(b, start)
+	b = binary.BigEndian.AppendUint64(b, start+uint64(len(data)))
+	b = binary.BigEndian.AppendUint64(b, 0)
+	return &pgproto3.CopyData{Data: append(b, data...)}
+}
+
+func keepalive(end uint64, reply bool) *pgproto3.CopyData {
+	b := []byte{'k'}
+	b = binary.BigEndian.AppendUint64(b, end)
+	b = binary.BigEndian.AppendUint64(b, 0)
+	if reply {
+		return &pgproto3.CopyData{Data: append(b, 1)}
+	}
+	return &pgproto3.CopyData{Data: append(b, 0)}
+}
+
+// connector returns the conns in order, one per connection.
+func connector(conns ...*fakeConn) func(context.Context) (replication.Conn, error) {
+	var mu sync.Mutex
+	return func(context.Context) (replication.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(conns) == 0 {
+			return nil, assert.AnError
+		}
+		c := conns[0]
+		conns = conns[1:]
+		return c, nil
+	}
+}
+
+var fastRetry = replication.Retry(retry.Retry{Attempts: 2, Delay: time.Millisecond})
+
+func TestLSN(t *testing.T) {
+	t.Parallel()
+	t.Run("String", testLSNString)
+	t.Run("Parse", testLSNParse)
+}
+
+func testLSNString(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "0/0", replication.LSN(0).String())
+	assert.Equal(t, "16/B374D848", replication.LSN(0x16B374D848).String())
+}
+
+func testLSNParse(t *testing.T) {
+	t.Parallel()
+	l, err := replication.ParseLSN("16/B374D848")
+	require.NoError(t, err)
+	assert.Equal(t, replication.LSN(0x16B374D848), l)
+
+	for _, s := range []string{"", "16", "x/1", "1/x", "100000000/0"} {
+		_, err := replication.ParseLSN(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	t.Run("NilHandler", testNewNilHandler)
+	t.Run("EmptySlot", testNewEmptySlot)
+}
+
+func testNewNilHandler(t *testing.T) {
+	t.Parallel()
+	_, err := replication.New(connector(), "slot", nil)
+	assert.ErrorIs(t, err, replication.ErrNilHandler)
+}
+
+func testNewEmptySlot(t *testing.T) {
+	t.Parallel()
+	_, err := replication.New(connector(), "", func(context.Context, replication.Change) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, replication.ErrEmptySlot)
+}
+
+func TestListenerRun(t *testing.T) {
+	t.Parallel()
+	t.Run("Deliver", testListenerRunDeliver)
+	t.Run("SlotExists", testListenerRunSlotExists)
+	t.Run("StartError", testListenerRunStartError)
+	t.Run("HandlerError", testListenerRunHandlerError)
+	t.Run("AcknowledgedWhileRunning", testListenerRunAcknowledgedWhileRunning)
+}
+
+func testListenerRunDeliver(t *testing.T) {
+	t.Parallel()
+	conn := &fakeConn{messages: []pgproto3.BackendMessage{
+		&pgproto3.CopyBothResponse{},
+		xLogData(100, "one"),
+		xLogData(200, "two"),
+		keepalive(300, true),
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []string
+	l, err := replication.New(connector(conn), "orders", func(_ context.Context, c replication.Change) error {
+		got = append(got, c.LSN.String()+" "+string(c.Data))
+		if len(got) == 2 {
+			go func() {
+				assert.Eventually(t, func() bool { return len(conn.statuses()) > 0 }, time.Second, time.Millisecond)
+				cancel()
+			}()
+		}
+		return nil
+	},
+		replication.Temporary(),
+		replication.Plugin("pgoutput", map[string]string{"publication_names": "orders", "proto_version": "1"}),
+		fastRetry,
+	)
+	require.NoError(t, err)
+
+	err = l.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"0/64 one", "0/C8 two"}, got)
+	assert.Equal(t, replication.LSN(203), l.Acknowledged())
+	assert.Equal(t, []string{`CREATE_REPLICATION_SLOT "orders" TEMPORARY LOGICAL "pgoutput"`}, conn.execs)
+	assert.Equal(t, []string{
+		`START_REPLICATION SLOT "orders" LOGICAL 0/0 ("proto_version" '1', "publication_names" 'orders')`,
+	}, conn.queries())
+
+	status := conn.statuses()[0]
+	require.Len(t, status, 34)
+	assert.EqualValues(t, 'r', status[0])
+	assert.EqualValues(t, 203, binary.BigEndian.Uint64(status[1:9]))
+	assert.EqualValues(t, 203, binary.BigEndian.Uint64(status[9:17]))
+	assert.EqualValues(t, 203, binary.BigEndian.Uint64(status[17:25]))
+}
+
+func testListenerRunSlotExists(t *testing.T) {
+	t.Parallel()
+	conn := &fakeConn{
+		execErr: &pgconn.PgError{Code: "42710"},
+		messages: []pgproto3.BackendMessage{
+			&pgproto3.CopyBothResponse{},
+			xLogData(100, "one"),
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := replication.New(connector(conn), "orders", func(context.Context, replication.Change) error {
+		cancel()
+		return nil
+	}, fastRetry)
+	require.NoError(t, err)
+
+	err = l.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, replication.LSN(103), l.Acknowledged())
+	assert.Equal(t, []string{`CREATE_REPLICATION_SLOT "orders" LOGICAL "test_decoding"`}, conn.execs)
+}
+
+func testListenerRunAcknowledgedWhileRunning(t *testing.T) {
+	t.Parallel()
+	conn := &fakeConn{messages: []pgproto3.BackendMessage{
+		&pgproto3.CopyBothResponse{},
+		xLogData(100, "one"),
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := replication.New(connector(conn), "orders", func(context.Context, replication.Change) error {
+		return nil
+	}, fastRetry)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+	assert.Eventually(t, func() bool {
+		return l.Acknowledged() == replication.LSN(103)
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func testListenerRunStartError(t *testing.T) {
+	t.Parallel()
+	errResp := func() *fakeConn {
+		return &fakeConn{messages: []pgproto3.BackendMessage{
+			&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42704", Message: "replication slot does not exist"},
+		}}
+	}
+	var reported []error
+	l, err := replication.New(connector(errResp(), errResp()), "orders",
+		func(context.Context, replication.Change) error { return nil },
+		fastRetry,
+		replication.OnError(func(err error) { reported = append(reported, err) }),
+	)
+	require.NoError(t, err)
+
+	err = l.Run(context.Background())
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "42704", pgErr.Code)
+	assert.Len(t, reported, 2)
+}
+
+func testListenerRunHandlerError(t *testing.T) {
+	t.Parallel()
+	first := &fakeConn{messages: []pgproto3.BackendMessage{
+		&pgproto3.CopyBothResponse{},
+		xLogData(100, "one"),
+		xLogData(200, "two"),
+	}}
+	second := &fakeConn{messages: []pgproto3.BackendMessage{
+		&pgproto3.CopyBothResponse{},
+		xLogData(200, "two"),
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []string
+	var reported []error
+	failed := false
+	l, err := replication.New(connector(first, second), "orders", func(_ context.Context, c replication.Change) error {
+		if string(c.Data) == "two" && !failed {
+			failed = true
+			return assert.AnError
+		}
+		got = append(got, string(c.Data))
+		if len(got) == 2 {
+			cancel()
+		}
+		return nil
+	},
+		fastRetry,
+		replication.OnError(func(err error) { reported = append(reported, err) }),
+	)
+	require.NoError(t, err)
+
+	err = l.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"one", "two"}, got)
+	require.Len(t, reported, 1)
+	assert.ErrorIs(t, reported[0], assert.AnError)
+	assert.True(t, strings.HasPrefix(second.queries()[0], `START_REPLICATION SLOT "orders" LOGICAL 0/67`), second.queries())
+}
@@ -0,0 +1,80 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// resultLimit is the maximum number of rows and bytes that the Query method
+// reads. Zero means no limit.
+type resultLimit struct {
+	rows  int64
+	bytes int64
+}
+
+type resultLimitKey struct{}
+
+// WithResultLimit returns a copy of the ctx that overrides the MaxResultRows
+// and MaxResultBytes limits of the Query calls made with it. Zero values keep
+// the limits of the PGX, and negative values remove them.
+func WithResultLimit(ctx context.Context, rows, bytes int64) context.Context {
+	return context.WithValue(ctx, resultLimitKey{}, resultLimit{
+		rows:  rows,
+		bytes: bytes,
+	})
+}
+
+// resultLimit returns the limits of the PGX overridden by the ctx.
+func (p *PGX) resultLimit(ctx context.Context) resultLimit {
+	l := p.results
+	override, ok := ctx.Value(resultLimitKey{}).(resultLimit)
+	if !ok {
+		return l
+	}
+	if override.rows != 0 {
+		l.rows = max(override.rows, 0)
+	}
+	if override.bytes != 0 {
+		l.bytes = max(override.bytes, 0)
+	}
+
+	return l
+}
+
+// resultCounter counts the rows and bytes read by a Query call. The bytes are
+// counted when there is a limit on them, or the measure is set.
+type resultCounter struct {
+	limit   resultLimit
+	measure bool
+	rows    int64
+	bytes   int64
+}
+
+// add counts the current row of the rows, and returns an ErrResultTooLarge
+// error wrapped in a *retry.StopError if any of the limits are exceeded.
+func (c *resultCounter) add(rows pgx.Rows) error {
+	c.rows++
+	if c.limit.rows > 0 && c.rows > c.limit.rows {
+		return &retry.StopError{
+			Err: fmt.Errorf("%w: more than %d rows, read the rows in pages or with a cursor",
+				ErrResultTooLarge, c.limit.rows),
+		}
+	}
+	if c.limit.bytes <= 0 && !c.measure {
+		return nil
+	}
+	for _, v := range rows.RawValues() {
+		c.bytes += int64(len(v))
+	}
+	if c.limit.bytes > 0 && c.bytes > c.limit.bytes {
+		return &retry.StopError{
+			Err: fmt.Errorf("%w: more than %d bytes, read the rows in pages or with a cursor",
+				ErrResultTooLarge, c.limit.bytes),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newResultSimulator(t *testing.T) *dbtesting.Simulator {
+	t.Helper()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SELECT name`).Return([]string{"name"},
+		[]any{"arsham"},
+		[]any{"john"},
+		[]any{"jane"},
+	)
+
+	return sim
+}
+
+func queryNames(ctx context.Context, tr *dbtools.PGX) ([]string, error) {
+	var names []string
+	err := tr.Query(ctx, func(rows pgx.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	}, "SELECT name FROM users")
+	return names, err
+}
+
+func TestMaxResultRows(t *testing.T) {
+	t.Parallel()
+	t.Run("Within", testMaxResultRowsWithin)
+	t.Run("Exceeded", testMaxResultRowsExceeded)
+	t.Run("Override", testMaxResultRowsOverride)
+	t.Run("Remove", testMaxResultRowsRemove)
+}
+
+func testMaxResultRowsWithin(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(newResultSimulator(t), dbtools.MaxResultRows(3))
+	require.NoError(t, err)
+
+	names, err := queryNames(context.Background(), tr)
+	require.NoError(t, err)
+	assert.Len(t, names, 3)
+}
+
+func testMaxResultRowsExceeded(t *testing.T) {
+	t.Parallel()
+	sim := newResultSimulator(t)
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(5, time.Millisecond),
+		dbtools.MaxResultRows(2),
+	)
+	require.NoError(t, err)
+
+	names, err := queryNames(context.Background(), tr)
+	require.ErrorIs(t, err, dbtools.ErrResultTooLarge)
+	assert.Contains(t, err.Error(), "2 rows")
+	assert.Len(t, names, 2)
+	assert.Len(t, sim.SQL(), 1, "query should not be retried")
+}
+
+func testMaxResultRowsOverride(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(newResultSimulator(t), dbtools.MaxResultRows(10))
+	require.NoError(t, err)
+
+	ctx := dbtools.WithResultLimit(context.Background(), 1, 0)
+	_, err = queryNames(ctx, tr)
+	assert.ErrorIs(t, err, dbtools.ErrResultTooLarge)
+}
+
+func testMaxResultRowsRemove(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(newResultSimulator(t), dbtools.MaxResultRows(1))
+	require.NoError(t, err)
+
+	ctx := dbtools.WithResultLimit(context.Background(), -1, 0)
+	names, err := queryNames(ctx, tr)
+	require.NoError(t, err)
+	assert.Len(t, names, 3)
+}
+
+func TestMaxResultBytes(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(newResultSimulator(t), dbtools.MaxResultBytes(10))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	names, err := queryNames(ctx, tr)
+	require.ErrorIs(t, err, dbtools.ErrResultTooLarge)
+	assert.Contains(t, err.Error(), "10 bytes")
+	assert.Equal(t, []string{"arsham", "john"}, names)
+
+	ctx = dbtools.WithResultLimit(ctx, 0, 14)
+	names, err = queryNames(ctx, tr)
+	require.NoError(t, err)
+	assert.Len(t, names, 3)
+}
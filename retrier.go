@@ -0,0 +1,67 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/arsham/retry/v3"
+)
+
+// Retrier is the contract for a retry engine. The DoContext method should
+// call the fn until it succeeds, or the retries are exhausted, or the ctx is
+// cancelled, or the fn returns an error that should not be retried. The
+// errors that should not be retried are recognised with the StopCause
+// function. It lets you use another retry library, for example the backoff
+// library:
+//
+//	type backoffRetrier struct{}
+//
+//	func (backoffRetrier) DoContext(ctx context.Context, fn func() error) error {
+//		return backoff.Retry(func() error {
+//			err := fn()
+//			if cause, ok := dbtools.StopCause(err); ok {
+//				return backoff.Permanent(cause)
+//			}
+//			return err
+//		}, backoff.WithContext(backoff.NewExponentialBackOff(), ctx))
+//	}
+type Retrier interface {
+	DoContext(ctx context.Context, fn func() error) error
+}
+
+// StopCause returns the error wrapped by the err if the err should not be
+// retried, and true. It returns the err and false otherwise.
+func StopCause(err error) (error, bool) {
+	var stop *retry.StopError
+	if errors.As(err, &stop) {
+		return stop.Err, true
+	}
+
+	return err, false
+}
+
+// do calls the fn with the Retrier set with the WithRetrier option, or with
+// the loop.
+func (p *PGX) do(ctx context.Context, loop retry.Retry, fn func() error) error {
+	if p.retrier == nil {
+		loop, fn = p.slept(ctx, loop, fn)
+		return loop.DoContext(ctx, fn)
+	}
+	err := p.retrier.DoContext(ctx, fn)
+	if cause, ok := StopCause(err); ok {
+		return cause
+	}
+
+	return err
+}
+
+// delegated returns the loop with unlimited attempts when a Retrier decides
+// the number of the attempts, so the Budget is spent on every retried error.
+func (p *PGX) delegated(loop retry.Retry) retry.Retry {
+	if p.retrier != nil {
+		loop.Attempts = math.MaxInt
+	}
+
+	return loop
+}
@@ -0,0 +1,112 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRetrier retries the functions without a delay for the given
+// attempts.
+type countingRetrier struct {
+	attempts int
+	calls    int
+}
+
+func (c *countingRetrier) DoContext(ctx context.Context, fn func() error) error {
+	var err error
+	for range c.attempts {
+		c.calls++
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		if cause, ok := dbtools.StopCause(err); ok {
+			return cause
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func TestWithRetrier(t *testing.T) {
+	t.Parallel()
+	t.Run("Transaction", testWithRetrierTransaction)
+	t.Run("Stop", testWithRetrierStop)
+	t.Run("Exec", testWithRetrierExec)
+	t.Run("WaitForReady", testWithRetrierWaitForReady)
+}
+
+func testWithRetrierTransaction(t *testing.T) {
+	t.Parallel()
+	r := &countingRetrier{attempts: 4}
+	tr, err := dbtools.New(dbtesting.NewSimulator(), dbtools.WithRetrier(r))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), failingTx(assert.AnError, assert.AnError, assert.AnError))
+	require.NoError(t, err)
+	assert.Equal(t, 4, r.calls)
+	assert.Contains(t, tr.Describe().Features, "WithRetrier")
+}
+
+func testWithRetrierStop(t *testing.T) {
+	t.Parallel()
+	r := &countingRetrier{attempts: 4}
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.WithRetrier(r),
+		dbtools.WithClassifier(func(error) bool { return false }),
+	)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), failingTx(assert.AnError))
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, r.calls)
+	var txErr *dbtools.TxError
+	assert.ErrorAs(t, err, &txErr)
+}
+
+func testWithRetrierExec(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^DELETE").Error(&pgconn.ConnectError{}).Times(2)
+	sim.On("^DELETE").Exec("DELETE 1")
+	r := &countingRetrier{attempts: 3}
+	tr, err := dbtools.New(sim, dbtools.WithRetrier(r))
+	require.NoError(t, err)
+
+	tag, err := tr.Exec(context.Background(), "DELETE FROM sessions")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, tag.RowsAffected())
+	assert.Equal(t, 3, r.calls)
+
+	err = tr.Query(context.Background(), func(pgx.Rows) error { return nil }, "SELECT 1")
+	assert.Error(t, err, "the simulator has no rule for the query")
+	assert.Equal(t, 6, r.calls)
+}
+
+func testWithRetrierWaitForReady(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("PING").Error(&pgconn.ConnectError{}).Times(1)
+	r := &countingRetrier{attempts: 2}
+	tr, err := dbtools.New(sim, dbtools.WithRetrier(r))
+	require.NoError(t, err)
+
+	require.NoError(t, tr.WaitForReady(context.Background()))
+	assert.Equal(t, 2, r.calls)
+}
+
+func TestStopCause(t *testing.T) {
+	t.Parallel()
+	err, ok := dbtools.StopCause(assert.AnError)
+	assert.False(t, ok)
+	assert.Equal(t, assert.AnError, err)
+}
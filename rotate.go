@@ -0,0 +1,250 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// rotateTimeout bounds the creation of a new pool when it is rotated.
+const rotateTimeout = 30 * time.Second
+
+// PoolFactory creates a new Pool, for example with the credentials read from
+// a secret store.
+type PoolFactory func(ctx context.Context) (Pool, error)
+
+// RotatingPool is a Pool that recreates the underlying pool with the factory
+// when the authentication fails, for example after the password is rotated,
+// or when a rotation signal is received. The previous pool is closed in the
+// background if it has a Close method. It is safe for concurrent use.
+//
+// The Begin calls that fail with an authentication error return the error
+// after the pool is recreated, therefore the next attempt of the transaction
+// uses the new pool.
+type RotatingPool struct {
+	factory PoolFactory
+	// rotating serialises the rotations, so the Begin calls are not blocked
+	// while the new pool is being created.
+	rotating sync.Mutex
+
+	mu         sync.RWMutex
+	pool       Pool
+	generation int
+}
+
+// NewRotatingPool creates the first pool with the factory. The pool is
+// recreated each time the rotate channel receives a value, until the ctx is
+// cancelled. The rotate channel can be nil.
+func NewRotatingPool(ctx context.Context, factory PoolFactory, rotate <-chan struct{}) (*RotatingPool, error) {
+	if factory == nil {
+		return nil, ErrEmptyDatabase
+	}
+	pool, err := factory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating pool: %w", err)
+	}
+	if pool == nil {
+		return nil, ErrEmptyDatabase
+	}
+	r := &RotatingPool{
+		factory: factory,
+		pool:    pool,
+	}
+	if rotate != nil {
+		go r.watch(ctx, rotate)
+	}
+
+	return r, nil
+}
+
+func (r *RotatingPool) watch(ctx context.Context, rotate <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-rotate:
+			if !ok {
+				return
+			}
+			_, gen := r.current()
+			//nolint:errcheck // the current pool is kept on errors.
+			r.rotate(ctx, gen)
+		}
+	}
+}
+
+// current returns the current pool and its generation.
+func (r *RotatingPool) current() (Pool, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool, r.generation
+}
+
+// Rotate recreates the pool with the factory. The current pool is kept if
+// the factory returns an error. The factory receives a context that is not
+// cancelled with the ctx, and times out after 30s.
+func (r *RotatingPool) Rotate(ctx context.Context) error {
+	_, gen := r.current()
+	return r.rotate(ctx, gen)
+}
+
+// rotate recreates the pool if it is still at the gen generation, so the
+// concurrent failures of the same pool recreate it once. The new pool is
+// created without holding the lock of the current pool, with a context that
+// is detached from the caller's, so a cancelled caller doesn't abort the
+// rotation for the others.
+func (r *RotatingPool) rotate(ctx context.Context, gen int) error {
+	r.rotating.Lock()
+	defer r.rotating.Unlock()
+	if _, current := r.current(); current != gen {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rotateTimeout)
+	defer cancel()
+	pool, err := r.factory(ctx)
+	if err != nil {
+		return fmt.Errorf("recreating pool: %w", err)
+	}
+	if pool == nil {
+		return ErrEmptyDatabase
+	}
+
+	r.mu.Lock()
+	old := r.pool
+	r.pool = pool
+	r.generation++
+	r.mu.Unlock()
+	if c, ok := old.(interface{ Close() }); ok {
+		// Closing a pgxpool.Pool waits for the connections to be released.
+		go c.Close()
+	}
+
+	return nil
+}
+
+// checkAuth recreates the pool of the gen generation if the err is an
+// authentication error.
+func (r *RotatingPool) checkAuth(ctx context.Context, gen int, err error) {
+	if IsAuthError(err) {
+		//nolint:errcheck // the original error is returned.
+		r.rotate(ctx, gen)
+	}
+}
+
+// Close closes the current pool if it has a Close method.
+func (r *RotatingPool) Close() {
+	pool, _ := r.current()
+	if c, ok := pool.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
+
+// Begin starts a transaction on the current pool.
+func (r *RotatingPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	pool, gen := r.current()
+	tx, err := pool.Begin(ctx)
+	r.checkAuth(ctx, gen, err)
+
+	return tx, err
+}
+
+// BeginTx starts a transaction with the options on the current pool. It
+// returns an ErrNoTxBeginner error if the pool doesn't implement the
+// TxBeginner interface.
+func (r *RotatingPool) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	pool, gen := r.current()
+	b, ok := pool.(TxBeginner)
+	if !ok {
+		return nil, &retry.StopError{Err: ErrNoTxBeginner}
+	}
+	tx, err := b.BeginTx(ctx, opts)
+	r.checkAuth(ctx, gen, err)
+
+	return tx, err
+}
+
+// Ping pings the current pool. It returns nil if the pool doesn't implement
+// the Pinger interface.
+func (r *RotatingPool) Ping(ctx context.Context) error {
+	pool, gen := r.current()
+	p, ok := pool.(Pinger)
+	if !ok {
+		return nil
+	}
+	err := p.Ping(ctx)
+	r.checkAuth(ctx, gen, err)
+
+	return err
+}
+
+func (r *RotatingPool) querier() (Querier, int, error) {
+	pool, gen := r.current()
+	q, ok := pool.(Querier)
+	if !ok {
+		return nil, gen, &retry.StopError{Err: ErrNoQuerier}
+	}
+
+	return q, gen, nil
+}
+
+// Exec runs the query on the current pool.
+func (r *RotatingPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	q, gen, err := r.querier()
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	tag, err := q.Exec(ctx, sql, args...)
+	r.checkAuth(ctx, gen, err)
+
+	return tag, err
+}
+
+// Query runs the query on the current pool.
+func (r *RotatingPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q, gen, err := r.querier()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.Query(ctx, sql, args...)
+	r.checkAuth(ctx, gen, err)
+
+	return rows, err
+}
+
+// QueryRow runs the query on the current pool. As the error is only known
+// when the row is scanned, the pool is recreated when the Scan method returns
+// an authentication error.
+func (r *RotatingPool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	q, gen, err := r.querier()
+	if err != nil {
+		return errRow{err: err}
+	}
+
+	return &rotatingRow{
+		Row: q.QueryRow(ctx, sql, args...),
+		ctx: ctx,
+		r:   r,
+		gen: gen,
+	}
+}
+
+// rotatingRow checks the error of scanning the Row for authentication
+// failures.
+type rotatingRow struct {
+	pgx.Row
+	ctx context.Context //nolint:containedctx // the query is run on Scan.
+	r   *RotatingPool
+	gen int
+}
+
+func (w *rotatingRow) Scan(dest ...any) error {
+	err := w.Row.Scan(dest...)
+	w.r.checkAuth(w.ctx, w.gen, err)
+
+	return err //nolint:wrapcheck // the row is transparent.
+}
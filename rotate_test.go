@@ -0,0 +1,222 @@
+package dbtools_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closingSimulator records when it is closed.
+type closingSimulator struct {
+	*dbtesting.Simulator
+	closed atomic.Bool
+}
+
+func (c *closingSimulator) Close() { c.closed.Store(true) }
+
+// simFactory returns the simulators in order.
+type simFactory struct {
+	mu   sync.Mutex
+	sims []*closingSimulator
+	err  error
+}
+
+func (f *simFactory) create(context.Context) (dbtools.Pool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	sim := f.sims[0]
+	f.sims = f.sims[1:]
+
+	return sim, nil
+}
+
+func newClosingSimulators(n int) []*closingSimulator {
+	ret := make([]*closingSimulator, n)
+	for i := range ret {
+		ret[i] = &closingSimulator{Simulator: dbtesting.NewSimulator()}
+	}
+	return ret
+}
+
+func TestRotatingPool(t *testing.T) {
+	t.Parallel()
+	t.Run("Factory", testRotatingPoolFactory)
+	t.Run("AuthError", testRotatingPoolAuthError)
+	t.Run("QueryRowAuthError", testRotatingPoolQueryRowAuthError)
+	t.Run("Signal", testRotatingPoolSignal)
+	t.Run("RotateError", testRotatingPoolRotateError)
+	t.Run("Interfaces", testRotatingPoolInterfaces)
+	t.Run("SlowFactory", testRotatingPoolSlowFactory)
+}
+
+func testRotatingPoolFactory(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, err := dbtools.NewRotatingPool(ctx, nil, nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+
+	f := &simFactory{err: assert.AnError}
+	_, err = dbtools.NewRotatingPool(ctx, f.create, nil)
+	assert.ErrorIs(t, err, assert.AnError)
+
+	_, err = dbtools.NewRotatingPool(ctx, func(context.Context) (dbtools.Pool, error) {
+		return nil, nil
+	}, nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func testRotatingPoolAuthError(t *testing.T) {
+	t.Parallel()
+	sims := newClosingSimulators(2)
+	sims[0].On(`^BEGIN$`).Error(&pgconn.PgError{Code: "28P01"})
+	f := &simFactory{sims: sims}
+	ctx := context.Background()
+	pool, err := dbtools.NewRotatingPool(ctx, f.create, nil)
+	require.NoError(t, err)
+
+	tr, err := dbtools.New(pool, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+	err = tr.Transaction(ctx, func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"BEGIN"}, sims[0].SQL())
+	assert.Equal(t, []string{"BEGIN", "COMMIT"}, sims[1].SQL())
+	assert.Eventually(t, sims[0].closed.Load, time.Second, time.Millisecond)
+	assert.False(t, sims[1].closed.Load())
+
+	pool.Close()
+	assert.True(t, sims[1].closed.Load())
+}
+
+func testRotatingPoolQueryRowAuthError(t *testing.T) {
+	t.Parallel()
+	sims := newClosingSimulators(2)
+	sims[0].On(`^SELECT`).Error(&pgconn.PgError{Code: "28P01"})
+	sims[1].On(`^SELECT`).Return([]string{"n"}, []any{int64(1)})
+	f := &simFactory{sims: sims}
+	ctx := context.Background()
+	pool, err := dbtools.NewRotatingPool(ctx, f.create, nil)
+	require.NoError(t, err)
+
+	var n int64
+	err = pool.QueryRow(ctx, "SELECT 1").Scan(&n)
+	require.True(t, dbtools.IsAuthError(err))
+	assert.Eventually(t, sims[0].closed.Load, time.Second, time.Millisecond)
+
+	require.NoError(t, pool.QueryRow(ctx, "SELECT 1").Scan(&n))
+	assert.EqualValues(t, 1, n)
+	assert.Equal(t, []string{"SELECT 1"}, sims[1].SQL())
+}
+
+func testRotatingPoolSignal(t *testing.T) {
+	t.Parallel()
+	sims := newClosingSimulators(2)
+	f := &simFactory{sims: sims}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rotate := make(chan struct{})
+	pool, err := dbtools.NewRotatingPool(ctx, f.create, rotate)
+	require.NoError(t, err)
+
+	rotate <- struct{}{}
+	assert.Eventually(t, sims[0].closed.Load, time.Second, time.Millisecond)
+	require.NoError(t, pool.Ping(ctx))
+	assert.Equal(t, []string{"PING"}, sims[1].SQL())
+}
+
+func testRotatingPoolRotateError(t *testing.T) {
+	t.Parallel()
+	sims := newClosingSimulators(1)
+	f := &simFactory{sims: sims}
+	ctx := context.Background()
+	pool, err := dbtools.NewRotatingPool(ctx, f.create, nil)
+	require.NoError(t, err)
+
+	f.err = assert.AnError
+	err = pool.Rotate(ctx)
+	require.ErrorIs(t, err, assert.AnError)
+	assert.False(t, sims[0].closed.Load())
+
+	_, err = pool.Begin(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN"}, sims[0].SQL())
+}
+
+func testRotatingPoolInterfaces(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pool, err := dbtools.NewRotatingPool(ctx, func(context.Context) (dbtools.Pool, error) {
+		return mocks.NewPool(t), nil
+	}, nil)
+	require.NoError(t, err)
+
+	_, err = pool.BeginTx(ctx, pgx.TxOptions{})
+	assert.ErrorIs(t, err, dbtools.ErrNoTxBeginner)
+	_, err = pool.Exec(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, dbtools.ErrNoQuerier)
+	_, err = pool.Query(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, dbtools.ErrNoQuerier)
+	assert.ErrorIs(t, pool.QueryRow(ctx, "SELECT 1").Scan(), dbtools.ErrNoQuerier)
+	assert.NoError(t, pool.Ping(ctx))
+	assert.NotPanics(t, pool.Close)
+}
+
+func testRotatingPoolSlowFactory(t *testing.T) {
+	t.Parallel()
+	sims := newClosingSimulators(2)
+	release := make(chan struct{})
+	calls := 0
+	factory := func(ctx context.Context) (dbtools.Pool, error) {
+		calls++
+		if calls == 1 {
+			return sims[0], nil
+		}
+		<-release
+		// The factory is not cancelled with the caller.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return sims[1], nil
+	}
+	r, err := dbtools.NewRotatingPool(context.Background(), factory, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Rotate(ctx) }()
+	cancel()
+
+	// The current pool is used while the new one is being created.
+	begun := make(chan error)
+	go func() {
+		tx, err := r.Begin(context.Background())
+		if err == nil {
+			err = tx.Rollback(context.Background())
+		}
+		begun <- err
+	}()
+	select {
+	case err := <-begun:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Begin is blocked by the rotation")
+	}
+	assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, sims[0].SQL())
+
+	close(release)
+	require.NoError(t, <-done)
+	assert.Eventually(t, sims[0].closed.Load, time.Second, time.Millisecond)
+}
@@ -0,0 +1,222 @@
+// Package saga runs a workflow as a chain of steps, each in its own retried
+// transaction. When a step fails, the compensations of the steps that have
+// completed are run in the reverse order, so the workflow can be undone
+// across the services it has touched:
+//
+//	s, err := saga.New(tr, []saga.Step{
+//		{Name: "reserve-stock", Forward: reserveStock, Compensate: releaseStock},
+//		{Name: "charge-card", Forward: chargeCard, Compensate: refundCard},
+//		{Name: "ship", Forward: ship},
+//	})
+//	// handle the error
+//	err = s.Run(ctx)
+//
+// The failed step is not compensated, as its transaction is rolled back.
+// Therefore each step should do its side effects on other services last, or
+// its compensation should be safe to run for a partially done step.
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// Func is the forward or the compensation function of a step.
+type Func func(ctx context.Context, tx pgx.Tx) error
+
+// Step is a named step of a Saga.
+type Step struct {
+	Name    string
+	Forward Func
+	// Compensate undoes the Forward function. It can be nil if the step
+	// doesn't need to be undone.
+	Compensate Func
+}
+
+// Error is returned from the Run method when a step fails. It wraps the
+// error of the step and the errors of the compensations.
+type Error struct {
+	// Step is the name of the failed step.
+	Step string
+	Err  error
+	// Compensated lists the names of the steps that are compensated, in
+	// the order they are run.
+	Compensated []string
+	// CompensationErr is the joined errors of the compensations that failed
+	// after all the retries.
+	CompensationErr error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("step %q: %v", e.Step, e.Err)
+	if e.CompensationErr != nil {
+		msg += fmt.Sprintf("; compensating: %v", strings.ReplaceAll(e.CompensationErr.Error(), "\n", "; "))
+	}
+	return msg
+}
+
+// Unwrap returns the error of the step and the errors of the compensations.
+func (e *Error) Unwrap() []error {
+	if e.CompensationErr == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.CompensationErr}
+}
+
+// ConfigFunc is used for configuring the Saga.
+type ConfigFunc func(*Saga)
+
+// CompensationRetry sets the retry policy of each compensation, on top of the
+// retries of the Transactioner. The default is 5 attempts with an
+// incremental delay of 1s.
+func CompensationRetry(r retry.Retry) ConfigFunc {
+	return func(s *Saga) {
+		s.retry = r
+	}
+}
+
+// OnCompensationError sets the function that is called when an attempt of a
+// compensation fails.
+func OnCompensationError(fn func(step string, err error)) ConfigFunc {
+	return func(s *Saga) {
+		s.onError = fn
+	}
+}
+
+// Saga is a list of steps with their compensations. Each call to Add returns
+// a new Saga, therefore a Saga can be shared and extended without affecting
+// the other users.
+type Saga struct {
+	tr      dbtools.Transactioner
+	steps   []Step
+	retry   retry.Retry
+	onError func(step string, err error)
+}
+
+// New returns a Saga that runs the steps in transactions with the tr. It
+// returns a dbtools.ErrEmptyDatabase error if the tr is nil, an ErrNoSteps
+// error if there are no steps, an ErrNilStep error if a forward function is
+// nil, and an ErrDuplicateStep error if two steps have the same name.
+func New(tr dbtools.Transactioner, steps []Step, conf ...ConfigFunc) (*Saga, error) {
+	if tr == nil {
+		return nil, dbtools.ErrEmptyDatabase
+	}
+	if err := validate(steps); err != nil {
+		return nil, err
+	}
+	s := &Saga{
+		tr:    tr,
+		steps: slices.Clone(steps),
+		retry: retry.Retry{
+			Attempts: 5,
+			Delay:    time.Second,
+			Method:   retry.IncrementalDelay,
+		},
+	}
+	for _, fn := range conf {
+		fn(s)
+	}
+	if s.retry.Attempts < 1 {
+		s.retry.Attempts = 1
+	}
+
+	return s, nil
+}
+
+// Add returns a new Saga with the step added to the end of the steps. The
+// compensate function can be nil. It returns the same errors as the New
+// function.
+func (s *Saga) Add(name string, forward, compensate Func) (*Saga, error) {
+	steps := make([]Step, len(s.steps), len(s.steps)+1)
+	copy(steps, s.steps)
+	steps = append(steps, Step{Name: name, Forward: forward, Compensate: compensate})
+	if err := validate(steps); err != nil {
+		return nil, err
+	}
+	ret := *s
+	ret.steps = steps
+
+	return &ret, nil
+}
+
+// Steps returns a copy of the steps.
+func (s *Saga) Steps() []Step {
+	steps := make([]Step, len(s.steps))
+	copy(steps, s.steps)
+
+	return steps
+}
+
+func validate(steps []Step) error {
+	if len(steps) == 0 {
+		return dbtools.ErrNoSteps
+	}
+	seen := make(map[string]struct{}, len(steps))
+	for i, step := range steps {
+		if step.Forward == nil {
+			return fmt.Errorf("%w: step %q at %d", dbtools.ErrNilStep, step.Name, i)
+		}
+		if _, ok := seen[step.Name]; ok {
+			return fmt.Errorf("%w: %q", dbtools.ErrDuplicateStep, step.Name)
+		}
+		seen[step.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// Run runs the steps in order, each in its own transaction. If a step fails,
+// the compensations of the completed steps are run in the reverse order and
+// an *Error is returned. A compensation that fails after all the retries
+// doesn't stop the other compensations. The compensations are run even if
+// the ctx is cancelled, with a context that keeps its values.
+func (s *Saga) Run(ctx context.Context) error {
+	for i, step := range s.steps {
+		err := s.tr.Transaction(ctx, func(tx pgx.Tx) error {
+			return step.Forward(ctx, tx)
+		})
+		if err == nil {
+			continue
+		}
+		sagaErr := &Error{Step: step.Name, Err: err}
+		s.compensate(context.WithoutCancel(ctx), s.steps[:i], sagaErr)
+
+		return sagaErr
+	}
+
+	return nil
+}
+
+// compensate runs the compensations of the steps in the reverse order.
+func (s *Saga) compensate(ctx context.Context, steps []Step, sagaErr *Error) {
+	var errs []error
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := steps[i]
+		if step.Compensate == nil {
+			continue
+		}
+		err := s.retry.DoContext(ctx, func() error {
+			err := s.tr.Transaction(ctx, func(tx pgx.Tx) error {
+				return step.Compensate(ctx, tx)
+			})
+			if err != nil && s.onError != nil {
+				s.onError(step.Name, err)
+			}
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("step %q: %w", step.Name, err))
+			continue
+		}
+		sagaErr.Compensated = append(sagaErr.Compensated, step.Name)
+	}
+	sagaErr.CompensationErr = errors.Join(errs...)
+}
@@ -0,0 +1,198 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/saga"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTr runs the functions without a transaction.
+type fakeTr struct{}
+
+func (fakeTr) Transaction(_ context.Context, fns ...func(pgx.Tx) error) error {
+	for _, fn := range fns {
+		if err := fn(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recorder records the names of the functions that are run.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) fn(name string, err error) saga.Func {
+	return func(context.Context, pgx.Tx) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.calls = append(r.calls, name)
+		return err
+	}
+}
+
+var fastRetry = saga.CompensationRetry(retry.Retry{Attempts: 3, Delay: time.Millisecond})
+
+// newSaga returns a Saga of the steps.
+func newSaga(t *testing.T, steps []saga.Step, conf ...saga.ConfigFunc) *saga.Saga {
+	t.Helper()
+	s, err := saga.New(fakeTr{}, steps, conf...)
+	require.NoError(t, err)
+	return s
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	r := &recorder{}
+	a := saga.Step{Name: "a", Forward: r.fn("a", nil)}
+	_, err := saga.New(nil, []saga.Step{a})
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+
+	tcs := map[string]struct {
+		steps []saga.Step
+		want  error
+	}{
+		"no steps":  {nil, dbtools.ErrNoSteps},
+		"nil step":  {[]saga.Step{a, {Name: "b", Compensate: r.fn("undo b", nil)}}, dbtools.ErrNilStep},
+		"duplicate": {[]saga.Step{a, a}, dbtools.ErrDuplicateStep},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := saga.New(fakeTr{}, tc.steps)
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+	assert.Empty(t, r.calls)
+}
+
+func TestSagaAdd(t *testing.T) {
+	t.Parallel()
+	r := &recorder{}
+	base := newSaga(t, []saga.Step{{Name: "a", Forward: r.fn("a", nil), Compensate: r.fn("undo a", nil)}})
+	s, err := base.Add("b", r.fn("b", nil), r.fn("undo b", nil))
+	require.NoError(t, err)
+	assert.Len(t, base.Steps(), 1)
+	require.Len(t, s.Steps(), 2)
+	assert.Equal(t, "b", s.Steps()[1].Name)
+
+	_, err = base.Add("c", nil, nil)
+	assert.ErrorIs(t, err, dbtools.ErrNilStep)
+	_, err = base.Add("a", r.fn("a", nil), nil)
+	assert.ErrorIs(t, err, dbtools.ErrDuplicateStep)
+
+	err = s.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, r.calls)
+}
+
+func TestSagaRun(t *testing.T) {
+	t.Parallel()
+	t.Run("Compensate", testSagaRunCompensate)
+	t.Run("CompensationRetry", testSagaRunCompensationRetry)
+	t.Run("CompensationError", testSagaRunCompensationError)
+	t.Run("Cancelled", testSagaRunCancelled)
+}
+
+func testSagaRunCompensate(t *testing.T) {
+	t.Parallel()
+	r := &recorder{}
+	s := newSaga(t, []saga.Step{
+		{Name: "a", Forward: r.fn("a", nil), Compensate: r.fn("undo a", nil)},
+		{Name: "b", Forward: r.fn("b", nil)},
+		{Name: "c", Forward: r.fn("c", nil), Compensate: r.fn("undo c", nil)},
+		{Name: "d", Forward: r.fn("d", assert.AnError), Compensate: r.fn("undo d", nil)},
+		{Name: "e", Forward: r.fn("e", nil), Compensate: r.fn("undo e", nil)},
+	}, fastRetry)
+
+	err := s.Run(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	var sagaErr *saga.Error
+	require.ErrorAs(t, err, &sagaErr)
+	assert.Equal(t, "d", sagaErr.Step)
+	assert.Equal(t, []string{"c", "a"}, sagaErr.Compensated)
+	assert.NoError(t, sagaErr.CompensationErr)
+	assert.Equal(t, []string{"a", "b", "c", "d", "undo c", "undo a"}, r.calls)
+}
+
+func testSagaRunCompensationRetry(t *testing.T) {
+	t.Parallel()
+	r := &recorder{}
+	failures := 2
+	undo := func(ctx context.Context, tx pgx.Tx) error {
+		if failures > 0 {
+			failures--
+			return assert.AnError
+		}
+		return r.fn("undo a", nil)(ctx, tx)
+	}
+	var reported []string
+	s := newSaga(t, []saga.Step{
+		{Name: "a", Forward: r.fn("a", nil), Compensate: undo},
+		{Name: "b", Forward: r.fn("b", errors.New("b failed"))},
+	}, fastRetry, saga.OnCompensationError(func(step string, err error) {
+		assert.ErrorIs(t, err, assert.AnError)
+		reported = append(reported, step)
+	}))
+
+	err := s.Run(context.Background())
+	var sagaErr *saga.Error
+	require.ErrorAs(t, err, &sagaErr)
+	assert.NoError(t, sagaErr.CompensationErr)
+	assert.Equal(t, []string{"a"}, sagaErr.Compensated)
+	assert.Equal(t, []string{"a", "a"}, reported)
+	assert.Equal(t, []string{"a", "b", "undo a"}, r.calls)
+}
+
+func testSagaRunCompensationError(t *testing.T) {
+	t.Parallel()
+	r := &recorder{}
+	errUndo := errors.New("undo failed")
+	s := newSaga(t, []saga.Step{
+		{Name: "a", Forward: r.fn("a", nil), Compensate: r.fn("undo a", nil)},
+		{Name: "b", Forward: r.fn("b", nil), Compensate: r.fn("undo b", errUndo)},
+		{Name: "c", Forward: r.fn("c", assert.AnError)},
+	}, fastRetry)
+
+	err := s.Run(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	assert.ErrorIs(t, err, errUndo)
+	assert.Contains(t, err.Error(), `step "c"`)
+	assert.Contains(t, err.Error(), `compensating: step "b"`)
+
+	var sagaErr *saga.Error
+	require.ErrorAs(t, err, &sagaErr)
+	assert.Equal(t, []string{"a"}, sagaErr.Compensated)
+	assert.Equal(t, []string{"a", "b", "c", "undo b", "undo b", "undo b", "undo a"}, r.calls)
+}
+
+func testSagaRunCancelled(t *testing.T) {
+	t.Parallel()
+	r := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newSaga(t, []saga.Step{
+		{Name: "a", Forward: r.fn("a", nil), Compensate: func(ctx context.Context, _ pgx.Tx) error {
+			assert.NoError(t, ctx.Err())
+			return r.fn("undo a", nil)(ctx, nil)
+		}},
+		{Name: "b", Forward: func(ctx context.Context, _ pgx.Tx) error {
+			cancel()
+			return ctx.Err()
+		}},
+	}, fastRetry)
+
+	err := s.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"a", "undo a"}, r.calls)
+}
@@ -0,0 +1,95 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arsham/retry/v3"
+)
+
+// savepointCheck reports the savepoints that are not released when the
+// transaction is committed. If warn is nil, the transaction is stopped with an
+// ErrSavepointLeak error instead.
+type savepointCheck struct {
+	warn func(names []string)
+}
+
+// hook returns a statement hook that tracks the SAVEPOINT, RELEASE and
+// ROLLBACK TO statements of one attempt. The savepoints of the nested
+// transactions are managed by pgx and are not tracked.
+func (c *savepointCheck) hook() stmtHook {
+	var open []string
+
+	return stmtHook{
+		after: func(_ context.Context, s *statement) error {
+			if s.Err == nil {
+				open = trackSavepoint(open, s.SQL)
+			}
+
+			return nil
+		},
+		commit: func(context.Context) error {
+			if len(open) == 0 {
+				return nil
+			}
+			names := make([]string, len(open))
+			copy(names, open)
+			if c.warn != nil {
+				c.warn(names)
+				return nil
+			}
+
+			return &retry.StopError{
+				Err: fmt.Errorf("%w: %s", ErrSavepointLeak, strings.Join(names, ", ")),
+			}
+		},
+	}
+}
+
+// trackSavepoint returns the open savepoints after the sql is run.
+func trackSavepoint(open []string, sql string) []string {
+	fields := strings.Fields(strings.TrimRight(strings.TrimSpace(sql), ";"))
+	if len(fields) < 2 {
+		return open
+	}
+	keyword := strings.ToUpper(fields[0])
+	switch {
+	case keyword == "SAVEPOINT" && len(fields) == 2:
+		return append(open, identifier(fields[1]))
+	case keyword == "RELEASE":
+		name := fields[len(fields)-1]
+		if i := lastIndex(open, identifier(name)); i >= 0 {
+			// Releasing a savepoint releases the later ones too.
+			return open[:i]
+		}
+	case keyword == "ROLLBACK" && strings.EqualFold(fields[1], "TO"):
+		name := fields[len(fields)-1]
+		if i := lastIndex(open, identifier(name)); i >= 0 {
+			// The savepoint stays open but the later ones are destroyed.
+			return open[:i+1]
+		}
+	}
+
+	return open
+}
+
+// identifier returns the name as the server sees it. Unquoted names are folded
+// to lower case.
+func identifier(name string) string {
+	if len(name) > 1 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+
+	return strings.ToLower(name)
+}
+
+func lastIndex(names []string, name string) int {
+	for i := len(names) - 1; i >= 0; i-- {
+		if names[i] == name {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,122 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavepointLeak(t *testing.T) {
+	t.Parallel()
+	t.Run("Released", testSavepointLeakReleased)
+	t.Run("Fail", testSavepointLeakFail)
+	t.Run("Warn", testSavepointLeakWarn)
+	t.Run("RollbackTo", testSavepointLeakRollbackTo)
+}
+
+// execAll runs the queries in order and returns the first error.
+func execAll(ctx context.Context, tx pgx.Tx, queries ...string) error {
+	for _, q := range queries {
+		if _, err := tx.Exec(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func testSavepointLeakReleased(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db, dbtools.FailOnSavepointLeak())
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil).Times(4)
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		return execAll(ctx, tx,
+			"SAVEPOINT a",
+			`savepoint "B"`,
+			"INSERT INTO foo VALUES (1)",
+			"RELEASE SAVEPOINT A;",
+		)
+	})
+	require.NoError(t, err)
+}
+
+func testSavepointLeakFail(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db,
+		dbtools.Retry(10, time.Millisecond),
+		dbtools.FailOnSavepointLeak(),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil).Times(3)
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		return execAll(ctx, tx, "SAVEPOINT a", "SAVEPOINT b", "RELEASE b")
+	})
+	require.ErrorIs(t, err, dbtools.ErrSavepointLeak)
+	assert.Contains(t, err.Error(), "a")
+}
+
+func testSavepointLeakWarn(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	var leaked []string
+	tr, err := dbtools.New(db, dbtools.WarnOnSavepointLeak(func(names []string) {
+		leaked = names
+	}))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil).Twice()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		return execAll(ctx, tx, "SAVEPOINT a", "SAVEPOINT b")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, leaked)
+}
+
+func testSavepointLeakRollbackTo(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	var leaked []string
+	tr, err := dbtools.New(db, dbtools.WarnOnSavepointLeak(func(names []string) {
+		leaked = names
+	}))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil).Times(3)
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		return execAll(ctx, tx, "SAVEPOINT a", "SAVEPOINT b", "ROLLBACK TO SAVEPOINT a")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, leaked)
+}
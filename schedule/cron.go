@@ -0,0 +1,238 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCron is returned when a cron expression can't be parsed.
+var ErrInvalidCron = errors.New("invalid cron expression")
+
+// Cron is a parsed cron expression. It is safe for concurrent use.
+type Cron struct {
+	loc    *time.Location
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// anyDay is true if either the day of the month or the day of the week
+	// is a star, in which case both should match. Otherwise any of them
+	// should match.
+	anyDay bool
+}
+
+type bounds struct {
+	names    map[string]int
+	min, max int
+}
+
+var (
+	minutes = bounds{min: 0, max: 59}
+	hours   = bounds{min: 0, max: 23}
+	doms    = bounds{min: 1, max: 31}
+	months  = bounds{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// The day of the week accepts 7 for Sunday too.
+	dows = bounds{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard cron expression with five fields: minute,
+// hour, day of the month, month and day of the week. The fields accept
+// lists, ranges, steps and the three letter names of the months and the
+// days. The @yearly, @monthly, @weekly, @daily and @hourly descriptors are
+// accepted too. The expression is evaluated in UTC, unless it is prefixed
+// with the time zone:
+//
+//	CRON_TZ=Europe/London 30 2 * * mon-fri
+//
+// If both the day of the month and the day of the week are restricted, the
+// time matches if any of them match. The expressions that never match, for
+// example the 30th of February, are rejected.
+func ParseCron(expr string) (*Cron, error) {
+	c := &Cron{loc: time.UTC}
+	spec := strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(spec, "CRON_TZ="); ok {
+		name, fields, _ := strings.Cut(rest, " ")
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidCron, expr, err)
+		}
+		c.loc, spec = loc, strings.TrimSpace(fields)
+	}
+	if d, ok := descriptors[spec]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q: expected 5 fields, got %d", ErrInvalidCron, expr, len(fields))
+	}
+
+	var err error
+	parsers := []struct {
+		dst *uint64
+		b   bounds
+	}{
+		{&c.minute, minutes},
+		{&c.hour, hours},
+		{&c.dom, doms},
+		{&c.month, months},
+		{&c.dow, dows},
+	}
+	for i, p := range parsers {
+		*p.dst, err = parseField(fields[i], p.b)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidCron, expr, err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.anyDay = isStar(fields[2]) || isStar(fields[4])
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%w: %q: never matches", ErrInvalidCron, expr)
+	}
+
+	return c, nil
+}
+
+func isStar(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// parseField returns the bits of the values of the field.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		start, end := b.min, b.max
+		if !isStar(rng) {
+			lo, hi, isRange := strings.Cut(rng, "-")
+			var err error
+			start, err = b.value(lo)
+			if err != nil {
+				return 0, err
+			}
+			end = start
+			switch {
+			case isRange:
+				end, err = b.value(hi)
+				if err != nil {
+					return 0, err
+				}
+			case hasStep:
+				end = b.max
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (b bounds) value(s string) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+
+	return v, nil
+}
+
+// Location returns the time zone the expression is evaluated in.
+func (c *Cron) Location() *time.Location { return c.loc }
+
+// Next returns the first time after the t that matches the expression, in the
+// time zone of the expression. The clock times that are skipped by a daylight
+// saving change don't match, and the ones that happen twice only match at
+// their first occurrence. It returns the zero time if there is no matching
+// time in the next five years.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+
+	for t.Year() <= limit {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			// Adding to the instant keeps the first occurrence of the
+			// repeated hours.
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 || repeated(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// repeated returns true if the clock time of the t has already happened
+// before a daylight saving change.
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-12 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+
+	return earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute() && earlier.Day() == t.Day()
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDay {
+		return dom && dow
+	}
+
+	return dom || dow
+}
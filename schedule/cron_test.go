@@ -0,0 +1,119 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]string{
+		"empty":         "",
+		"few fields":    "* * * *",
+		"many fields":   "* * * * * *",
+		"minute range":  "60 * * * *",
+		"hour range":    "* 24 * * *",
+		"dom zero":      "* * 0 * *",
+		"bad month":     "* * * foo *",
+		"bad step":      "*/0 * * * *",
+		"bad step text": "*/x * * * *",
+		"reverse range": "30-10 * * * *",
+		"bad zone":      "CRON_TZ=Mars/Olympus * * * * *",
+		"february 30":   "0 0 30 2 *",
+		"april 31":      "0 0 31 4 *",
+	}
+	for name, expr := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := schedule.ParseCron(expr)
+			assert.ErrorIs(t, err, schedule.ErrInvalidCron)
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	t.Parallel()
+	// A Monday.
+	from := time.Date(2024, 1, 15, 10, 17, 30, 0, time.UTC)
+	tcs := map[string]struct {
+		expr string
+		want time.Time
+	}{
+		"every minute":   {"* * * * *", time.Date(2024, 1, 15, 10, 18, 0, 0, time.UTC)},
+		"step":           {"*/15 * * * *", time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)},
+		"list":           {"5,20,40 * * * *", time.Date(2024, 1, 15, 10, 20, 0, 0, time.UTC)},
+		"range step":     {"0 9-17/4 * * *", time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC)},
+		"start step":     {"0 20/2 * * *", time.Date(2024, 1, 15, 20, 0, 0, 0, time.UTC)},
+		"next day":       {"0 9 * * *", time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC)},
+		"weekday names":  {"0 9 * * sat,SUN", time.Date(2024, 1, 20, 9, 0, 0, 0, time.UTC)},
+		"sunday as 7":    {"0 9 * * 7", time.Date(2024, 1, 21, 9, 0, 0, 0, time.UTC)},
+		"month name":     {"0 0 1 mar *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		"leap day":       {"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		"day or weekday": {"0 0 20 * fri", time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)},
+		"day and star":   {"0 0 20 * *", time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)},
+		"next year":      {"0 0 1 1 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"hourly":         {"@hourly", time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		"weekly":         {"@weekly", time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c, err := schedule.ParseCron(tc.expr)
+			require.NoError(t, err)
+			got := c.Next(from)
+			assert.True(t, tc.want.Equal(got), "want %s, got %s", tc.want, got)
+		})
+	}
+}
+
+func TestCronTimeZone(t *testing.T) {
+	t.Parallel()
+	t.Run("Location", testCronTimeZoneLocation)
+	t.Run("SpringForward", testCronTimeZoneSpringForward)
+	t.Run("FallBack", testCronTimeZoneFallBack)
+}
+
+func testCronTimeZoneLocation(t *testing.T) {
+	t.Parallel()
+	c, err := schedule.ParseCron("CRON_TZ=Asia/Tokyo 0 9 * * *")
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", c.Location().String())
+
+	got := c.Next(time.Date(2024, 1, 15, 0, 30, 0, 0, time.UTC))
+	want := time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)
+	assert.True(t, want.Equal(got), "want %s, got %s", want, got)
+}
+
+func testCronTimeZoneSpringForward(t *testing.T) {
+	t.Parallel()
+	// The clocks go from 01:00 to 02:00 on 31 March 2024 in London.
+	c, err := schedule.ParseCron("CRON_TZ=Europe/London 30 1 * * *")
+	require.NoError(t, err)
+	loc := c.Location()
+
+	got := c.Next(time.Date(2024, 3, 30, 12, 0, 0, 0, loc))
+	want := time.Date(2024, 4, 1, 1, 30, 0, 0, loc)
+	assert.True(t, want.Equal(got), "want %s, got %s", want, got)
+}
+
+func testCronTimeZoneFallBack(t *testing.T) {
+	t.Parallel()
+	// The clocks go from 02:00 to 01:00 on 27 October 2024 in London.
+	c, err := schedule.ParseCron("CRON_TZ=Europe/London 30 1 * * *")
+	require.NoError(t, err)
+
+	first := c.Next(time.Date(2024, 10, 26, 12, 0, 0, 0, time.UTC))
+	assert.True(t, time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC).Equal(first), first)
+	second := c.Next(first)
+	assert.True(t, time.Date(2024, 10, 28, 1, 30, 0, 0, time.UTC).Equal(second),
+		"the repeated time should only match once, got %s", second)
+
+	// Between the two occurrences.
+	second = c.Next(time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC))
+	assert.True(t, time.Date(2024, 10, 28, 1, 30, 0, 0, time.UTC).Equal(second),
+		"the repeated time should only match once, got %s", second)
+}
@@ -0,0 +1,260 @@
+// Package schedule runs jobs on cron schedules. The schedules are stored in a
+// table and are evaluated in transactions, therefore each run happens once
+// even when several schedulers run at the same time, and the changes of a job
+// are committed together with its run.
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTable is the name of the schedules table.
+const DefaultTable = "dbtools_schedules"
+
+// Schema creates the schedules table. Run it in your migrations.
+const Schema = `CREATE TABLE IF NOT EXISTS ` + DefaultTable + ` (
+	name     TEXT PRIMARY KEY,
+	next_run TIMESTAMPTZ NOT NULL,
+	last_run TIMESTAMPTZ
+);`
+
+// maxCatchUp is the maximum number of the missed runs that are run with the
+// CatchUpAll policy in each poll.
+const maxCatchUp = 1000
+
+var (
+	// ErrNilJob is returned when adding a job without a function.
+	ErrNilJob = errors.New("nil job function")
+
+	// ErrEmptyName is returned when adding a job without a name.
+	ErrEmptyName = errors.New("empty job name")
+
+	// ErrDuplicateJob is returned when a job name is added twice.
+	ErrDuplicateJob = errors.New("duplicate job name")
+)
+
+// CatchUp decides what happens to the runs that are missed while no
+// scheduler was running.
+type CatchUp int
+
+const (
+	// CatchUpOnce runs the job once for all the missed runs. The job receives
+	// the time of the last missed run.
+	CatchUpOnce CatchUp = iota
+	// CatchUpAll runs the job for each of the missed runs in order.
+	CatchUpAll
+	// CatchUpSkip skips the runs that are late by more than the poll interval
+	// of the scheduler.
+	CatchUpSkip
+)
+
+// JobFunc is run in the transaction that advances the schedule. The at is the
+// scheduled time of the run.
+type JobFunc func(ctx context.Context, tx pgx.Tx, at time.Time) error
+
+type job struct {
+	name    string
+	cron    *Cron
+	fn      JobFunc
+	catchUp CatchUp
+}
+
+// ConfigFunc is used for configuring the Scheduler.
+type ConfigFunc func(*Scheduler)
+
+// PollInterval sets the delay between checking the schedules. The default
+// value is 10s.
+func PollInterval(d time.Duration) ConfigFunc {
+	return func(s *Scheduler) {
+		s.interval = d
+	}
+}
+
+// OnError sets the function that is called when running a job fails. The
+// Scheduler keeps polling anyway.
+func OnError(fn func(error)) ConfigFunc {
+	return func(s *Scheduler) {
+		s.onError = fn
+	}
+}
+
+// Now sets the function that returns the current time. It is useful in tests.
+// The default is time.Now.
+func Now(fn func() time.Time) ConfigFunc {
+	return func(s *Scheduler) {
+		s.now = fn
+	}
+}
+
+// Scheduler runs the jobs when they are due.
+type Scheduler struct {
+	tr       *dbtools.PGX
+	jobs     []job
+	interval time.Duration
+	now      func() time.Time
+	onError  func(error)
+}
+
+// New returns a Scheduler that runs the jobs in transactions of the tr.
+func New(tr *dbtools.PGX, conf ...ConfigFunc) (*Scheduler, error) {
+	if tr == nil {
+		return nil, dbtools.ErrEmptyDatabase
+	}
+	s := &Scheduler{
+		tr:       tr,
+		interval: 10 * time.Second,
+		now:      time.Now,
+	}
+	for _, fn := range conf {
+		fn(s)
+	}
+
+	return s, nil
+}
+
+// Add adds the job with the cron expression. See the ParseCron function for
+// the syntax of the expression. The name identifies the schedule in the
+// table, therefore it should not change between deployments. Add should be
+// called before the Run method.
+func (s *Scheduler) Add(name, expr string, catchUp CatchUp, fn JobFunc) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+	if fn == nil {
+		return ErrNilJob
+	}
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("%w: %s", ErrDuplicateJob, name)
+		}
+	}
+	c, err := ParseCron(expr)
+	if err != nil {
+		return err
+	}
+	s.jobs = append(s.jobs, job{name: name, cron: c, fn: fn, catchUp: catchUp})
+
+	return nil
+}
+
+// Run runs the due jobs until the ctx is cancelled, and returns the error of
+// the ctx.
+func (s *Scheduler) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		_, err := s.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil && s.onError != nil {
+			s.onError(err)
+		}
+		timer.Reset(s.interval)
+	}
+}
+
+// RunOnce runs the jobs that are due and returns the number of runs. Each job
+// is run in its own transaction, and the errors of all jobs are joined.
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	var total int
+	var errs []error
+	for _, j := range s.jobs {
+		n, err := s.runJob(ctx, j)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("running job %q: %w", j.name, err))
+		}
+		total += n
+	}
+
+	return total, errors.Join(errs...)
+}
+
+// runJob locks the schedule of the job and runs it if it is due. If the
+// schedule is locked by another scheduler, it is skipped.
+func (s *Scheduler) runJob(ctx context.Context, j job) (int, error) {
+	var runs int
+	err := s.tr.Transaction(ctx, func(tx pgx.Tx) error {
+		runs = 0
+		now := s.now()
+		const insert = `INSERT INTO ` + DefaultTable + ` (name, next_run) VALUES ($1, $2)
+	ON CONFLICT (name) DO NOTHING`
+		if _, err := tx.Exec(ctx, insert, j.name, j.cron.Next(now)); err != nil {
+			return fmt.Errorf("creating schedule: %w", err)
+		}
+
+		const lock = `SELECT next_run FROM ` + DefaultTable + ` WHERE name = $1 FOR UPDATE SKIP LOCKED`
+		var next time.Time
+		err := tx.QueryRow(ctx, lock, j.name).Scan(&next)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("locking schedule: %w", err)
+		}
+		if next.After(now) {
+			return nil
+		}
+
+		due, next := s.due(j, next, now)
+		for _, at := range due {
+			if err := j.fn(ctx, tx, at); err != nil {
+				return fmt.Errorf("run at %s: %w", at.Format(time.RFC3339), err)
+			}
+		}
+		runs = len(due)
+
+		const update = `UPDATE ` + DefaultTable + ` SET next_run = $2, last_run = $3 WHERE name = $1`
+		if _, err := tx.Exec(ctx, update, j.name, next, now); err != nil {
+			return fmt.Errorf("advancing schedule: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return runs, nil
+}
+
+// due returns the times the job should run for with its CatchUp policy, and
+// the next scheduled time after the now.
+func (s *Scheduler) due(j job, next, now time.Time) ([]time.Time, time.Time) {
+	var missed []time.Time
+	for !next.IsZero() && !next.After(now) {
+		missed = append(missed, next)
+		next = j.cron.Next(next)
+		if len(missed) == maxCatchUp && j.catchUp == CatchUpAll {
+			// The rest are run in the next polls.
+			return missed, next
+		}
+		if len(missed) > 1 && j.catchUp != CatchUpAll {
+			missed = missed[1:]
+		}
+	}
+	if next.IsZero() {
+		// The expression has no more matches. Check again in a year.
+		next = now.AddDate(1, 0, 0)
+	}
+
+	switch j.catchUp {
+	case CatchUpAll:
+		return missed, next
+	case CatchUpSkip:
+		if now.Sub(missed[0]) > s.interval {
+			return nil, next
+		}
+	}
+
+	return missed[:1], next
+}
@@ -0,0 +1,218 @@
+package schedule_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/schedule"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2024, 1, 15, 10, 17, 30, 0, time.UTC)
+
+func at(hour, minute int) time.Time {
+	return time.Date(2024, 1, 15, hour, minute, 0, 0, time.UTC)
+}
+
+// newScheduler returns a scheduler on a simulator that returns the next as
+// the next run of the schedules.
+func newScheduler(t *testing.T, next time.Time, conf ...schedule.ConfigFunc) (*schedule.Scheduler, *dbtesting.Simulator) {
+	t.Helper()
+	sim := dbtesting.NewSimulator()
+	sim.On(`SELECT next_run`).Return([]string{"next_run"}, []any{next})
+	sim.On(`.`)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	conf = append([]schedule.ConfigFunc{schedule.Now(func() time.Time { return now })}, conf...)
+	s, err := schedule.New(tr, conf...)
+	require.NoError(t, err)
+	return s, sim
+}
+
+// recorder returns a job function that records the times it is run at.
+func recorder(got *[]time.Time) schedule.JobFunc {
+	return func(_ context.Context, _ pgx.Tx, at time.Time) error {
+		*got = append(*got, at)
+		return nil
+	}
+}
+
+// updates returns the arguments of the statements that advance the
+// schedules.
+func updates(sim *dbtesting.Simulator) [][]any {
+	var ret [][]any
+	for _, s := range sim.Statements() {
+		if strings.HasPrefix(s.SQL, "UPDATE") {
+			ret = append(ret, s.Args)
+		}
+	}
+	return ret
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := schedule.New(nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	t.Parallel()
+	s, _ := newScheduler(t, now)
+	fn := func(context.Context, pgx.Tx, time.Time) error { return nil }
+
+	assert.ErrorIs(t, s.Add("", "* * * * *", schedule.CatchUpOnce, fn), schedule.ErrEmptyName)
+	assert.ErrorIs(t, s.Add("report", "* * * * *", schedule.CatchUpOnce, nil), schedule.ErrNilJob)
+	assert.ErrorIs(t, s.Add("report", "* * *", schedule.CatchUpOnce, fn), schedule.ErrInvalidCron)
+	assert.ErrorIs(t, s.Add("report", "0 0 30 2 *", schedule.CatchUpOnce, fn), schedule.ErrInvalidCron)
+	require.NoError(t, s.Add("report", "* * * * *", schedule.CatchUpOnce, fn))
+	assert.ErrorIs(t, s.Add("report", "@daily", schedule.CatchUpOnce, fn), schedule.ErrDuplicateJob)
+}
+
+func TestSchedulerRunOnce(t *testing.T) {
+	t.Parallel()
+	t.Run("NotDue", testSchedulerRunOnceNotDue)
+	t.Run("Locked", testSchedulerRunOnceLocked)
+	t.Run("CatchUpOnce", testSchedulerRunOnceCatchUpOnce)
+	t.Run("CatchUpAll", testSchedulerRunOnceCatchUpAll)
+	t.Run("CatchUpSkip", testSchedulerRunOnceCatchUpSkip)
+	t.Run("OnTime", testSchedulerRunOnceOnTime)
+	t.Run("JobError", testSchedulerRunOnceJobError)
+}
+
+func testSchedulerRunOnceNotDue(t *testing.T) {
+	t.Parallel()
+	s, sim := newScheduler(t, at(11, 0))
+	var got []time.Time
+	require.NoError(t, s.Add("report", "0 * * * *", schedule.CatchUpOnce, recorder(&got)))
+
+	n, err := s.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, got)
+	assert.Empty(t, updates(sim))
+	var inserts [][]any
+	for _, s := range sim.Statements() {
+		if strings.HasPrefix(s.SQL, "INSERT") {
+			inserts = append(inserts, s.Args)
+		}
+	}
+	assert.Equal(t, [][]any{{"report", at(11, 0)}}, inserts,
+		"the schedule should be created with the next run")
+}
+
+func testSchedulerRunOnceLocked(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`.`)
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	s, err := schedule.New(tr)
+	require.NoError(t, err)
+	require.NoError(t, s.Add("report", "* * * * *", schedule.CatchUpOnce,
+		func(context.Context, pgx.Tx, time.Time) error {
+			t.Error("didn't expect the job to run")
+			return nil
+		}))
+
+	n, err := s.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func testSchedulerRunOnceCatchUpOnce(t *testing.T) {
+	t.Parallel()
+	s, sim := newScheduler(t, at(7, 0))
+	var got []time.Time
+	require.NoError(t, s.Add("report", "0 * * * *", schedule.CatchUpOnce, recorder(&got)))
+
+	n, err := s.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []time.Time{at(10, 0)}, got)
+	assert.Equal(t, [][]any{{"report", at(11, 0), now}}, updates(sim))
+}
+
+func testSchedulerRunOnceCatchUpAll(t *testing.T) {
+	t.Parallel()
+	s, sim := newScheduler(t, at(7, 0))
+	var got []time.Time
+	require.NoError(t, s.Add("report", "0 * * * *", schedule.CatchUpAll, recorder(&got)))
+
+	n, err := s.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []time.Time{at(7, 0), at(8, 0), at(9, 0), at(10, 0)}, got)
+	assert.Equal(t, [][]any{{"report", at(11, 0), now}}, updates(sim))
+}
+
+func testSchedulerRunOnceCatchUpSkip(t *testing.T) {
+	t.Parallel()
+	s, sim := newScheduler(t, at(7, 0), schedule.PollInterval(time.Minute))
+	var got []time.Time
+	require.NoError(t, s.Add("report", "0 * * * *", schedule.CatchUpSkip, recorder(&got)))
+
+	n, err := s.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, got)
+	assert.Equal(t, [][]any{{"report", at(11, 0), now}}, updates(sim))
+}
+
+func testSchedulerRunOnceOnTime(t *testing.T) {
+	t.Parallel()
+	s, _ := newScheduler(t, at(10, 17), schedule.PollInterval(time.Minute))
+	var got []time.Time
+	require.NoError(t, s.Add("report", "*/1 * * * *", schedule.CatchUpSkip, recorder(&got)))
+
+	n, err := s.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []time.Time{at(10, 17)}, got)
+}
+
+func testSchedulerRunOnceJobError(t *testing.T) {
+	t.Parallel()
+	s, sim := newScheduler(t, at(10, 0))
+	var got []time.Time
+	require.NoError(t, s.Add("failing", "0 * * * *", schedule.CatchUpOnce,
+		func(context.Context, pgx.Tx, time.Time) error {
+			return assert.AnError
+		}))
+	require.NoError(t, s.Add("report", "0 * * * *", schedule.CatchUpOnce, recorder(&got)))
+
+	n, err := s.RunOnce(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), `"failing"`)
+	assert.Equal(t, 1, n)
+	assert.Len(t, got, 1)
+	assert.Equal(t, [][]any{{"report", at(11, 0), now}}, updates(sim))
+}
+
+func TestSchedulerRun(t *testing.T) {
+	t.Parallel()
+	s, _ := newScheduler(t, at(10, 0), schedule.PollInterval(time.Millisecond))
+	ran := make(chan struct{}, 10)
+	require.NoError(t, s.Add("report", "0 * * * *", schedule.CatchUpOnce,
+		func(context.Context, pgx.Tx, time.Time) error {
+			select {
+			case ran <- struct{}{}:
+			default:
+			}
+			return nil
+		}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+	<-ran
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,56 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+type schemaVersion struct {
+	column string
+	table  pgx.Identifier
+	want   int64
+}
+
+// VerifySchema checks the latest applied migration version in the table set
+// with the SchemaVersion function is not older than the expected version. It
+// returns an ErrSchemaVersion error describing both versions if the database
+// is not migrated, and an ErrNoSchemaVersion error if the SchemaVersion is
+// not set. Database errors are retried with the retry policy of the PGX
+// object. You should call this method when the application starts to fail
+// fast:
+//
+//	tr, err := dbtools.New(pool,
+//		dbtools.SchemaVersion(pgx.Identifier{"schema_migrations"}, "version", 42),
+//	)
+//	// handle the error!
+//	err = tr.VerifySchema(ctx)
+//
+// A database with a newer version is accepted so the older instances can keep
+// running during deployments.
+func (p *PGX) VerifySchema(ctx context.Context) error {
+	if p.schema == nil {
+		return ErrNoSchemaVersion
+	}
+	query := fmt.Sprintf("SELECT COALESCE(MAX(%s), 0)::bigint FROM %s",
+		pgx.Identifier{p.schema.column}.Sanitize(),
+		p.schema.table.Sanitize(),
+	)
+
+	return p.Transaction(ctx, func(tx pgx.Tx) error {
+		var got int64
+		err := tx.QueryRow(ctx, query).Scan(&got)
+		if err != nil {
+			return fmt.Errorf("reading schema version: %w", err)
+		}
+		if got < p.schema.want {
+			return &retry.StopError{
+				Err: fmt.Errorf("%w: want version %d, got %d", ErrSchemaVersion, p.schema.want, got),
+			}
+		}
+
+		return nil
+	})
+}
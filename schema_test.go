@@ -0,0 +1,95 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXVerifySchema(t *testing.T) {
+	t.Parallel()
+	t.Run("NotConfigured", testPGXVerifySchemaNotConfigured)
+	t.Run("Versions", testPGXVerifySchemaVersions)
+	t.Run("QueryError", testPGXVerifySchemaQueryError)
+}
+
+func testPGXVerifySchemaNotConfigured(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(mocks.NewPool(t))
+	require.NoError(t, err)
+	err = tr.VerifySchema(context.Background())
+	assert.ErrorIs(t, err, dbtools.ErrNoSchemaVersion)
+}
+
+func testPGXVerifySchemaVersions(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		got     int64
+		wantErr error
+	}{
+		"older": {41, dbtools.ErrSchemaVersion},
+		"equal": {42, nil},
+		"newer": {43, nil},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			db := mocks.NewPool(t)
+			tr, err := dbtools.New(db,
+				dbtools.Retry(10, time.Millisecond),
+				dbtools.SchemaVersion(pgx.Identifier{"public", "schema_migrations"}, "version", 42),
+			)
+			require.NoError(t, err)
+
+			tx := mocks.NewPGXTx(t)
+			row := mocks.NewPGXRow(t)
+			db.On("Begin", mock.Anything).Return(tx, nil).Once()
+			query := `SELECT COALESCE(MAX("version"), 0)::bigint FROM "public"."schema_migrations"`
+			tx.On("QueryRow", mock.Anything, query).Return(row).Once()
+			row.On("Scan", mock.Anything).Return(nil).Once().Run(func(args mock.Arguments) {
+				*args.Get(0).(*int64) = tc.got
+			})
+			if tc.wantErr != nil {
+				tx.On("Rollback", mock.Anything).Return(nil).Once()
+			} else {
+				tx.On("Commit", mock.Anything).Return(nil).Once()
+			}
+
+			err = tr.VerifySchema(context.Background())
+			if tc.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Contains(t, err.Error(), "want version 42, got 41")
+		})
+	}
+}
+
+func testPGXVerifySchemaQueryError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	total := 3
+	tr, err := dbtools.New(db,
+		dbtools.Retry(total, time.Millisecond),
+		dbtools.SchemaVersion(pgx.Identifier{"schema_migrations"}, "version", 1),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	row := mocks.NewPGXRow(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("QueryRow", mock.Anything, mock.Anything).Return(row).Times(total)
+	row.On("Scan", mock.Anything).Return(assert.AnError).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	err = tr.VerifySchema(context.Background())
+	assert.ErrorIs(t, err, assert.AnError)
+}
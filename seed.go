@@ -0,0 +1,184 @@
+package dbtools
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// seedChunk is the number of rows that are inserted by each statement of a
+// CSV seed file.
+const seedChunk = 500
+
+// SeedOption configures the Seed function.
+type SeedOption func(*seedConfig)
+
+type seedConfig struct {
+	truncate bool
+}
+
+// TruncateFirst makes the Seed function truncate the tables of the CSV files
+// before loading them. The tables are truncated with a single statement and
+// their identity columns are restarted.
+func TruncateFirst() SeedOption {
+	return func(c *seedConfig) {
+		c.truncate = true
+	}
+}
+
+// seedFile is a parsed seed file.
+type seedFile struct {
+	name    string
+	sql     string
+	table   pgx.Identifier
+	columns []string
+	rows    [][]any
+}
+
+// Seed loads the files of the fsys that match the glob in a single
+// transaction with the tr, in the lexical order of their paths. Prefix the
+// names with numbers to control the order, for example "01_users.csv" and
+// "02_orders.sql".
+//
+// The ".sql" files are executed as they are, and can contain several
+// statements. The rows of the ".csv" files are inserted into the table with
+// the name of the file, without the extension and the number prefix. The
+// name can be qualified with the schema, for example "02_billing.invoices.csv".
+// The first line of a CSV file contains the column names, and the empty
+// values are inserted as NULL. The values are sent as literals, therefore
+// the server converts them to the types of the columns:
+//
+//	//go:embed seeds
+//	var seeds embed.FS
+//
+//	err := dbtools.Seed(ctx, tr, seeds, "seeds/*", dbtools.TruncateFirst())
+//
+// The files are read before the transaction is started. It returns an
+// ErrNoSeedFiles error if the glob doesn't match any files.
+func Seed(ctx context.Context, tr Transactioner, fsys fs.FS, glob string, opts ...SeedOption) error {
+	var c seedConfig
+	for _, fn := range opts {
+		fn(&c)
+	}
+	names, err := fs.Glob(fsys, glob)
+	if err != nil {
+		return fmt.Errorf("matching seed files: %w", err)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoSeedFiles, glob)
+	}
+	slices.Sort(names)
+
+	files := make([]seedFile, 0, len(names))
+	var tables []string
+	for _, name := range names {
+		f, err := readSeed(fsys, name)
+		if err != nil {
+			return err
+		}
+		if f.table != nil {
+			tables = append(tables, f.table.Sanitize())
+		}
+		files = append(files, f)
+	}
+
+	return tr.Transaction(ctx, func(tx pgx.Tx) error {
+		if c.truncate && len(tables) > 0 {
+			query := "TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY"
+			if _, err := tx.Exec(ctx, query); err != nil {
+				return fmt.Errorf("truncating seed tables: %w", err)
+			}
+		}
+		for _, f := range files {
+			if err := f.load(ctx, tx); err != nil {
+				return fmt.Errorf("seeding %s: %w", f.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// readSeed reads and parses the seed file.
+func readSeed(fsys fs.FS, name string) (seedFile, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return seedFile{}, fmt.Errorf("reading seed file: %w", err)
+	}
+	f := seedFile{name: name}
+	switch path.Ext(name) {
+	case ".sql":
+		f.sql = string(b)
+		return f, nil
+	case ".csv":
+	default:
+		return seedFile{}, fmt.Errorf("unsupported seed file: %s", name)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return seedFile{}, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	if len(records) == 0 {
+		return seedFile{}, fmt.Errorf("parsing %s: missing header", name)
+	}
+	table := strings.TrimSuffix(path.Base(name), ".csv")
+	if prefix, rest, ok := strings.Cut(table, "_"); ok && strings.Trim(prefix, "0123456789") == "" {
+		table = rest
+	}
+	f.table = pgx.Identifier(strings.Split(table, "."))
+	f.columns = records[0]
+	for _, record := range records[1:] {
+		row := make([]any, len(record))
+		for i, v := range record {
+			if v != "" {
+				row[i] = v
+			}
+		}
+		f.rows = append(f.rows, row)
+	}
+
+	return f, nil
+}
+
+// load runs the sql or inserts the rows of the f in the tx.
+func (f seedFile) load(ctx context.Context, tx pgx.Tx) error {
+	if f.table == nil {
+		_, err := tx.Exec(ctx, f.sql)
+		return err
+	}
+
+	prefix := "INSERT INTO " + f.table.Sanitize() + " (" + identifiers(f.columns) + ") VALUES "
+	for start := 0; start < len(f.rows); start += seedChunk {
+		chunk := f.rows[start:min(start+seedChunk, len(f.rows))]
+		var b strings.Builder
+		args := []any{pgx.QueryExecModeSimpleProtocol}
+		b.WriteString(prefix)
+		for i, row := range chunk {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteByte('(')
+			for j, v := range row {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				args = append(args, v)
+				fmt.Fprintf(&b, "$%d", len(args)-1)
+			}
+			b.WriteByte(')')
+		}
+		if _, err := tx.Exec(ctx, b.String(), args...); err != nil {
+			// The first line is the header.
+			return fmt.Errorf("inserting lines %d-%d: %w", start+2, start+len(chunk)+1, err)
+		}
+	}
+
+	return nil
+}
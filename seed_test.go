@@ -0,0 +1,124 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var seeds = fstest.MapFS{
+	"seeds/02_billing.invoices.csv": {Data: []byte("id,user_id,note\n10,1,\n11,2,paid\n")},
+	"seeds/01_users.csv":            {Data: []byte("id,name\n1,alice\n2,bob\n")},
+	"seeds/03_fix.sql":              {Data: []byte("UPDATE users SET name = upper(name); ANALYZE users;")},
+	"other/users.csv":               {Data: []byte("id\n1\n")},
+}
+
+func TestSeed(t *testing.T) {
+	t.Parallel()
+	t.Run("Load", testSeedLoad)
+	t.Run("TruncateFirst", testSeedTruncateFirst)
+	t.Run("Retry", testSeedRetry)
+	t.Run("Failure", testSeedFailure)
+	t.Run("Invalid", testSeedInvalid)
+}
+
+func seedSimulator() *dbtesting.Simulator {
+	sim := dbtesting.NewSimulator()
+	sim.On("^(INSERT|UPDATE|TRUNCATE)").Exec("OK")
+	return sim
+}
+
+func testSeedLoad(t *testing.T) {
+	t.Parallel()
+	sim := seedSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = dbtools.Seed(context.Background(), tr, seeds, "seeds/*")
+	require.NoError(t, err)
+	stmts := sim.Statements()
+	require.Len(t, stmts, 5)
+	assert.Equal(t, `INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4)`, stmts[1].SQL)
+	assert.Equal(t, []any{pgx.QueryExecModeSimpleProtocol, "1", "alice", "2", "bob"}, stmts[1].Args)
+	assert.Equal(t, `INSERT INTO "billing"."invoices" ("id", "user_id", "note") VALUES ($1, $2, $3), ($4, $5, $6)`, stmts[2].SQL)
+	assert.Equal(t, []any{pgx.QueryExecModeSimpleProtocol, "10", "1", nil, "11", "2", "paid"}, stmts[2].Args)
+	assert.Equal(t, "UPDATE users SET name = upper(name); ANALYZE users;", stmts[3].SQL)
+	assert.Equal(t, "COMMIT", stmts[4].SQL)
+}
+
+func testSeedTruncateFirst(t *testing.T) {
+	t.Parallel()
+	sim := seedSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = dbtools.Seed(context.Background(), tr, seeds, "seeds/*", dbtools.TruncateFirst())
+	require.NoError(t, err)
+	assert.Equal(t, `TRUNCATE "users", "billing"."invoices" RESTART IDENTITY`, sim.SQL()[1])
+}
+
+func testSeedRetry(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^UPDATE").Error(&pgconn.PgError{Code: "40P01"}).Times(1)
+	sim.On("^(INSERT|UPDATE)").Exec("OK")
+	tr, err := dbtools.New(sim, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	err = dbtools.Seed(context.Background(), tr, seeds, "seeds/*")
+	require.NoError(t, err)
+	assert.Equal(t, "COMMIT", sim.SQL()[len(sim.SQL())-1])
+}
+
+func testSeedFailure(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^INSERT").Error(&pgconn.PgError{Code: "23505"})
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = dbtools.Seed(context.Background(), tr, seeds, "seeds/*")
+	require.Error(t, err)
+	assert.Equal(t, "23505", dbtools.SQLState(err))
+	assert.Contains(t, err.Error(), "seeds/01_users.csv")
+	assert.Contains(t, err.Error(), "lines 2-3")
+	assert.NotContains(t, sim.SQL(), "COMMIT")
+}
+
+func testSeedInvalid(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		fsys fstest.MapFS
+		glob string
+		want error
+	}{
+		"no match":    {fsys: seeds, glob: "nope/*", want: dbtools.ErrNoSeedFiles},
+		"bad glob":    {fsys: seeds, glob: "["},
+		"unsupported": {fsys: fstest.MapFS{"a.txt": {}}, glob: "*"},
+		"no header":   {fsys: fstest.MapFS{"a.csv": {}}, glob: "*"},
+		"bad csv":     {fsys: fstest.MapFS{"a.csv": {Data: []byte("a,b\n1\n")}}, glob: "*"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sim := dbtesting.NewSimulator()
+			tr, err := dbtools.New(sim)
+			require.NoError(t, err)
+
+			err = dbtools.Seed(context.Background(), tr, tc.fsys, tc.glob)
+			require.Error(t, err)
+			if tc.want != nil {
+				assert.ErrorIs(t, err, tc.want)
+			}
+			assert.Empty(t, sim.SQL(), "the transaction should not be started")
+		})
+	}
+}
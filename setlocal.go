@@ -0,0 +1,51 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// labelPrefix is the prefix of the run-time parameters of the labels.
+	labelPrefix = "dbtools."
+
+	// maxIdentifierLength is the maximum length of the identifiers and the
+	// application_name on the server.
+	maxIdentifierLength = 63
+)
+
+type localSetting struct {
+	name  string
+	value string
+}
+
+// localSteps returns a step that sets the local run-time parameters, if
+// there are any.
+func (p *PGX) localSteps(ctx context.Context) []Step {
+	if len(p.locals) == 0 {
+		return nil
+	}
+	names := make([]string, len(p.locals))
+	values := make([]string, len(p.locals))
+	for i, l := range p.locals {
+		names[i] = l.name
+		values[i] = l.value
+	}
+	const query = `SELECT set_config(n, v, true) FROM unnest($1::text[], $2::text[]) AS t(n, v)`
+	set := Step{
+		Name:     "set local",
+		internal: true,
+		Fn: func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, query, names, values)
+			if err != nil {
+				return fmt.Errorf("setting local parameters: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	return []Step{set}
+}
@@ -0,0 +1,102 @@
+package dbtools_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLocal(t *testing.T) {
+	t.Parallel()
+	t.Run("Values", testSetLocalValues)
+	t.Run("Error", testSetLocalError)
+	t.Run("RealDatabase", testSetLocalRealDatabase)
+}
+
+func testSetLocalValues(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db,
+		dbtools.ApplicationName("billing"),
+		dbtools.Labels(map[string]string{"team": "payments", "feature": "checkout"}),
+		dbtools.SetLocal("lock_timeout", "1s"),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, mock.MatchedBy(func(q string) bool {
+		return strings.Contains(q, "set_config")
+	}),
+		[]string{"application_name", "dbtools.feature", "dbtools.team", "lock_timeout"},
+		[]string{"billing", "checkout", "payments", "1s"},
+	).Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+}
+
+func testSetLocalError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	total := 3
+	tr, err := dbtools.New(db,
+		dbtools.Retry(total, time.Millisecond),
+		dbtools.SetLocal("lock_timeout", "1s"),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("Exec", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(pgconn.CommandTag{}, assert.AnError).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		t.Error("didn't expect to receive this call")
+		return nil
+	})
+	require.ErrorIs(t, err, assert.AnError)
+}
+
+func testSetLocalRealDatabase(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("slow test")
+	}
+	ctx := context.Background()
+	addr := getDB(t)
+	config, err := pgxpool.ParseConfig(addr)
+	require.NoError(t, err)
+	dbtools.WithApplicationName("service", "v1.2.3")(config)
+	dbtools.WithPoolLabels(map[string]string{"pool": "primary"})(config)
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer db.Close()
+
+	tr, err := dbtools.New(db, dbtools.Labels(map[string]string{"feature": "checkout"}))
+	require.NoError(t, err)
+
+	var appName, pool, feature string
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		const query = `SELECT current_setting('application_name'),
+			current_setting('dbtools.pool'),
+			current_setting('dbtools.feature')`
+		return tx.QueryRow(ctx, query).Scan(&appName, &pool, &feature)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "service/v1.2.3", appName)
+	assert.Equal(t, "primary", pool)
+	assert.Equal(t, "checkout", feature)
+}
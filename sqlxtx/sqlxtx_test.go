@@ -0,0 +1,258 @@
+package sqlxtx_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mysqldialect"
+	"github.com/arsham/dbtools/v4/sqlxtx"
+	"github.com/arsham/retry/v3"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+
+	return sqlx.NewDb(db, "sqlmock"), mock
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := sqlxtx.New(nil)
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+}
+
+func TestTransaction(t *testing.T) {
+	t.Parallel()
+	t.Run("NilFunction", testTransactionNilFunction)
+	t.Run("Commit", testTransactionCommit)
+	t.Run("BeginError", testTransactionBeginError)
+	t.Run("Retry", testTransactionRetry)
+	t.Run("StopError", testTransactionStopError)
+	t.Run("Classifier", testTransactionClassifier)
+	t.Run("Dialect", testTransactionDialect)
+	t.Run("Panic", testTransactionPanic)
+	t.Run("RollbackError", testTransactionRollbackError)
+	t.Run("CommitError", testTransactionCommitError)
+	t.Run("TxOptions", testTransactionTxOptions)
+}
+
+func testTransactionNilFunction(t *testing.T) {
+	t.Parallel()
+	db, _ := newDB(t)
+	tr, err := sqlxtx.New(db)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(*sqlx.Tx) error { return nil }, nil)
+	assert.ErrorIs(t, err, dbtools.ErrNilStep)
+}
+
+func testTransactionCommit(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr, err := sqlxtx.New(db)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE users SET seen = true")
+		return err
+	})
+	assert.NoError(t, err)
+}
+
+func testTransactionBeginError(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr, err := sqlxtx.New(db)
+	require.NoError(t, err)
+
+	mock.ExpectBegin().WillReturnError(assert.AnError)
+	err = tr.Transaction(context.Background(), func(*sqlx.Tx) error { return nil })
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testTransactionRetry(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr, err := sqlxtx.New(db, sqlxtx.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	calls := 0
+	err = tr.Transaction(context.Background(), func(*sqlx.Tx) error {
+		calls++
+		if calls < 3 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func testTransactionStopError(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr, err := sqlxtx.New(db, sqlxtx.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	calls := 0
+	err = tr.Transaction(context.Background(), func(*sqlx.Tx) error {
+		calls++
+		return &retry.StopError{Err: assert.AnError}
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, calls)
+}
+
+func testTransactionClassifier(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	permanent := errors.New("permanent")
+	tr, err := sqlxtx.New(db,
+		sqlxtx.Retry(5, time.Millisecond),
+		sqlxtx.WithClassifier(func(err error) bool {
+			return !errors.Is(err, permanent)
+		}),
+	)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	calls := 0
+	err = tr.Transaction(context.Background(), func(*sqlx.Tx) error {
+		calls++
+		if calls == 2 {
+			return permanent
+		}
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, permanent)
+	assert.Equal(t, 2, calls)
+}
+
+func testTransactionDialect(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr, err := sqlxtx.New(db,
+		sqlxtx.Retry(5, time.Millisecond),
+		sqlxtx.WithDialect(mysqldialect.Dialect),
+	)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	calls := 0
+	err = tr.Transaction(context.Background(), func(*sqlx.Tx) error {
+		calls++
+		switch calls {
+		case 1:
+			return &mysql.MySQLError{Number: 1213}
+		case 2:
+			return &mysql.MySQLError{Number: 1205}
+		}
+		return &mysql.MySQLError{Number: 1062}
+	})
+	assert.EqualValues(t, 1062, mysqldialect.ErrorNumber(err))
+	assert.Equal(t, 3, calls)
+}
+
+func testTransactionPanic(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr, err := sqlxtx.New(db, sqlxtx.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	assert.NotPanics(t, func() {
+		err = tr.Transaction(context.Background(), func(*sqlx.Tx) error {
+			panic("oops")
+		})
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oops")
+}
+
+func testTransactionRollbackError(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr, err := sqlxtx.New(db)
+	require.NoError(t, err)
+
+	rollbackErr := errors.New("rollback")
+	mock.ExpectBegin()
+	mock.ExpectRollback().WillReturnError(rollbackErr)
+
+	err = tr.Transaction(context.Background(), func(*sqlx.Tx) error {
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	assert.ErrorIs(t, err, rollbackErr)
+}
+
+func testTransactionCommitError(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr, err := sqlxtx.New(db)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(assert.AnError)
+
+	err = tr.Transaction(context.Background(), func(*sqlx.Tx) error { return nil })
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "committing transaction")
+}
+
+func testTransactionTxOptions(t *testing.T) {
+	t.Parallel()
+	db, mock := newDB(t)
+	tr, err := sqlxtx.New(db, sqlxtx.TxOptions(sql.TxOptions{ReadOnly: true}))
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err = tr.Transaction(context.Background(), func(*sqlx.Tx) error { return nil })
+	assert.NoError(t, err)
+}
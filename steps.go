@@ -0,0 +1,109 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// Step is a labelled function that runs inside a transaction. The Name is
+// used for reporting errors and is empty for the functions passed directly to
+// the Transaction method.
+type Step struct {
+	Fn   func(pgx.Tx) error
+	Name string
+	// internal steps are set up by the library and receive the transaction
+	// without the statement hooks.
+	internal bool
+	// phase is the phase that the errors of the step are reported in. It is
+	// PhaseFn if empty.
+	phase TxPhase
+	// index is the position of the step in the functions of the call.
+	index int
+}
+
+// wrapErr adds the name of the step to the err. If the err is a
+// *retry.StopError, the name is added to the inner error so the retry library
+// still stops.
+func (s Step) wrapErr(err error) error {
+	if s.Name == "" {
+		return err
+	}
+	var stop *retry.StopError
+	if errors.As(err, &stop) {
+		return &retry.StopError{Err: fmt.Errorf("step %q: %w", s.Name, stop.Err)}
+	}
+
+	return fmt.Errorf("step %q: %w", s.Name, err)
+}
+
+// StepList is a builder for a list of labelled steps. The zero value is an
+// empty list. Each call to Add returns a new StepList, therefore a list can be
+// shared and extended without affecting the other users.
+type StepList struct {
+	steps []Step
+}
+
+// Steps returns an empty StepList. Use the Add method to add steps to it:
+//
+//	err := dbtools.Steps().
+//		Add("lock-user", lockUser).
+//		Add("debit", debit).
+//		Run(ctx, tr)
+func Steps() *StepList {
+	return &StepList{}
+}
+
+// Add returns a new StepList with the fn added to the end of the list with
+// the given name.
+func (s *StepList) Add(name string, fn func(pgx.Tx) error) *StepList {
+	steps := make([]Step, len(s.steps), len(s.steps)+1)
+	copy(steps, s.steps)
+
+	return &StepList{steps: append(steps, Step{Name: name, Fn: fn})}
+}
+
+// Steps returns a copy of the steps in the list.
+func (s *StepList) Steps() []Step {
+	steps := make([]Step, len(s.steps))
+	copy(steps, s.steps)
+
+	return steps
+}
+
+// Run runs the steps in order inside a transaction with the tr. It has the
+// same semantics as the PGX.Transaction method. The name of the failed step is
+// included in the returned error.
+//
+// The list is validated before the transaction is started. It returns an
+// ErrNoSteps error if the list is empty, an ErrNilStep error if any of the
+// functions are nil, and an ErrDuplicateStep error if two steps have the same
+// name.
+func (s *StepList) Run(ctx context.Context, tr *PGX) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	return tr.run(ctx, s.steps)
+}
+
+func (s *StepList) validate() error {
+	if len(s.steps) == 0 {
+		return ErrNoSteps
+	}
+	seen := make(map[string]struct{}, len(s.steps))
+	for i, step := range s.steps {
+		if step.Fn == nil {
+			return fmt.Errorf("%w: step %q (#%d)", ErrNilStep, step.Name, i)
+		}
+		if _, ok := seen[step.Name]; ok {
+			return fmt.Errorf("%w: %q", ErrDuplicateStep, step.Name)
+		}
+		seen[step.Name] = struct{}{}
+	}
+
+	return nil
+}
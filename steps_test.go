@@ -0,0 +1,164 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepList(t *testing.T) {
+	t.Parallel()
+	t.Run("Add", testStepListAdd)
+	t.Run("Run", testStepListRun)
+	t.Run("ErrorName", testStepListErrorName)
+	t.Run("StopError", testStepListStopError)
+	t.Run("Panic", testStepListPanic)
+	t.Run("Validation", testStepListValidation)
+}
+
+func testStepListAdd(t *testing.T) {
+	t.Parallel()
+	fn := func(pgx.Tx) error { return nil }
+	base := dbtools.Steps().Add("first", fn)
+	a := base.Add("second", fn)
+	b := base.Add("third", fn)
+
+	names := func(s *dbtools.StepList) []string {
+		ret := []string{}
+		for _, step := range s.Steps() {
+			ret = append(ret, step.Name)
+		}
+		return ret
+	}
+	assert.Equal(t, []string{"first"}, names(base))
+	assert.Equal(t, []string{"first", "second"}, names(a))
+	assert.Equal(t, []string{"first", "third"}, names(b))
+}
+
+func testStepListRun(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	calls := []string{}
+	err = dbtools.Steps().
+		Add("first", func(pgx.Tx) error {
+			calls = append(calls, "first")
+			return nil
+		}).
+		Add("second", func(pgx.Tx) error {
+			calls = append(calls, "second")
+			return nil
+		}).
+		Run(ctx, tr)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, calls)
+}
+
+func testStepListErrorName(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	total := 3
+	tr, err := dbtools.New(db, dbtools.Retry(total, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	err = dbtools.Steps().
+		Add("lock-user", func(pgx.Tx) error { return nil }).
+		Add("debit", func(pgx.Tx) error { return assert.AnError }).
+		Run(ctx, tr)
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), `"debit"`)
+	assert.NotContains(t, err.Error(), `"lock-user"`)
+}
+
+func testStepListStopError(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db, dbtools.Retry(10, time.Millisecond))
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	calls := 0
+	err = dbtools.Steps().
+		Add("debit", func(pgx.Tx) error {
+			calls++
+			return &retry.StopError{Err: assert.AnError}
+		}).
+		Run(ctx, tr)
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), `"debit"`)
+	assert.Equal(t, 1, calls)
+}
+
+func testStepListPanic(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	ctx := context.Background()
+
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Rollback", mock.Anything).Return(nil).Once()
+
+	msg := randomString(20)
+	assert.NotPanics(t, func() {
+		err = dbtools.Steps().
+			Add("credit", func(pgx.Tx) error { panic(msg) }).
+			Run(ctx, tr)
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), msg)
+	assert.Contains(t, err.Error(), `"credit"`)
+}
+
+func testStepListValidation(t *testing.T) {
+	t.Parallel()
+	fn := func(pgx.Tx) error { return nil }
+	tcs := map[string]struct {
+		steps   *dbtools.StepList
+		wantErr error
+	}{
+		"empty":     {dbtools.Steps(), dbtools.ErrNoSteps},
+		"zero":      {&dbtools.StepList{}, dbtools.ErrNoSteps},
+		"nil fn":    {dbtools.Steps().Add("a", fn).Add("b", nil), dbtools.ErrNilStep},
+		"duplicate": {dbtools.Steps().Add("a", fn).Add("b", fn).Add("a", fn), dbtools.ErrDuplicateStep},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			// The pool doesn't expect any calls.
+			tr, err := dbtools.New(mocks.NewPool(t))
+			require.NoError(t, err)
+			err = tc.steps.Run(context.Background(), tr)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
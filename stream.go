@@ -0,0 +1,114 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// streamCursor is the name of the server-side cursor of the Stream method.
+const streamCursor = "dbtools_stream"
+
+// Stream declares a server-side cursor for the query, ordered by the keyCol,
+// and calls the fn with each row. The rows are fetched in batches of the
+// fetchSize, therefore the result set is not held in memory. The keyCol
+// should be selected by the query and be unique, for example the primary key.
+// The query should not have an ORDER BY clause, as it is wrapped in a
+// sub-query that adds it:
+//
+//	err := p.Stream(ctx, `SELECT id, email FROM users`, "id", 1000,
+//		func(rows pgx.Rows) error {
+//			var id int64
+//			var email string
+//			if err := rows.Scan(&id, &email); err != nil {
+//				return err
+//			}
+//			return export(id, email)
+//		},
+//	)
+//
+// The cursor is read in a read only transaction. When the transaction fails,
+// for example when the connection is dropped, it is retried with the policy
+// of the p, and the cursor is declared again after the key of the last row
+// that the fn has processed. Therefore the fn is not called again with the
+// rows it has returned nil for. It returns an ErrInvalidPageSize error if
+// the fetchSize is less than 1.
+func (p *PGX) Stream(ctx context.Context, query, keyCol string, fetchSize int, fn func(pgx.Rows) error, args ...any) error {
+	if fetchSize < 1 {
+		return fmt.Errorf("%w: %d", ErrInvalidPageSize, fetchSize)
+	}
+	col := pgx.Identifier{keyCol}.Sanitize()
+	fetch := "FETCH FORWARD " + strconv.Itoa(fetchSize) + " FROM " + streamCursor
+	var last any
+	seen := false
+
+	return p.ReadOnly().Transaction(ctx, func(tx pgx.Tx) error {
+		sql := "DECLARE " + streamCursor + " NO SCROLL CURSOR FOR SELECT * FROM (" + query + ") AS stream"
+		declareArgs := args
+		if seen {
+			declareArgs = append(args[:len(args):len(args)], last)
+			sql += " WHERE " + col + " > $" + strconv.Itoa(len(declareArgs))
+		}
+		if _, err := tx.Exec(ctx, sql+" ORDER BY "+col, declareArgs...); err != nil {
+			return fmt.Errorf("declaring cursor: %w", err)
+		}
+
+		for {
+			n, err := streamBatch(ctx, tx, fetch, keyCol, func(rows pgx.Rows, key any) error {
+				if err := fn(rows); err != nil {
+					return err
+				}
+				last, seen = key, true
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if n < fetchSize {
+				break
+			}
+		}
+
+		_, err := tx.Exec(ctx, "CLOSE "+streamCursor)
+		return err
+	})
+}
+
+// streamBatch fetches a batch of rows from the cursor and calls the fn with
+// each row and the value of its keyCol. It returns the number of the rows.
+func streamBatch(ctx context.Context, tx pgx.Tx, fetch, keyCol string, fn func(pgx.Rows, any) error) (int, error) {
+	rows, err := tx.Query(ctx, fetch)
+	if err != nil {
+		return 0, fmt.Errorf("fetching rows: %w", err)
+	}
+	defer rows.Close()
+	col := -1
+	for i, f := range rows.FieldDescriptions() {
+		if f.Name == keyCol {
+			col = i
+		}
+	}
+
+	n := 0
+	for rows.Next() {
+		if col < 0 {
+			return n, &retry.StopError{Err: fmt.Errorf("key column %q is not selected", keyCol)}
+		}
+		values, err := rows.Values()
+		if err != nil {
+			return n, fmt.Errorf("reading key: %w", err)
+		}
+		if err := fn(rows, values[col]); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGXStream(t *testing.T) {
+	t.Parallel()
+	t.Run("Rows", testPGXStreamRows)
+	t.Run("Reconnect", testPGXStreamReconnect)
+	t.Run("FnError", testPGXStreamFnError)
+	t.Run("MissingColumn", testPGXStreamMissingColumn)
+	t.Run("InvalidFetchSize", testPGXStreamInvalidFetchSize)
+}
+
+// collectNames returns a stream function that appends the names to the
+// names.
+func collectNames(names *[]string) func(pgx.Rows) error {
+	return func(rows pgx.Rows) error {
+		name, err := scanName(rows)
+		*names = append(*names, name)
+		return err
+	}
+}
+
+func testPGXStreamRows(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	cols := []string{"id", "name"}
+	sim.On("^DECLARE").Exec("DECLARE CURSOR")
+	sim.On("^FETCH").Return(cols, []any{int64(1), "a"}, []any{int64(2), "b"}).Times(1)
+	sim.On("^FETCH").Return(cols, []any{int64(3), "c"})
+	sim.On("^CLOSE").Exec("CLOSE CURSOR")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	var names []string
+	err = tr.Stream(context.Background(), `SELECT id, name FROM users WHERE status = $1`, "id", 2,
+		collectNames(&names), "active")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+	assert.Equal(t, []string{
+		"BEGIN",
+		`DECLARE dbtools_stream NO SCROLL CURSOR FOR SELECT * FROM (SELECT id, name FROM users WHERE status = $1) AS stream ORDER BY "id"`,
+		"FETCH FORWARD 2 FROM dbtools_stream",
+		"FETCH FORWARD 2 FROM dbtools_stream",
+		"CLOSE dbtools_stream",
+		"COMMIT",
+	}, sim.SQL())
+}
+
+func testPGXStreamReconnect(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	cols := []string{"id", "name"}
+	sim.On("^DECLARE").Exec("DECLARE CURSOR")
+	sim.On("^FETCH").Return(cols, []any{int64(1), "a"}).Times(1)
+	sim.On("^FETCH").Error(&pgconn.ConnectError{}).Times(1)
+	sim.On("^FETCH").Return(cols)
+	sim.On("^CLOSE").Exec("CLOSE CURSOR")
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	var names []string
+	err = tr.Stream(context.Background(), `SELECT id, name FROM users`, "id", 1, collectNames(&names))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, names)
+
+	var declares []dbtesting.Statement
+	for _, s := range sim.Statements() {
+		if s.SQL[0] == 'D' {
+			declares = append(declares, s)
+		}
+	}
+	require.Len(t, declares, 2)
+	assert.Empty(t, declares[0].Args)
+	assert.Equal(t, `DECLARE dbtools_stream NO SCROLL CURSOR FOR SELECT * FROM (SELECT id, name FROM users) AS stream WHERE "id" > $1 ORDER BY "id"`, declares[1].SQL)
+	assert.Equal(t, []any{int64(1)}, declares[1].Args, "the cursor should resume after the last key")
+}
+
+func testPGXStreamFnError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	cols := []string{"id", "name"}
+	sim.On("^DECLARE").Exec("DECLARE CURSOR")
+	sim.On("^FETCH").Return(cols, []any{int64(1), "a"}, []any{int64(2), "b"}).Times(1)
+	sim.On("^FETCH").Return(cols, []any{int64(2), "b"}).Times(1)
+	sim.On("^FETCH").Return(cols)
+	sim.On("^CLOSE").Exec("CLOSE CURSOR")
+	tr, err := dbtools.New(sim, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	var names []string
+	failed := false
+	err = tr.Stream(context.Background(), `SELECT id, name FROM users`, "id", 5, func(rows pgx.Rows) error {
+		name, err := scanName(rows)
+		if err != nil {
+			return err
+		}
+		if name == "b" && !failed {
+			failed = true
+			return assert.AnError
+		}
+		names = append(names, name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names, "the failed row should be streamed again")
+}
+
+func testPGXStreamMissingColumn(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^DECLARE").Exec("DECLARE CURSOR")
+	sim.On("^FETCH").Return([]string{"name"}, []any{"a"})
+	tr, err := dbtools.New(sim, dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	calls := 0
+	err = tr.Stream(context.Background(), `SELECT name FROM users`, "id", 5, func(pgx.Rows) error {
+		calls++
+		return nil
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"id" is not selected`)
+	assert.Zero(t, calls)
+	assert.Len(t, sim.SQL(), 4, "it should not be retried")
+}
+
+func testPGXStreamInvalidFetchSize(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.Stream(context.Background(), `SELECT id FROM users`, "id", 0, func(pgx.Rows) error { return nil })
+	require.ErrorIs(t, err, dbtools.ErrInvalidPageSize)
+	assert.Empty(t, sim.SQL())
+}
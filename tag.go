@@ -0,0 +1,54 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type tagKey struct{}
+
+// Tag returns a copy of the ctx that tags the transactions started with it.
+// The tag is appended to the application_name for the duration of the
+// transaction, therefore the DBAs can attribute the long-running
+// transactions in the pg_stat_activity view to the calling feature:
+//
+//	ctx = dbtools.Tag(ctx, "checkout-flow")
+//	err := tr.Transaction(ctx, fns...)
+func Tag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, tagKey{}, tag)
+}
+
+// TagFromContext returns the tag set with the Tag function.
+func TagFromContext(ctx context.Context) (string, bool) {
+	tag, ok := ctx.Value(tagKey{}).(string)
+	return tag, ok && tag != ""
+}
+
+// tagSteps returns a step that appends the tag of the ctx to the
+// application_name, if the ctx is tagged.
+func tagSteps(ctx context.Context) []Step {
+	tag, ok := TagFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	query := fmt.Sprintf(`SELECT set_config('application_name',
+		left(concat_ws(' ', current_setting('application_name'), $1::text), %d), true)`,
+		maxIdentifierLength,
+	)
+	set := Step{
+		Name:     "tag",
+		internal: true,
+		Fn: func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, query, "["+tag+"]")
+			if err != nil {
+				return fmt.Errorf("setting tag: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	return []Step{set}
+}
@@ -0,0 +1,83 @@
+package dbtools_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTag(t *testing.T) {
+	t.Parallel()
+	t.Run("Context", testTagContext)
+	t.Run("Transaction", testTagTransaction)
+	t.Run("RealDatabase", testTagRealDatabase)
+}
+
+func testTagContext(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, ok := dbtools.TagFromContext(ctx)
+	assert.False(t, ok)
+
+	ctx = dbtools.Tag(ctx, "checkout-flow")
+	tag, ok := dbtools.TagFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "checkout-flow", tag)
+}
+
+func testTagTransaction(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, mock.MatchedBy(func(q string) bool {
+		return strings.Contains(q, "application_name")
+	}), "[checkout-flow]").Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := dbtools.Tag(context.Background(), "checkout-flow")
+	err = tr.Transaction(ctx, func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+}
+
+func testTagRealDatabase(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("slow test")
+	}
+	ctx := context.Background()
+	addr := getDB(t)
+	config, err := pgxpool.ParseConfig(addr)
+	require.NoError(t, err)
+	dbtools.WithApplicationName("billing", "")(config)
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer db.Close()
+
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	var inside, outside string
+	err = tr.Transaction(dbtools.Tag(ctx, "checkout-flow"), func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `SELECT application_name FROM pg_stat_activity WHERE pid = pg_backend_pid()`).
+			Scan(&inside)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "billing [checkout-flow]", inside)
+
+	err = db.QueryRow(ctx, `SHOW application_name`).Scan(&outside)
+	require.NoError(t, err)
+	assert.Equal(t, "billing", outside)
+}
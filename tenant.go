@@ -0,0 +1,63 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// defaultTenantSetting is the run-time parameter that holds the tenant ID.
+const defaultTenantSetting = "app.tenant_id"
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of the ctx that carries the tenantID. The
+// transactions started with this context set the tenant ID as a local
+// run-time parameter on every attempt, right after the transaction is
+// started. This way the row level security policies can use the
+// current_setting function to restrict the rows:
+//
+//	CREATE POLICY tenant_isolation ON orders
+//		USING (tenant_id = current_setting('app.tenant_id')::uuid);
+//
+// The value is reset when the transaction ends, therefore it doesn't leak
+// to other transactions using the same connection. The name of the parameter
+// can be changed with the TenantSetting option.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID set with the WithTenant function.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// tenantSteps returns a step that sets the tenant ID of the ctx, if there is
+// one.
+func (p *PGX) tenantSteps(ctx context.Context) []Step {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	name := p.tenantSetting
+	if name == "" {
+		name = defaultTenantSetting
+	}
+	const query = `SELECT set_config($1, $2, true)`
+	set := Step{
+		Name:     "tenant",
+		internal: true,
+		Fn: func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, query, name, tenant)
+			if err != nil {
+				return fmt.Errorf("setting tenant: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	return []Step{set}
+}
@@ -0,0 +1,86 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTenant(t *testing.T) {
+	t.Parallel()
+	t.Run("Context", testWithTenantContext)
+	t.Run("DefaultSetting", testWithTenantDefaultSetting)
+	t.Run("EveryAttempt", testWithTenantEveryAttempt)
+	t.Run("NoTenant", testWithTenantNoTenant)
+}
+
+func testWithTenantContext(t *testing.T) {
+	t.Parallel()
+	_, ok := dbtools.TenantFromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := dbtools.WithTenant(context.Background(), "tenant-1")
+	tenant, ok := dbtools.TenantFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "tenant-1", tenant)
+}
+
+func testWithTenantDefaultSetting(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.Anything, "SELECT set_config($1, $2, true)", "app.tenant_id", "tenant-1").
+		Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	ctx := dbtools.WithTenant(context.Background(), "tenant-1")
+	err = tr.Transaction(ctx, func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+}
+
+func testWithTenantEveryAttempt(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	total := 3
+	tr, err := dbtools.New(db,
+		dbtools.Retry(total, time.Millisecond),
+		dbtools.TenantSetting("myapp.tenant"),
+	)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Times(total)
+	tx.On("Exec", mock.Anything, mock.Anything, "myapp.tenant", "tenant-2").
+		Return(pgconn.CommandTag{}, nil).Times(total)
+	tx.On("Rollback", mock.Anything).Return(nil).Times(total)
+
+	ctx := dbtools.WithTenant(context.Background(), "tenant-2")
+	err = tr.Transaction(ctx, func(pgx.Tx) error { return assert.AnError })
+	require.ErrorIs(t, err, assert.AnError)
+}
+
+func testWithTenantNoTenant(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+}
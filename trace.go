@@ -0,0 +1,74 @@
+package dbtools
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TxInfo identifies the transaction and the attempt a statement is run in.
+type TxInfo struct {
+	// Label is the label of the PGX object if it is set.
+	Label string
+	// ID is unique to each call of the Transaction method in the process, and
+	// is the same for all the attempts of the call.
+	ID uint64
+	// Attempt is the attempt number, starting from 1.
+	Attempt int
+}
+
+type txInfoKey struct{}
+
+var txCounter atomic.Uint64
+
+func nextTxID() uint64 { return txCounter.Add(1) }
+
+func withTxInfo(ctx context.Context, info TxInfo) context.Context {
+	return context.WithValue(ctx, txInfoKey{}, info)
+}
+
+// TxInfoFromContext returns the TxInfo of the statement the ctx is passed to.
+// The context of the statements is only annotated when the PGX object is
+// configured with the TraceQueries option, therefore this function can be
+// used in the tracers of the pool for correlating the queries with the
+// attempts of the transactions.
+func TxInfoFromContext(ctx context.Context) (TxInfo, bool) {
+	info, ok := ctx.Value(txInfoKey{}).(TxInfo)
+	return info, ok
+}
+
+// queryTracer annotates the statements with the TxInfo and calls the tracers
+// around them.
+type queryTracer struct {
+	tracers []pgx.QueryTracer
+}
+
+// hook returns a statement hook that annotates the statements with the info.
+// The tracers are called with a nil connection, because the connection is not
+// exposed by the transaction.
+func (q *queryTracer) hook(info TxInfo) stmtHook {
+	return stmtHook{
+		before: func(_ context.Context, s *statement) error {
+			s.Ctx = withTxInfo(s.Ctx, info)
+			for _, t := range q.tracers {
+				s.Ctx = t.TraceQueryStart(s.Ctx, nil, pgx.TraceQueryStartData{
+					SQL:  s.SQL,
+					Args: s.Args,
+				})
+			}
+
+			return nil
+		},
+		after: func(_ context.Context, s *statement) error {
+			for _, t := range q.tracers {
+				t.TraceQueryEnd(s.Ctx, nil, pgx.TraceQueryEndData{
+					CommandTag: s.Tag,
+					Err:        s.Err,
+				})
+			}
+
+			return nil
+		},
+	}
+}
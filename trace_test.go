@@ -0,0 +1,134 @@
+package dbtools_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type tracedQuery struct {
+	err  error
+	sql  string
+	info dbtools.TxInfo
+}
+
+// recordingTracer records the queries with the TxInfo of their context.
+type recordingTracer struct {
+	mu      sync.Mutex
+	queries []tracedQuery
+}
+
+type tracedSQLKey struct{}
+
+func (r *recordingTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, tracedSQLKey{}, data.SQL)
+}
+
+func (r *recordingTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	info, _ := dbtools.TxInfoFromContext(ctx)
+	sql, _ := ctx.Value(tracedSQLKey{}).(string)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = append(r.queries, tracedQuery{sql: sql, info: info, err: data.Err})
+}
+
+func TestTraceQueries(t *testing.T) {
+	t.Parallel()
+	t.Run("Tracers", testTraceQueriesTracers)
+	t.Run("Context", testTraceQueriesContext)
+	t.Run("Disabled", testTraceQueriesDisabled)
+}
+
+func testTraceQueriesTracers(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`UPDATE`).Error(assert.AnError).Times(1)
+	sim.On(`.`)
+	rec := &recordingTracer{}
+	tr, err := dbtools.New(sim,
+		dbtools.TraceQueries(rec),
+		dbtools.Label("users"),
+		dbtools.Retry(2, time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET seen = true")
+		return err
+	})
+	require.NoError(t, err)
+
+	require.Len(t, rec.queries, 2)
+	first, second := rec.queries[0], rec.queries[1]
+	assert.Equal(t, "UPDATE users SET seen = true", first.sql)
+	assert.ErrorIs(t, first.err, assert.AnError)
+	assert.Equal(t, 1, first.info.Attempt)
+	assert.Equal(t, "users", first.info.Label)
+	assert.NoError(t, second.err)
+	assert.Equal(t, 2, second.info.Attempt)
+	assert.NotZero(t, first.info.ID)
+	assert.Equal(t, first.info.ID, second.info.ID, "attempts should share the ID")
+
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM users")
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, rec.queries, 3)
+	assert.NotEqual(t, first.info.ID, rec.queries[2].info.ID)
+}
+
+func testTraceQueriesContext(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.MatchedBy(func(ctx context.Context) bool {
+		info, ok := dbtools.TxInfoFromContext(ctx)
+		return ok && info.Attempt == 1 && info.ID != 0
+	}), "SELECT 1").Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	tr, err := dbtools.New(db, dbtools.TraceQueries())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT 1")
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func testTraceQueriesDisabled(t *testing.T) {
+	t.Parallel()
+	db := mocks.NewPool(t)
+	tx := mocks.NewPGXTx(t)
+	db.On("Begin", mock.Anything).Return(tx, nil).Once()
+	tx.On("Exec", mock.MatchedBy(func(ctx context.Context) bool {
+		_, ok := dbtools.TxInfoFromContext(ctx)
+		return !ok
+	}), "SELECT 1").Return(pgconn.CommandTag{}, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT 1")
+		return err
+	})
+	require.NoError(t, err)
+}
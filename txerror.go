@@ -0,0 +1,81 @@
+package dbtools
+
+import (
+	"context"
+	"errors"
+
+	"github.com/arsham/retry/v3"
+)
+
+// TxPhase is the phase of an attempt of a transaction.
+type TxPhase string
+
+// The phases of an attempt of a transaction.
+const (
+	PhaseBegin    TxPhase = "begin"
+	PhaseFn       TxPhase = "fn"
+	PhaseCommit   TxPhase = "commit"
+	PhaseRollback TxPhase = "rollback"
+)
+
+// TxError is returned when an attempt of a transaction fails. It records
+// where the attempt failed, and wraps the error, therefore the errors.Is and
+// errors.As functions work with the underlying error:
+//
+//	var txErr *dbtools.TxError
+//	if errors.As(err, &txErr) && txErr.Phase == dbtools.PhaseCommit {
+//		// the transaction failed to commit.
+//	}
+//
+// The message of the error is the message of the underlying error.
+type TxError struct {
+	// Attempt is the attempt number, starting from 1.
+	Attempt int
+	// Step is the index of the function that failed, or -1 if the error is
+	// not returned by a function.
+	Step int
+	// StepName is the name of the step that failed, if it has a name.
+	StepName string
+	// Phase is the phase of the attempt that failed. It is PhaseRollback if
+	// the rollback failed after another error.
+	Phase TxPhase
+	// SQLState is the SQLSTATE code of the error if it is returned by the
+	// server.
+	SQLState string
+	Err      error
+}
+
+func (e *TxError) Error() string { return e.Err.Error() }
+func (e *TxError) Unwrap() error { return e.Err }
+
+// txError wraps the err of the phase of the attempt in a *TxError. The step is
+// nil when the err is not returned by a step. If the err is a
+// *retry.StopError, the *TxError is wrapped in a new one so the retry library
+// still stops and returns it.
+func txError(ctx context.Context, phase TxPhase, step *Step, err error) error {
+	if err == nil {
+		return nil
+	}
+	info, _ := TxInfoFromContext(ctx)
+	txErr := &TxError{
+		Attempt:  info.Attempt,
+		Step:     -1,
+		Phase:    phase,
+		SQLState: SQLState(err),
+		Err:      err,
+	}
+	if step != nil && !step.internal {
+		txErr.Step = step.index
+		txErr.StepName = step.Name
+	}
+
+	var stop *retry.StopError
+	if !errors.As(err, &stop) {
+		return txErr
+	}
+	if stop == err { //nolint:errorlint // only the outer StopError is unwrapped.
+		txErr.Err = stop.Err
+	}
+
+	return &retry.StopError{Err: txErr}
+}
@@ -0,0 +1,133 @@
+package dbtools_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asTxError returns the *dbtools.TxError of the err.
+func asTxError(t *testing.T, err error) *dbtools.TxError {
+	t.Helper()
+	var txErr *dbtools.TxError
+	require.ErrorAs(t, err, &txErr)
+	return txErr
+}
+
+func TestTxError(t *testing.T) {
+	t.Parallel()
+	t.Run("Begin", testTxErrorBegin)
+	t.Run("Fn", testTxErrorFn)
+	t.Run("Steps", testTxErrorSteps)
+	t.Run("Commit", testTxErrorCommit)
+	t.Run("Rollback", testTxErrorRollback)
+	t.Run("Stopped", testTxErrorStopped)
+}
+
+func testTxErrorBegin(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("BEGIN").Error(&pgconn.PgError{Code: "53300"}) // too_many_connections
+	tr, err := dbtools.New(sim, dbtools.Retry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	txErr := asTxError(t, err)
+	assert.Equal(t, dbtools.PhaseBegin, txErr.Phase)
+	assert.Equal(t, 2, txErr.Attempt)
+	assert.Equal(t, -1, txErr.Step)
+	assert.Equal(t, "53300", txErr.SQLState)
+	assert.Equal(t, txErr.Err.Error(), err.Error())
+}
+
+func testTxErrorFn(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(), dbtools.Retry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	pgErr := &pgconn.PgError{Code: "23505"}
+	err = tr.Transaction(context.Background(),
+		func(pgx.Tx) error { return nil },
+		func(pgx.Tx) error { return pgErr },
+	)
+	txErr := asTxError(t, err)
+	assert.Equal(t, dbtools.PhaseFn, txErr.Phase)
+	assert.Equal(t, 3, txErr.Attempt)
+	assert.Equal(t, 1, txErr.Step)
+	assert.Empty(t, txErr.StepName)
+	assert.Equal(t, "23505", txErr.SQLState)
+	assert.ErrorIs(t, err, pgErr)
+	assert.Equal(t, dbtools.KindTx, dbtools.ErrorKind(err))
+}
+
+func testTxErrorSteps(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+
+	err = dbtools.Steps().
+		Add("lock", func(pgx.Tx) error { return nil }).
+		Add("debit", func(pgx.Tx) error { return assert.AnError }).
+		Run(context.Background(), tr)
+	txErr := asTxError(t, err)
+	assert.Equal(t, 1, txErr.Step)
+	assert.Equal(t, "debit", txErr.StepName)
+	assert.Empty(t, txErr.SQLState)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testTxErrorCommit(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("COMMIT").Error(&pgconn.PgError{Code: "40001"})
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	txErr := asTxError(t, err)
+	assert.Equal(t, dbtools.PhaseCommit, txErr.Phase)
+	assert.Equal(t, "40001", txErr.SQLState)
+	assert.True(t, dbtools.IsSerializationFailure(err))
+}
+
+func testTxErrorRollback(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("ROLLBACK").Error(errors.New("rollback failed"))
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return assert.AnError })
+	txErr := asTxError(t, err)
+	assert.Equal(t, dbtools.PhaseRollback, txErr.Phase)
+	assert.Equal(t, 0, txErr.Step)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "rollback failed")
+}
+
+func testTxErrorStopped(t *testing.T) {
+	t.Parallel()
+	tr, err := dbtools.New(dbtesting.NewSimulator(),
+		dbtools.Retry(5, time.Millisecond),
+		dbtools.WithClassifier(func(error) bool { return false }),
+	)
+	require.NoError(t, err)
+
+	calls := 0
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		calls++
+		return assert.AnError
+	})
+	assert.Equal(t, 1, calls, "the classified errors should stop the retries")
+	txErr := asTxError(t, err)
+	assert.Equal(t, 1, txErr.Attempt)
+	assert.Equal(t, assert.AnError.Error(), err.Error())
+}
@@ -0,0 +1,238 @@
+package dbtools
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// statement describes a statement that is run in a transaction. The Rows,
+// Err and Duration fields are set after the statement is run.
+type statement struct {
+	// Ctx is the context the statement is run with. The before functions of
+	// the hooks can replace it.
+	Ctx      context.Context //nolint:containedctx // it is passed to the tx.
+	Err      error
+	SQL      string
+	Args     []any
+	Rows     int64
+	Tag      pgconn.CommandTag
+	Duration time.Duration
+	// Batch is the number of queries when the statement is a batch.
+	Batch int
+	// Queries are the queries of the batch.
+	Queries []string
+}
+
+// stmtHook is called around the statements of a transaction. If the before
+// function returns an error the statement is not run and the error is
+// returned. If the after function returns an error, it replaces the error of
+// the statement. If the commit function returns an error, the transaction is
+// rolled back instead of being committed.
+type stmtHook struct {
+	before func(ctx context.Context, s *statement) error
+	after  func(ctx context.Context, s *statement) error
+	commit func(ctx context.Context) error
+}
+
+// hookedTx calls the hooks around the statements that run through it. The
+// nested transactions are wrapped with the same hooks.
+type hookedTx struct {
+	pgx.Tx
+	hooks []stmtHook
+}
+
+// wrapTx returns the tx wrapped with the statement hooks if there are any.
+// The ctx is the context of the attempt.
+func (p *PGX) wrapTx(ctx context.Context, tx pgx.Tx) pgx.Tx {
+	hooks := p.stmtHooks(ctx)
+	if len(hooks) == 0 {
+		return tx
+	}
+
+	return &hookedTx{Tx: tx, hooks: hooks}
+}
+
+// stmtHooks returns the statement hooks of the enabled features.
+func (p *PGX) stmtHooks(ctx context.Context) []stmtHook {
+	var hooks []stmtHook
+	if p.quota != nil {
+		hooks = append(hooks, p.quota.hook())
+	}
+	if p.soft != nil || p.maxAge > 0 {
+		hooks = append(hooks, p.guard())
+	}
+	if p.savepoints != nil {
+		hooks = append(hooks, p.savepoints.hook())
+	}
+	if p.sqlCapture != nil {
+		hooks = append(hooks, p.sqlCapture.hook())
+	}
+	if p.unbounded != nil {
+		hooks = append(hooks, p.unbounded.hook())
+	}
+	if p.tracer != nil {
+		info, _ := TxInfoFromContext(ctx)
+		hooks = append(hooks, p.tracer.hook(info))
+	}
+
+	return hooks
+}
+
+func (h *hookedTx) before(ctx context.Context, s *statement) error {
+	for _, hook := range h.hooks {
+		if hook.before == nil {
+			continue
+		}
+		if err := hook.before(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *hookedTx) after(ctx context.Context, s *statement, start time.Time) error {
+	s.Duration = time.Since(start)
+	for _, hook := range h.hooks {
+		if hook.after == nil {
+			continue
+		}
+		if err := hook.after(ctx, s); err != nil {
+			s.Err = err
+		}
+	}
+
+	return s.Err
+}
+
+// commitHooks calls the commit hooks of the tx if it is wrapped.
+func commitHooks(ctx context.Context, tx pgx.Tx) error {
+	h, ok := tx.(*hookedTx)
+	if !ok {
+		return nil
+	}
+	for _, hook := range h.hooks {
+		if hook.commit == nil {
+			continue
+		}
+		if err := hook.commit(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Begin starts a pseudo nested transaction.
+func (h *hookedTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := h.Tx.Begin(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // the tx is transparent.
+	}
+
+	return &hookedTx{Tx: tx, hooks: h.hooks}, nil
+}
+
+// Exec runs the hooks around the Exec method of the transaction.
+func (h *hookedTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	s := &statement{Ctx: ctx, SQL: sql, Args: args}
+	if err := h.before(ctx, s); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	start := time.Now()
+	tag, err := h.Tx.Exec(s.Ctx, sql, args...)
+	s.Rows, s.Tag, s.Err = tag.RowsAffected(), tag, err
+
+	return tag, h.after(s.Ctx, s, start)
+}
+
+// Query runs the hooks around the Query method of the transaction. The
+// Duration and Rows of the statement only cover sending the query.
+func (h *hookedTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	s := &statement{Ctx: ctx, SQL: sql, Args: args}
+	if err := h.before(ctx, s); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	rows, err := h.Tx.Query(s.Ctx, sql, args...)
+	s.Err = err
+	if err := h.after(s.Ctx, s, start); err != nil {
+		if rows != nil {
+			rows.Close()
+		}
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// QueryRow runs the hooks around the QueryRow method of the transaction. If
+// any of the hooks return an error, it is returned from the Scan method of
+// the row.
+func (h *hookedTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	s := &statement{Ctx: ctx, SQL: sql, Args: args}
+	if err := h.before(ctx, s); err != nil {
+		return errRow{err: err}
+	}
+	start := time.Now()
+	row := h.Tx.QueryRow(s.Ctx, sql, args...)
+	if err := h.after(s.Ctx, s, start); err != nil {
+		return errRow{err: err}
+	}
+
+	return row
+}
+
+// SendBatch runs the hooks around the SendBatch method of the transaction.
+// The whole batch is reported as one statement.
+func (h *hookedTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	s := &statement{Ctx: ctx, SQL: "BATCH", Batch: b.Len(), Queries: make([]string, 0, b.Len())}
+	for _, q := range b.QueuedQueries {
+		s.Queries = append(s.Queries, q.SQL)
+	}
+	if err := h.before(ctx, s); err != nil {
+		return errBatchResults{err: err}
+	}
+	start := time.Now()
+	results := h.Tx.SendBatch(s.Ctx, b)
+	if err := h.after(s.Ctx, s, start); err != nil {
+		results.Close()
+		return errBatchResults{err: err}
+	}
+
+	return results
+}
+
+// CopyFrom runs the hooks around the CopyFrom method of the transaction.
+func (h *hookedTx) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	s := &statement{Ctx: ctx, SQL: "COPY " + table.Sanitize()}
+	if err := h.before(ctx, s); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	n, err := h.Tx.CopyFrom(s.Ctx, table, columns, src)
+	s.Rows, s.Err = n, err
+
+	return n, h.after(s.Ctx, s, start)
+}
+
+// errRow is a pgx.Row that returns the err when scanned.
+type errRow struct {
+	err error
+}
+
+func (e errRow) Scan(...any) error { return e.err }
+
+// errBatchResults is a pgx.BatchResults that returns the err from all
+// methods.
+type errBatchResults struct {
+	err error
+}
+
+func (e errBatchResults) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, e.err }
+func (e errBatchResults) Query() (pgx.Rows, error)         { return nil, e.err }
+func (e errBatchResults) QueryRow() pgx.Row                { return errRow(e) }
+func (e errBatchResults) Close() error                     { return e.err }
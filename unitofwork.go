@@ -0,0 +1,70 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// UnitOfWork runs functions in a transaction with a set of repositories that
+// are bound to the transaction. The repositories are created for each
+// attempt, therefore they never hold the transaction of a failed attempt:
+//
+//	type Repos struct {
+//		Users  *UserRepo
+//		Orders *OrderRepo
+//	}
+//
+//	uow, err := dbtools.NewUnitOfWork(p, func(tx pgx.Tx) Repos {
+//		return Repos{Users: &UserRepo{tx: tx}, Orders: &OrderRepo{tx: tx}}
+//	})
+//	// handle the error!
+//	err = uow.Do(ctx, func(r Repos) error {
+//		if err := r.Users.Debit(ctx, userID, total); err != nil {
+//			return err
+//		}
+//		return r.Orders.Create(ctx, order)
+//	})
+//
+// It is safe for concurrent use if the Transactioner is.
+type UnitOfWork[T any] struct {
+	tr       Transactioner
+	newRepos func(pgx.Tx) T
+}
+
+// NewUnitOfWork returns a UnitOfWork that runs the transactions with the tr,
+// and creates the repositories with the newRepos function. It returns an
+// ErrEmptyDatabase error if the tr is nil, and an ErrInvalidBinding error if
+// the newRepos is nil.
+func NewUnitOfWork[T any](tr Transactioner, newRepos func(pgx.Tx) T) (*UnitOfWork[T], error) {
+	if tr == nil {
+		return nil, ErrEmptyDatabase
+	}
+	if newRepos == nil {
+		return nil, fmt.Errorf("%w: nil repository constructor", ErrInvalidBinding)
+	}
+
+	return &UnitOfWork[T]{tr: tr, newRepos: newRepos}, nil
+}
+
+// Do runs the fn in a transaction with the repositories of the transaction.
+// It has the same semantics as the Transaction method of the Transactioner,
+// therefore the fn is called again with new repositories when the
+// transaction is retried.
+func (u *UnitOfWork[T]) Do(ctx context.Context, fn func(repos T) error) error {
+	return u.tr.Transaction(ctx, func(tx pgx.Tx) error {
+		return fn(u.newRepos(tx))
+	})
+}
+
+// ReadOnly returns a UnitOfWork that runs the transactions in the read only
+// mode if the Transactioner is a *PGX. Otherwise it returns the u.
+func (u *UnitOfWork[T]) ReadOnly() *UnitOfWork[T] {
+	p, ok := u.tr.(*PGX)
+	if !ok {
+		return u
+	}
+
+	return &UnitOfWork[T]{tr: p.ReadOnly(), newRepos: u.newRepos}
+}
@@ -0,0 +1,110 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/arsham/dbtools/v4/mocks"
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type uowRepos struct {
+	tx pgx.Tx
+}
+
+func TestUnitOfWork(t *testing.T) {
+	t.Parallel()
+	t.Run("Invalid", testUnitOfWorkInvalid)
+	t.Run("Do", testUnitOfWorkDo)
+	t.Run("Retry", testUnitOfWorkRetry)
+	t.Run("ReadOnly", testUnitOfWorkReadOnly)
+}
+
+func testUnitOfWorkInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := dbtools.NewUnitOfWork(nil, func(tx pgx.Tx) uowRepos { return uowRepos{tx: tx} })
+	assert.ErrorIs(t, err, dbtools.ErrEmptyDatabase)
+
+	tr, err := dbtools.New(dbtesting.NewSimulator())
+	require.NoError(t, err)
+	_, err = dbtools.NewUnitOfWork[uowRepos](tr, nil)
+	assert.ErrorIs(t, err, dbtools.ErrInvalidBinding)
+}
+
+func testUnitOfWorkDo(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^UPDATE").Exec("UPDATE 1")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+	uow, err := dbtools.NewUnitOfWork(tr, func(tx pgx.Tx) uowRepos { return uowRepos{tx: tx} })
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = uow.Do(ctx, func(r uowRepos) error {
+		require.NotNil(t, r.tx)
+		_, err := r.tx.Exec(ctx, "UPDATE users SET name = 'a'")
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "UPDATE users SET name = 'a'", "COMMIT"}, sim.SQL())
+
+	err = uow.Do(ctx, func(uowRepos) error { return assert.AnError })
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func testUnitOfWorkRetry(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	tr, err := dbtools.New(sim, dbtools.WithRetry(retry.Retry{Attempts: 3, Delay: time.Millisecond}))
+	require.NoError(t, err)
+	built := 0
+	uow, err := dbtools.NewUnitOfWork(tr, func(tx pgx.Tx) uowRepos {
+		built++
+		return uowRepos{tx: tx}
+	})
+	require.NoError(t, err)
+
+	var seen []uowRepos
+	err = uow.Do(context.Background(), func(r uowRepos) error {
+		seen = append(seen, r)
+		if len(seen) < 2 {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, built)
+	require.Len(t, seen, 2)
+	assert.NotSame(t, seen[0].tx, seen[1].tx)
+}
+
+func testUnitOfWorkReadOnly(t *testing.T) {
+	t.Parallel()
+	db, b := newTxBeginnerPool(t)
+	tr, err := dbtools.New(db)
+	require.NoError(t, err)
+	uow, err := dbtools.NewUnitOfWork(tr, func(tx pgx.Tx) uowRepos { return uowRepos{tx: tx} })
+	require.NoError(t, err)
+
+	tx := mocks.NewPGXTx(t)
+	b.On("BeginTx", mock.Anything, readOnly).Return(tx, nil).Once()
+	tx.On("Commit", mock.Anything).Return(nil).Once()
+
+	err = uow.ReadOnly().Do(context.Background(), func(r uowRepos) error {
+		assert.NotNil(t, r.tx)
+		return nil
+	})
+	require.NoError(t, err)
+
+	other, err := dbtools.NewUnitOfWork(tr.ReadOnly(), func(tx pgx.Tx) uowRepos { return uowRepos{tx: tx} })
+	require.NoError(t, err)
+	assert.Same(t, other, other.ReadOnly())
+}
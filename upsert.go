@@ -0,0 +1,111 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxParams is the maximum number of the parameters of a statement in the
+// PostgreSQL protocol.
+const maxParams = 65535
+
+// Upsert inserts the rows into the table with multi-row INSERT statements,
+// and returns the number of the affected rows. Each row should have a value
+// for each of the columns. The statements are chunked so each of them has
+// less than 65535 parameters.
+//
+// When the conflictCols are given, the conflicting rows update the
+// updateCols with the new values, or are skipped if there are no
+// updateCols. Call it inside the Transaction method so a failed chunk rolls
+// back all the rows, and the whole load is retried:
+//
+//	err := p.Transaction(ctx, func(tx pgx.Tx) error {
+//		_, err := dbtools.Upsert(ctx, tx, pgx.Identifier{"prices"},
+//			[]string{"sku", "price"}, rows,
+//			[]string{"sku"}, []string{"price"},
+//		)
+//		return err
+//	})
+//
+// It returns an ErrInvalidUpsert error if there are no columns, a row has
+// the wrong number of values, or the updateCols are given without the
+// conflictCols.
+func Upsert(ctx context.Context, tx pgx.Tx, table pgx.Identifier, columns []string, rows [][]any, conflictCols, updateCols []string) (int64, error) {
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("%w: no columns", ErrInvalidUpsert)
+	}
+	if len(updateCols) > 0 && len(conflictCols) == 0 {
+		return 0, fmt.Errorf("%w: update columns without conflict columns", ErrInvalidUpsert)
+	}
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return 0, fmt.Errorf("%w: row #%d has %d values, want %d", ErrInvalidUpsert, i, len(row), len(columns))
+		}
+	}
+
+	prefix := "INSERT INTO " + table.Sanitize() + " (" + identifiers(columns) + ") VALUES "
+	suffix := onConflict(conflictCols, updateCols)
+	size := maxParams / len(columns)
+	var total int64
+	for start := 0; start < len(rows); start += size {
+		chunk := rows[start:min(start+size, len(rows))]
+		var b strings.Builder
+		args := make([]any, 0, len(chunk)*len(columns))
+		b.WriteString(prefix)
+		for i, row := range chunk {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteByte('(')
+			for j, v := range row {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				args = append(args, v)
+				b.WriteString("$" + strconv.Itoa(len(args)))
+			}
+			b.WriteByte(')')
+		}
+		b.WriteString(suffix)
+
+		tag, err := tx.Exec(ctx, b.String(), args...)
+		if err != nil {
+			return total, fmt.Errorf("upserting rows %d-%d: %w", start, start+len(chunk)-1, err)
+		}
+		total += tag.RowsAffected()
+	}
+
+	return total, nil
+}
+
+// identifiers returns the columns quoted and separated by commas.
+func identifiers(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = pgx.Identifier{c}.Sanitize()
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// onConflict returns the ON CONFLICT clause of the Upsert statements.
+func onConflict(conflictCols, updateCols []string) string {
+	if len(conflictCols) == 0 {
+		return ""
+	}
+	clause := " ON CONFLICT (" + identifiers(conflictCols) + ") DO "
+	if len(updateCols) == 0 {
+		return clause + "NOTHING"
+	}
+	sets := make([]string, len(updateCols))
+	for i, c := range updateCols {
+		col := pgx.Identifier{c}.Sanitize()
+		sets[i] = col + " = EXCLUDED." + col
+	}
+
+	return clause + "UPDATE SET " + strings.Join(sets, ", ")
+}
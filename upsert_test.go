@@ -0,0 +1,148 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsert(t *testing.T) {
+	t.Parallel()
+	t.Run("Statements", testUpsertStatements)
+	t.Run("Chunks", testUpsertChunks)
+	t.Run("Invalid", testUpsertInvalid)
+	t.Run("Error", testUpsertError)
+}
+
+func testUpsertStatements(t *testing.T) {
+	t.Parallel()
+	rows := [][]any{{"a", 1}, {"b", 2}}
+	tcs := map[string]struct {
+		conflict []string
+		update   []string
+		want     string
+	}{
+		"insert": {
+			want: `INSERT INTO "public"."prices" ("sku", "price") VALUES ($1, $2), ($3, $4)`,
+		},
+		"do nothing": {
+			conflict: []string{"sku"},
+			want:     `INSERT INTO "public"."prices" ("sku", "price") VALUES ($1, $2), ($3, $4) ON CONFLICT ("sku") DO NOTHING`,
+		},
+		"do update": {
+			conflict: []string{"sku"},
+			update:   []string{"price"},
+			want:     `INSERT INTO "public"."prices" ("sku", "price") VALUES ($1, $2), ($3, $4) ON CONFLICT ("sku") DO UPDATE SET "price" = EXCLUDED."price"`,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sim := dbtesting.NewSimulator()
+			sim.On("^INSERT").Exec("INSERT 0 2")
+			tr, err := dbtools.New(sim)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			var n int64
+			err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+				var err error
+				n, err = dbtools.Upsert(ctx, tx, pgx.Identifier{"public", "prices"},
+					[]string{"sku", "price"}, rows, tc.conflict, tc.update)
+				return err
+			})
+			require.NoError(t, err)
+			assert.EqualValues(t, 2, n)
+
+			stmts := sim.Statements()
+			require.Len(t, stmts, 3)
+			assert.Equal(t, tc.want, stmts[1].SQL)
+			assert.Equal(t, []any{"a", 1, "b", 2}, stmts[1].Args)
+		})
+	}
+}
+
+func testUpsertChunks(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^INSERT").Exec("INSERT 0 1")
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	columns := []string{"a", "b", "c"}
+	rows := make([][]any, 65535/len(columns)*2+1)
+	for i := range rows {
+		rows[i] = []any{i, i, i}
+	}
+	ctx := context.Background()
+	var n int64
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		n, err = dbtools.Upsert(ctx, tx, pgx.Identifier{"t"}, columns, rows, nil, nil)
+		return err
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, n)
+
+	var sizes []int
+	for _, s := range sim.Statements() {
+		if len(s.Args) > 0 {
+			assert.LessOrEqual(t, len(s.Args), 65535)
+			sizes = append(sizes, len(s.Args))
+		}
+	}
+	assert.Equal(t, []int{65535, 65535, 3}, sizes)
+}
+
+func testUpsertInvalid(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]struct {
+		columns  []string
+		rows     [][]any
+		conflict []string
+		update   []string
+	}{
+		"no columns":     {rows: [][]any{{1}}},
+		"short row":      {columns: []string{"a", "b"}, rows: [][]any{{1, 2}, {1}}},
+		"long row":       {columns: []string{"a"}, rows: [][]any{{1, 2}}},
+		"update without": {columns: []string{"a"}, rows: [][]any{{1}}, update: []string{"a"}},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sim := dbtesting.NewSimulator()
+			tr, err := dbtools.New(sim)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+				_, err := dbtools.Upsert(ctx, tx, pgx.Identifier{"t"}, tc.columns, tc.rows, tc.conflict, tc.update)
+				return err
+			})
+			require.ErrorIs(t, err, dbtools.ErrInvalidUpsert)
+			assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, sim.SQL())
+		})
+	}
+}
+
+func testUpsertError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On("^INSERT").Error(&pgconn.PgError{Code: "23505"})
+	tr, err := dbtools.New(sim)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := dbtools.Upsert(ctx, tx, pgx.Identifier{"t"}, []string{"a"}, [][]any{{1}, {2}}, nil, nil)
+		return err
+	})
+	assert.Equal(t, "23505", dbtools.SQLState(err))
+	assert.Contains(t, err.Error(), "rows 0-1")
+}
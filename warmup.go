@@ -0,0 +1,32 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// warmUpSteps returns a step that runs the warm-up statements, if there are
+// any. The errors are reported as the errors of starting the transaction, in
+// the PhaseBegin phase.
+func (p *PGX) warmUpSteps(ctx context.Context) []Step {
+	if len(p.warmUp) == 0 {
+		return nil
+	}
+	run := Step{
+		internal: true,
+		phase:    PhaseBegin,
+		Fn: func(tx pgx.Tx) error {
+			for _, query := range p.warmUp {
+				if _, err := tx.Exec(ctx, query); err != nil {
+					return fmt.Errorf("starting transaction: warm-up statement %q: %w", query, err)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	return []Step{run}
+}
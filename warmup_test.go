@@ -0,0 +1,110 @@
+package dbtools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmUp(t *testing.T) {
+	t.Parallel()
+	t.Run("Order", testWarmUpOrder)
+	t.Run("Retry", testWarmUpRetry)
+	t.Run("Error", testWarmUpError)
+	t.Run("Preset", testWarmUpPreset)
+}
+
+func testWarmUpOrder(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SET LOCAL`).Exec("SET")
+	sim.On(`^SELECT set_config`).Exec("SELECT 1")
+	sim.On(`^UPDATE`).Exec("UPDATE 1")
+	tr, err := dbtools.New(sim,
+		dbtools.WarmUp("SET LOCAL search_path = app"),
+		dbtools.WarmUp("SELECT set_config('app.mode', 'web', true)"),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = tr.Transaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET seen = true")
+		return err
+	})
+	require.NoError(t, err)
+	want := []string{
+		"BEGIN",
+		"SET LOCAL search_path = app",
+		"SELECT set_config('app.mode', 'web', true)",
+		"UPDATE users SET seen = true",
+		"COMMIT",
+	}
+	assert.Equal(t, want, sim.SQL())
+}
+
+func testWarmUpRetry(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SET LOCAL`).Error(assert.AnError).Times(1)
+	sim.On(`^SET LOCAL`).Exec("SET")
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(2, time.Millisecond),
+		dbtools.WarmUp("SET LOCAL search_path = app"),
+	)
+	require.NoError(t, err)
+
+	calls := 0
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func testWarmUpError(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SET LOCAL`).Error(assert.AnError)
+	tr, err := dbtools.New(sim, dbtools.WarmUp("SET LOCAL foo = bar"))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "starting transaction")
+	var txErr *dbtools.TxError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, dbtools.PhaseBegin, txErr.Phase)
+	assert.Equal(t, -1, txErr.Step)
+}
+
+func testWarmUpPreset(t *testing.T) {
+	t.Parallel()
+	sim := dbtesting.NewSimulator()
+	sim.On(`^SET LOCAL`).Exec("SET")
+	tr, err := dbtools.New(sim,
+		dbtools.WarmUp("SET LOCAL a = 1"),
+		dbtools.WithPreset("b", dbtools.WarmUp("SET LOCAL b = 1")),
+		dbtools.WithPreset("c", dbtools.WarmUp("SET LOCAL c = 1")),
+	)
+	require.NoError(t, err)
+	b, err := tr.Preset("b")
+	require.NoError(t, err)
+	c, err := tr.Preset("c")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, b.Transaction(ctx, func(pgx.Tx) error { return nil }))
+	require.NoError(t, c.Transaction(ctx, func(pgx.Tx) error { return nil }))
+	want := []string{
+		"BEGIN", "SET LOCAL a = 1", "SET LOCAL b = 1", "COMMIT",
+		"BEGIN", "SET LOCAL a = 1", "SET LOCAL c = 1", "COMMIT",
+	}
+	assert.Equal(t, want, sim.SQL())
+}
@@ -0,0 +1,128 @@
+package dbtools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arsham/retry/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+// watchdog holds the configuration of the Watchdog option.
+type watchdog struct {
+	cancelAfter    time.Duration
+	terminateAfter time.Duration
+}
+
+// watch cancels the backend of an attempt from another connection when the
+// attempt runs for too long.
+type watch struct {
+	q     Querier
+	pid   int32
+	grace time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+	fired   bool
+}
+
+// watch starts watching the backend of the tx. It returns a nil watch if the
+// Watchdog option is not set, or the tx runs on a read replica, as the
+// backend can only be cancelled on the same server.
+func (p *PGX) watch(ctx context.Context, tx pgx.Tx) (*watch, error) {
+	if p.watchdog == nil || (p.readOnly() && p.replicas != nil) {
+		return nil, nil
+	}
+	q, err := p.querier()
+	if err != nil {
+		return nil, &retry.StopError{Err: err}
+	}
+	w := &watch{q: q, grace: p.gracePeriod}
+	if err := tx.QueryRow(ctx, "SELECT pg_backend_pid()").Scan(&w.pid); err != nil {
+		return nil, fmt.Errorf("getting backend pid: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timer = time.AfterFunc(p.watchdog.cancelAfter, func() {
+		if !w.kill("pg_cancel_backend") || p.watchdog.terminateAfter <= 0 {
+			return
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if !w.stopped {
+			w.timer = time.AfterFunc(p.watchdog.terminateAfter, func() {
+				w.kill("pg_terminate_backend")
+			})
+		}
+	})
+
+	return w, nil
+}
+
+// kill calls the fn with the pid of the backend, unless the watch is stopped.
+// The lock is held while the query runs, so the backend is not released to
+// the pool in the meantime.
+func (w *watch) kill(fn string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return false
+	}
+	w.fired = true
+	ctx, cancel := context.WithTimeout(context.Background(), w.grace)
+	defer cancel()
+	//nolint:errcheck // the transaction fails with the reason if it is killed.
+	w.q.Exec(ctx, "SELECT "+fn+"($1)", w.pid)
+
+	return true
+}
+
+// stop stops the watch. It should be called before the connection of the
+// transaction is released.
+func (w *watch) stop() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	w.timer.Stop()
+}
+
+// result returns the err of the attempt wrapped in an ErrTransactionKilled
+// error if the backend was killed by the watch. The attempt is not retried.
+func (w *watch) result(err error) error {
+	if w == nil || err == nil {
+		return err
+	}
+	w.mu.Lock()
+	fired := w.fired
+	w.mu.Unlock()
+	if !fired {
+		return err
+	}
+	cause, _ := StopCause(err)
+
+	return &retry.StopError{Err: fmt.Errorf("%w: %w", ErrTransactionKilled, cause)}
+}
+
+// watchedTx stops the watch before the transaction is committed or rolled
+// back.
+type watchedTx struct {
+	pgx.Tx
+	w *watch
+}
+
+func (t *watchedTx) Commit(ctx context.Context) error {
+	t.w.stop()
+	return t.Tx.Commit(ctx)
+}
+
+func (t *watchedTx) Rollback(ctx context.Context) error {
+	t.w.stop()
+	return t.Tx.Rollback(ctx)
+}
@@ -0,0 +1,110 @@
+package dbtools_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arsham/dbtools/v4"
+	"github.com/arsham/dbtools/v4/dbtesting"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWatchedSimulator returns a simulator that reports 42 as the backend pid.
+func newWatchedSimulator() *dbtesting.Simulator {
+	sim := dbtesting.NewSimulator()
+	sim.On(`pg_backend_pid`).Return([]string{"pg_backend_pid"}, []any{int32(42)})
+	sim.On(`pg_(cancel|terminate)_backend`).Return([]string{"ok"}, []any{true})
+	return sim
+}
+
+// waitFor blocks until the simulator receives the sql.
+func waitFor(t *testing.T, sim *dbtesting.Simulator, sql string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return slices.Contains(sim.SQL(), sql)
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Parallel()
+	t.Run("Cancel", testWatchdogCancel)
+	t.Run("Terminate", testWatchdogTerminate)
+	t.Run("Fast", testWatchdogFast)
+	t.Run("NoQuerier", testWatchdogNoQuerier)
+}
+
+func testWatchdogCancel(t *testing.T) {
+	t.Parallel()
+	sim := newWatchedSimulator()
+	tr, err := dbtools.New(sim,
+		dbtools.Retry(3, time.Millisecond),
+		dbtools.Watchdog(10*time.Millisecond, 0),
+	)
+	require.NoError(t, err)
+
+	calls := 0
+	cancelled := errors.New("canceling statement due to user request")
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		calls++
+		waitFor(t, sim, "SELECT pg_cancel_backend($1)")
+		return cancelled
+	})
+	require.ErrorIs(t, err, dbtools.ErrTransactionKilled)
+	assert.ErrorIs(t, err, cancelled)
+	assert.Equal(t, 1, calls, "the killed transaction should not be retried")
+
+	statements := sim.Statements()
+	i := slices.IndexFunc(statements, func(s dbtesting.Statement) bool {
+		return s.SQL == "SELECT pg_cancel_backend($1)"
+	})
+	require.GreaterOrEqual(t, i, 0)
+	assert.Equal(t, []any{int32(42)}, statements[i].Args)
+	assert.NotContains(t, sim.SQL(), "SELECT pg_terminate_backend($1)")
+}
+
+func testWatchdogTerminate(t *testing.T) {
+	t.Parallel()
+	sim := newWatchedSimulator()
+	tr, err := dbtools.New(sim, dbtools.Watchdog(5*time.Millisecond, 5*time.Millisecond))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error {
+		waitFor(t, sim, "SELECT pg_terminate_backend($1)")
+		return errors.New("terminating connection due to administrator command")
+	})
+	require.ErrorIs(t, err, dbtools.ErrTransactionKilled)
+	assert.Contains(t, tr.Describe().Features, "Watchdog")
+}
+
+func testWatchdogFast(t *testing.T) {
+	t.Parallel()
+	sim := newWatchedSimulator()
+	tr, err := dbtools.New(sim, dbtools.Watchdog(10*time.Millisecond, 0))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, []string{"BEGIN", "SELECT pg_backend_pid()", "COMMIT"}, sim.SQL(),
+		"the watchdog should be stopped with the transaction")
+}
+
+func testWatchdogNoQuerier(t *testing.T) {
+	t.Parallel()
+	sim := newWatchedSimulator()
+	tr, err := dbtools.New(poolOnly{sim}, dbtools.Watchdog(time.Second, 0))
+	require.NoError(t, err)
+
+	err = tr.Transaction(context.Background(), func(pgx.Tx) error { return nil })
+	assert.ErrorIs(t, err, dbtools.ErrNoQuerier)
+}
+
+// poolOnly hides the other methods of the pool.
+type poolOnly struct {
+	dbtools.Pool
+}